@@ -0,0 +1,121 @@
+package broadcaster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// backfillRetryInterval is the time to wait before retrying a failed backfill request
+const backfillRetryInterval = 5 * time.Second
+
+// errBackfillStopped is returned to stop fetching logs when the broadcaster stops or the subscription
+// is unregistered
+var errBackfillStopped = errors.New("backfill stopped")
+
+// startBackfill starts backfilling the historical events of the given subscription
+func (l *singleChainBroadcaster) startBackfill(ctx context.Context, s *eventSubscription) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		l.backfill(ctx, s)
+	}()
+}
+
+// backfill delivers the historical events of the given subscription in chunks fetched by the log
+// fetcher, from its checkpoint up to the last block handled by the broadcaster. The subscription is
+// then handed over to new blocks while no block is being handled, so that no block is missed or
+// handled twice.
+func (l *singleChainBroadcaster) backfill(ctx context.Context, s *eventSubscription) {
+	logger := l.logger.WithField("id", s.id)
+
+	if l.checkpoints != nil {
+		checkpoint, ok, err := l.checkpoints.GetCheckpoint(ctx, l.chainID, EventCheckpointKey(s.id))
+		if err != nil {
+			logger.WithError(err).Error("failed to get the checkpoint, backfilling from FromBlock")
+		} else if ok {
+			l.handleLock.Lock()
+			if checkpoint > s.checkpoint {
+				s.checkpoint = checkpoint
+			}
+			l.handleLock.Unlock()
+		}
+	}
+
+	// The hand-off block is unknown before the first block has been handled
+	select {
+	case <-l.handled:
+	case <-l.stop:
+		return
+	case <-ctx.Done():
+		return
+	}
+
+	for !s.isRemoved() {
+		l.handleLock.Lock()
+		from := s.checkpoint + 1
+		to := confirmedNumber(l.checkpoint, s.opts.Confirmations)
+		if s.opts.ToBlock != nil && s.opts.ToBlock.Uint64() < to {
+			to = s.opts.ToBlock.Uint64()
+		}
+
+		if from > to {
+			s.live = true
+			s.progress.reset(from - 1)
+			l.handleLock.Unlock()
+
+			logger.WithField("block", from-1).Info("backfill completed")
+			return
+		}
+		l.handleLock.Unlock()
+
+		// Deliver the chunks in order, checkpointing each one
+		err := l.logFetcher.fetch(ctx, s.filterQuery(from, to), from, to, func(_, to uint64, logs []types.Log) error {
+			var handlers sync.WaitGroup
+			for _, log := range logs {
+				if log.Removed || !s.matches(log) {
+					continue
+				}
+
+				l.enqueueEvent(ctx, s, log, &handlers)
+			}
+			handlers.Wait()
+
+			select {
+			case <-l.stop:
+				return errBackfillStopped
+			default:
+			}
+
+			if s.isRemoved() {
+				return errBackfillStopped
+			}
+
+			l.handleLock.Lock()
+			s.checkpoint = to
+			l.handleLock.Unlock()
+
+			l.putCheckpoints(ctx, map[string]uint64{EventCheckpointKey(s.id): to})
+
+			return nil
+		})
+		if err == errBackfillStopped {
+			return
+		}
+
+		if err != nil {
+			logger.WithError(err).WithField("from", from).WithField("to", to).Error("failed to filter logs for backfill")
+
+			select {
+			case <-time.After(backfillRetryInterval):
+			case <-l.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package broadcaster
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SingleChainBroadcaster_Backfill(t *testing.T) {
+	t.Run("backfill historical events and continue with new blocks", func(t *testing.T) {
+		env := newTestEnv(t)
+
+		// Mine an event in each of the blocks 2 to 4
+		for i := 0; i < 3; i++ {
+			env.trigger(t)
+			env.backend.Commit()
+		}
+
+		broadcaster := env.startBroadcaster(t, Options{MaxLogsRange: 2}, nil)
+
+		var lock sync.Mutex
+		var blocks []uint64
+		_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
+			lock.Lock()
+			blocks = append(blocks, event.BlockNumber)
+			lock.Unlock()
+		}, EventOptions{
+			FromBlock: big.NewInt(3),
+		})
+		require.NoError(t, err)
+
+		// Mine events while backfilling
+		for i := 0; i < 2; i++ {
+			env.trigger(t)
+			env.backend.Commit()
+		}
+
+		gomega.NewWithT(t).Eventually(func() []uint64 {
+			lock.Lock()
+			defer lock.Unlock()
+			return append([]uint64(nil), blocks...)
+		}).Should(gomega.Equal([]uint64{3, 4, 5, 6}))
+	})
+
+	t.Run("stop at the last block", func(t *testing.T) {
+		env := newTestEnv(t)
+
+		var lock sync.Mutex
+		var blocks []uint64
+		broadcaster := env.startBroadcaster(t, Options{}, func(broadcaster *singleChainBroadcaster) {
+			_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
+				lock.Lock()
+				blocks = append(blocks, event.BlockNumber)
+				lock.Unlock()
+			}, EventOptions{
+				FromBlock: big.NewInt(0),
+				ToBlock:   big.NewInt(3),
+			})
+			require.NoError(t, err)
+		})
+
+		for i := 0; i < 3; i++ {
+			env.trigger(t)
+			env.backend.Commit()
+		}
+
+		waitCheckpoint(t, broadcaster, 4)
+
+		gomega.NewWithT(t).Eventually(func() []uint64 {
+			lock.Lock()
+			defer lock.Unlock()
+			return append([]uint64(nil), blocks...)
+		}).Should(gomega.Equal([]uint64{2, 3}))
+	})
+}
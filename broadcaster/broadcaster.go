@@ -2,7 +2,9 @@ package broadcaster
 
 import (
 	"context"
+	"math/big"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 )
@@ -13,6 +15,14 @@ type HandleEventFunc func(ctx context.Context, event types.Log)
 // HandleBlockFunc is the signature of a function to handle heads
 type HandleBlockFunc func(ctx context.Context, header types.Header)
 
+// HandleEventErrFunc is the signature of a function to handle events which may fail.
+// Failed deliveries are retried and dead-lettered once the attempts are exhausted.
+type HandleEventErrFunc func(ctx context.Context, event types.Log) error
+
+// HandleBlockErrFunc is the signature of a function to handle heads which may fail.
+// Failed deliveries are retried and dead-lettered once the attempts are exhausted.
+type HandleBlockErrFunc func(ctx context.Context, header types.Header) error
+
 // EventOptions contains options to filter events
 type EventOptions struct {
 	// Contracts contains contract addresses to listen events from.
@@ -20,15 +30,47 @@ type EventOptions struct {
 
 	// Event types to receive, with value filter for each field in the event
 	// No filter or an empty filter for a given field position mean: all values allowed
-	// the key should be a result of AbigenLog.Topic() call
+	// A value filter only matches events having the field at its position, as with eth_getLogs
+	// the key should be a result of AbigenLog.Topic() call, the zero hash stands for any event type
 	// topic => topicValueFilters
 	LogsWithTopics map[common.Hash][][]common.Hash
+
+	// FromBlock is the first block to receive events of. If set, the historical events are backfilled
+	// before the events of new blocks, without gaps or duplicates. Optional.
+	FromBlock *big.Int
+
+	// ToBlock is the last block to receive events of. Optional.
+	ToBlock *big.Int
+
+	// Confirmations is the number of blocks to wait for on top of a block before delivering its events.
+	// The block is verified to still be canonical then. Zero delivers events as soon as a block is seen.
+	Confirmations uint64
+
+	// NotifyRemoved makes the handler receive the delivered events of blocks which have been re-organized
+	// away again, with Removed set, before the events of the new canonical blocks.
+	NotifyRemoved bool
+
+	// Retry configures the retries of failed deliveries
+	Retry RetryOptions
+
+	// Queue configures the queue the events are delivered through
+	Queue QueueOptions
 }
 
 // BlockOptions contains options to filter blocks
 type BlockOptions struct {
 	// Number returns true if the block with the given number should be handled
 	Number func(number uint64) bool
+
+	// Confirmations is the number of blocks to wait for on top of a block before delivering it.
+	// The block is verified to still be canonical then. Zero delivers blocks as soon as they are seen.
+	Confirmations uint64
+
+	// Retry configures the retries of failed deliveries
+	Retry RetryOptions
+
+	// Queue configures the queue the blocks are delivered through
+	Queue QueueOptions
 }
 
 // Broadcaster represents a behavior of events broadcaster.
@@ -39,6 +81,45 @@ type Broadcaster interface {
 	// RegisterBlockHandler registers the given handler for blocks based on the given filters.
 	RegisterBlockHandler(id string, chainID uint64, handler HandleBlockFunc, opts BlockOptions) (func(), error)
 
+	// RegisterEventErrHandler registers the given handler which may fail for specific events based on the
+	// given filters.
+	RegisterEventErrHandler(id string, chainID uint64, handler HandleEventErrFunc, opts EventOptions) (func(), error)
+
+	// RegisterBlockErrHandler registers the given handler which may fail for blocks based on the given filters.
+	RegisterBlockErrHandler(id string, chainID uint64, handler HandleBlockErrFunc, opts BlockOptions) (func(), error)
+
+	// RegisterDecodedEventHandler registers the given handler for the event with the given name of the given
+	// ABI. The handler receives the events decoded.
+	RegisterDecodedEventHandler(
+		id string,
+		chainID uint64,
+		contractABI abi.ABI,
+		eventName string,
+		handler HandleDecodedEventFunc,
+		opts DecodedEventOptions,
+	) (func(), error)
+
+	// RegisterTransactionHandler registers the given handler for mined transactions based on the given filters.
+	RegisterTransactionHandler(
+		id string,
+		chainID uint64,
+		handler HandleTransactionFunc,
+		opts TransactionOptions,
+	) (func(), error)
+
+	// RegisterPendingTransactionHandler registers the given handler for pending transactions based on the
+	// given filters.
+	RegisterPendingTransactionHandler(
+		id string,
+		chainID uint64,
+		handler HandleTransactionFunc,
+		opts TransactionOptions,
+	) (func(), error)
+
+	// ReplayDeadLetters delivers the dead-lettered events, blocks and transactions to their subscriptions again.
+	// Returns the number of delivered dead letters.
+	ReplayDeadLetters(ctx context.Context) (int, error)
+
 	// Start starts broadcasting on-chain data to subscribers
 	Start(ctx context.Context) error
 
@@ -0,0 +1,127 @@
+package broadcaster
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	tmDB "github.com/tendermint/tm-db"
+)
+
+// ChainCheckpointKey is the checkpoint key of the last block fully handled by all subscriptions of a chain
+const ChainCheckpointKey = "chain"
+
+// CheckpointStore persists the last fully handled block, so that a broadcaster resumes where it
+// stopped after a restart.
+type CheckpointStore interface {
+	// GetCheckpoint returns the checkpoint stored under key for the given chain, and false if there is none.
+	GetCheckpoint(ctx context.Context, chainID uint64, key string) (uint64, bool, error)
+
+	// PutCheckpoints stores the given checkpoints of the given chain, keyed by checkpoint key, atomically.
+	PutCheckpoints(ctx context.Context, chainID uint64, checkpoints map[string]uint64) error
+}
+
+// EventCheckpointKey returns the checkpoint key of the event subscription with the given ID
+func EventCheckpointKey(id string) string {
+	return "event:" + id
+}
+
+// BlockCheckpointKey returns the checkpoint key of the block subscription with the given ID
+func BlockCheckpointKey(id string) string {
+	return "block:" + id
+}
+
+// TransactionCheckpointKey returns the checkpoint key of the transaction subscription with the given ID
+func TransactionCheckpointKey(id string) string {
+	return "tx:" + id
+}
+
+// memoryCheckpointStore keeps checkpoints in memory
+type memoryCheckpointStore struct {
+	lock        sync.Mutex
+	checkpoints map[uint64]map[string]uint64
+}
+
+// NewMemoryCheckpointStore creates a CheckpointStore which keeps checkpoints in memory only
+func NewMemoryCheckpointStore() CheckpointStore {
+	return &memoryCheckpointStore{
+		checkpoints: make(map[uint64]map[string]uint64),
+	}
+}
+
+func (s *memoryCheckpointStore) GetCheckpoint(_ context.Context, chainID uint64, key string) (uint64, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	number, ok := s.checkpoints[chainID][key]
+	return number, ok, nil
+}
+
+func (s *memoryCheckpointStore) PutCheckpoints(_ context.Context, chainID uint64, checkpoints map[string]uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.checkpoints[chainID]; !ok {
+		s.checkpoints[chainID] = make(map[string]uint64)
+	}
+
+	for key, number := range checkpoints {
+		s.checkpoints[chainID][key] = number
+	}
+
+	return nil
+}
+
+// dbCheckpointStore keeps checkpoints in a Tendermint DB
+type dbCheckpointStore struct {
+	db tmDB.DB
+}
+
+// NewDBCheckpointStore creates a CheckpointStore which keeps checkpoints in the given Tendermint DB.
+// The DB may be shared with other data, all keys are prefixed with "checkpoint/".
+func NewDBCheckpointStore(db tmDB.DB) CheckpointStore {
+	return &dbCheckpointStore{
+		db: db,
+	}
+}
+
+func (s *dbCheckpointStore) GetCheckpoint(_ context.Context, chainID uint64, key string) (uint64, bool, error) {
+	value, err := s.db.Get(checkpointDBKey(chainID, key))
+	if err != nil {
+		return 0, false, errors.Wrap(err, "could not get checkpoint")
+	}
+
+	if value == nil {
+		return 0, false, nil
+	}
+
+	if len(value) != 8 {
+		return 0, false, fmt.Errorf("invalid checkpoint of %d bytes", len(value))
+	}
+
+	return binary.BigEndian.Uint64(value), true, nil
+}
+
+func (s *dbCheckpointStore) PutCheckpoints(_ context.Context, chainID uint64, checkpoints map[string]uint64) error {
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	for key, number := range checkpoints {
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, number)
+
+		batch.Set(checkpointDBKey(chainID, key), value)
+	}
+
+	if err := batch.WriteSync(); err != nil {
+		return errors.Wrap(err, "could not write checkpoints")
+	}
+
+	return nil
+}
+
+func checkpointDBKey(chainID uint64, key string) []byte {
+	return []byte(fmt.Sprintf("checkpoint/%d/%s", chainID, key))
+}
@@ -0,0 +1,101 @@
+package broadcaster
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/require"
+	tmDB "github.com/tendermint/tm-db"
+)
+
+func Test_SingleChainBroadcaster_Checkpoints(t *testing.T) {
+	t.Run("replay blocks and events mined while stopped", func(t *testing.T) {
+		env := newTestEnv(t)
+		checkpoints := NewMemoryCheckpointStore()
+
+		var lock sync.Mutex
+		var blocks []uint64
+		var events int
+		register := func(broadcaster *singleChainBroadcaster) {
+			_, err := broadcaster.RegisterBlockHandler(testWfID, testChainID, func(ctx context.Context, header types.Header) {
+				lock.Lock()
+				blocks = append(blocks, header.Number.Uint64())
+				lock.Unlock()
+			}, BlockOptions{})
+			require.NoError(t, err)
+
+			_, err = broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
+				lock.Lock()
+				events++
+				lock.Unlock()
+			}, EventOptions{})
+			require.NoError(t, err)
+		}
+
+		broadcaster := env.startBroadcaster(t, Options{Checkpoints: checkpoints}, register)
+
+		env.backend.Commit()
+
+		gomega.NewWithT(t).Eventually(func() bool {
+			checkpoint, ok, err := checkpoints.GetCheckpoint(env.ctx, testChainID, ChainCheckpointKey)
+			return err == nil && ok && checkpoint == 2
+		}).Should(gomega.BeTrue())
+		require.NoError(t, broadcaster.Stop())
+
+		// Mine blocks while the broadcaster is stopped
+		env.trigger(t)
+		env.backend.Commit()
+		env.backend.Commit()
+
+		env.startBroadcaster(t, Options{Checkpoints: checkpoints}, register)
+
+		gomega.NewWithT(t).Eventually(func() []uint64 {
+			lock.Lock()
+			defer lock.Unlock()
+			return append([]uint64(nil), blocks...)
+		}).Should(gomega.Equal([]uint64{1, 2, 3, 4}))
+
+		lock.Lock()
+		require.Equal(t, 1, events)
+		lock.Unlock()
+
+		for _, key := range []string{ChainCheckpointKey, BlockCheckpointKey(testWfID), EventCheckpointKey(testWfID)} {
+			checkpoint, ok, err := checkpoints.GetCheckpoint(env.ctx, testChainID, key)
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, uint64(4), checkpoint, key)
+		}
+	})
+}
+
+func Test_DBCheckpointStore(t *testing.T) {
+	ctx := context.Background()
+	checkpoints := NewDBCheckpointStore(tmDB.NewMemDB())
+
+	_, ok, err := checkpoints.GetCheckpoint(ctx, testChainID, ChainCheckpointKey)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	err = checkpoints.PutCheckpoints(ctx, testChainID, map[string]uint64{
+		ChainCheckpointKey:           10,
+		EventCheckpointKey(testWfID): 8,
+	})
+	require.NoError(t, err)
+
+	checkpoint, ok, err := checkpoints.GetCheckpoint(ctx, testChainID, ChainCheckpointKey)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(10), checkpoint)
+
+	checkpoint, ok, err = checkpoints.GetCheckpoint(ctx, testChainID, EventCheckpointKey(testWfID))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(8), checkpoint)
+
+	_, ok, err = checkpoints.GetCheckpoint(ctx, testChainID+1, ChainCheckpointKey)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,178 @@
+package broadcaster
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+// pendingBlock is a handled block buffered until it is deep enough for all subscriptions
+type pendingBlock struct {
+	header types.Header
+	logs   []types.Log
+}
+
+// confirmedNumber returns the number of the block which has the given number of confirmations when
+// the block with the given number is the head, or 0 if there is none.
+func confirmedNumber(number, confirmations uint64) uint64 {
+	if number < confirmations {
+		return 0
+	}
+
+	return number - confirmations
+}
+
+// confirmedBlocks are the events and the blocks which are deep enough for the subscriptions waiting
+// for confirmations
+type confirmedBlocks struct {
+	events  map[*eventSubscription][]types.Log
+	headers map[*blockSubscription][]types.Header
+}
+
+// fetchConfirmed returns the blocks which are deep enough after the block with the given number for the
+// subscriptions waiting for confirmations. All blocks are verified to be canonical before delivering
+// any of them, so that nothing is delivered twice if the verification fails.
+func (l *singleChainBroadcaster) fetchConfirmed(ctx context.Context, number uint64) (*confirmedBlocks, error) {
+	verified := make(map[uint64]*pendingBlock)
+	block := func(number uint64) (*pendingBlock, error) {
+		if b, ok := verified[number]; ok {
+			return b, nil
+		}
+
+		b, err := l.canonicalBlock(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+
+		verified[number] = b
+		return b, nil
+	}
+
+	confirmed := &confirmedBlocks{
+		events:  make(map[*eventSubscription][]types.Log),
+		headers: make(map[*blockSubscription][]types.Header),
+	}
+
+	for _, s := range l.sbs.allEventSubscriptions() {
+		if !s.live || s.opts.Confirmations == 0 {
+			continue
+		}
+
+		for n := s.checkpoint + 1; n <= confirmedNumber(number, s.opts.Confirmations) && s.beforeToBlock(n); n++ {
+			b, err := block(n)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, log := range b.logs {
+				if !log.Removed && s.matches(log) {
+					confirmed.events[s] = append(confirmed.events[s], log)
+				}
+			}
+		}
+	}
+
+	for _, s := range l.sbs.allBlockSubscriptions() {
+		if s.opts.Confirmations == 0 {
+			continue
+		}
+
+		for n := s.checkpoint + 1; n <= confirmedNumber(number, s.opts.Confirmations); n++ {
+			if s.opts.Number != nil && !s.opts.Number(n) {
+				continue
+			}
+
+			b, err := block(n)
+			if err != nil {
+				return nil, err
+			}
+
+			confirmed.headers[s] = append(confirmed.headers[s], b.header)
+		}
+	}
+
+	return confirmed, nil
+}
+
+// queueConfirmed queues the deliveries of the given confirmed blocks, in order through the queue of each
+// subscription
+func (l *singleChainBroadcaster) queueConfirmed(
+	ctx context.Context,
+	confirmed *confirmedBlocks,
+	queued queuedBlocks,
+) {
+	for s, logs := range confirmed.events {
+		for _, log := range logs {
+			l.recordDelivered(s, log)
+			l.enqueueEvent(ctx, s, log, queued.of(s.progress))
+		}
+	}
+
+	for s, headers := range confirmed.headers {
+		for _, header := range headers {
+			l.enqueueBlock(ctx, s, header, queued.of(s.progress))
+		}
+	}
+}
+
+// canonicalBlock returns the canonical block with the given number along with its logs. The buffered
+// block is used if its hash matches the canonical one, the logs are fetched again otherwise.
+func (l *singleChainBroadcaster) canonicalBlock(ctx context.Context, number uint64) (*pendingBlock, error) {
+	header, err := l.client.HeaderByNumber(ctx, big.NewInt(0).SetUint64(number))
+	if err != nil {
+		failedGetHeaderByNumberCounter.WithLabelValues(big.NewInt(0).SetUint64(l.chainID).String()).Inc()
+		return nil, errors.Wrap(err, "failed to get the header of a confirmed block")
+	}
+
+	hash := header.Hash()
+	if b, ok := l.pending[number]; ok {
+		if b.header.Hash() == hash {
+			return b, nil
+		}
+
+		l.logger.WithField("block", number).Warn("block is not canonical anymore, fetching the canonical events")
+	}
+
+	var logs []types.Log
+	if l.sbs.existEventSubscribers() {
+		if logs, err = l.fetchBlockLogs(ctx, header); err != nil {
+			return nil, errors.Wrap(err, "failed to filter logs for a confirmed block")
+		}
+	}
+
+	b := &pendingBlock{header: *header, logs: logs}
+	l.pending[number] = b
+
+	return b, nil
+}
+
+// prunePending removes the buffered blocks which are deep enough for all subscriptions after the block
+// with the given number, and the delivered events too old to be re-organized
+func (l *singleChainBroadcaster) prunePending(number uint64) {
+	var confirmations uint64
+	for _, s := range l.sbs.allEventSubscriptions() {
+		if s.opts.Confirmations > confirmations {
+			confirmations = s.opts.Confirmations
+		}
+	}
+
+	for _, s := range l.sbs.allBlockSubscriptions() {
+		if s.opts.Confirmations > confirmations {
+			confirmations = s.opts.Confirmations
+		}
+	}
+
+	confirmed := confirmedNumber(number, confirmations)
+	for n := range l.pending {
+		if n <= confirmed {
+			delete(l.pending, n)
+		}
+	}
+	for n := range l.delivered {
+		if n+maxReorgDepth <= number {
+			delete(l.delivered, n)
+		}
+	}
+}
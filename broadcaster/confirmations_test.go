@@ -0,0 +1,87 @@
+package broadcaster
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SingleChainBroadcaster_Confirmations(t *testing.T) {
+	t.Run("deliver blocks and events once deep enough", func(t *testing.T) {
+		env := newTestEnv(t)
+
+		var lock sync.Mutex
+		var blocks, events []uint64
+		broadcaster := env.startBroadcaster(t, Options{}, func(broadcaster *singleChainBroadcaster) {
+			_, err := broadcaster.RegisterBlockHandler(testWfID, testChainID, func(ctx context.Context, header types.Header) {
+				lock.Lock()
+				blocks = append(blocks, header.Number.Uint64())
+				lock.Unlock()
+			}, BlockOptions{
+				Confirmations: 2,
+			})
+			require.NoError(t, err)
+
+			_, err = broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
+				lock.Lock()
+				events = append(events, event.BlockNumber)
+				lock.Unlock()
+			}, EventOptions{
+				Confirmations: 1,
+			})
+			require.NoError(t, err)
+		})
+
+		// Mine an event in each of the blocks 2 to 4
+		for i := 0; i < 3; i++ {
+			env.trigger(t)
+			env.backend.Commit()
+		}
+
+		waitCheckpoint(t, broadcaster, 4)
+
+		lock.Lock()
+		require.Equal(t, []uint64{2}, blocks)
+		require.Equal(t, []uint64{2, 3}, events)
+		lock.Unlock()
+	})
+
+	t.Run("skip events of re-organized blocks", func(t *testing.T) {
+		env := newTestEnv(t)
+
+		var lock sync.Mutex
+		var events []uint64
+		broadcaster := env.startBroadcaster(t, Options{}, func(broadcaster *singleChainBroadcaster) {
+			_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
+				lock.Lock()
+				events = append(events, event.BlockNumber)
+				lock.Unlock()
+			}, EventOptions{
+				Confirmations: 2,
+			})
+			require.NoError(t, err)
+		})
+
+		parent := env.backend.Commit()
+
+		// Mine an event in the block 3 and re-organize it away
+		env.trigger(t)
+		env.backend.Commit()
+
+		waitCheckpoint(t, broadcaster, 3)
+
+		require.NoError(t, env.backend.Fork(env.ctx, parent))
+		for i := 0; i < 3; i++ {
+			env.backend.Commit()
+		}
+
+		waitCheckpoint(t, broadcaster, 5)
+
+		lock.Lock()
+		require.Empty(t, events)
+		lock.Unlock()
+	})
+}
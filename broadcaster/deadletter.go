@@ -0,0 +1,300 @@
+package broadcaster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	tmDB "github.com/tendermint/tm-db"
+)
+
+// DeadLetter is an event, a block or a transaction which could not be delivered to a subscription.
+// Pending is set for the transactions of pending transaction subscriptions, which may share their IDs
+// with mined transaction subscriptions. A Transaction without Tx stands for all the transactions of its
+// Header, whose block body could not be fetched.
+type DeadLetter struct {
+	ID             string        `json:"id"`
+	ChainID        uint64        `json:"chainId"`
+	SubscriptionID string        `json:"subscriptionId"`
+	Event          *types.Log    `json:"event,omitempty"`
+	Header         *types.Header `json:"header,omitempty"`
+	Transaction    *Transaction  `json:"transaction,omitempty"`
+	Pending        bool          `json:"pending,omitempty"`
+	Error          string        `json:"error"`
+	Attempts       int           `json:"attempts"`
+	FailedAt       time.Time     `json:"failedAt"`
+}
+
+// DeadLetterStore keeps the events, blocks and transactions which could not be delivered, so that they
+// can be inspected and replayed.
+type DeadLetterStore interface {
+	// PutDeadLetter creates or replaces the given dead letter
+	PutDeadLetter(ctx context.Context, letter *DeadLetter) error
+
+	// GetDeadLetters returns the dead letters of the given chain ordered by failure time
+	GetDeadLetters(ctx context.Context, chainID uint64) ([]*DeadLetter, error)
+
+	// DeleteDeadLetter deletes the dead letter with the given ID, if any
+	DeleteDeadLetter(ctx context.Context, chainID uint64, id string) error
+}
+
+// memoryDeadLetterStore keeps dead letters in memory
+type memoryDeadLetterStore struct {
+	lock    sync.Mutex
+	letters map[uint64]map[string]DeadLetter
+}
+
+// NewMemoryDeadLetterStore creates a DeadLetterStore which keeps dead letters in memory only
+func NewMemoryDeadLetterStore() DeadLetterStore {
+	return &memoryDeadLetterStore{
+		letters: make(map[uint64]map[string]DeadLetter),
+	}
+}
+
+func (s *memoryDeadLetterStore) PutDeadLetter(_ context.Context, letter *DeadLetter) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.letters[letter.ChainID]; !ok {
+		s.letters[letter.ChainID] = make(map[string]DeadLetter)
+	}
+
+	s.letters[letter.ChainID][letter.ID] = *letter
+
+	return nil
+}
+
+func (s *memoryDeadLetterStore) GetDeadLetters(_ context.Context, chainID uint64) ([]*DeadLetter, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var letters []*DeadLetter
+	for _, letter := range s.letters[chainID] {
+		letter := letter
+		letters = append(letters, &letter)
+	}
+
+	sortDeadLetters(letters)
+
+	return letters, nil
+}
+
+func (s *memoryDeadLetterStore) DeleteDeadLetter(_ context.Context, chainID uint64, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.letters[chainID], id)
+
+	return nil
+}
+
+// dbDeadLetterStore keeps dead letters in a Tendermint DB
+type dbDeadLetterStore struct {
+	db tmDB.DB
+}
+
+// NewDBDeadLetterStore creates a DeadLetterStore which keeps JSON-encoded dead letters in the given
+// Tendermint DB. The DB may be shared with other data, all keys are prefixed with "deadletter/".
+func NewDBDeadLetterStore(db tmDB.DB) DeadLetterStore {
+	return &dbDeadLetterStore{
+		db: db,
+	}
+}
+
+func (s *dbDeadLetterStore) PutDeadLetter(_ context.Context, letter *DeadLetter) error {
+	value, err := json.Marshal(letter)
+	if err != nil {
+		return errors.Wrap(err, "could not encode dead letter")
+	}
+
+	if err = s.db.SetSync(deadLetterDBKey(letter.ChainID, letter.ID), value); err != nil {
+		return errors.Wrap(err, "could not set dead letter")
+	}
+
+	return nil
+}
+
+func (s *dbDeadLetterStore) GetDeadLetters(_ context.Context, chainID uint64) ([]*DeadLetter, error) {
+	prefix := deadLetterDBKey(chainID, "")
+	end := append([]byte(nil), prefix...)
+	end[len(end)-1]++
+
+	it, err := s.db.Iterator(prefix, end)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not iterate over dead letters")
+	}
+	defer it.Close()
+
+	var letters []*DeadLetter
+	for ; it.Valid(); it.Next() {
+		var letter DeadLetter
+		if err = json.Unmarshal(it.Value(), &letter); err != nil {
+			return nil, errors.Wrap(err, "could not decode dead letter")
+		}
+
+		letters = append(letters, &letter)
+	}
+
+	sortDeadLetters(letters)
+
+	return letters, nil
+}
+
+func (s *dbDeadLetterStore) DeleteDeadLetter(_ context.Context, chainID uint64, id string) error {
+	if err := s.db.DeleteSync(deadLetterDBKey(chainID, id)); err != nil {
+		return errors.Wrap(err, "could not delete dead letter")
+	}
+
+	return nil
+}
+
+func deadLetterDBKey(chainID uint64, id string) []byte {
+	return []byte(fmt.Sprintf("deadletter/%d/%s", chainID, id))
+}
+
+func sortDeadLetters(letters []*DeadLetter) {
+	sort.Slice(letters, func(i, j int) bool {
+		if !letters[i].FailedAt.Equal(letters[j].FailedAt) {
+			return letters[i].FailedAt.Before(letters[j].FailedAt)
+		}
+
+		return letters[i].ID < letters[j].ID
+	})
+}
+
+// deliverEvent delivers the given event to the given subscription, retrying on failure. The event is
+// dead-lettered once the attempts are exhausted.
+func (l *singleChainBroadcaster) deliverEvent(ctx context.Context, s *eventSubscription, event types.Log) {
+	attempts, err := retry(ctx, l.stop, s.opts.Retry, func() error {
+		return s.execute(ctx, event)
+	})
+	if err != nil {
+		l.deadLetter(ctx, &DeadLetter{SubscriptionID: s.id, Event: &event}, attempts, err)
+	}
+}
+
+// deliverBlock delivers the given block to the given subscription, retrying on failure. The block is
+// dead-lettered once the attempts are exhausted.
+func (l *singleChainBroadcaster) deliverBlock(ctx context.Context, s *blockSubscription, header types.Header) {
+	attempts, err := retry(ctx, l.stop, s.opts.Retry, func() error {
+		return s.execute(ctx, header)
+	})
+	if err != nil {
+		l.deadLetter(ctx, &DeadLetter{SubscriptionID: s.id, Header: &header}, attempts, err)
+	}
+}
+
+// deadLetter stores the given failed delivery in the dead-letter store, if any
+func (l *singleChainBroadcaster) deadLetter(ctx context.Context, letter *DeadLetter, attempts int, err error) {
+	failedDeliveryCounter.WithLabelValues(big.NewInt(0).SetUint64(l.chainID).String()).Inc()
+
+	logger := l.logger.WithError(err).WithFields(logrus.Fields{
+		"id":       letter.SubscriptionID,
+		"attempts": attempts,
+	})
+
+	if l.deadLetters == nil {
+		logger.Error("failed to deliver to subscriber, dropping")
+		return
+	}
+
+	letter.ID = uuid.New().String()
+	letter.ChainID = l.chainID
+	letter.Error = err.Error()
+	letter.Attempts = attempts
+	letter.FailedAt = time.Now()
+
+	if err = l.deadLetters.PutDeadLetter(ctx, letter); err != nil {
+		logger.WithField("error", err.Error()).Error("failed to deliver to subscriber and to store the dead letter")
+		return
+	}
+
+	logger.WithField("letter", letter.ID).Warn("failed to deliver to subscriber, dead-lettered")
+}
+
+// ReplayDeadLetters delivers the dead letters of the chain to their subscriptions again, retrying
+// on failure. Delivered letters are deleted, failed ones are kept with the attempts and the error
+// updated. Letters of subscriptions which are not registered are kept. Returns the number of
+// delivered letters.
+func (l *singleChainBroadcaster) ReplayDeadLetters(ctx context.Context) (int, error) {
+	if l.deadLetters == nil {
+		return 0, errors.New("no dead-letter store configured")
+	}
+
+	letters, err := l.deadLetters.GetDeadLetters(ctx, l.chainID)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get dead letters")
+	}
+
+	eventSubscriptions := make(map[string]*eventSubscription)
+	for _, s := range l.sbs.allEventSubscriptions() {
+		eventSubscriptions[s.id] = s
+	}
+
+	blockSubscriptions := make(map[string]*blockSubscription)
+	for _, s := range l.sbs.allBlockSubscriptions() {
+		blockSubscriptions[s.id] = s
+	}
+
+	transactionSubscriptions := make(map[string]*transactionSubscription)
+	for _, s := range l.sbs.allTransactionSubscriptions() {
+		transactionSubscriptions[s.id] = s
+	}
+
+	pendingTransactionSubscriptions := make(map[string]*transactionSubscription)
+	for _, s := range l.sbs.allPendingTransactionSubscriptions() {
+		pendingTransactionSubscriptions[s.id] = s
+	}
+
+	var delivered int
+	for _, letter := range letters {
+		var attempts int
+		switch {
+		case letter.Event != nil && eventSubscriptions[letter.SubscriptionID] != nil:
+			s := eventSubscriptions[letter.SubscriptionID]
+			attempts, err = l.redeliver(ctx, s.queue, s.id, s.opts.Retry, func() error {
+				return s.execute(ctx, *letter.Event)
+			})
+		case letter.Header != nil && blockSubscriptions[letter.SubscriptionID] != nil:
+			s := blockSubscriptions[letter.SubscriptionID]
+			attempts, err = l.redeliver(ctx, s.queue, s.id, s.opts.Retry, func() error {
+				return s.execute(ctx, *letter.Header)
+			})
+		case letter.Transaction != nil && !letter.Pending && transactionSubscriptions[letter.SubscriptionID] != nil:
+			s := transactionSubscriptions[letter.SubscriptionID]
+			attempts, err = l.replayTransaction(ctx, s, *letter.Transaction)
+		case letter.Transaction != nil && letter.Pending && pendingTransactionSubscriptions[letter.SubscriptionID] != nil:
+			s := pendingTransactionSubscriptions[letter.SubscriptionID]
+			attempts, err = l.replayTransaction(ctx, s, *letter.Transaction)
+		default:
+			continue
+		}
+
+		if err == nil {
+			if err = l.deadLetters.DeleteDeadLetter(ctx, l.chainID, letter.ID); err != nil {
+				return delivered, errors.Wrap(err, "failed to delete a replayed dead letter")
+			}
+
+			delivered++
+			continue
+		}
+
+		letter.Error = err.Error()
+		letter.Attempts += attempts
+		letter.FailedAt = time.Now()
+
+		if err = l.deadLetters.PutDeadLetter(ctx, letter); err != nil {
+			return delivered, errors.Wrap(err, "failed to update a dead letter")
+		}
+	}
+
+	return delivered, nil
+}
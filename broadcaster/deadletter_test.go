@@ -0,0 +1,90 @@
+package broadcaster
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	tmDB "github.com/tendermint/tm-db"
+)
+
+func Test_DBDeadLetterStore(t *testing.T) {
+	ctx := context.Background()
+	deadLetters := NewDBDeadLetterStore(tmDB.NewMemDB())
+
+	header := &types.Header{Number: big.NewInt(10), Difficulty: big.NewInt(1)}
+	event := &types.Log{Address: common.HexToAddress("0x1"), Topics: []common.Hash{common.HexToHash("0x2")}, BlockNumber: 10}
+	failedAt := time.Now()
+
+	require.NoError(t, deadLetters.PutDeadLetter(ctx, &DeadLetter{
+		ID: "b", ChainID: testChainID, SubscriptionID: testWfID, Header: header, FailedAt: failedAt.Add(time.Second),
+	}))
+	require.NoError(t, deadLetters.PutDeadLetter(ctx, &DeadLetter{
+		ID: "a", ChainID: testChainID, SubscriptionID: testWfID, Event: event, Error: "failed", FailedAt: failedAt,
+	}))
+	require.NoError(t, deadLetters.PutDeadLetter(ctx, &DeadLetter{
+		ID: "c", ChainID: testChainID + 1, SubscriptionID: testWfID, Header: header, FailedAt: failedAt,
+	}))
+
+	letters, err := deadLetters.GetDeadLetters(ctx, testChainID)
+	require.NoError(t, err)
+	require.Len(t, letters, 2)
+	require.Equal(t, "a", letters[0].ID)
+	require.Equal(t, event.Address, letters[0].Event.Address)
+	require.Equal(t, "failed", letters[0].Error)
+	require.Equal(t, "b", letters[1].ID)
+	require.Equal(t, header.Hash(), letters[1].Header.Hash())
+
+	require.NoError(t, deadLetters.DeleteDeadLetter(ctx, testChainID, "a"))
+
+	letters, err = deadLetters.GetDeadLetters(ctx, testChainID)
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	require.Equal(t, "b", letters[0].ID)
+}
+
+func Test_SingleChainBroadcaster_ReplayTransactionDeadLetters(t *testing.T) {
+	env := newTestEnv(t)
+	deadLetters := NewMemoryDeadLetterStore()
+	broadcaster := env.newBroadcaster(t, Options{
+		DeadLetters:         deadLetters,
+		PendingTransactions: NewPendingTxStreamer(env.logger, &fakePendingTxRPC{}, time.Second, testChainID),
+	})
+
+	// A mined and a pending transaction subscriptions sharing their ID
+	mined := make(chan Transaction, 1)
+	_, err := broadcaster.RegisterTransactionHandler(testWfID, testChainID, func(ctx context.Context, tx Transaction) error {
+		mined <- tx
+		return nil
+	}, TransactionOptions{})
+	require.NoError(t, err)
+
+	pending := make(chan Transaction, 1)
+	_, err = broadcaster.RegisterPendingTransactionHandler(testWfID, testChainID,
+		func(ctx context.Context, tx Transaction) error {
+			pending <- tx
+			return nil
+		}, TransactionOptions{})
+	require.NoError(t, err)
+
+	minedTx := types.NewTransaction(0, common.HexToAddress("0x1"), big.NewInt(1), 21000, big.NewInt(1), nil)
+	pendingTx := types.NewTransaction(1, common.HexToAddress("0x1"), big.NewInt(1), 21000, big.NewInt(1), nil)
+	require.NoError(t, deadLetters.PutDeadLetter(env.ctx, &DeadLetter{
+		ID: "mined", ChainID: testChainID, SubscriptionID: testWfID, Transaction: &Transaction{Tx: minedTx},
+	}))
+	require.NoError(t, deadLetters.PutDeadLetter(env.ctx, &DeadLetter{
+		ID: "pending", ChainID: testChainID, SubscriptionID: testWfID, Transaction: &Transaction{Tx: pendingTx},
+		Pending: true,
+	}))
+
+	replayed, err := broadcaster.ReplayDeadLetters(env.ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, replayed)
+
+	require.Equal(t, minedTx.Hash(), (<-mined).Tx.Hash())
+	require.Equal(t, pendingTx.Hash(), (<-pending).Tx.Hash())
+}
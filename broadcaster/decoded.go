@@ -0,0 +1,156 @@
+package broadcaster
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+// DecodedEvent is an event decoded with the ABI of its contract
+type DecodedEvent struct {
+	// Name is the name of the event in the ABI
+	Name string
+
+	// Args contains the values of the indexed and non-indexed arguments of the event by name
+	Args map[string]interface{}
+
+	// Log is the raw event
+	Log types.Log
+}
+
+// HandleDecodedEventFunc is the signature of a function to handle decoded events which may fail.
+// Failed deliveries are retried and dead-lettered once the attempts are exhausted.
+type HandleDecodedEventFunc func(ctx context.Context, event DecodedEvent) error
+
+// DecodedEventOptions contains options to filter decoded events
+type DecodedEventOptions struct {
+	EventOptions
+
+	// Indexed filters the events by the values of their indexed arguments, keyed by argument name.
+	// An event matches if each listed argument has one of the given values. The values have the Go
+	// types of the arguments, e.g. common.Address or *big.Int. Optional.
+	Indexed map[string][]interface{}
+}
+
+// eventDecoder decodes the events of a single ABI event
+type eventDecoder struct {
+	event abi.Event
+}
+
+// newEventDecoder creates a decoder of the event with the given name of the given ABI
+func newEventDecoder(contractABI abi.ABI, eventName string) (*eventDecoder, error) {
+	event, ok := contractABI.Events[eventName]
+	if !ok {
+		return nil, fmt.Errorf("event %s not found in the ABI", eventName)
+	}
+
+	if event.Anonymous {
+		return nil, fmt.Errorf("anonymous event %s cannot be filtered by topic", eventName)
+	}
+
+	return &eventDecoder{
+		event: event,
+	}, nil
+}
+
+// topics returns the topic filters of the event, for EventOptions.LogsWithTopics
+func (d *eventDecoder) topics(indexed map[string][]interface{}) (map[common.Hash][][]common.Hash, error) {
+	var query [][]interface{}
+	var found int
+	for _, arg := range d.event.Inputs {
+		if !arg.Indexed {
+			continue
+		}
+
+		values, ok := indexed[arg.Name]
+		if ok {
+			found++
+		}
+
+		query = append(query, values)
+	}
+
+	if found != len(indexed) {
+		return nil, fmt.Errorf("filters on unknown indexed arguments of event %s", d.event.Name)
+	}
+
+	filters, err := abi.MakeTopics(query...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to make the topic filters of event %s", d.event.Name)
+	}
+
+	return map[common.Hash][][]common.Hash{
+		d.event.ID: filters,
+	}, nil
+}
+
+// decode decodes the given event
+func (d *eventDecoder) decode(event types.Log) (DecodedEvent, error) {
+	if len(event.Topics) == 0 || event.Topics[0] != d.event.ID {
+		return DecodedEvent{}, fmt.Errorf("event is not a %s event", d.event.Name)
+	}
+
+	args := make(map[string]interface{})
+	if err := d.event.Inputs.UnpackIntoMap(args, event.Data); err != nil {
+		return DecodedEvent{}, errors.Wrapf(err, "failed to unpack the data of event %s", d.event.Name)
+	}
+
+	var indexed abi.Arguments
+	for _, arg := range d.event.Inputs {
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+
+	if len(event.Topics)-1 != len(indexed) {
+		return DecodedEvent{}, fmt.Errorf("event %s has %d indexed arguments, got %d topics",
+			d.event.Name, len(indexed), len(event.Topics)-1)
+	}
+
+	if err := abi.ParseTopicsIntoMap(args, indexed, event.Topics[1:]); err != nil {
+		return DecodedEvent{}, errors.Wrapf(err, "failed to parse the topics of event %s", d.event.Name)
+	}
+
+	return DecodedEvent{
+		Name: d.event.Name,
+		Args: args,
+		Log:  event,
+	}, nil
+}
+
+// RegisterDecodedEventHandler registers the given handler for the event with the given name of the given
+// ABI. The topic filters are computed from the ABI, the handler receives the events decoded. Events
+// which cannot be decoded are dead-lettered without retries.
+func (l *singleChainBroadcaster) RegisterDecodedEventHandler(
+	id string,
+	chainID uint64,
+	contractABI abi.ABI,
+	eventName string,
+	handler HandleDecodedEventFunc,
+	opts DecodedEventOptions,
+) (func(), error) {
+	decoder, err := newEventDecoder(contractABI, eventName)
+	if err != nil {
+		return nil, err
+	}
+
+	eventOpts := opts.EventOptions
+	if eventOpts.LogsWithTopics, err = decoder.topics(opts.Indexed); err != nil {
+		return nil, err
+	}
+
+	return l.RegisterEventErrHandler(id, chainID, func(ctx context.Context, event types.Log) error {
+		decoded, err := decoder.decode(event)
+		if err != nil {
+			failedDecodeCounter.WithLabelValues(big.NewInt(0).SetUint64(l.chainID).String()).Inc()
+			return permanent(err)
+		}
+
+		return handler(ctx, decoded)
+	}, eventOpts)
+}
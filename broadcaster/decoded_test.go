@@ -0,0 +1,89 @@
+package broadcaster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/begmaroman/eth-services/broadcaster/contracts"
+)
+
+func Test_SingleChainBroadcaster_DecodedEvents(t *testing.T) {
+	ctx := context.Background()
+
+	counterABI, err := contracts.CounterMetaData.GetAbi()
+	require.NoError(t, err)
+
+	t.Run("decode events", func(t *testing.T) {
+		env := newTestEnv(t)
+
+		events := make(chan DecodedEvent, 1)
+		env.startBroadcaster(t, Options{}, func(broadcaster *singleChainBroadcaster) {
+			_, err := broadcaster.RegisterDecodedEventHandler(testWfID, testChainID, *counterABI, "TriggerPerformance",
+				func(ctx context.Context, event DecodedEvent) error {
+					events <- event
+					return nil
+				}, DecodedEventOptions{})
+			require.NoError(t, err)
+		})
+
+		env.trigger(t)
+		env.backend.Commit()
+
+		select {
+		case event := <-events:
+			require.Equal(t, "TriggerPerformance", event.Name)
+			require.Equal(t, []byte("qwe"), event.Args["data"])
+			require.Equal(t, true, event.Args["perform"])
+			require.Equal(t, common.HexToHash(testTriggerPerformanceEventID), event.Log.Topics[0])
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no event decoded")
+		}
+	})
+
+	t.Run("reject unknown events and arguments", func(t *testing.T) {
+		broadcaster := newTestEnv(t).newBroadcaster(t, Options{})
+
+		handler := func(ctx context.Context, event DecodedEvent) error { return nil }
+
+		_, err := broadcaster.RegisterDecodedEventHandler(testWfID, testChainID, *counterABI, "Unknown", handler,
+			DecodedEventOptions{})
+		require.Error(t, err)
+
+		_, err = broadcaster.RegisterDecodedEventHandler(testWfID, testChainID, *counterABI, "Performed", handler,
+			DecodedEventOptions{Indexed: map[string][]interface{}{"to": {common.HexToAddress("0x1")}}})
+		require.Error(t, err)
+	})
+
+	t.Run("filter indexed arguments", func(t *testing.T) {
+		decoder, err := newEventDecoder(*counterABI, "Performed")
+		require.NoError(t, err)
+
+		from := common.HexToAddress("0x1")
+		topics, err := decoder.topics(map[string][]interface{}{"from": {from}})
+		require.NoError(t, err)
+		require.Equal(t, [][]common.Hash{{common.BytesToHash(from.Bytes())}}, topics[counterABI.Events["Performed"].ID])
+	})
+
+	t.Run("surface decoding failures", func(t *testing.T) {
+		decoder, err := newEventDecoder(*counterABI, "TriggerPerformance")
+		require.NoError(t, err)
+
+		_, err = decoder.decode(types.Log{
+			Topics: []common.Hash{common.HexToHash(testTriggerPerformanceEventID)},
+			Data:   []byte{1, 2, 3},
+		})
+		require.Error(t, err)
+
+		attempts, err := retry(ctx, nil, RetryOptions{MinBackoff: time.Millisecond}, func() error {
+			return permanent(errors.New("undecodable"))
+		})
+		require.Error(t, err)
+		require.Equal(t, 1, attempts)
+	})
+}
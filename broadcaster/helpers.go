@@ -9,14 +9,20 @@ var (
 	zeroHash = common.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000000")
 )
 
-// Returns true if there is at least one filter value (or no filters at all) that matches an actual received value for every index i, or false otherwise
+// Returns true if, for every index i with filter values, the actual received value at index i is one of them, or false
+// otherwise. Like the filters of eth_getLogs, a value filter never matches a missing value.
 func filtersContainValues(topicValues []common.Hash, filters [][]common.Hash) bool {
-	for i := 0; i < len(topicValues) && i < len(filters); i++ {
-		filterValues := filters[i]
-
+	for i, filterValues := range filters {
 		// Empty filter for given index means: all values allowed
-		valueFound := len(filterValues) == 0
+		if len(filterValues) == 0 {
+			continue
+		}
+
+		if i >= len(topicValues) {
+			return false
+		}
 
+		valueFound := false
 		for _, filterValue := range filterValues {
 			if filterValue == topicValues[i] {
 				valueFound = true
@@ -0,0 +1,331 @@
+package broadcaster
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// logsLimitErrors are parts of the errors returned by providers when a logs request covers too many
+// blocks or matches too many logs
+var logsLimitErrors = []string{
+	"query returned more than",
+	"response size exceeded",
+	"log response size exceeded",
+	"block range",
+	"range is too large",
+	"range too large",
+	"too many blocks",
+	"limit exceeded",
+	"query timeout exceeded",
+}
+
+// isLogsLimitError returns true if the given error is returned by a provider because a logs request is
+// too large
+func isLogsLimitError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, limitErr := range logsLimitErrors {
+		if strings.Contains(msg, limitErr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// blockHashUnsupportedErrors are parts of the errors returned by providers which do not support
+// EIP-234 BlockHash logs queries. They name the BlockHash field, so that other invalid requests, e.g.
+// of unknown blocks, are not mistaken for them.
+var blockHashUnsupportedErrors = []string{
+	"blockhash is not supported",
+	"blockhash not supported",
+	"block hash is not supported",
+	"block hash not supported",
+	"blockhash filter is not supported",
+	"unsupported field blockhash",
+	`unknown field "blockhash"`,
+}
+
+const (
+	// blockHashFailuresThreshold is the number of consecutive BlockHash queries rejected as unsupported
+	// after which blocks are queried by number only
+	blockHashFailuresThreshold = 3
+	// blockHashReprobeInterval is the time after which BlockHash queries are tried again once
+	// blocks are queried by number only
+	blockHashReprobeInterval = 10 * time.Minute
+)
+
+// isBlockHashUnsupportedError returns true if the given error is returned by a provider because it does
+// not support BlockHash logs queries
+func isBlockHashUnsupportedError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, unsupportedErr := range blockHashUnsupportedErrors {
+		if strings.Contains(msg, unsupportedErr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// logChunk is a range of blocks fetched by a single logs request
+type logChunk struct {
+	from, to uint64
+	logs     []types.Log
+	err      error
+}
+
+// logFetcher fetches logs over large block ranges with chunked FilterLogs requests. The chunk size
+// adapts to the limits of the provider: it is halved on limit errors and doubled on success, up to the
+// configured maximum range.
+type logFetcher struct {
+	logger      logrus.FieldLogger
+	client      ethereum.LogFilterer
+	chainID     uint64
+	maxRange    uint64
+	concurrency int
+
+	// lock guards size and the BlockHash support, which are shared by all fetches
+	lock sync.Mutex
+	size uint64
+
+	// blockHashFailures counts the consecutive BlockHash queries rejected as unsupported, and
+	// blockHashDowngraded is when blocks started to be queried by number only
+	blockHashFailures   int
+	blockHashDowngraded time.Time
+	blockHashReprobe    time.Duration
+}
+
+func newLogFetcher(
+	logger logrus.FieldLogger,
+	client ethereum.LogFilterer,
+	chainID uint64,
+	maxRange uint64,
+	concurrency int,
+) *logFetcher {
+	return &logFetcher{
+		logger:      logger,
+		client:      client,
+		chainID:     chainID,
+		maxRange:    maxRange,
+		concurrency: concurrency,
+		size:        maxRange,
+
+		blockHashReprobe: blockHashReprobeInterval,
+	}
+}
+
+// fetch fetches the logs matching the given query in the blocks from..to. Up to the configured
+// concurrency of chunks are fetched at once, and deliver is called with each chunk in ascending
+// order. Fetching stops at the first error of deliver, which is returned.
+func (f *logFetcher) fetch(
+	ctx context.Context,
+	query ethereum.FilterQuery,
+	from, to uint64,
+	deliver func(from, to uint64, logs []types.Log) error,
+) error {
+	for from <= to {
+		chunks := f.chunks(from, to)
+
+		var requests sync.WaitGroup
+		for _, chunk := range chunks {
+			requests.Add(1)
+			go func(chunk *logChunk) {
+				defer requests.Done()
+
+				chunkQuery := query
+				chunkQuery.FromBlock = big.NewInt(0).SetUint64(chunk.from)
+				chunkQuery.ToBlock = big.NewInt(0).SetUint64(chunk.to)
+
+				chunk.logs, chunk.err = f.filterLogs(ctx, chunkQuery)
+			}(chunk)
+		}
+		requests.Wait()
+
+		// Deliver in order up to the first failed chunk, which is fetched again in smaller chunks
+		var limited bool
+		for _, chunk := range chunks {
+			if chunk.err != nil {
+				if !isLogsLimitError(chunk.err) || chunk.from == chunk.to {
+					return errors.Wrapf(chunk.err, "failed to filter logs from block %d to %d", chunk.from, chunk.to)
+				}
+
+				f.shrink(chunk)
+				limited = true
+				break
+			}
+
+			if err := deliver(chunk.from, chunk.to, chunk.logs); err != nil {
+				return err
+			}
+
+			from = chunk.to + 1
+		}
+
+		if !limited {
+			f.grow()
+		}
+	}
+
+	return nil
+}
+
+// chunks splits the blocks from..to into the chunks of the next concurrent requests
+func (f *logFetcher) chunks(from, to uint64) []*logChunk {
+	f.lock.Lock()
+	size := f.size
+	f.lock.Unlock()
+
+	var chunks []*logChunk
+	for len(chunks) < f.concurrency && from <= to {
+		chunkTo := to
+		if to-from >= size {
+			chunkTo = from + size - 1
+		}
+
+		chunks = append(chunks, &logChunk{from: from, to: chunkTo})
+		from = chunkTo + 1
+	}
+
+	return chunks
+}
+
+// shrink halves the chunk size below the size of the given chunk, which hit a limit of the provider
+func (f *logFetcher) shrink(chunk *logChunk) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if size := (chunk.to - chunk.from + 1) / 2; size < f.size {
+		f.size = size
+	}
+
+	limitedGetLogsCounter.WithLabelValues(big.NewInt(0).SetUint64(f.chainID).String()).Inc()
+	f.logger.WithError(chunk.err).WithFields(logrus.Fields{
+		"from": chunk.from,
+		"to":   chunk.to,
+		"size": f.size,
+	}).Warn("logs request hit a provider limit, reducing the range")
+}
+
+// grow doubles the chunk size up to the maximum range
+func (f *logFetcher) grow() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.size *= 2; f.size > f.maxRange {
+		f.size = f.maxRange
+	}
+}
+
+// fetchBlock fetches the logs of the given block matching the given query. The logs are queried by
+// block hash (EIP-234), so that they belong to the given header even if the chain re-organizes
+// meanwhile. Providers which do not support it are queried by number, and the logs are verified to
+// belong to the given header then.
+func (f *logFetcher) fetchBlock(
+	ctx context.Context,
+	query ethereum.FilterQuery,
+	header *types.Header,
+) ([]types.Log, error) {
+	hash := header.Hash()
+
+	if f.queryByBlockHash() {
+		hashQuery := query
+		hashQuery.FromBlock = nil
+		hashQuery.ToBlock = nil
+		hashQuery.BlockHash = &hash
+
+		logs, err := f.filterLogs(ctx, hashQuery)
+		if err == nil {
+			f.blockHashSupported()
+			return logs, nil
+		}
+
+		if !isBlockHashUnsupportedError(err) {
+			return nil, errors.Wrapf(err, "failed to filter logs of block %s", hash.Hex())
+		}
+
+		f.blockHashUnsupported(err)
+	}
+
+	numberQuery := query
+	numberQuery.BlockHash = nil
+	numberQuery.FromBlock = header.Number
+	numberQuery.ToBlock = header.Number
+
+	logs, err := f.filterLogs(ctx, numberQuery)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to filter logs of block %d", header.Number.Uint64())
+	}
+
+	for _, log := range logs {
+		if log.BlockHash != hash {
+			return nil, fmt.Errorf("block %d has been re-organized while fetching its logs", header.Number.Uint64())
+		}
+	}
+
+	return logs, nil
+}
+
+// queryByBlockHash returns true if blocks are to be queried by block hash: unless the provider rejected
+// repeated BlockHash queries as unsupported, in which case they are tried again after an interval
+func (f *logFetcher) queryByBlockHash() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.blockHashDowngraded.IsZero() || time.Since(f.blockHashDowngraded) >= f.blockHashReprobe
+}
+
+// blockHashSupported records a successful BlockHash query
+func (f *logFetcher) blockHashSupported() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if !f.blockHashDowngraded.IsZero() {
+		f.logger.Info("logs queries by block hash are supported again")
+	}
+
+	f.blockHashFailures = 0
+	f.blockHashDowngraded = time.Time{}
+}
+
+// blockHashUnsupported records a BlockHash query rejected as unsupported, and queries blocks by number
+// only once it happened repeatedly
+func (f *logFetcher) blockHashUnsupported(err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.blockHashFailures++
+	if f.blockHashFailures < blockHashFailuresThreshold {
+		f.logger.WithError(err).Debug("logs query by block hash rejected, querying by number")
+		return
+	}
+
+	if f.blockHashDowngraded.IsZero() {
+		f.logger.WithError(err).Warn("logs queries by block hash are not supported, querying by number")
+	}
+
+	f.blockHashDowngraded = time.Now()
+}
+
+// filterLogs issues a single logs request, counting the requests and the logs returned
+func (f *logFetcher) filterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	chainID := big.NewInt(0).SetUint64(f.chainID).String()
+	logQueriesCounter.WithLabelValues(chainID).Inc()
+
+	logs, err := f.client.FilterLogs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	fetchedLogsCounter.WithLabelValues(chainID).Add(float64(len(logs)))
+
+	return logs, nil
+}
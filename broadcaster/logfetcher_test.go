@@ -0,0 +1,171 @@
+package broadcaster
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// limitedLogFilterer returns a log per block, and a limit error for ranges of more than limit blocks
+type limitedLogFilterer struct {
+	limit uint64
+}
+
+func (f *limitedLogFilterer) FilterLogs(_ context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+	if to-from+1 > f.limit {
+		return nil, errors.New("query returned more than 10000 results")
+	}
+
+	var logs []types.Log
+	for n := from; n <= to; n++ {
+		logs = append(logs, types.Log{BlockNumber: n})
+	}
+
+	return logs, nil
+}
+
+func (f *limitedLogFilterer) SubscribeFilterLogs(
+	context.Context,
+	ethereum.FilterQuery,
+	chan<- types.Log,
+) (ethereum.Subscription, error) {
+	return nil, errors.New("not supported")
+}
+
+func Test_LogFetcher(t *testing.T) {
+	ctx := context.Background()
+	filterer := &limitedLogFilterer{limit: 3}
+	fetcher := newLogFetcher(logrus.New(), filterer, testChainID, 8, 3)
+
+	var numbers []uint64
+	next := uint64(1)
+	err := fetcher.fetch(ctx, ethereum.FilterQuery{}, 1, 40, func(from, to uint64, logs []types.Log) error {
+		// Chunks are delivered in order, without gaps
+		require.Equal(t, next, from)
+		require.LessOrEqual(t, to-from+1, uint64(3))
+		next = to + 1
+
+		for _, log := range logs {
+			numbers = append(numbers, log.BlockNumber)
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(41), next)
+	require.Len(t, numbers, 40)
+	for i, number := range numbers {
+		require.Equal(t, uint64(i+1), number)
+	}
+
+	t.Run("fails on errors of single blocks", func(t *testing.T) {
+		fetcher := newLogFetcher(logrus.New(), &limitedLogFilterer{limit: 0}, testChainID, 8, 3)
+		err := fetcher.fetch(ctx, ethereum.FilterQuery{}, 1, 10, func(uint64, uint64, []types.Log) error {
+			return nil
+		})
+		require.Error(t, err)
+	})
+}
+
+// numberLogFilterer rejects BlockHash queries with hashErr, "blockHash is not supported" by default,
+// and returns a log of the block with the given hash
+type numberLogFilterer struct {
+	hash    common.Hash
+	hashErr error
+
+	hashQueries int
+}
+
+func (f *numberLogFilterer) FilterLogs(_ context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	if q.BlockHash != nil {
+		f.hashQueries++
+		if f.hashErr != nil {
+			return nil, f.hashErr
+		}
+		return nil, errors.New("invalid argument 0: blockHash is not supported")
+	}
+
+	return []types.Log{{BlockNumber: q.FromBlock.Uint64(), BlockHash: f.hash}}, nil
+}
+
+func (f *numberLogFilterer) SubscribeFilterLogs(
+	context.Context,
+	ethereum.FilterQuery,
+	chan<- types.Log,
+) (ethereum.Subscription, error) {
+	return nil, errors.New("not supported")
+}
+
+func Test_LogFetcher_FetchBlock(t *testing.T) {
+	ctx := context.Background()
+	header := &types.Header{Number: big.NewInt(10), Difficulty: big.NewInt(1)}
+
+	t.Run("query by block hash", func(t *testing.T) {
+		env := newTestEnv(t)
+
+		env.trigger(t)
+		env.backend.Commit()
+
+		header, err := env.backend.HeaderByNumber(ctx, nil)
+		require.NoError(t, err)
+
+		fetcher := newLogFetcher(env.logger, env.backend, testChainID, 8, 1)
+		logs, err := fetcher.fetchBlock(ctx, ethereum.FilterQuery{}, header)
+		require.NoError(t, err)
+		require.NotEmpty(t, logs)
+
+		for _, log := range logs {
+			require.Equal(t, header.Hash(), log.BlockHash)
+		}
+	})
+
+	t.Run("fall back to number", func(t *testing.T) {
+		filterer := &numberLogFilterer{hash: header.Hash()}
+		fetcher := newLogFetcher(logrus.New(), filterer, testChainID, 8, 1)
+
+		// Blocks are queried by number only once BlockHash queries are rejected repeatedly
+		for i := 0; i < blockHashFailuresThreshold+2; i++ {
+			logs, err := fetcher.fetchBlock(ctx, ethereum.FilterQuery{}, header)
+			require.NoError(t, err)
+			require.Len(t, logs, 1)
+		}
+		require.Equal(t, blockHashFailuresThreshold, filterer.hashQueries)
+		require.False(t, fetcher.queryByBlockHash())
+
+		// BlockHash queries are tried again after the interval
+		fetcher.blockHashReprobe = 0
+		_, err := fetcher.fetchBlock(ctx, ethereum.FilterQuery{}, header)
+		require.NoError(t, err)
+		require.Equal(t, blockHashFailuresThreshold+1, filterer.hashQueries)
+	})
+
+	t.Run("keep querying by block hash on other errors", func(t *testing.T) {
+		filterer := &numberLogFilterer{
+			hash:    header.Hash(),
+			hashErr: errors.New("invalid params: block not found"),
+		}
+		fetcher := newLogFetcher(logrus.New(), filterer, testChainID, 8, 1)
+
+		for i := 0; i < blockHashFailuresThreshold+1; i++ {
+			_, err := fetcher.fetchBlock(ctx, ethereum.FilterQuery{}, header)
+			require.Error(t, err)
+		}
+		require.Equal(t, blockHashFailuresThreshold+1, filterer.hashQueries)
+		require.True(t, fetcher.queryByBlockHash())
+	})
+
+	t.Run("detect re-orgs when falling back to number", func(t *testing.T) {
+		fetcher := newLogFetcher(logrus.New(), &numberLogFilterer{hash: common.HexToHash("0x1")}, testChainID, 8, 1)
+
+		_, err := fetcher.fetchBlock(ctx, ethereum.FilterQuery{}, header)
+		require.Error(t, err)
+	})
+}
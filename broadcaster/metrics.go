@@ -30,6 +30,69 @@ var (
 		Name:      "failed_get_header_by_number",
 		Help:      "The total number of failed requests to get header by number",
 	}, []string{"chain_id"})
+
+	failedSaveCheckpointCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nerif_app",
+		Subsystem: "broadcaster",
+		Name:      "failed_save_checkpoint",
+		Help:      "The total number of failed attempts to save checkpoints",
+	}, []string{"chain_id"})
+
+	reorgCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nerif_app",
+		Subsystem: "broadcaster",
+		Name:      "reorgs",
+		Help:      "The total number of detected chain re-orgs",
+	}, []string{"chain_id"})
+
+	failedDeliveryCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nerif_app",
+		Subsystem: "broadcaster",
+		Name:      "failed_delivery",
+		Help:      "The total number of events and blocks which could not be delivered after all retries",
+	}, []string{"chain_id"})
+
+	limitedGetLogsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nerif_app",
+		Subsystem: "broadcaster",
+		Name:      "limited_get_logs",
+		Help:      "The total number of logs requests which hit a provider limit",
+	}, []string{"chain_id"})
+
+	logQueriesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nerif_app",
+		Subsystem: "broadcaster",
+		Name:      "log_queries",
+		Help:      "The total number of logs requests issued",
+	}, []string{"chain_id"})
+
+	fetchedLogsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nerif_app",
+		Subsystem: "broadcaster",
+		Name:      "fetched_logs",
+		Help:      "The total number of logs returned by logs requests",
+	}, []string{"chain_id"})
+
+	failedDecodeCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nerif_app",
+		Subsystem: "broadcaster",
+		Name:      "failed_decode",
+		Help:      "The total number of events which could not be decoded with the ABI of their handler",
+	}, []string{"chain_id"})
+
+	failedSubscribePendingTxCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nerif_app",
+		Subsystem: "broadcaster",
+		Name:      "failed_subscribe_pending_tx",
+		Help:      "The total number of failed subscriptions for pending transactions",
+	}, []string{"chain_id"})
+
+	queueOverflowCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nerif_app",
+		Subsystem: "broadcaster",
+		Name:      "queue_overflow",
+		Help:      "The total number of deliveries queued while the delivery queue of a subscriber was full",
+	}, []string{"chain_id", "policy"})
 )
 
 func init() {
@@ -37,4 +100,13 @@ func init() {
 	prometheus.MustRegister(failedHealthcheckCounter)
 	prometheus.MustRegister(resubscribeNewHeadsSubscriptionCounter)
 	prometheus.MustRegister(failedGetHeaderByNumberCounter)
+	prometheus.MustRegister(failedSaveCheckpointCounter)
+	prometheus.MustRegister(reorgCounter)
+	prometheus.MustRegister(failedDeliveryCounter)
+	prometheus.MustRegister(queueOverflowCounter)
+	prometheus.MustRegister(limitedGetLogsCounter)
+	prometheus.MustRegister(logQueriesCounter)
+	prometheus.MustRegister(fetchedLogsCounter)
+	prometheus.MustRegister(failedDecodeCounter)
+	prometheus.MustRegister(failedSubscribePendingTxCounter)
 }
@@ -0,0 +1,176 @@
+package broadcaster
+
+import (
+	"sync"
+)
+
+// deliveryTracker is told about the deliveries queued for a block and about their completion. A
+// *sync.WaitGroup is one.
+type deliveryTracker interface {
+	Add(delta int)
+	Done()
+}
+
+// deliveryProgress tracks the blocks queued to a subscription, and advances the checkpoint of the
+// subscription once the deliveries of a block and of all the blocks before it are done. The heads loop
+// moves on as soon as a block is queued, so that a slow subscriber only holds back itself.
+type deliveryProgress struct {
+	// key is the checkpoint key of the subscription
+	key string
+	// confirmations is the number of confirmations the subscription waits for
+	confirmations uint64
+
+	lock sync.Mutex
+	// blocks are the queued blocks which are not fully delivered yet, in ascending order
+	blocks []*queuedBlock
+	// checkpoint is the last block fully delivered to the subscription
+	checkpoint uint64
+	// active is set once the checkpoint is known, i.e. once the subscription receives new blocks
+	active bool
+}
+
+func newDeliveryProgress(key string, confirmations uint64) *deliveryProgress {
+	return &deliveryProgress{
+		key:           key,
+		confirmations: confirmations,
+	}
+}
+
+// queuedBlock counts the pending deliveries of a block queued to a subscription
+type queuedBlock struct {
+	progress *deliveryProgress
+	number   uint64
+	// pending is the number of deliveries which are not done, plus one until the block is sealed
+	pending int
+	// discarded is set if a delivery has been discarded by a stop, the block is not checkpointed then
+	discarded bool
+	// stop is closed once the broadcaster stops
+	stop <-chan struct{}
+	// save stores the checkpoint of the subscription
+	save func(number uint64)
+}
+
+// queue starts tracking the deliveries of the block with the given number. The block is not fully
+// delivered before it is sealed by calling Done once more, after all its deliveries have been queued.
+func (p *deliveryProgress) queue(number uint64, stop <-chan struct{}, save func(number uint64)) *queuedBlock {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	b := &queuedBlock{
+		progress: p,
+		number:   number,
+		pending:  1,
+		stop:     stop,
+		save:     save,
+	}
+	p.blocks = append(p.blocks, b)
+
+	return b
+}
+
+// Add adds the given number of deliveries to the block
+func (b *queuedBlock) Add(delta int) {
+	b.progress.lock.Lock()
+	defer b.progress.lock.Unlock()
+
+	b.pending += delta
+}
+
+// Done marks a delivery of the block as done, or seals the block
+func (b *queuedBlock) Done() {
+	p := b.progress
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// Deliveries are discarded when the queues are closed, the block is delivered again after a restart
+	select {
+	case <-b.stop:
+		b.discarded = true
+	default:
+	}
+
+	b.pending--
+	p.advance()
+}
+
+// advance checkpoints the fully delivered blocks at the front of the queued blocks. The checkpoint is
+// saved while the lock is held, so that it is never stored out of order.
+func (p *deliveryProgress) advance() {
+	var last *queuedBlock
+	for len(p.blocks) > 0 && p.blocks[0].pending == 0 && !p.blocks[0].discarded {
+		last = p.blocks[0]
+		p.blocks = p.blocks[1:]
+	}
+
+	if last == nil || last.number <= p.checkpoint {
+		return
+	}
+
+	p.checkpoint = last.number
+	last.save(last.number)
+}
+
+// handledHead returns the last head fully handled by the subscription, which is as many blocks above its
+// checkpoint as it waits confirmations for. Returns false if the subscription does not receive new
+// blocks yet.
+func (p *deliveryProgress) handledHead() (uint64, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.checkpoint + p.confirmations, p.active
+}
+
+// reset sets the last block fully delivered to the subscription, e.g. once it has been loaded
+func (p *deliveryProgress) reset(number uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.checkpoint = number
+	p.active = true
+}
+
+// revert stops tracking the queued blocks after the given number, which have been re-organized away,
+// and moves the checkpoint back to the given number. Returns true if the checkpoint has been moved.
+func (p *deliveryProgress) revert(number uint64) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	kept := p.blocks[:0]
+	for _, b := range p.blocks {
+		if b.number <= number {
+			kept = append(kept, b)
+		}
+	}
+	p.blocks = kept
+
+	if p.checkpoint <= number {
+		return false
+	}
+
+	p.checkpoint = number
+	return true
+}
+
+// trackDelivery adds a delivery to handlers and returns the function marking it as done. handlers may
+// be nil.
+func trackDelivery(handlers deliveryTracker) func() {
+	if handlers == nil {
+		return func() {}
+	}
+
+	handlers.Add(1)
+	return handlers.Done
+}
+
+// queuedBlocks are the blocks queued to the subscriptions while a block is handled, by progress of
+// subscription
+type queuedBlocks map[*deliveryProgress]*queuedBlock
+
+// of returns the block queued to the subscription with the given progress, or nil if there is none
+func (q queuedBlocks) of(p *deliveryProgress) deliveryTracker {
+	if b, ok := q[p]; ok {
+		return b
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package broadcaster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DeliveryProgress(t *testing.T) {
+	// newProgress returns a progress starting at the block 1, and the function recording the
+	// checkpoints it saves in saved
+	newProgress := func() (p *deliveryProgress, save func(number uint64), saved *[]uint64) {
+		p = newDeliveryProgress(BlockCheckpointKey(testWfID), 0)
+		p.reset(1)
+
+		saved = new([]uint64)
+		return p, func(number uint64) { *saved = append(*saved, number) }, saved
+	}
+
+	t.Run("checkpoint blocks in order", func(t *testing.T) {
+		p, save, saved := newProgress()
+		stop := make(chan struct{})
+
+		first := p.queue(2, stop, save)
+		first.Add(2)
+		first.Done()
+
+		second := p.queue(3, stop, save)
+		second.Add(1)
+		second.Done()
+
+		// The block 3 is delivered first, it waits for the block 2
+		second.Done()
+		first.Done()
+		require.Empty(t, *saved)
+
+		first.Done()
+		require.Equal(t, []uint64{3}, *saved)
+
+		head, ok := p.handledHead()
+		require.True(t, ok)
+		require.Equal(t, uint64(3), head)
+	})
+
+	t.Run("drop reverted blocks", func(t *testing.T) {
+		p, save, saved := newProgress()
+		stop := make(chan struct{})
+
+		kept := p.queue(2, stop, save)
+		kept.Add(1)
+		kept.Done()
+
+		reverted := p.queue(3, stop, save)
+		reverted.Done()
+		require.Empty(t, *saved)
+
+		require.False(t, p.revert(2))
+		kept.Done()
+		require.Equal(t, []uint64{2}, *saved)
+
+		require.True(t, p.revert(1))
+		head, _ := p.handledHead()
+		require.Equal(t, uint64(1), head)
+	})
+
+	t.Run("skip blocks discarded by a stop", func(t *testing.T) {
+		p, save, saved := newProgress()
+		stop := make(chan struct{})
+
+		b := p.queue(2, stop, save)
+		b.Add(1)
+		b.Done()
+
+		close(stop)
+		b.Done()
+		require.Empty(t, *saved)
+
+		head, _ := p.handledHead()
+		require.Equal(t, uint64(1), head)
+	})
+}
@@ -0,0 +1,270 @@
+package broadcaster
+
+import (
+	"bytes"
+	"context"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// maxTopics is the number of topic positions of a log: the event signature and up to 3 indexed arguments
+const maxTopics = 4
+
+// hashSet is a sorted set of hashes, nil matches any value
+type hashSet []common.Hash
+
+func newHashSet(hashes []common.Hash) hashSet {
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	set := make(hashSet, 0, len(hashes))
+	seen := make(map[common.Hash]struct{}, len(hashes))
+	for _, hash := range hashes {
+		if _, ok := seen[hash]; !ok {
+			seen[hash] = struct{}{}
+			set = append(set, hash)
+		}
+	}
+
+	sort.Slice(set, func(i, j int) bool {
+		return bytes.Compare(set[i][:], set[j][:]) < 0
+	})
+
+	return set
+}
+
+// contains returns true if the set matches all values matched by the given one
+func (s hashSet) contains(other hashSet) bool {
+	if s == nil {
+		return true
+	}
+
+	if other == nil {
+		return false
+	}
+
+	values := make(map[common.Hash]struct{}, len(s))
+	for _, hash := range s {
+		values[hash] = struct{}{}
+	}
+
+	for _, hash := range other {
+		if _, ok := values[hash]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s hashSet) equal(other hashSet) bool {
+	if (s == nil) != (other == nil) || len(s) != len(other) {
+		return false
+	}
+
+	for i := range s {
+		if s[i] != other[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// union returns the set matching the values of both sets
+func (s hashSet) union(other hashSet) hashSet {
+	if s == nil || other == nil {
+		return nil
+	}
+
+	return newHashSet(append(append([]common.Hash{}, s...), other...))
+}
+
+// logQuery is a precise logs filter: the contract addresses, then the values of each topic position
+type logQuery [1 + maxTopics]hashSet
+
+// contains returns true if the query matches all logs matched by the given one
+func (q logQuery) contains(other logQuery) bool {
+	for i := range q {
+		if !q[i].contains(other[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// merge returns the query matching exactly the logs of both queries, and false if there is none,
+// i.e. if the queries differ in more than one dimension.
+func (q logQuery) merge(other logQuery) (logQuery, bool) {
+	differing := -1
+	for i := range q {
+		if q[i].equal(other[i]) {
+			continue
+		}
+
+		if differing >= 0 {
+			return logQuery{}, false
+		}
+		differing = i
+	}
+
+	merged := q
+	if differing >= 0 {
+		merged[differing] = q[differing].union(other[differing])
+	}
+
+	return merged, true
+}
+
+// filterQuery returns the query for FilterLogs. Trailing topic positions matching any value are left
+// out, so that logs with less topics match.
+func (q logQuery) filterQuery() ethereum.FilterQuery {
+	var query ethereum.FilterQuery
+	for _, hash := range q[0] {
+		query.Addresses = append(query.Addresses, common.BytesToAddress(hash.Bytes()))
+	}
+
+	topics := q[1:]
+	for len(topics) > 0 && topics[len(topics)-1] == nil {
+		topics = topics[:len(topics)-1]
+	}
+
+	for _, values := range topics {
+		query.Topics = append(query.Topics, values)
+	}
+
+	return query
+}
+
+// key returns a string identifying the query, to order queries deterministically
+func (q logQuery) key() string {
+	var key bytes.Buffer
+	for _, set := range q {
+		if set == nil {
+			key.WriteString("*")
+		}
+
+		for _, hash := range set {
+			key.Write(hash.Bytes())
+		}
+
+		key.WriteString("/")
+	}
+
+	return key.String()
+}
+
+// logQueries returns the precise queries of the logs wanted by the subscription, one per event type
+func (s *eventSubscription) logQueries() []logQuery {
+	var addrs []common.Hash
+	for _, addr := range s.opts.Contracts {
+		addrs = append(addrs, common.BytesToHash(addr.Bytes()))
+	}
+
+	if len(s.opts.LogsWithTopics) == 0 {
+		return []logQuery{{newHashSet(addrs)}}
+	}
+
+	var queries []logQuery
+	for topic, values := range s.opts.LogsWithTopics {
+		query := logQuery{newHashSet(addrs)}
+
+		// The zero hash stands for any event type
+		if topic != zeroHash {
+			query[1] = newHashSet([]common.Hash{topic})
+		}
+
+		for i := 0; i < len(values) && i < maxTopics-1; i++ {
+			query[2+i] = newHashSet(values[i])
+		}
+
+		queries = append(queries, query)
+	}
+
+	return queries
+}
+
+// planLogQueries reduces the given queries to a minimal set of queries matching exactly the same logs:
+// queries matched by another one are dropped, and queries differing in a single dimension are merged.
+func planLogQueries(queries []logQuery) []logQuery {
+	planned := append([]logQuery{}, queries...)
+
+	for changed := true; changed; {
+		changed = false
+
+	search:
+		for i := 0; i < len(planned); i++ {
+			for j := 0; j < len(planned); j++ {
+				if i == j {
+					continue
+				}
+
+				if planned[i].contains(planned[j]) {
+					planned = append(planned[:j], planned[j+1:]...)
+					changed = true
+					break search
+				}
+
+				if merged, ok := planned[i].merge(planned[j]); ok {
+					planned[i] = merged
+					planned = append(planned[:j], planned[j+1:]...)
+					changed = true
+					break search
+				}
+			}
+		}
+	}
+
+	sort.Slice(planned, func(i, j int) bool {
+		return planned[i].key() < planned[j].key()
+	})
+
+	return planned
+}
+
+// buildQueries returns the minimal set of precise queries fetching the logs wanted by all event
+// subscriptions
+func (s *subscriptions) buildQueries() []ethereum.FilterQuery {
+	var queries []logQuery
+	for _, sub := range s.allEventSubscriptions() {
+		queries = append(queries, sub.logQueries()...)
+	}
+
+	var filterQueries []ethereum.FilterQuery
+	for _, query := range planLogQueries(queries) {
+		filterQueries = append(filterQueries, query.filterQuery())
+	}
+
+	return filterQueries
+}
+
+// fetchBlockLogs fetches the logs of the given block wanted by the event subscriptions, with the
+// planned queries. The logs matched by several queries are returned once, ordered by index.
+func (l *singleChainBroadcaster) fetchBlockLogs(ctx context.Context, header *types.Header) ([]types.Log, error) {
+	seen := make(map[uint]struct{})
+	var logs []types.Log
+	for _, query := range l.sbs.buildQueries() {
+		queryLogs, err := l.logFetcher.fetchBlock(ctx, query, header)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, log := range queryLogs {
+			if _, ok := seen[log.Index]; !ok {
+				seen[log.Index] = struct{}{}
+				logs = append(logs, log)
+			}
+		}
+	}
+
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].Index < logs[j].Index
+	})
+
+	return logs, nil
+}
@@ -0,0 +1,77 @@
+package broadcaster
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Subscriptions_BuildQueries(t *testing.T) {
+	contractA := common.HexToAddress("0x1")
+	contractB := common.HexToAddress("0x2")
+	topicA := common.HexToHash(testTriggerPerformanceEventID)
+	topicB := common.HexToHash(testPerformedEventID)
+	value := common.HexToHash("0x3")
+
+	buildQueries := func(opts ...EventOptions) []ethereum.FilterQuery {
+		sbs := newSubscriptions()
+		for i, o := range opts {
+			sbs.addEventSubscription(newEventSubscription(fmt.Sprintf("sub-%d", i), nil, o))
+		}
+
+		return sbs.buildQueries()
+	}
+
+	t.Run("merges the contracts of the same topics", func(t *testing.T) {
+		queries := buildQueries(
+			EventOptions{Contracts: []common.Address{contractA}, LogsWithTopics: map[common.Hash][][]common.Hash{topicA: {}}},
+			EventOptions{Contracts: []common.Address{contractB}, LogsWithTopics: map[common.Hash][][]common.Hash{topicA: {}}},
+		)
+
+		require.Equal(t, []ethereum.FilterQuery{{
+			Addresses: []common.Address{contractA, contractB},
+			Topics:    [][]common.Hash{{topicA}},
+		}}, queries)
+	})
+
+	t.Run("sends the topic values", func(t *testing.T) {
+		queries := buildQueries(
+			EventOptions{LogsWithTopics: map[common.Hash][][]common.Hash{topicB: {{}, {value}}}},
+		)
+
+		require.Equal(t, []ethereum.FilterQuery{{
+			Topics: [][]common.Hash{{topicB}, nil, {value}},
+		}}, queries)
+	})
+
+	t.Run("keeps incompatible queries apart", func(t *testing.T) {
+		queries := buildQueries(
+			EventOptions{Contracts: []common.Address{contractA}, LogsWithTopics: map[common.Hash][][]common.Hash{topicA: {}}},
+			EventOptions{
+				Contracts:      []common.Address{contractB},
+				LogsWithTopics: map[common.Hash][][]common.Hash{topicB: {{value}}},
+			},
+			EventOptions{Contracts: []common.Address{contractB}},
+		)
+
+		require.Equal(t, []ethereum.FilterQuery{{
+			Addresses: []common.Address{contractA},
+			Topics:    [][]common.Hash{{topicA}},
+		}, {
+			Addresses: []common.Address{contractB},
+		}}, queries)
+	})
+
+	t.Run("drops the queries matched by a wildcard one", func(t *testing.T) {
+		queries := buildQueries(
+			EventOptions{Contracts: []common.Address{contractA}, LogsWithTopics: map[common.Hash][][]common.Hash{topicA: {}}},
+			EventOptions{LogsWithTopics: map[common.Hash][][]common.Hash{zeroHash: {{value}}}},
+			EventOptions{},
+		)
+
+		require.Equal(t, []ethereum.FilterQuery{{}}, queries)
+	})
+}
@@ -0,0 +1,276 @@
+package broadcaster
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultQueueSize is the number of deliveries queued by subscriptions without one
+	DefaultQueueSize = 1000
+	// DefaultQueueConcurrency is the number of concurrent deliveries of subscriptions without one
+	DefaultQueueConcurrency = 1
+)
+
+var (
+	// errQueueFull is returned when a delivery is rejected by a full queue with the OverflowFail policy
+	errQueueFull = errors.New("delivery queue is full")
+	// errQueueClosed is returned when a delivery is queued after the subscription has been unregistered
+	errQueueClosed = errors.New("delivery queue is closed")
+	// errDeliveryDropped is returned when a queued delivery is dropped by the OverflowDropOldest policy
+	errDeliveryDropped = errors.New("delivery has been dropped from a full queue")
+)
+
+// OverflowPolicy defines what happens to a delivery queued while the queue of a subscription is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until the queue has room. It holds back the following blocks.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued delivery to make room
+	OverflowDropOldest
+	// OverflowFail rejects the delivery, it is dead-lettered
+	OverflowFail
+)
+
+// String returns the name of the policy
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop_oldest"
+	case OverflowFail:
+		return "fail"
+	default:
+		return "unknown"
+	}
+}
+
+// QueueOptions configures the delivery queue of a subscription
+type QueueOptions struct {
+	// Size is the maximum number of queued deliveries. Defaults to DefaultQueueSize.
+	Size int
+
+	// Concurrency is the number of deliveries running at once. 1 delivers strictly in order.
+	// Defaults to DefaultQueueConcurrency.
+	Concurrency int
+
+	// Overflow is the policy applied when the queue is full. Defaults to OverflowBlock.
+	Overflow OverflowPolicy
+}
+
+func (o QueueOptions) withDefaults() QueueOptions {
+	if o.Size <= 0 {
+		o.Size = DefaultQueueSize
+	}
+
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultQueueConcurrency
+	}
+
+	return o
+}
+
+// delivery is a queued call of a subscriber. done is called once it has run or has been discarded.
+type delivery struct {
+	run  func()
+	done func()
+}
+
+// deliveryQueue delivers to a subscriber in order with a bounded buffer and a fixed number of workers
+type deliveryQueue struct {
+	opts     QueueOptions
+	jobs     chan delivery
+	stop     chan struct{}
+	stopOnce sync.Once
+	workers  sync.WaitGroup
+
+	// lock guards closed, pushes hold it for reading so that nothing is queued once closed is set
+	lock   sync.RWMutex
+	closed bool
+}
+
+// newDeliveryQueue creates a queue and starts its workers
+func newDeliveryQueue(opts QueueOptions) *deliveryQueue {
+	opts = opts.withDefaults()
+
+	q := &deliveryQueue{
+		opts: opts,
+		jobs: make(chan delivery, opts.Size),
+		stop: make(chan struct{}),
+	}
+
+	for i := 0; i < opts.Concurrency; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+
+	return q
+}
+
+func (q *deliveryQueue) work() {
+	defer q.workers.Done()
+
+	for {
+		select {
+		case d := <-q.jobs:
+			d.run()
+			d.done()
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// push queues the given delivery, applying the overflow policy if the queue is full. Returns true if
+// the queue was full. The delivery is not queued if an error is returned.
+func (q *deliveryQueue) push(d delivery) (bool, error) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	if q.closed {
+		return false, errQueueClosed
+	}
+
+	select {
+	case q.jobs <- d:
+		return false, nil
+	default:
+	}
+
+	switch q.opts.Overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case q.jobs <- d:
+				return true, nil
+			case dropped := <-q.jobs:
+				dropped.done()
+			}
+		}
+	case OverflowFail:
+		return true, errQueueFull
+	default:
+		select {
+		case q.jobs <- d:
+			return true, nil
+		case <-q.stop:
+			return true, errQueueClosed
+		}
+	}
+}
+
+// close stops the workers and discards the queued deliveries. Running deliveries are not waited for.
+func (q *deliveryQueue) close() {
+	q.stopOnce.Do(func() {
+		close(q.stop)
+
+		q.lock.Lock()
+		q.closed = true
+		q.lock.Unlock()
+
+		for {
+			select {
+			case d := <-q.jobs:
+				d.done()
+			default:
+				return
+			}
+		}
+	})
+}
+
+// wait waits for the workers to return after close
+func (q *deliveryQueue) wait() {
+	q.workers.Wait()
+}
+
+// enqueue queues the given delivery to the subscription with the given ID and reports overflows.
+// The delivery is not run if an error is returned.
+func (l *singleChainBroadcaster) enqueue(q *deliveryQueue, id string, d delivery) error {
+	overflow, err := q.push(d)
+	if overflow {
+		chainID := big.NewInt(0).SetUint64(l.chainID).String()
+		queueOverflowCounter.WithLabelValues(chainID, q.opts.Overflow.String()).Inc()
+		l.logger.WithFields(logrus.Fields{
+			"id":     id,
+			"policy": q.opts.Overflow.String(),
+		}).Warn("delivery queue of subscriber is full")
+	}
+
+	return err
+}
+
+// enqueueEvent queues the delivery of the given event to the given subscription. handlers, if not nil,
+// is done once the event has been delivered, dead-lettered or discarded.
+func (l *singleChainBroadcaster) enqueueEvent(
+	ctx context.Context,
+	s *eventSubscription,
+	event types.Log,
+	handlers deliveryTracker,
+) {
+	done := trackDelivery(handlers)
+	err := l.enqueue(s.queue, s.id, delivery{
+		run:  func() { l.deliverEvent(ctx, s, event) },
+		done: done,
+	})
+	if err != nil {
+		done()
+
+		if err == errQueueFull {
+			l.deadLetter(ctx, &DeadLetter{SubscriptionID: s.id, Event: &event}, 0, err)
+		}
+	}
+}
+
+// enqueueBlock queues the delivery of the given block to the given subscription. handlers, if not nil,
+// is done once the block has been delivered, dead-lettered or discarded.
+func (l *singleChainBroadcaster) enqueueBlock(
+	ctx context.Context,
+	s *blockSubscription,
+	header types.Header,
+	handlers deliveryTracker,
+) {
+	done := trackDelivery(handlers)
+	err := l.enqueue(s.queue, s.id, delivery{
+		run:  func() { l.deliverBlock(ctx, s, header) },
+		done: done,
+	})
+	if err != nil {
+		done()
+
+		if err == errQueueFull {
+			l.deadLetter(ctx, &DeadLetter{SubscriptionID: s.id, Header: &header}, 0, err)
+		}
+	}
+}
+
+// redeliver calls fn with retries through the given queue of the subscription with the given ID, and
+// waits for it. Returns the number of attempts and the last error.
+func (l *singleChainBroadcaster) redeliver(
+	ctx context.Context,
+	q *deliveryQueue,
+	id string,
+	opts RetryOptions,
+	fn func() error,
+) (int, error) {
+	var attempts int
+	err := errDeliveryDropped
+
+	done := make(chan struct{})
+	if qErr := l.enqueue(q, id, delivery{
+		run:  func() { attempts, err = retry(ctx, l.stop, opts, fn) },
+		done: func() { close(done) },
+	}); qErr != nil {
+		return 0, qErr
+	}
+	<-done
+
+	return attempts, err
+}
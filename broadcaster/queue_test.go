@@ -0,0 +1,187 @@
+package broadcaster
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SingleChainBroadcaster_OrderedDelivery(t *testing.T) {
+	env := newTestEnv(t)
+
+	var indexes []uint
+	var lock sync.Mutex
+	broadcaster := env.startBroadcaster(t, Options{}, func(broadcaster *singleChainBroadcaster) {
+		_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
+			// A slow handler must neither drop nor reorder the following events
+			time.Sleep(10 * time.Millisecond)
+
+			lock.Lock()
+			indexes = append(indexes, event.Index)
+			lock.Unlock()
+		}, EventOptions{})
+		require.NoError(t, err)
+	})
+
+	for i := 0; i < 5; i++ {
+		env.trigger(t)
+	}
+	env.backend.Commit()
+
+	gomega.NewWithT(t).Eventually(func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(indexes)
+	}).Should(gomega.Equal(5))
+
+	require.NoError(t, broadcaster.Stop())
+	require.Equal(t, []uint{0, 1, 2, 3, 4}, indexes)
+}
+
+func Test_SingleChainBroadcaster_BlockedSubscriber(t *testing.T) {
+	env := newTestEnv(t)
+	checkpoints := NewMemoryCheckpointStore()
+
+	var lock sync.Mutex
+	var blocked, free []uint64
+	release := make(chan struct{})
+	broadcaster := env.startBroadcaster(t, Options{Checkpoints: checkpoints}, func(broadcaster *singleChainBroadcaster) {
+		_, err := broadcaster.RegisterBlockHandler("blocked", testChainID, func(ctx context.Context, header types.Header) {
+			<-release
+
+			lock.Lock()
+			blocked = append(blocked, header.Number.Uint64())
+			lock.Unlock()
+		}, BlockOptions{})
+		require.NoError(t, err)
+
+		_, err = broadcaster.RegisterBlockHandler("free", testChainID, func(ctx context.Context, header types.Header) {
+			lock.Lock()
+			free = append(free, header.Number.Uint64())
+			lock.Unlock()
+		}, BlockOptions{})
+		require.NoError(t, err)
+	})
+
+	var releaseOnce sync.Once
+	t.Cleanup(func() {
+		releaseOnce.Do(func() { close(release) })
+	})
+
+	for i := 0; i < 3; i++ {
+		env.backend.Commit()
+	}
+
+	// The blocked subscriber holds back neither the other subscriber nor its checkpoint
+	gomega.NewWithT(t).Eventually(func() []uint64 {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]uint64(nil), free...)
+	}).Should(gomega.Equal([]uint64{1, 2, 3, 4}))
+
+	gomega.NewWithT(t).Eventually(func() uint64 {
+		checkpoint, _, err := checkpoints.GetCheckpoint(env.ctx, testChainID, BlockCheckpointKey("free"))
+		require.NoError(t, err)
+		return checkpoint
+	}).Should(gomega.Equal(uint64(4)))
+
+	// The chain checkpoint waits for the blocked subscriber
+	for _, key := range []string{ChainCheckpointKey, BlockCheckpointKey("blocked")} {
+		_, ok, err := checkpoints.GetCheckpoint(env.ctx, testChainID, key)
+		require.NoError(t, err)
+		require.False(t, ok, key)
+	}
+
+	releaseOnce.Do(func() { close(release) })
+	waitCheckpoint(t, broadcaster, 4)
+
+	lock.Lock()
+	require.Equal(t, []uint64{1, 2, 3, 4}, blocked)
+	lock.Unlock()
+
+	for _, key := range []string{ChainCheckpointKey, BlockCheckpointKey("blocked")} {
+		checkpoint, ok, err := checkpoints.GetCheckpoint(env.ctx, testChainID, key)
+		require.NoError(t, err)
+		require.True(t, ok, key)
+		require.Equal(t, uint64(4), checkpoint, key)
+	}
+}
+
+func Test_DeliveryQueue_Overflow(t *testing.T) {
+	// fill starts a delivery blocking the worker until release is closed, and queues another one
+	fill := func(t *testing.T, q *deliveryQueue) (release chan struct{}, ran *int32, done chan struct{}) {
+		running := make(chan struct{})
+		release = make(chan struct{})
+		ran = new(int32)
+		done = make(chan struct{})
+
+		_, err := q.push(delivery{run: func() {
+			close(running)
+			<-release
+		}, done: func() {}})
+		require.NoError(t, err)
+		<-running
+
+		overflow, err := q.push(delivery{run: func() { atomic.AddInt32(ran, 1) }, done: func() { close(done) }})
+		require.NoError(t, err)
+		require.False(t, overflow)
+
+		return release, ran, done
+	}
+
+	t.Run("drop oldest", func(t *testing.T) {
+		q := newDeliveryQueue(QueueOptions{Size: 1, Overflow: OverflowDropOldest})
+		release, oldestRan, oldestDone := fill(t, q)
+
+		var newestRan int32
+		newestDone := make(chan struct{})
+		overflow, err := q.push(delivery{
+			run:  func() { atomic.AddInt32(&newestRan, 1) },
+			done: func() { close(newestDone) },
+		})
+		require.NoError(t, err)
+		require.True(t, overflow)
+
+		close(release)
+		<-oldestDone
+		<-newestDone
+
+		q.close()
+		q.wait()
+
+		require.Equal(t, int32(0), atomic.LoadInt32(oldestRan))
+		require.Equal(t, int32(1), atomic.LoadInt32(&newestRan))
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		q := newDeliveryQueue(QueueOptions{Size: 1, Overflow: OverflowFail})
+		release, queuedRan, queuedDone := fill(t, q)
+
+		overflow, err := q.push(delivery{run: func() {}, done: func() {}})
+		require.Equal(t, errQueueFull, err)
+		require.True(t, overflow)
+
+		close(release)
+		<-queuedDone
+
+		q.close()
+		q.wait()
+
+		require.Equal(t, int32(1), atomic.LoadInt32(queuedRan))
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		q := newDeliveryQueue(QueueOptions{})
+		q.close()
+		q.wait()
+
+		_, err := q.push(delivery{run: func() {}, done: func() {}})
+		require.Equal(t, errQueueClosed, err)
+	})
+}
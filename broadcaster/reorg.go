@@ -0,0 +1,190 @@
+package broadcaster
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxReorgDepth is the number of recent blocks tracked to detect re-orgs
+const maxReorgDepth = 128
+
+// headTracker tracks the hashes of the recent canonical heads to detect re-orgs by parent hash continuity.
+// It is not safe for concurrent use.
+type headTracker struct {
+	client Client
+	hashes map[uint64]common.Hash
+	// last is the number of the last tracked head
+	last uint64
+}
+
+func newHeadTracker(client Client) *headTracker {
+	return &headTracker{
+		client: client,
+		hashes: make(map[uint64]common.Hash),
+	}
+}
+
+// hash returns the hash of the tracked head with the given number
+func (t *headTracker) hash(number uint64) (common.Hash, bool) {
+	hash, ok := t.hashes[number]
+	return hash, ok
+}
+
+// branch returns the headers to handle for the given head in ascending order. These are the given head
+// preceded by the heads missing since the last tracked one, or by the new canonical branch if the
+// given head re-organizes tracked heads. Missing heads are fetched by parent hash. Returns nil if the
+// given head is tracked already.
+func (t *headTracker) branch(ctx context.Context, head *types.Header) ([]*types.Header, error) {
+	if hash, ok := t.hashes[head.Number.Uint64()]; ok && hash == head.Hash() {
+		return nil, nil
+	}
+
+	branch := []*types.Header{head}
+	for current := head; len(t.hashes) > 0 && current.Number.Uint64() > 0; {
+		parentNumber := current.Number.Uint64() - 1
+
+		hash, ok := t.hashes[parentNumber]
+		if ok && hash == current.ParentHash {
+			break
+		}
+
+		// The parent is older than the tracked heads, the branch cannot be connected
+		if !ok && parentNumber <= t.last {
+			break
+		}
+
+		parent, err := t.client.HeaderByHash(ctx, current.ParentHash)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get the parent header of block %d", current.Number.Uint64())
+		}
+
+		branch = append(branch, parent)
+		current = parent
+	}
+
+	// Order by number
+	for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+		branch[i], branch[j] = branch[j], branch[i]
+	}
+
+	return branch, nil
+}
+
+// add tracks the given head as the last canonical one. Tracked heads with the same or higher number
+// are replaced.
+func (t *headTracker) add(head *types.Header) {
+	number := head.Number.Uint64()
+	for n := range t.hashes {
+		if n >= number || n+maxReorgDepth <= number {
+			delete(t.hashes, n)
+		}
+	}
+
+	t.hashes[number] = head.Hash()
+	t.last = number
+}
+
+// recordDelivered records the given event as delivered to the given subscription, so that the
+// subscription is notified if the block of the event is re-organized away.
+func (l *singleChainBroadcaster) recordDelivered(s *eventSubscription, event types.Log) {
+	if !s.opts.NotifyRemoved {
+		return
+	}
+
+	if _, ok := l.delivered[event.BlockNumber]; !ok {
+		l.delivered[event.BlockNumber] = make(map[*eventSubscription][]types.Log)
+	}
+
+	l.delivered[event.BlockNumber][s] = append(l.delivered[event.BlockNumber][s], event)
+}
+
+// rewind reverts the handled blocks from the given number on, which have been re-organized away.
+// Subscriptions asking for it receive the events delivered for these blocks again with Removed set,
+// latest first, queued before the new canonical blocks. The checkpoints are moved back, so that the new
+// canonical blocks are delivered.
+func (l *singleChainBroadcaster) rewind(ctx context.Context, number uint64) {
+	l.handleLock.Lock()
+	defer l.handleLock.Unlock()
+
+	l.logger.WithFields(logrus.Fields{
+		"from": number,
+		"to":   l.checkpoint,
+	}).Warn("chain re-organized, reverting handled blocks")
+	reorgCounter.WithLabelValues(big.NewInt(0).SetUint64(l.chainID).String()).Inc()
+
+	removed := make(map[*eventSubscription][]types.Log)
+	for n := l.checkpoint; n >= number && n > 0; n-- {
+		for s, events := range l.delivered[n] {
+			for i := len(events) - 1; i >= 0; i-- {
+				event := events[i]
+				event.Removed = true
+				removed[s] = append(removed[s], event)
+			}
+		}
+
+		delete(l.delivered, n)
+		delete(l.pending, n)
+	}
+
+	for s, events := range removed {
+		for _, event := range events {
+			l.enqueueEvent(ctx, s, event, nil)
+		}
+	}
+
+	// Move the checkpoints back
+	reverted := number - 1
+	l.checkpoint = reverted
+
+	checkpoints := make(map[string]uint64)
+	l.chainLock.Lock()
+	l.handledHead = reverted
+	if l.chainCheckpoint > reverted {
+		l.chainCheckpoint = reverted
+		checkpoints[ChainCheckpointKey] = reverted
+	}
+	l.chainLock.Unlock()
+
+	// The deliveries still queued for the reverted blocks do not move the checkpoints forward anymore
+	for _, s := range l.sbs.allEventSubscriptions() {
+		if s.checkpoint > reverted {
+			s.checkpoint = reverted
+
+			// Backfilling subscriptions checkpoint the chunks they delivered themselves
+			if !s.live {
+				checkpoints[EventCheckpointKey(s.id)] = reverted
+			}
+		}
+
+		if s.progress.revert(reverted) {
+			checkpoints[EventCheckpointKey(s.id)] = reverted
+		}
+	}
+
+	for _, s := range l.sbs.allBlockSubscriptions() {
+		if s.checkpoint > reverted {
+			s.checkpoint = reverted
+		}
+
+		if s.progress.revert(reverted) {
+			checkpoints[BlockCheckpointKey(s.id)] = reverted
+		}
+	}
+
+	for _, s := range l.sbs.allTransactionSubscriptions() {
+		if s.checkpoint > reverted {
+			s.checkpoint = reverted
+		}
+
+		if s.progress.revert(reverted) {
+			checkpoints[TransactionCheckpointKey(s.id)] = reverted
+		}
+	}
+
+	l.putCheckpoints(ctx, checkpoints)
+}
@@ -0,0 +1,76 @@
+package broadcaster
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SingleChainBroadcaster_Reorg(t *testing.T) {
+	env := newTestEnv(t)
+
+	type delivery struct {
+		block   uint64
+		hash    common.Hash
+		removed bool
+	}
+
+	var lock sync.Mutex
+	var events []delivery
+	var blocks []common.Hash
+	env.startBroadcaster(t, Options{}, func(broadcaster *singleChainBroadcaster) {
+		_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
+			lock.Lock()
+			events = append(events, delivery{block: event.BlockNumber, hash: event.BlockHash, removed: event.Removed})
+			lock.Unlock()
+		}, EventOptions{
+			NotifyRemoved: true,
+		})
+		require.NoError(t, err)
+
+		_, err = broadcaster.RegisterBlockHandler(testWfID, testChainID, func(ctx context.Context, header types.Header) {
+			lock.Lock()
+			blocks = append(blocks, header.Hash())
+			lock.Unlock()
+		}, BlockOptions{})
+		require.NoError(t, err)
+	})
+
+	parent := env.backend.Commit()
+
+	// Mine an event in the block 3
+	env.trigger(t)
+	orphaned := env.backend.Commit()
+
+	gomega.NewWithT(t).Eventually(func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(events)
+	}).Should(gomega.Equal(1))
+
+	// Re-organize the block 3 away and mine the event in the block 4 of the new branch
+	require.NoError(t, env.backend.Fork(env.ctx, parent))
+	env.backend.Commit()
+	env.trigger(t)
+	env.backend.Commit()
+	head := env.backend.Commit()
+
+	gomega.NewWithT(t).Eventually(func() common.Hash {
+		lock.Lock()
+		defer lock.Unlock()
+		return blocks[len(blocks)-1]
+	}).Should(gomega.Equal(head))
+
+	lock.Lock()
+	require.Len(t, events, 3)
+	require.Equal(t, delivery{block: 3, hash: orphaned}, events[0])
+	require.Equal(t, delivery{block: 3, hash: orphaned, removed: true}, events[1])
+	require.Equal(t, uint64(4), events[2].block)
+	require.False(t, events[2].removed)
+	lock.Unlock()
+}
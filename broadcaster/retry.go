@@ -0,0 +1,107 @@
+package broadcaster
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jpillora/backoff"
+)
+
+const (
+	// DefaultRetryMaxAttempts is the maximum number of delivery attempts of subscriptions without one
+	DefaultRetryMaxAttempts = 5
+	// DefaultRetryMinBackoff is the delay before the first retry of subscriptions without one
+	DefaultRetryMinBackoff = 100 * time.Millisecond
+	// DefaultRetryMaxBackoff is the maximum delay between retries of subscriptions without one
+	DefaultRetryMaxBackoff = 10 * time.Second
+	// DefaultRetryFactor is the backoff factor of subscriptions without one
+	DefaultRetryFactor = 2
+)
+
+// RetryOptions configures the retries of failed deliveries with exponential backoff
+type RetryOptions struct {
+	// MaxAttempts is the maximum number of delivery attempts, including the first one.
+	// Defaults to DefaultRetryMaxAttempts.
+	MaxAttempts int
+
+	// MinBackoff is the delay before the first retry. Defaults to DefaultRetryMinBackoff.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between retries. Defaults to DefaultRetryMaxBackoff.
+	MaxBackoff time.Duration
+
+	// Factor multiplies the delay after each retry. Defaults to DefaultRetryFactor.
+	Factor float64
+}
+
+func (o RetryOptions) withDefaults() RetryOptions {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = DefaultRetryMaxAttempts
+	}
+
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = DefaultRetryMinBackoff
+	}
+
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = DefaultRetryMaxBackoff
+	}
+
+	if o.Factor <= 0 {
+		o.Factor = DefaultRetryFactor
+	}
+
+	return o
+}
+
+// permanentError is an error which retrying does not fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// permanent marks the given error as permanent, so that the delivery is not retried
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// retry calls fn until it succeeds or the attempts are exhausted, waiting with exponential backoff in
+// between. It gives up early on permanent errors, or if ctx is done or stop is closed. Returns the number of attempts and the
+// last error.
+func retry(ctx context.Context, stop <-chan struct{}, opts RetryOptions, fn func() error) (int, error) {
+	opts = opts.withDefaults()
+	b := &backoff.Backoff{
+		Min:    opts.MinBackoff,
+		Max:    opts.MaxBackoff,
+		Factor: opts.Factor,
+		Jitter: true,
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= opts.MaxAttempts {
+			return attempt, err
+		}
+
+		var permanentErr *permanentError
+		if errors.As(err, &permanentErr) {
+			return attempt, err
+		}
+
+		select {
+		case <-time.After(b.Duration()):
+		case <-ctx.Done():
+			return attempt, err
+		case <-stop:
+			return attempt, err
+		}
+	}
+}
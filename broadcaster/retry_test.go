@@ -0,0 +1,104 @@
+package broadcaster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SingleChainBroadcaster_Retry(t *testing.T) {
+	retryOpts := RetryOptions{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+	}
+
+	t.Run("retry failed deliveries", func(t *testing.T) {
+		env := newTestEnv(t)
+		deadLetters := NewMemoryDeadLetterStore()
+
+		var attempts int32
+		broadcaster := env.startBroadcaster(t, Options{DeadLetters: deadLetters}, func(broadcaster *singleChainBroadcaster) {
+			_, err := broadcaster.RegisterEventErrHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) error {
+				if atomic.AddInt32(&attempts, 1) < 3 {
+					return errors.New("downstream failed")
+				}
+				return nil
+			}, EventOptions{
+				Retry: retryOpts,
+			})
+			require.NoError(t, err)
+		})
+
+		env.trigger(t)
+		env.backend.Commit()
+
+		gomega.NewWithT(t).Eventually(func() int32 {
+			return atomic.LoadInt32(&attempts)
+		}).Should(gomega.Equal(int32(3)))
+
+		require.NoError(t, broadcaster.Stop())
+
+		letters, err := deadLetters.GetDeadLetters(env.ctx, testChainID)
+		require.NoError(t, err)
+		require.Empty(t, letters)
+	})
+
+	t.Run("dead-letter exhausted deliveries and replay them", func(t *testing.T) {
+		env := newTestEnv(t)
+		deadLetters := NewMemoryDeadLetterStore()
+
+		var failing int32 = 1
+		var delivered []uint64
+		var lock sync.Mutex
+		broadcaster := env.startBroadcaster(t, Options{DeadLetters: deadLetters}, func(broadcaster *singleChainBroadcaster) {
+			_, err := broadcaster.RegisterBlockErrHandler(testWfID, testChainID, func(ctx context.Context, header types.Header) error {
+				if atomic.LoadInt32(&failing) == 1 {
+					return errors.New("downstream failed")
+				}
+
+				lock.Lock()
+				delivered = append(delivered, header.Number.Uint64())
+				lock.Unlock()
+				return nil
+			}, BlockOptions{
+				Retry: retryOpts,
+			})
+			require.NoError(t, err)
+		})
+
+		var letters []*DeadLetter
+		gomega.NewWithT(t).Eventually(func() int {
+			var err error
+			letters, err = deadLetters.GetDeadLetters(env.ctx, testChainID)
+			require.NoError(t, err)
+			return len(letters)
+		}).Should(gomega.Equal(1))
+
+		require.Equal(t, testWfID, letters[0].SubscriptionID)
+		require.Equal(t, uint64(1), letters[0].Header.Number.Uint64())
+		require.Equal(t, 3, letters[0].Attempts)
+		require.Equal(t, "downstream failed", letters[0].Error)
+
+		atomic.StoreInt32(&failing, 0)
+
+		replayed, err := broadcaster.ReplayDeadLetters(env.ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, replayed)
+
+		letters, err = deadLetters.GetDeadLetters(env.ctx, testChainID)
+		require.NoError(t, err)
+		require.Empty(t, letters)
+
+		lock.Lock()
+		require.Equal(t, []uint64{1}, delivered)
+		lock.Unlock()
+	})
+}
@@ -17,6 +17,15 @@ import (
 const (
 	headsChanSize        = 1000
 	blockUpdateThreshold = 2
+
+	// DefaultMaxLogsRange is the maximum number of blocks fetched by a single logs request
+	DefaultMaxLogsRange = 1000
+	// DefaultLogsConcurrency is the number of concurrent logs requests over large block ranges
+	DefaultLogsConcurrency = 4
+	// DefaultPendingTxConcurrency is the number of pending transactions fetched at once
+	DefaultPendingTxConcurrency = 8
+	// DefaultReceiptsConcurrency is the number of receipts of a block fetched at once
+	DefaultReceiptsConcurrency = 8
 )
 
 // Client represents the behavior of the on-chain data provider
@@ -29,6 +38,37 @@ type Client interface {
 type Options struct {
 	ChainID   uint64
 	BlockTime time.Duration
+
+	// Checkpoints persists the last fully handled blocks, so that the blocks mined while the broadcaster
+	// was down are replayed on Start. Optional, nothing is replayed if not set.
+	Checkpoints CheckpointStore
+
+	// MaxLogsRange is the maximum number of blocks fetched by a single FilterLogs request over large
+	// block ranges, e.g. when backfilling historical events. It should not exceed the range limit of
+	// the provider. Smaller ranges are used when the provider returns limit errors. Defaults to
+	// DefaultMaxLogsRange.
+	MaxLogsRange uint64
+
+	// LogsConcurrency is the number of FilterLogs requests running at once over large block ranges.
+	// Defaults to DefaultLogsConcurrency.
+	LogsConcurrency int
+
+	// PendingTransactions streams the pending transactions delivered to pending transaction handlers.
+	// Optional, pending transaction handlers cannot be registered if not set.
+	PendingTransactions PendingTxStreamer
+
+	// PendingTxConcurrency is the number of pending transactions fetched at once. Defaults to
+	// DefaultPendingTxConcurrency.
+	PendingTxConcurrency int
+
+	// ReceiptsConcurrency is the number of receipts of a block fetched at once for transaction
+	// subscriptions, if the provider does not support eth_getBlockReceipts. Defaults to
+	// DefaultReceiptsConcurrency.
+	ReceiptsConcurrency int
+
+	// DeadLetters keeps the events, blocks and transactions which could not be delivered after all
+	// retries. Optional, failed deliveries are dropped if not set.
+	DeadLetters DeadLetterStore
 }
 
 // singleChainBroadcaster implements Broadcaster interface.
@@ -41,8 +81,51 @@ type singleChainBroadcaster struct {
 	blockTime    time.Duration
 	sbs          *subscriptions
 	stop         chan struct{}
+	stopOnce     sync.Once
 	wg           sync.WaitGroup
 
+	checkpoints       CheckpointStore
+	logFetcher        *logFetcher
+	deadLetters       DeadLetterStore
+	pendingTxStreamer PendingTxStreamer
+	// pendingTxWorkers is the number of workers fetching pending transactions
+	pendingTxWorkers int
+	// receiptWorkers is the number of receipts of a block fetched at once
+	receiptWorkers int
+	// blockReceiptsUnsupported is set to 1 once the provider rejected eth_getBlockReceipts
+	blockReceiptsUnsupported int32
+	// fetchRetry configures the retries of the block bodies and receipts fetched for transaction
+	// subscriptions
+	fetchRetry RetryOptions
+
+	// handleLock is held while a block is handled. It guards the checkpoints of the broadcaster and of
+	// the subscriptions, so that backfilled subscriptions are handed over to live blocks atomically.
+	handleLock sync.Mutex
+	// startLock guards ctx, so that each backfill is started once
+	startLock sync.Mutex
+	// ctx is the context passed to Start, nil before
+	ctx context.Context
+	// checkpoint is the last block queued to all live subscriptions, only written by the heads loop
+	checkpoint uint64
+	// chainLock guards the chain checkpoint, which the queue workers move forward too
+	chainLock sync.Mutex
+	// handledHead is the checkpoint as seen by the queue workers
+	handledHead uint64
+	// chainCheckpoint is the last stored chain checkpoint, the last head fully handled by all live
+	// subscriptions
+	chainCheckpoint uint64
+	// progressed is signaled when the checkpoint of a subscription has moved forward
+	progressed chan struct{}
+	// pending buffers the handled blocks by number until they are deep enough for all subscriptions
+	pending map[uint64]*pendingBlock
+	// delivered records the events delivered by block number, to notify removals on re-orgs
+	delivered map[uint64]map[*eventSubscription][]types.Log
+	// tracker tracks the handled blocks to detect re-orgs, only accessed by the heads loop
+	tracker *headTracker
+	// handled is closed once the first block has been handled or a checkpoint has been loaded
+	handled     chan struct{}
+	handledOnce sync.Once
+
 	lastHeadLock      sync.Mutex
 	lastHead          *big.Int
 	lastHeadUpdatedAt time.Time
@@ -55,6 +138,22 @@ func NewSingleChain(
 	headStreamer HeadStreamer,
 	opts Options,
 ) (Broadcaster, error) {
+	if opts.MaxLogsRange == 0 {
+		opts.MaxLogsRange = DefaultMaxLogsRange
+	}
+
+	if opts.LogsConcurrency <= 0 {
+		opts.LogsConcurrency = DefaultLogsConcurrency
+	}
+
+	if opts.PendingTxConcurrency <= 0 {
+		opts.PendingTxConcurrency = DefaultPendingTxConcurrency
+	}
+
+	if opts.ReceiptsConcurrency <= 0 {
+		opts.ReceiptsConcurrency = DefaultReceiptsConcurrency
+	}
+
 	return &singleChainBroadcaster{
 		logger:            logger,
 		client:            client,
@@ -63,6 +162,17 @@ func NewSingleChain(
 		blockTime:         opts.BlockTime,
 		sbs:               newSubscriptions(),
 		stop:              make(chan struct{}),
+		checkpoints:       opts.Checkpoints,
+		logFetcher:        newLogFetcher(logger, client, opts.ChainID, opts.MaxLogsRange, opts.LogsConcurrency),
+		deadLetters:       opts.DeadLetters,
+		pendingTxStreamer: opts.PendingTransactions,
+		pendingTxWorkers:  opts.PendingTxConcurrency,
+		receiptWorkers:    opts.ReceiptsConcurrency,
+		pending:           make(map[uint64]*pendingBlock),
+		delivered:         make(map[uint64]map[*eventSubscription][]types.Log),
+		tracker:           newHeadTracker(client),
+		handled:           make(chan struct{}),
+		progressed:        make(chan struct{}, 1),
 		lastHead:          big.NewInt(0),
 		lastHeadUpdatedAt: time.Now(),
 	}, nil
@@ -70,13 +180,29 @@ func NewSingleChain(
 
 // RegisterEventHandler registers the given handler using the given events filters
 func (l *singleChainBroadcaster) RegisterEventHandler(id string, chainID uint64, handler HandleEventFunc, opts EventOptions) (func(), error) {
+	return l.RegisterEventErrHandler(id, chainID, func(ctx context.Context, event types.Log) error {
+		handler(ctx, event)
+		return nil
+	}, opts)
+}
+
+// RegisterEventErrHandler registers the given handler which may fail using the given events filters
+func (l *singleChainBroadcaster) RegisterEventErrHandler(id string, chainID uint64, handler HandleEventErrFunc, opts EventOptions) (func(), error) {
 	if chainID != l.chainID {
 		return nil, fmt.Errorf("the given chain ID %d does not match with the broadcaster's one %d", chainID, l.chainID)
 	}
 
-	l.sbs.addEventSubscription(newEventSubscription(id, handler, opts))
+	s := newEventSubscription(id, handler, opts)
+
+	l.startLock.Lock()
+	l.sbs.addEventSubscription(s)
+	if !s.live && l.ctx != nil {
+		l.startBackfill(l.ctx, s)
+	}
+	l.startLock.Unlock()
 
 	return func() {
+		s.remove()
 		l.sbs.removeEventSubscriptions(id)
 		l.logger.WithField("id", id).Info("subscription has been unregistered")
 	}, nil
@@ -84,25 +210,100 @@ func (l *singleChainBroadcaster) RegisterEventHandler(id string, chainID uint64,
 
 // RegisterBlockHandler registers the given block handler
 func (l *singleChainBroadcaster) RegisterBlockHandler(id string, chainID uint64, handler HandleBlockFunc, opts BlockOptions) (func(), error) {
+	return l.RegisterBlockErrHandler(id, chainID, func(ctx context.Context, header types.Header) error {
+		handler(ctx, header)
+		return nil
+	}, opts)
+}
+
+// RegisterBlockErrHandler registers the given block handler which may fail
+func (l *singleChainBroadcaster) RegisterBlockErrHandler(id string, chainID uint64, handler HandleBlockErrFunc, opts BlockOptions) (func(), error) {
 	if chainID != l.chainID {
 		return nil, fmt.Errorf("the given chain ID %d does not match with the broadcaster's one %d", chainID, l.chainID)
 	}
 
-	l.sbs.addBlockSubscription(newBlockSubscription(id, handler, opts))
+	s := newBlockSubscription(id, handler, opts)
+	l.sbs.addBlockSubscription(s)
 
 	return func() {
+		s.queue.close()
 		l.sbs.removeBlockSubscriptions(id)
 		l.logger.WithField("id", id).Info("subscription has been unregistered")
 	}, nil
 }
 
-// Start starts broadcasting messages
+// Start starts broadcasting messages. If a checkpoint store is configured, the blocks mined since
+// the checkpoints are replayed before switching to live mode.
 func (l *singleChainBroadcaster) Start(ctx context.Context) error {
+	if err := l.loadCheckpoints(ctx); err != nil {
+		return err
+	}
+
+	// Backfill the historical events of the subscriptions registered so far
+	l.startLock.Lock()
+	l.ctx = ctx
+	for _, s := range l.sbs.allEventSubscriptions() {
+		if !s.live {
+			l.startBackfill(ctx, s)
+		}
+	}
+	l.startLock.Unlock()
+
 	// Start stream
 	l.headStreamer.Start(ctx)
 
+	if l.pendingTxStreamer != nil {
+		l.pendingTxStreamer.Start(ctx)
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			l.handlePendingTransactions(ctx)
+		}()
+	}
+
+	// Move the chain checkpoint forward as the subscriptions catch up
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+
+		for {
+			select {
+			case <-l.progressed:
+				l.saveChainCheckpoint(ctx)
+			case <-l.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	heads := make(chan *types.Header)
+	go func() {
+		for {
+			head, ok := l.headStreamer.Next()
+			if !ok {
+				return
+			}
+
+			select {
+			case heads <- head:
+			case <-l.stop:
+				return
+			}
+		}
+	}()
+
 	// Handle new heads
+	l.wg.Add(1)
 	go func() {
+		defer l.wg.Done()
+
+		if l.checkpoint > 0 {
+			l.replay(ctx)
+		}
+
 		for {
 			select {
 			case <-ctx.Done():
@@ -114,79 +315,66 @@ func (l *singleChainBroadcaster) Start(ctx context.Context) error {
 
 				return
 			case <-l.stop:
-				l.headStreamer.Stop()
-
 				return
-			default:
-				head := l.headStreamer.Next()
-
-				// Update the last handled head
-				l.lastHeadLock.Lock()
-				l.lastHead = new(big.Int).Set(head.Number)
-				l.lastHeadUpdatedAt = time.Now()
-				l.lastHeadLock.Unlock()
-
-				logger := l.logger.WithField("block", head.Number.String())
-				logger.Debug("got new block")
-
-				var errGroup errgroup.Group
-
-				// Call block subscribers
-				if l.sbs.existBlockSubscribers() {
-					errGroup.Go(func() error {
-						logger.Debug("found head subscribers for the current block")
-						l.handleBlock(ctx, *head)
-						return nil
-					})
-				}
+			case head := <-heads:
+				l.handleHead(ctx, head)
+			}
+		}
+	}()
 
-				// Call event subscribers
-				if l.sbs.existEventSubscribers() {
-					errGroup.Go(func() error {
-						filters := l.sbs.buildFilters()
-						filters.FromBlock = head.Number
-						filters.ToBlock = head.Number
+	return nil
+}
 
-						// Fetch logs from chain
-						logs, err := l.client.FilterLogs(ctx, filters)
-						if err != nil {
-							return errors.Wrap(err, "failed to filter logs for the current block")
-						}
+// Stop stops broadcasting. The queued deliveries are discarded, the running ones are waited for.
+func (l *singleChainBroadcaster) Stop() error {
+	var queues []*deliveryQueue
+	for _, s := range l.sbs.allEventSubscriptions() {
+		queues = append(queues, s.queue)
+	}
 
-						if len(logs) == 0 {
-							logger.Debug("no events for the block")
-							return nil
-						}
+	for _, s := range l.sbs.allBlockSubscriptions() {
+		queues = append(queues, s.queue)
+	}
 
-						logger.WithField("logs", len(logs)).Debug("found some events to be handled")
+	for _, s := range l.sbs.allTransactionSubscriptions() {
+		queues = append(queues, s.queue)
+	}
 
-						for _, log := range logs {
-							if log.Removed {
-								continue
-							}
+	for _, s := range l.sbs.allPendingTransactionSubscriptions() {
+		queues = append(queues, s.queue)
+	}
 
-							l.handleEvent(ctx, log)
-						}
+	l.stopOnce.Do(func() {
+		close(l.stop)
+		l.headStreamer.Stop()
 
-						return nil
-					})
-				}
+		if l.pendingTxStreamer != nil {
+			l.pendingTxStreamer.Stop()
+		}
 
-				if err := errGroup.Wait(); err != nil {
-					logger.Error(err)
-				}
-			}
+		for _, q := range queues {
+			q.close()
 		}
-	}()
+	})
+	l.wg.Wait()
+
+	for _, q := range queues {
+		q.wait()
+	}
 
 	return nil
 }
 
-// Stop stops broadcasting
-func (l *singleChainBroadcaster) Stop() error {
-	l.stop <- struct{}{}
-	l.wg.Wait()
-	return nil
+// isStopped returns true once the broadcaster is stopped or ctx is done
+func (l *singleChainBroadcaster) isStopped(ctx context.Context) bool {
+	select {
+	case <-l.stop:
+		return true
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
 }
 
 // Healthcheck performs a healthcheck
@@ -205,38 +393,446 @@ func (l *singleChainBroadcaster) isHeadsSubscriptionStuck() (bool, time.Duration
 	return lastUpdate > l.blockTime*blockUpdateThreshold*2, lastUpdate
 }
 
+// loadCheckpoints loads the checkpoints of the chain and of the registered subscriptions.
+// Subscriptions without a checkpoint start from the chain checkpoint.
+func (l *singleChainBroadcaster) loadCheckpoints(ctx context.Context) error {
+	if l.checkpoints == nil {
+		return nil
+	}
+
+	chainCheckpoint, ok, err := l.checkpoints.GetCheckpoint(ctx, l.chainID, ChainCheckpointKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the chain checkpoint")
+	}
+
+	if !ok {
+		l.logger.Info("no checkpoint found, starting from the current head")
+		return nil
+	}
+
+	l.chainCheckpoint = chainCheckpoint
+	l.handledHead = chainCheckpoint
+	l.checkpoint = chainCheckpoint
+	l.markHandled()
+
+	loadCheckpoint := func(key string, confirmations uint64) (uint64, error) {
+		checkpoint, ok, err := l.checkpoints.GetCheckpoint(ctx, l.chainID, key)
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to get the checkpoint %s", key)
+		}
+
+		if !ok {
+			checkpoint = confirmedNumber(chainCheckpoint, confirmations)
+		}
+
+		if checkpoint < l.checkpoint {
+			l.checkpoint = checkpoint
+		}
+
+		return checkpoint, nil
+	}
+
+	for _, s := range l.sbs.allEventSubscriptions() {
+		// Backfilled subscriptions load their checkpoints on their own
+		if !s.live {
+			continue
+		}
+
+		if s.checkpoint, err = loadCheckpoint(EventCheckpointKey(s.id), s.opts.Confirmations); err != nil {
+			return err
+		}
+		s.progress.reset(s.checkpoint)
+	}
+
+	for _, s := range l.sbs.allBlockSubscriptions() {
+		if s.checkpoint, err = loadCheckpoint(BlockCheckpointKey(s.id), s.opts.Confirmations); err != nil {
+			return err
+		}
+		s.progress.reset(s.checkpoint)
+	}
+
+	for _, s := range l.sbs.allTransactionSubscriptions() {
+		if s.checkpoint, err = loadCheckpoint(TransactionCheckpointKey(s.id), 0); err != nil {
+			return err
+		}
+		s.progress.reset(s.checkpoint)
+	}
+
+	l.logger.WithField("block", l.checkpoint).Info("resuming from checkpoint")
+
+	return nil
+}
+
+// replay handles the blocks mined since the checkpoint up to the current head
+func (l *singleChainBroadcaster) replay(ctx context.Context) {
+	head, err := l.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		failedGetHeaderByNumberCounter.WithLabelValues(big.NewInt(0).SetUint64(l.chainID).String()).Inc()
+		l.logger.WithError(err).Error("failed to get the current head to replay blocks")
+		return
+	}
+
+	l.logger.WithFields(logrus.Fields{
+		"from": l.checkpoint + 1,
+		"to":   head.Number.String(),
+	}).Info("replaying blocks since checkpoint")
+
+	l.handleHead(ctx, head)
+}
+
+// handleHead handles the given head along with the blocks between the checkpoint and the head.
+// Heads which have already been handled are skipped, re-organized blocks are reverted first.
+func (l *singleChainBroadcaster) handleHead(ctx context.Context, head *types.Header) {
+	logger := l.logger.WithField("block", head.Number.String())
+
+	// Without the hash of the checkpoint, e.g. after a restart, the missing blocks are fetched by number
+	if _, ok := l.tracker.hash(l.checkpoint); !ok {
+		l.catchUp(ctx, head)
+		return
+	}
+
+	headers, err := l.tracker.branch(ctx, head)
+	if err != nil {
+		failedGetHeaderByNumberCounter.WithLabelValues(big.NewInt(0).SetUint64(l.chainID).String()).Inc()
+		logger.WithError(err).Error("failed to get the canonical branch of the head")
+		return
+	}
+
+	if len(headers) == 0 {
+		logger.Debug("block has already been handled")
+		return
+	}
+
+	for _, header := range headers {
+		select {
+		case <-l.stop:
+			return
+		default:
+		}
+
+		if header.Number.Uint64() <= l.checkpoint {
+			l.rewind(ctx, header.Number.Uint64())
+		}
+
+		if err = l.handleHeader(ctx, *header); err != nil {
+			logger.WithError(err).WithField("branch", header.Number.String()).Error("failed to handle block")
+			return
+		}
+	}
+}
+
+// catchUp handles the given head along with the blocks between the checkpoint and the head, fetched
+// by number. Heads which have already been handled are skipped.
+func (l *singleChainBroadcaster) catchUp(ctx context.Context, head *types.Header) {
+	number := head.Number.Uint64()
+	logger := l.logger.WithField("block", head.Number.String())
+
+	if l.checkpoint > 0 && number <= l.checkpoint {
+		logger.Debug("block has already been handled")
+		return
+	}
+
+	// Handle the missing blocks first, the next head retries from the checkpoint on failure
+	for missing := l.checkpoint + 1; l.checkpoint > 0 && missing < number; missing++ {
+		select {
+		case <-l.stop:
+			return
+		default:
+		}
+
+		header, err := l.client.HeaderByNumber(ctx, big.NewInt(0).SetUint64(missing))
+		if err != nil {
+			failedGetHeaderByNumberCounter.WithLabelValues(big.NewInt(0).SetUint64(l.chainID).String()).Inc()
+			logger.WithError(err).WithField("missing", missing).Error("failed to get missing header")
+			return
+		}
+
+		if err = l.handleHeader(ctx, *header); err != nil {
+			logger.WithError(err).WithField("missing", missing).Error("failed to handle missing block")
+			return
+		}
+	}
+
+	if err := l.handleHeader(ctx, *head); err != nil {
+		logger.Error(err)
+	}
+}
+
+// handleHeader queues the deliveries of the given block and its events to the subscribers, and records
+// the block as handled. The checkpoint of each subscription is saved once its own deliveries are done,
+// the next block is handled meanwhile.
+func (l *singleChainBroadcaster) handleHeader(ctx context.Context, head types.Header) error {
+	// Update the last handled head
+	l.lastHeadLock.Lock()
+	l.lastHead = new(big.Int).Set(head.Number)
+	l.lastHeadUpdatedAt = time.Now()
+	l.lastHeadLock.Unlock()
+
+	logger := l.logger.WithField("block", head.Number.String())
+	logger.Debug("got new block")
+
+	l.handleLock.Lock()
+	defer l.handleLock.Unlock()
+
+	number := head.Number.Uint64()
+	l.initCheckpoints(number)
+
+	var (
+		errGroup errgroup.Group
+		logs     []types.Log
+		txs      *blockTransactions
+	)
+
+	// Fetch everything the block is delivered with before queueing any delivery, so that nothing is
+	// delivered twice if a fetch fails and the block is handled again
+	errGroup.Go(func() (err error) {
+		txs, err = l.fetchTransactions(ctx, head, l.transactionSubscriptions(head))
+		return err
+	})
+
+	if l.sbs.existEventSubscribers() {
+		errGroup.Go(func() error {
+			// Fetch the logs of exactly this block from chain
+			var err error
+			logs, err = l.fetchBlockLogs(ctx, &head)
+			return errors.Wrap(err, "failed to filter logs for the current block")
+		})
+	}
+
+	if err := errGroup.Wait(); err != nil {
+		return err
+	}
+
+	// Buffer the block for the subscriptions waiting for confirmations, and fetch the blocks which are
+	// deep enough now
+	l.pending[number] = &pendingBlock{header: head, logs: logs}
+	confirmed, err := l.fetchConfirmed(ctx, number)
+	if err != nil {
+		return err
+	}
+
+	queued := l.queueBlocks(ctx, number)
+
+	// Call block subscribers
+	if l.sbs.existBlockSubscribers() {
+		logger.Debug("found head subscribers for the current block")
+		l.handleBlock(ctx, head, queued)
+	}
+
+	// Call transaction subscribers
+	l.queueTransactions(ctx, txs, queued)
+
+	// Call event subscribers
+	if len(logs) > 0 {
+		logger.WithField("logs", len(logs)).Debug("found some events to be handled")
+	}
+
+	for _, log := range logs {
+		if log.Removed {
+			continue
+		}
+
+		l.handleEvent(ctx, log, queued)
+	}
+
+	l.queueConfirmed(ctx, confirmed, queued)
+
+	l.tracker.add(&head)
+	l.saveCheckpoint(ctx, number, queued)
+	l.prunePending(number)
+
+	return nil
+}
+
+// initCheckpoints sets the checkpoints of the live subscriptions registered after Start, so that they
+// receive the blocks from the given one on.
+func (l *singleChainBroadcaster) initCheckpoints(number uint64) {
+	if number == 0 {
+		return
+	}
+
+	for _, s := range l.sbs.allEventSubscriptions() {
+		if s.live && s.checkpoint == 0 {
+			s.checkpoint = number - 1
+			s.progress.reset(s.checkpoint)
+		}
+	}
+
+	for _, s := range l.sbs.allBlockSubscriptions() {
+		if s.checkpoint == 0 {
+			s.checkpoint = number - 1
+			s.progress.reset(s.checkpoint)
+		}
+	}
+
+	for _, s := range l.sbs.allTransactionSubscriptions() {
+		if s.checkpoint == 0 {
+			s.checkpoint = number - 1
+			s.progress.reset(s.checkpoint)
+		}
+	}
+}
+
+// queueBlocks starts tracking the deliveries of the block with the given number for the subscriptions
+// it moves forward. Subscriptions waiting for confirmations move forward to the block as deep as their
+// confirmations below it.
+func (l *singleChainBroadcaster) queueBlocks(ctx context.Context, number uint64) queuedBlocks {
+	queued := make(queuedBlocks)
+	queue := func(p *deliveryProgress, number uint64) {
+		queued[p] = p.queue(number, l.stop, func(number uint64) {
+			l.putCheckpoints(ctx, map[string]uint64{p.key: number})
+			l.notifyProgress()
+		})
+	}
+
+	for _, s := range l.sbs.allEventSubscriptions() {
+		if confirmed := confirmedNumber(number, s.opts.Confirmations); s.live && s.checkpoint < confirmed {
+			queue(s.progress, confirmed)
+		}
+	}
+
+	for _, s := range l.sbs.allBlockSubscriptions() {
+		if confirmed := confirmedNumber(number, s.opts.Confirmations); s.checkpoint < confirmed {
+			queue(s.progress, confirmed)
+		}
+	}
+
+	for _, s := range l.sbs.allTransactionSubscriptions() {
+		if s.checkpoint < number {
+			queue(s.progress, number)
+		}
+	}
+
+	return queued
+}
+
+// saveCheckpoint records the block with the given number as handled by the heads loop and seals the
+// blocks queued to the subscriptions.
+func (l *singleChainBroadcaster) saveCheckpoint(ctx context.Context, number uint64, queued queuedBlocks) {
+	l.checkpoint = number
+	l.markHandled()
+
+	for _, s := range l.sbs.allEventSubscriptions() {
+		if b, ok := queued[s.progress]; ok {
+			s.checkpoint = b.number
+		}
+	}
+
+	for _, s := range l.sbs.allBlockSubscriptions() {
+		if b, ok := queued[s.progress]; ok {
+			s.checkpoint = b.number
+		}
+	}
+
+	for _, s := range l.sbs.allTransactionSubscriptions() {
+		if b, ok := queued[s.progress]; ok {
+			s.checkpoint = b.number
+		}
+	}
+
+	for _, b := range queued {
+		b.Done()
+	}
+
+	l.chainLock.Lock()
+	l.handledHead = number
+	l.chainLock.Unlock()
+
+	l.saveChainCheckpoint(ctx)
+}
+
+// saveChainCheckpoint moves the chain checkpoint forward to the last head fully handled by all live
+// subscriptions
+func (l *singleChainBroadcaster) saveChainCheckpoint(ctx context.Context) {
+	l.chainLock.Lock()
+	defer l.chainLock.Unlock()
+
+	handled := l.handledHead
+	handledBy := func(p *deliveryProgress) {
+		if head, ok := p.handledHead(); ok && head < handled {
+			handled = head
+		}
+	}
+
+	for _, s := range l.sbs.allEventSubscriptions() {
+		handledBy(s.progress)
+	}
+
+	for _, s := range l.sbs.allBlockSubscriptions() {
+		handledBy(s.progress)
+	}
+
+	for _, s := range l.sbs.allTransactionSubscriptions() {
+		handledBy(s.progress)
+	}
+
+	if handled > l.chainCheckpoint {
+		l.chainCheckpoint = handled
+		l.putCheckpoints(ctx, map[string]uint64{ChainCheckpointKey: handled})
+	}
+}
+
+// notifyProgress signals that the checkpoint of a subscription has moved forward, so that the chain
+// checkpoint follows. It does not block.
+func (l *singleChainBroadcaster) notifyProgress() {
+	select {
+	case l.progressed <- struct{}{}:
+	default:
+	}
+}
+
+// putCheckpoints stores the given checkpoints if a checkpoint store is configured
+func (l *singleChainBroadcaster) putCheckpoints(ctx context.Context, checkpoints map[string]uint64) {
+	if l.checkpoints == nil || len(checkpoints) == 0 {
+		return
+	}
+
+	if err := l.checkpoints.PutCheckpoints(ctx, l.chainID, checkpoints); err != nil {
+		failedSaveCheckpointCounter.WithLabelValues(big.NewInt(0).SetUint64(l.chainID).String()).Inc()
+		l.logger.WithError(err).Error("failed to save checkpoints")
+	}
+}
+
+// markHandled signals that the broadcaster has a checkpoint to hand backfilled subscriptions over at
+func (l *singleChainBroadcaster) markHandled() {
+	l.handledOnce.Do(func() {
+		close(l.handled)
+	})
+}
+
 // handleEvent handles the given event
-func (l *singleChainBroadcaster) handleEvent(ctx context.Context, event types.Log) {
+func (l *singleChainBroadcaster) handleEvent(ctx context.Context, event types.Log, queued queuedBlocks) {
 	sbs := l.sbs.getEventSubscriptions(event)
 	if len(sbs) == 0 {
 		return
 	}
 
 	for _, s := range sbs {
-		l.wg.Add(1)
-		go func(s *eventSubscription) {
-			if err := s.execute(ctx, event); err != nil {
-				l.logger.WithError(err).Debug("failed to execute subscriber on event")
-			}
-			l.wg.Done()
-		}(s)
+		// Skip subscriptions which are still backfilling, wait for confirmations, have handled the
+		// block before a restart or do not want blocks this late
+		if !s.live || s.opts.Confirmations > 0 || s.checkpoint >= event.BlockNumber ||
+			!s.beforeToBlock(event.BlockNumber) {
+			continue
+		}
+
+		l.recordDelivered(s, event)
+		l.enqueueEvent(ctx, s, event, queued.of(s.progress))
 	}
 }
 
-// handleEvent handles the given event
-func (l *singleChainBroadcaster) handleBlock(ctx context.Context, header types.Header) {
+// handleBlock handles the given block
+func (l *singleChainBroadcaster) handleBlock(ctx context.Context, header types.Header, queued queuedBlocks) {
 	sbs := l.sbs.getBlockSubscriptions(header)
 	if len(sbs) == 0 {
 		return
 	}
 
 	for _, s := range sbs {
-		l.wg.Add(1)
-		go func(s *blockSubscription) {
-			if err := s.execute(ctx, header); err != nil {
-				l.logger.WithError(err).Debug("failed to execute subscriber on block")
-			}
-			l.wg.Done()
-		}(s)
+		// Skip subscriptions which wait for confirmations or have handled the block before a restart
+		if s.opts.Confirmations > 0 || s.checkpoint >= header.Number.Uint64() {
+			continue
+		}
+
+		l.enqueueBlock(ctx, s, header, queued.of(s.progress))
 	}
 }
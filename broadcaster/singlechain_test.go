@@ -2,9 +2,14 @@ package broadcaster
 
 import (
 	"context"
+	"errors"
 	"math/big"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
 	"github.com/ethereum/go-ethereum/common"
@@ -21,6 +26,7 @@ import (
 
 const (
 	testTriggerPerformanceEventID = "0xe5fc199a02ad9a3a02003f2440f5ea46b15b0a069c607e4bbbcde0fa705118b4"
+	testPerformedEventID          = "0xb55f31fdba783b65883517a934423678c525f9b6a83225968ffe3d0839988362"
 	testChainID                   = uint64(1337)
 	testWfID                      = "test-workflow"
 )
@@ -32,17 +38,11 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 	t.Run("successfully trigger subscriber on any event", func(t *testing.T) {
 		_, txOpts, simulatedBackend, testContract := initSimulatedBackend(ctx, t)
 
-		var consumed bool
-		broadcaster := &singleChainBroadcaster{
-			logger:  logger,
-			client:  simulatedBackend,
-			chainID: testChainID,
-			sbs:     newSubscriptions(),
-			stop:    make(chan struct{}),
-		}
+		var consumed atomic.Bool
+		broadcaster := newTestBroadcaster(t, logger, simulatedBackend, Options{})
 
 		_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
-			consumed = true
+			consumed.Store(true)
 		}, EventOptions{})
 		require.NoError(t, err)
 
@@ -58,7 +58,7 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 		require.NoError(t, err)
 
 		gomega.NewWithT(t).Eventually(func() bool {
-			return consumed
+			return consumed.Load()
 		}).Should(gomega.BeTrue())
 
 		err = broadcaster.Stop()
@@ -68,17 +68,11 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 	t.Run("successfully trigger subscriber on any event from the contract", func(t *testing.T) {
 		addr, txOpts, simulatedBackend, testContract := initSimulatedBackend(ctx, t)
 
-		var consumed bool
-		broadcaster := &singleChainBroadcaster{
-			logger:  logger,
-			client:  simulatedBackend,
-			chainID: testChainID,
-			sbs:     newSubscriptions(),
-			stop:    make(chan struct{}),
-		}
+		var consumed atomic.Bool
+		broadcaster := newTestBroadcaster(t, logger, simulatedBackend, Options{})
 
 		_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
-			consumed = true
+			consumed.Store(true)
 		}, EventOptions{
 			Contracts: []common.Address{addr},
 		})
@@ -96,7 +90,7 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 		require.NoError(t, err)
 
 		gomega.NewWithT(t).Eventually(func() bool {
-			return consumed
+			return consumed.Load()
 		}).Should(gomega.BeTrue())
 
 		err = broadcaster.Stop()
@@ -106,17 +100,11 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 	t.Run("successfully trigger subscriber on TriggerPerformance event from the contract", func(t *testing.T) {
 		addr, txOpts, simulatedBackend, testContract := initSimulatedBackend(ctx, t)
 
-		var consumed bool
-		broadcaster := &singleChainBroadcaster{
-			logger:  logger,
-			client:  simulatedBackend,
-			chainID: testChainID,
-			sbs:     newSubscriptions(),
-			stop:    make(chan struct{}),
-		}
+		var consumed atomic.Bool
+		broadcaster := newTestBroadcaster(t, logger, simulatedBackend, Options{})
 
 		_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
-			consumed = true
+			consumed.Store(true)
 		}, EventOptions{
 			Contracts: []common.Address{addr},
 			LogsWithTopics: map[common.Hash][][]common.Hash{
@@ -137,34 +125,26 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 		require.NoError(t, err)
 
 		gomega.NewWithT(t).Eventually(func() bool {
-			return consumed
+			return consumed.Load()
 		}).Should(gomega.BeTrue())
 
 		err = broadcaster.Stop()
 		require.NoError(t, err)
 	})
 
-	t.Run("successfully trigger subscriber on TriggerPerformance event from the contract and event value", func(t *testing.T) {
+	t.Run("successfully trigger subscriber on Performed event from the contract and event value", func(t *testing.T) {
 		addr, txOpts, simulatedBackend, testContract := initSimulatedBackend(ctx, t)
 
-		var consumed bool
-		broadcaster := &singleChainBroadcaster{
-			logger:  logger,
-			client:  simulatedBackend,
-			chainID: testChainID,
-			sbs:     newSubscriptions(),
-			stop:    make(chan struct{}),
-		}
+		var consumed atomic.Bool
+		broadcaster := newTestBroadcaster(t, logger, simulatedBackend, Options{})
 
 		_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
-			consumed = true
+			consumed.Store(true)
 		}, EventOptions{
 			Contracts: []common.Address{addr},
 			LogsWithTopics: map[common.Hash][][]common.Hash{
-				common.HexToHash(testTriggerPerformanceEventID): {
-					{},
-					{common.BytesToHash([]byte("qwe"))},
-					{},
+				common.HexToHash(testPerformedEventID): {
+					{common.BytesToHash(txOpts.From.Bytes())},
 				},
 			},
 		})
@@ -173,7 +153,7 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 		err = broadcaster.Start(ctx)
 		require.NoError(t, err)
 
-		tx, err := testContract.Trigger(txOpts, []byte("qwe"), true)
+		tx, err := testContract.Perform(txOpts, []byte("qwe"))
 		require.NoError(t, err)
 
 		simulatedBackend.Commit()
@@ -182,7 +162,7 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 		require.NoError(t, err)
 
 		gomega.NewWithT(t).Eventually(func() bool {
-			return consumed
+			return consumed.Load()
 		}).Should(gomega.BeTrue())
 
 		err = broadcaster.Stop()
@@ -192,24 +172,16 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 	t.Run("successfully trigger subscriber on any event from the contract and event value", func(t *testing.T) {
 		addr, txOpts, simulatedBackend, testContract := initSimulatedBackend(ctx, t)
 
-		var consumed bool
-		broadcaster := &singleChainBroadcaster{
-			logger:  logger,
-			client:  simulatedBackend,
-			chainID: testChainID,
-			sbs:     newSubscriptions(),
-			stop:    make(chan struct{}),
-		}
+		var consumed atomic.Bool
+		broadcaster := newTestBroadcaster(t, logger, simulatedBackend, Options{})
 
 		_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
-			consumed = true
+			consumed.Store(true)
 		}, EventOptions{
 			Contracts: []common.Address{addr},
 			LogsWithTopics: map[common.Hash][][]common.Hash{
 				zeroHash: {
-					{},
-					{common.BytesToHash([]byte("qwe"))},
-					{},
+					{common.BytesToHash(txOpts.From.Bytes())},
 				},
 			},
 		})
@@ -218,7 +190,7 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 		err = broadcaster.Start(ctx)
 		require.NoError(t, err)
 
-		tx, err := testContract.Trigger(txOpts, []byte("qwe"), true)
+		tx, err := testContract.Perform(txOpts, []byte("qwe"))
 		require.NoError(t, err)
 
 		simulatedBackend.Commit()
@@ -227,7 +199,7 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 		require.NoError(t, err)
 
 		gomega.NewWithT(t).Eventually(func() bool {
-			return consumed
+			return consumed.Load()
 		}).Should(gomega.BeTrue())
 
 		err = broadcaster.Stop()
@@ -237,23 +209,15 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 	t.Run("successfully trigger subscriber on event value", func(t *testing.T) {
 		_, txOpts, simulatedBackend, testContract := initSimulatedBackend(ctx, t)
 
-		var consumed bool
-		broadcaster := &singleChainBroadcaster{
-			logger:  logger,
-			client:  simulatedBackend,
-			chainID: testChainID,
-			sbs:     newSubscriptions(),
-			stop:    make(chan struct{}),
-		}
+		var consumed atomic.Bool
+		broadcaster := newTestBroadcaster(t, logger, simulatedBackend, Options{})
 
 		_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
-			consumed = true
+			consumed.Store(true)
 		}, EventOptions{
 			LogsWithTopics: map[common.Hash][][]common.Hash{
 				zeroHash: {
-					{},
-					{common.BytesToHash([]byte("qwe"))},
-					{},
+					{common.BytesToHash(txOpts.From.Bytes())},
 				},
 			},
 		})
@@ -262,7 +226,7 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 		err = broadcaster.Start(ctx)
 		require.NoError(t, err)
 
-		tx, err := testContract.Trigger(txOpts, []byte("qwe"), true)
+		tx, err := testContract.Perform(txOpts, []byte("qwe"))
 		require.NoError(t, err)
 
 		simulatedBackend.Commit()
@@ -271,7 +235,7 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 		require.NoError(t, err)
 
 		gomega.NewWithT(t).Eventually(func() bool {
-			return consumed
+			return consumed.Load()
 		}).Should(gomega.BeTrue())
 
 		err = broadcaster.Stop()
@@ -281,17 +245,11 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 	t.Run("wrong contract address provided", func(t *testing.T) {
 		_, txOpts, simulatedBackend, testContract := initSimulatedBackend(ctx, t)
 
-		var consumed bool
-		broadcaster := &singleChainBroadcaster{
-			logger:  logger,
-			client:  simulatedBackend,
-			chainID: testChainID,
-			sbs:     newSubscriptions(),
-			stop:    make(chan struct{}),
-		}
+		var consumed atomic.Bool
+		broadcaster := newTestBroadcaster(t, logger, simulatedBackend, Options{})
 
 		_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
-			consumed = true
+			consumed.Store(true)
 		}, EventOptions{
 			Contracts: []common.Address{common.HexToAddress("0x20dacbf83c5de6658e14cbf7bcae5c15eca2eedecf1c66fbca928e4d351bea0d")},
 		})
@@ -309,7 +267,7 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 		require.NoError(t, err)
 
 		gomega.NewWithT(t).Eventually(func() bool {
-			return consumed
+			return consumed.Load()
 		}).Should(gomega.BeFalse())
 
 		err = broadcaster.Stop()
@@ -319,17 +277,11 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 	t.Run("wrong topic hash provided", func(t *testing.T) {
 		addr, txOpts, simulatedBackend, testContract := initSimulatedBackend(ctx, t)
 
-		var consumed bool
-		broadcaster := &singleChainBroadcaster{
-			logger:  logger,
-			client:  simulatedBackend,
-			chainID: testChainID,
-			sbs:     newSubscriptions(),
-			stop:    make(chan struct{}),
-		}
+		var consumed atomic.Bool
+		broadcaster := newTestBroadcaster(t, logger, simulatedBackend, Options{})
 
 		_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
-			consumed = true
+			consumed.Store(true)
 		}, EventOptions{
 			Contracts: []common.Address{addr},
 			LogsWithTopics: map[common.Hash][][]common.Hash{
@@ -350,36 +302,26 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 		require.NoError(t, err)
 
 		gomega.NewWithT(t).Eventually(func() bool {
-			return consumed
+			return consumed.Load()
 		}).Should(gomega.BeFalse())
 
 		err = broadcaster.Stop()
 		require.NoError(t, err)
 	})
 
-	// TODO: This logic is not implemented yet
-	/*t.Run("wrong topic value provided", func(t *testing.T) {
+	t.Run("wrong topic value provided", func(t *testing.T) {
 		addr, txOpts, simulatedBackend, testContract := initSimulatedBackend(ctx, t)
 
-		var consumed bool
-		broadcaster := &singleChainBroadcaster{
-			logger:           logger,
-			client:           simulatedBackend,
-			chainID:          testChainID,
-			finalityDepth:    big.NewInt(0),
-			stop:             make(chan struct{}),
-			eventSubscribers: make(map[common.Address]map[common.Hash][]*eventSubscription),
-		}
-
-		err := broadcaster.RegisterEventHandler(testChainID, func(ctx context.Context, event types.Log) {
-			consumed = true
+		var consumed atomic.Bool
+		broadcaster := newTestBroadcaster(t, logger, simulatedBackend, Options{})
+
+		_, err := broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {
+			consumed.Store(true)
 		}, EventOptions{
 			Contracts: []common.Address{addr},
 			LogsWithTopics: map[common.Hash][][]common.Hash{
-				common.HexToHash(testTriggerPerformanceEventID): {
-					{},
+				common.HexToHash(testPerformedEventID): {
 					{common.BytesToHash([]byte("wrong"))},
-					{},
 				},
 			},
 		})
@@ -388,7 +330,7 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 		err = broadcaster.Start(ctx)
 		require.NoError(t, err)
 
-		tx, err := testContract.Trigger(txOpts, []byte("qwe"), true)
+		tx, err := testContract.Perform(txOpts, []byte("qwe"))
 		require.NoError(t, err)
 
 		simulatedBackend.Commit()
@@ -396,13 +338,13 @@ func Test_SingleChainBroadcaster_EventTrigger(t *testing.T) {
 		_, err = bind.WaitMined(ctx, simulatedBackend, tx)
 		require.NoError(t, err)
 
-		gomega.NewWithT(t).Eventually(func() bool {
-			return consumed
+		gomega.NewWithT(t).Consistently(func() bool {
+			return consumed.Load()
 		}).Should(gomega.BeFalse())
 
 		err = broadcaster.Stop()
 		require.NoError(t, err)
-	})*/
+	})
 }
 
 func Test_SingleChainBroadcaster_BlockTrigger(t *testing.T) {
@@ -412,17 +354,11 @@ func Test_SingleChainBroadcaster_BlockTrigger(t *testing.T) {
 	t.Run("each block trigger", func(t *testing.T) {
 		_, _, simulatedBackend, _ := initSimulatedBackend(ctx, t)
 
-		broadcaster := &singleChainBroadcaster{
-			logger:  logger,
-			client:  simulatedBackend,
-			chainID: testChainID,
-			sbs:     newSubscriptions(),
-			stop:    make(chan struct{}),
-		}
+		broadcaster := newTestBroadcaster(t, logger, simulatedBackend, Options{})
 
-		var consumed int
+		var consumed atomic.Int32
 		_, err := broadcaster.RegisterBlockHandler(testWfID, testChainID, func(ctx context.Context, header types.Header) {
-			consumed++
+			consumed.Add(1)
 		}, BlockOptions{
 			Number: EachBlockNumber(),
 		})
@@ -437,7 +373,7 @@ func Test_SingleChainBroadcaster_BlockTrigger(t *testing.T) {
 		simulatedBackend.Commit()
 
 		gomega.NewWithT(t).Eventually(func() bool {
-			return consumed == 3
+			return consumed.Load() == 3
 		}).Should(gomega.BeTrue())
 
 		err = broadcaster.Stop()
@@ -447,17 +383,11 @@ func Test_SingleChainBroadcaster_BlockTrigger(t *testing.T) {
 	t.Run("each second block trigger", func(t *testing.T) {
 		_, _, simulatedBackend, _ := initSimulatedBackend(ctx, t)
 
-		broadcaster := &singleChainBroadcaster{
-			logger:  logger,
-			client:  simulatedBackend,
-			chainID: testChainID,
-			sbs:     newSubscriptions(),
-			stop:    make(chan struct{}),
-		}
+		broadcaster := newTestBroadcaster(t, logger, simulatedBackend, Options{})
 
-		var consumed int
+		var consumed atomic.Int32
 		_, err := broadcaster.RegisterBlockHandler(testWfID, testChainID, func(ctx context.Context, header types.Header) {
-			consumed++
+			consumed.Add(1)
 		}, BlockOptions{
 			Number: BlockNumberMod(3),
 		})
@@ -474,7 +404,7 @@ func Test_SingleChainBroadcaster_BlockTrigger(t *testing.T) {
 		simulatedBackend.Commit()
 
 		gomega.NewWithT(t).Eventually(func() bool {
-			return consumed == 2
+			return consumed.Load() == 2
 		}).Should(gomega.BeTrue())
 
 		err = broadcaster.Stop()
@@ -482,6 +412,46 @@ func Test_SingleChainBroadcaster_BlockTrigger(t *testing.T) {
 	})
 }
 
+func newTestBroadcaster(t *testing.T, logger logrus.FieldLogger, client Client, opts Options) *singleChainBroadcaster {
+	t.Helper()
+
+	opts.ChainID = testChainID
+	opts.BlockTime = time.Second
+
+	broadcaster, err := NewSingleChain(logger, client, NewWSHeadStreamer(logger, client, testChainID), opts)
+	require.NoError(t, err)
+
+	return broadcaster.(*singleChainBroadcaster)
+}
+
+// newPollingTestBroadcaster creates a broadcaster polling heads, which does not miss the heads mined
+// before it is started unlike a new heads subscription.
+func newPollingTestBroadcaster(t *testing.T, logger logrus.FieldLogger, client Client, opts Options) *singleChainBroadcaster {
+	t.Helper()
+
+	opts.ChainID = testChainID
+	opts.BlockTime = time.Second
+
+	streamer := NewLongPollingHeadStreamer(logger, client, 10*time.Millisecond, testChainID)
+	broadcaster, err := NewSingleChain(logger, client, streamer, opts)
+	require.NoError(t, err)
+
+	return broadcaster.(*singleChainBroadcaster)
+}
+
+// startTestBroadcaster starts the given broadcaster and waits for the current head to be handled
+func startTestBroadcaster(ctx context.Context, t *testing.T, broadcaster *singleChainBroadcaster) {
+	t.Helper()
+
+	require.NoError(t, broadcaster.Start(ctx))
+
+	select {
+	case <-broadcaster.handled:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no block handled")
+	}
+}
+
 func initSimulatedBackend(ctx context.Context, t *testing.T) (common.Address, *bind.TransactOpts, *backends.SimulatedBackend, *contracts.Counter) {
 	t.Helper()
 
@@ -504,3 +474,128 @@ func initSimulatedBackend(ctx context.Context, t *testing.T) (common.Address, *b
 
 	return addr, txOpts, simulatedBackend, testContract
 }
+
+// testEnv is a simulated chain with the Counter contract deployed, shared by the broadcaster tests
+type testEnv struct {
+	ctx      context.Context
+	logger   logrus.FieldLogger
+	addr     common.Address
+	txOpts   *bind.TransactOpts
+	backend  *backends.SimulatedBackend
+	contract *contracts.Counter
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	ctx := context.Background()
+	addr, txOpts, simulatedBackend, testContract := initSimulatedBackend(ctx, t)
+
+	return &testEnv{
+		ctx:      ctx,
+		logger:   logrus.New(),
+		addr:     addr,
+		txOpts:   txOpts,
+		backend:  simulatedBackend,
+		contract: testContract,
+	}
+}
+
+// newBroadcaster creates a broadcaster polling the chain, stopped at the end of the test
+func (e *testEnv) newBroadcaster(t *testing.T, opts Options) *singleChainBroadcaster {
+	t.Helper()
+
+	broadcaster := newPollingTestBroadcaster(t, e.logger, e.backend, opts)
+	t.Cleanup(func() {
+		require.NoError(t, broadcaster.Stop())
+	})
+
+	return broadcaster
+}
+
+// startBroadcaster creates a broadcaster polling the chain, registers the handlers with register, and
+// starts it. The broadcaster is stopped at the end of the test.
+func (e *testEnv) startBroadcaster(
+	t *testing.T,
+	opts Options,
+	register func(broadcaster *singleChainBroadcaster),
+) *singleChainBroadcaster {
+	t.Helper()
+
+	broadcaster := e.newBroadcaster(t, opts)
+	if register != nil {
+		register(broadcaster)
+	}
+	startTestBroadcaster(e.ctx, t, broadcaster)
+
+	return broadcaster
+}
+
+// trigger sends a transaction emitting a TriggerPerformance event, mined with the next commit
+func (e *testEnv) trigger(t *testing.T) *types.Transaction {
+	t.Helper()
+
+	tx, err := e.contract.Trigger(e.txOpts, []byte("qwe"), true)
+	require.NoError(t, err)
+
+	return tx
+}
+
+// waitCheckpoint waits for all subscribers to have handled the chain up to the given block
+func waitCheckpoint(t *testing.T, broadcaster *singleChainBroadcaster, number uint64) {
+	t.Helper()
+
+	gomega.NewWithT(t).Eventually(func() uint64 {
+		broadcaster.chainLock.Lock()
+		defer broadcaster.chainLock.Unlock()
+		return broadcaster.chainCheckpoint
+	}).Should(gomega.Equal(number))
+}
+
+// failingLogsClient fails the next logs request once failLogs is set
+type failingLogsClient struct {
+	*backends.SimulatedBackend
+
+	failLogs int32
+}
+
+func (c *failingLogsClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	if atomic.CompareAndSwapInt32(&c.failLogs, 1, 0) {
+		return nil, errors.New("logs unavailable")
+	}
+
+	return c.SimulatedBackend.FilterLogs(ctx, q)
+}
+
+func Test_SingleChainBroadcaster_FailedFetch(t *testing.T) {
+	env := newTestEnv(t)
+	client := &failingLogsClient{SimulatedBackend: env.backend}
+
+	var lock sync.Mutex
+	deliveries := make(map[uint64]int)
+	broadcaster := newPollingTestBroadcaster(t, env.logger, client, Options{})
+	defer func() {
+		require.NoError(t, broadcaster.Stop())
+	}()
+
+	_, err := broadcaster.RegisterBlockHandler(testWfID, testChainID, func(ctx context.Context, header types.Header) {
+		lock.Lock()
+		deliveries[header.Number.Uint64()]++
+		lock.Unlock()
+	}, BlockOptions{})
+	require.NoError(t, err)
+
+	_, err = broadcaster.RegisterEventHandler(testWfID, testChainID, func(ctx context.Context, event types.Log) {}, EventOptions{})
+	require.NoError(t, err)
+	startTestBroadcaster(env.ctx, t, broadcaster)
+
+	// The block 2 fails to be handled once, and is handled again with the next head
+	atomic.StoreInt32(&client.failLogs, 1)
+	env.backend.Commit()
+	env.backend.Commit()
+	waitCheckpoint(t, broadcaster, 3)
+
+	lock.Lock()
+	require.Equal(t, map[uint64]int{1: 1, 2: 1, 3: 1}, deliveries)
+	lock.Unlock()
+}
@@ -4,14 +4,57 @@ import (
 	"context"
 
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
 )
 
 const (
 	headersChanCap = 100
 )
 
+// HeadStreamer streams the canonical heads of a chain in ascending order, along with the heads missing
+// in between and the new canonical branch on re-orgs. A full stream holds the streamer back until the
+// consumer catches up, so that no block number is lost.
 type HeadStreamer interface {
 	Start(ctx context.Context)
 	Stop()
-	Next() *types.Header
+
+	// Next returns the next header, waiting for one. Returns false once the streamer is stopped.
+	Next() (*types.Header, bool)
+}
+
+// sendHeader sends the given header to the stream, waiting while the stream is full. Returns false if
+// the streamer is stopped or ctx is done meanwhile.
+func sendHeader(
+	ctx context.Context,
+	logger logrus.FieldLogger,
+	headers chan<- *types.Header,
+	stop <-chan struct{},
+	header *types.Header,
+) bool {
+	select {
+	case headers <- header:
+		return true
+	default:
+	}
+
+	logger.WithField("block", header.Number.String()).Warn("headers channel is full, waiting for the consumer")
+
+	select {
+	case headers <- header:
+		return true
+	case <-stop:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// nextHeader returns the next header of the stream, and false once the streamer is stopped
+func nextHeader(headers <-chan *types.Header, stop <-chan struct{}) (*types.Header, bool) {
+	select {
+	case header := <-headers:
+		return header, true
+	case <-stop:
+		return nil, false
+	}
 }
@@ -8,7 +8,6 @@ import (
 
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/sync/errgroup"
 )
 
 type longPollingHeadStreamer struct {
@@ -17,9 +16,11 @@ type longPollingHeadStreamer struct {
 	chainID uint64
 
 	longPollingTicker *time.Ticker
+	stop              chan struct{}
+	stopOnce          sync.Once
 
-	lastBlockNumber     *big.Int
-	lastBlockNumberLock sync.Mutex
+	// tracker detects missing and re-organized heads, only accessed by the polling loop
+	tracker *headTracker
 
 	headersChan chan *types.Header
 }
@@ -35,19 +36,23 @@ func NewLongPollingHeadStreamer(
 		client:            client,
 		chainID:           chainID,
 		longPollingTicker: time.NewTicker(blockTime),
-		lastBlockNumber:   big.NewInt(0),
+		stop:              make(chan struct{}),
+		tracker:           newHeadTracker(client),
 		headersChan:       make(chan *types.Header, headersChanCap),
 	}
 }
 
 func (lp *longPollingHeadStreamer) Start(ctx context.Context) {
 	go func() {
-		for range lp.longPollingTicker.C {
+		defer lp.longPollingTicker.Stop()
+
+		for {
 			select {
 			case <-ctx.Done():
-				lp.longPollingTicker.Stop()
 				return
-			default:
+			case <-lp.stop:
+				return
+			case <-lp.longPollingTicker.C:
 				// Get the latest block
 				header, err := lp.client.HeaderByNumber(ctx, nil)
 				if err != nil {
@@ -56,63 +61,33 @@ func (lp *longPollingHeadStreamer) Start(ctx context.Context) {
 					continue
 				}
 
-				lp.lastBlockNumberLock.Lock()
-				lastHeaderNumber := lp.lastBlockNumber.Uint64()
-				lp.lastBlockNumberLock.Unlock()
-				currentHeaderNumber := header.Number.Uint64()
-
-				if currentHeaderNumber <= lastHeaderNumber {
+				// Send the latest header to the stream along with the missing or re-organized ones
+				headers, err := lp.tracker.branch(ctx, header)
+				if err != nil {
+					lp.logger.WithError(err).Error("failed to get the canonical branch of the header")
+					failedGetHeaderByNumberCounter.WithLabelValues(big.NewInt(0).SetUint64(lp.chainID).String()).Inc()
 					continue
 				}
 
-				// if the difference between the last fetched block and the current one is more than 1, fallback headers
-				if blockDiff := currentHeaderNumber - lastHeaderNumber; lastHeaderNumber > 0 && blockDiff > 1 {
-					var errGrp errgroup.Group
-
-					for blockToFetch := lastHeaderNumber + 1; blockToFetch < currentHeaderNumber-1; blockToFetch++ {
-						blockToFetch := blockToFetch
-						errGrp.Go(func() error {
-							fallbackHeader, err := lp.client.HeaderByNumber(ctx, big.NewInt(0).SetUint64(blockToFetch))
-							if err != nil {
-								failedGetHeaderByNumberCounter.WithLabelValues(big.NewInt(0).SetUint64(lp.chainID).String()).Inc()
-								return err
-							}
-
-							select {
-							case lp.headersChan <- fallbackHeader:
-							default:
-								lp.logger.Warn("headers channel is full, skipping header")
-							}
-
-							return nil
-						})
-					}
-
-					if err = errGrp.Wait(); err != nil {
-						lp.logger.WithError(err).Error("failed to fallback headers")
+				// Polling is held back while the stream is full, the next poll fetches the missing heads
+				for _, header := range headers {
+					if !sendHeader(ctx, lp.logger, lp.headersChan, lp.stop, header) {
+						return
 					}
-				}
 
-				// Send the latest header to the stream
-				select {
-				case lp.headersChan <- header:
-				default:
-					lp.logger.Warn("headers channel is full, skipping header")
+					lp.tracker.add(header)
 				}
-
-				// Update the last handled block number
-				lp.lastBlockNumberLock.Lock()
-				lp.lastBlockNumber = big.NewInt(0).Set(header.Number)
-				lp.lastBlockNumberLock.Unlock()
 			}
 		}
 	}()
 }
 
 func (lp *longPollingHeadStreamer) Stop() {
-	lp.longPollingTicker.Stop()
+	lp.stopOnce.Do(func() {
+		close(lp.stop)
+	})
 }
 
-func (lp *longPollingHeadStreamer) Next() *types.Header {
-	return <-lp.headersChan
+func (lp *longPollingHeadStreamer) Next() (*types.Header, bool) {
+	return nextHeader(lp.headersChan, lp.stop)
 }
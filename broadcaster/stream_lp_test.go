@@ -0,0 +1,44 @@
+package broadcaster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LongPollingHeadStreamer_Backpressure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	env := newTestEnv(t)
+
+	streamer := NewLongPollingHeadStreamer(env.logger, env.backend, 10*time.Millisecond, testChainID)
+	streamer.Start(ctx)
+	defer streamer.Stop()
+
+	first, ok := streamer.Next()
+	require.True(t, ok)
+
+	// Mine more blocks than the stream holds while nobody consumes it
+	const mined = headersChanCap + 50
+	for i := 0; i < mined; i++ {
+		env.backend.Commit()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	last := first.Number.Uint64()
+	for last < first.Number.Uint64()+mined {
+		header, ok := streamer.Next()
+		require.True(t, ok)
+		require.Equal(t, last+1, header.Number.Uint64())
+
+		last = header.Number.Uint64()
+	}
+
+	streamer.Stop()
+
+	_, ok = streamer.Next()
+	require.False(t, ok)
+}
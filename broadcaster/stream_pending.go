@@ -0,0 +1,276 @@
+package broadcaster
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	pendingTxChanCap = 1000
+	// pendingTxSeenSize is the number of recent pending transaction hashes remembered to de-duplicate them
+	pendingTxSeenSize = 10000
+	// pendingTxResubscribeInterval is the time to wait before resubscribing after a subscription failure
+	pendingTxResubscribeInterval = 5 * time.Second
+	// pendingTxSubscribeRetryInterval is the time after which subscribing is tried again while polling a
+	// filter
+	pendingTxSubscribeRetryInterval = time.Minute
+	// pendingTxUninstallTimeout bounds the request uninstalling a filter no longer polled
+	pendingTxUninstallTimeout = 5 * time.Second
+)
+
+// PendingTxRPC is the behavior of the RPC client used to stream pending transactions. It is implemented
+// by client.RPCClient.
+type PendingTxRPC interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+	EthSubscribe(ctx context.Context, channel interface{}, args ...interface{}) (ethereum.Subscription, error)
+}
+
+// PendingTxStreamer streams the hashes of the transactions entering the mempool of a node
+type PendingTxStreamer interface {
+	Start(ctx context.Context)
+	Stop()
+
+	// Next returns the hash of the next pending transaction, each one once. Returns false once the
+	// streamer is stopped.
+	Next() (common.Hash, bool)
+}
+
+// recentHashes remembers a bounded number of recent hashes, forgetting the oldest ones first.
+// It is not safe for concurrent use.
+type recentHashes struct {
+	hashes map[common.Hash]struct{}
+	order  []common.Hash
+	next   int
+}
+
+func newRecentHashes(size int) *recentHashes {
+	return &recentHashes{
+		hashes: make(map[common.Hash]struct{}, size),
+		order:  make([]common.Hash, size),
+	}
+}
+
+// add remembers the given hash. Returns false if it is remembered already.
+func (r *recentHashes) add(hash common.Hash) bool {
+	if _, ok := r.hashes[hash]; ok {
+		return false
+	}
+
+	delete(r.hashes, r.order[r.next])
+	r.order[r.next] = hash
+	r.next = (r.next + 1) % len(r.order)
+	r.hashes[hash] = struct{}{}
+
+	return true
+}
+
+type rpcPendingTxStreamer struct {
+	logger       logrus.FieldLogger
+	rpc          PendingTxRPC
+	chainID      uint64
+	pollInterval time.Duration
+	stop         chan struct{}
+	stopOnce     sync.Once
+
+	resubscribeInterval    time.Duration
+	subscribeRetryInterval time.Duration
+
+	// seen de-duplicates hashes, only accessed by the streaming loop
+	seen *recentHashes
+
+	hashesChan chan common.Hash
+}
+
+// NewPendingTxStreamer creates a PendingTxStreamer which subscribes to newPendingTransactions, and falls
+// back to polling a pending transaction filter with the given interval if the node does not support
+// subscriptions, e.g. over HTTP.
+func NewPendingTxStreamer(
+	logger logrus.FieldLogger,
+	rpc PendingTxRPC,
+	pollInterval time.Duration,
+	chainID uint64,
+) PendingTxStreamer {
+	return &rpcPendingTxStreamer{
+		logger:       logger,
+		rpc:          rpc,
+		chainID:      chainID,
+		pollInterval: pollInterval,
+		stop:         make(chan struct{}),
+		seen:         newRecentHashes(pendingTxSeenSize),
+		hashesChan:   make(chan common.Hash, pendingTxChanCap),
+
+		resubscribeInterval:    pendingTxResubscribeInterval,
+		subscribeRetryInterval: pendingTxSubscribeRetryInterval,
+	}
+}
+
+func (s *rpcPendingTxStreamer) Start(ctx context.Context) {
+	go func() {
+		for {
+			subscribed, err := s.subscribe(ctx)
+			if s.stopped(ctx) {
+				return
+			}
+
+			if !subscribed {
+				s.logger.WithError(err).Warn("failed to subscribe to pending transactions, polling a filter")
+				s.poll(ctx)
+				continue
+			}
+
+			if err != nil {
+				failedSubscribePendingTxCounter.WithLabelValues(big.NewInt(0).SetUint64(s.chainID).String()).Inc()
+				s.logger.WithError(err).Error("pending transactions subscription failed, resubscribing")
+			} else {
+				s.logger.Warn("pending transactions subscription ended, resubscribing")
+			}
+
+			select {
+			case <-time.After(s.resubscribeInterval):
+			case <-s.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (s *rpcPendingTxStreamer) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+func (s *rpcPendingTxStreamer) Next() (common.Hash, bool) {
+	select {
+	case hash := <-s.hashesChan:
+		return hash, true
+	case <-s.stop:
+		return common.Hash{}, false
+	}
+}
+
+// stopped returns true once the streamer is stopped or ctx is done
+func (s *rpcPendingTxStreamer) stopped(ctx context.Context) bool {
+	select {
+	case <-s.stop:
+		return true
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// subscribe streams the hashes of a newPendingTransactions subscription until the streamer is stopped
+// or the subscription ends. Returns false if the subscription could not be created.
+func (s *rpcPendingTxStreamer) subscribe(ctx context.Context) (bool, error) {
+	ch := make(chan common.Hash, pendingTxChanCap)
+
+	sub, err := s.rpc.EthSubscribe(ctx, ch, "newPendingTransactions")
+	if err != nil {
+		return false, err
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case hash := <-ch:
+			if !s.send(ctx, hash) {
+				return true, nil
+			}
+		case err := <-sub.Err():
+			return true, err
+		case <-s.stop:
+			return true, nil
+		case <-ctx.Done():
+			return true, nil
+		}
+	}
+}
+
+// poll streams the hashes of a pending transaction filter until the streamer is stopped, or until it is
+// time to try subscribing again. The filter is created again if it fails, e.g. when the node dropped it,
+// and uninstalled once no longer polled.
+func (s *rpcPendingTxStreamer) poll(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	subscribeRetry := time.After(s.subscribeRetryInterval)
+
+	var filterID string
+	defer func() {
+		if filterID != "" {
+			s.uninstallFilter(filterID)
+		}
+	}()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-subscribeRetry:
+			return
+		case <-s.stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		if filterID == "" {
+			if err := s.rpc.CallContext(ctx, &filterID, "eth_newPendingTransactionFilter"); err != nil {
+				s.logger.WithError(err).Error("failed to create a pending transaction filter")
+				filterID = ""
+				continue
+			}
+		}
+
+		var hashes []common.Hash
+		if err := s.rpc.CallContext(ctx, &hashes, "eth_getFilterChanges", filterID); err != nil {
+			s.logger.WithError(err).Error("failed to get the changes of the pending transaction filter")
+			filterID = ""
+			continue
+		}
+
+		for _, hash := range hashes {
+			if !s.send(ctx, hash) {
+				return
+			}
+		}
+	}
+}
+
+// uninstallFilter uninstalls the given pending transaction filter. It does not depend on the context of
+// the streamer, which may be done already.
+func (s *rpcPendingTxStreamer) uninstallFilter(filterID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), pendingTxUninstallTimeout)
+	defer cancel()
+
+	var uninstalled bool
+	if err := s.rpc.CallContext(ctx, &uninstalled, "eth_uninstallFilter", filterID); err != nil {
+		s.logger.WithError(err).Warn("failed to uninstall the pending transaction filter")
+	}
+}
+
+// send sends the given hash to the stream unless it has been sent already, waiting while the stream is
+// full. Returns false if the streamer is stopped or ctx is done meanwhile.
+func (s *rpcPendingTxStreamer) send(ctx context.Context, hash common.Hash) bool {
+	if !s.seen.add(hash) {
+		return true
+	}
+
+	select {
+	case s.hashesChan <- hash:
+		return true
+	case <-s.stop:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
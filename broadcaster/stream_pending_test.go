@@ -0,0 +1,198 @@
+package broadcaster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/begmaroman/eth-services/client"
+)
+
+// The RPC client of the client package streams pending transactions
+var _ PendingTxRPC = (client.RPCClient)(nil)
+
+// fakePendingTxRPC streams the given batches of pending transaction hashes through a subscription, or
+// through a filter if subscriptions are not supported. Subscriptions end after a batch with
+// endSubscriptions.
+type fakePendingTxRPC struct {
+	lock             sync.Mutex
+	subscriptions    bool
+	endSubscriptions bool
+	batches          [][]common.Hash
+
+	subscribed  int
+	uninstalled []string
+}
+
+func (r *fakePendingTxRPC) nextBatch() []common.Hash {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.batches) == 0 {
+		return nil
+	}
+
+	batch := r.batches[0]
+	r.batches = r.batches[1:]
+	return batch
+}
+
+func (r *fakePendingTxRPC) CallContext(_ context.Context, result interface{}, method string, args ...interface{}) error {
+	switch method {
+	case "eth_newPendingTransactionFilter":
+		*result.(*string) = "0x1"
+	case "eth_getFilterChanges":
+		*result.(*[]common.Hash) = r.nextBatch()
+	case "eth_uninstallFilter":
+		r.lock.Lock()
+		r.uninstalled = append(r.uninstalled, args[0].(string))
+		r.lock.Unlock()
+
+		*result.(*bool) = true
+	default:
+		return fmt.Errorf("unexpected method %s", method)
+	}
+
+	return nil
+}
+
+func (r *fakePendingTxRPC) EthSubscribe(_ context.Context, channel interface{}, _ ...interface{}) (ethereum.Subscription, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.subscriptions {
+		return nil, errors.New("notifications not supported")
+	}
+	r.subscribed++
+
+	end := r.endSubscriptions
+	ch := channel.(chan common.Hash)
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		for batch := r.nextBatch(); batch != nil; batch = r.nextBatch() {
+			for _, hash := range batch {
+				select {
+				case ch <- hash:
+				case <-quit:
+					return nil
+				}
+			}
+
+			if end {
+				return nil
+			}
+		}
+
+		<-quit
+		return nil
+	}), nil
+}
+
+func Test_PendingTxStreamer(t *testing.T) {
+	ctx := context.Background()
+	h1, h2, h3 := common.HexToHash("0x1"), common.HexToHash("0x2"), common.HexToHash("0x3")
+
+	for _, subscriptions := range []bool{true, false} {
+		t.Run(fmt.Sprintf("subscriptions %t", subscriptions), func(t *testing.T) {
+			rpc := &fakePendingTxRPC{
+				subscriptions: subscriptions,
+				batches:       [][]common.Hash{{h1, h2}, {h2, h3}, {h1}},
+			}
+
+			streamer := NewPendingTxStreamer(logrus.New(), rpc, 10*time.Millisecond, testChainID)
+			streamer.Start(ctx)
+
+			// Duplicates are skipped
+			for _, expected := range []common.Hash{h1, h2, h3} {
+				hash, ok := streamer.Next()
+				require.True(t, ok)
+				require.Equal(t, expected, hash)
+			}
+
+			streamer.Stop()
+
+			_, ok := streamer.Next()
+			require.False(t, ok)
+		})
+	}
+}
+
+func Test_PendingTxStreamer_Resubscribe(t *testing.T) {
+	ctx := context.Background()
+	h1, h2, h3 := common.HexToHash("0x1"), common.HexToHash("0x2"), common.HexToHash("0x3")
+
+	t.Run("resubscribe when the subscription ends", func(t *testing.T) {
+		rpc := &fakePendingTxRPC{
+			subscriptions:    true,
+			endSubscriptions: true,
+			batches:          [][]common.Hash{{h1}, {h2}, {h3}},
+		}
+
+		streamer := NewPendingTxStreamer(logrus.New(), rpc, 10*time.Millisecond, testChainID)
+		streamer.(*rpcPendingTxStreamer).resubscribeInterval = time.Millisecond
+		streamer.Start(ctx)
+		defer streamer.Stop()
+
+		for _, expected := range []common.Hash{h1, h2, h3} {
+			hash, ok := streamer.Next()
+			require.True(t, ok)
+			require.Equal(t, expected, hash)
+		}
+
+		rpc.lock.Lock()
+		require.GreaterOrEqual(t, rpc.subscribed, 3)
+		rpc.lock.Unlock()
+	})
+
+	t.Run("uninstall the filter when subscribing again", func(t *testing.T) {
+		rpc := &fakePendingTxRPC{batches: [][]common.Hash{{h1}}}
+
+		streamer := NewPendingTxStreamer(logrus.New(), rpc, 10*time.Millisecond, testChainID)
+		streamer.(*rpcPendingTxStreamer).subscribeRetryInterval = 50 * time.Millisecond
+		streamer.Start(ctx)
+
+		hash, ok := streamer.Next()
+		require.True(t, ok)
+		require.Equal(t, h1, hash)
+
+		// Subscriptions become available, e.g. once the node is reachable over WebSocket
+		rpc.lock.Lock()
+		rpc.subscriptions = true
+		rpc.lock.Unlock()
+
+		gomega.NewWithT(t).Eventually(func() bool {
+			rpc.lock.Lock()
+			defer rpc.lock.Unlock()
+			return rpc.subscribed == 1 && len(rpc.uninstalled) == 1 && rpc.uninstalled[0] == "0x1"
+		}).Should(gomega.BeTrue())
+
+		streamer.Stop()
+	})
+
+	t.Run("uninstall the filter when stopped", func(t *testing.T) {
+		rpc := &fakePendingTxRPC{batches: [][]common.Hash{{h1}}}
+
+		streamer := NewPendingTxStreamer(logrus.New(), rpc, 10*time.Millisecond, testChainID)
+		streamer.Start(ctx)
+
+		_, ok := streamer.Next()
+		require.True(t, ok)
+
+		streamer.Stop()
+
+		gomega.NewWithT(t).Eventually(func() []string {
+			rpc.lock.Lock()
+			defer rpc.lock.Unlock()
+			return append([]string(nil), rpc.uninstalled...)
+		}).Should(gomega.Equal([]string{"0x1"}))
+	})
+}
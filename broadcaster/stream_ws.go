@@ -9,7 +9,6 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/sync/errgroup"
 )
 
 type wsHeadStreamer struct {
@@ -17,9 +16,11 @@ type wsHeadStreamer struct {
 	client  Client
 	chainID uint64
 	stop    chan struct{}
+	// stopOnce makes Stop safe to call more than once
+	stopOnce sync.Once
 
-	lastBlockNumber     *big.Int
-	lastBlockNumberLock sync.Mutex
+	// tracker detects missing and re-organized heads, only accessed by the subscription loop
+	tracker *headTracker
 
 	headersChan chan *types.Header
 }
@@ -30,17 +31,18 @@ func NewWSHeadStreamer(
 	chainID uint64,
 ) HeadStreamer {
 	return &wsHeadStreamer{
-		logger:          logger,
-		client:          client,
-		chainID:         chainID,
-		stop:            make(chan struct{}),
-		lastBlockNumber: big.NewInt(0),
-		headersChan:     make(chan *types.Header, headersChanCap),
+		logger:      logger,
+		client:      client,
+		chainID:     chainID,
+		stop:        make(chan struct{}),
+		tracker:     newHeadTracker(client),
+		headersChan: make(chan *types.Header, headersChanCap),
 	}
 }
 
 func (ws *wsHeadStreamer) Start(ctx context.Context) {
-	var ch chan *types.Header
+	// The channel is shared by all resubscriptions, so that the loop below never reads a stale one
+	ch := make(chan *types.Header, headsChanSize)
 
 	// Initialize a subscription
 	sub := event.ResubscribeErr(5*time.Second, func(ctx context.Context, err error) (event.Subscription, error) {
@@ -52,7 +54,6 @@ func (ws *wsHeadStreamer) Start(ctx context.Context) {
 
 		resubscribeNewHeadsSubscriptionCounter.WithLabelValues(big.NewInt(0).SetUint64(ws.chainID).String()).Inc()
 
-		ch = make(chan *types.Header, headsChanSize)
 		return ws.client.SubscribeNewHead(ctx, ch)
 	})
 
@@ -75,62 +76,34 @@ func (ws *wsHeadStreamer) Start(ctx context.Context) {
 
 				return
 			case header := <-ch:
-				ws.lastBlockNumberLock.Lock()
-				lastHeaderNumber := ws.lastBlockNumber.Uint64()
-				ws.lastBlockNumberLock.Unlock()
-				currentHeaderNumber := header.Number.Uint64()
-
-				if currentHeaderNumber <= lastHeaderNumber {
+				// Send the header to the stream along with the missing or re-organized ones
+				headers, err := ws.tracker.branch(ctx, header)
+				if err != nil {
+					ws.logger.WithError(err).Error("failed to get the canonical branch of the header")
 					continue
 				}
 
-				// if the difference between the last fetched block and the current one is more than 1, fallback headers
-				if blockDiff := currentHeaderNumber - lastHeaderNumber; lastHeaderNumber > 0 && blockDiff > 1 {
-					var errGrp errgroup.Group
-
-					for blockToFetch := lastHeaderNumber + 1; blockToFetch < currentHeaderNumber-1; blockToFetch++ {
-						blockToFetch := blockToFetch
-						errGrp.Go(func() error {
-							fallbackHeader, err := ws.client.HeaderByNumber(ctx, big.NewInt(0).SetUint64(blockToFetch))
-							if err != nil {
-								return err
-							}
-
-							select {
-							case ws.headersChan <- fallbackHeader:
-							default:
-								ws.logger.Warn("headers channel is full, skipping header")
-							}
-
-							return nil
-						})
-					}
-
-					if err := errGrp.Wait(); err != nil {
-						ws.logger.WithError(err).Error("failed to fallback headers")
+				// New heads queue up in ch while the stream is full. If the subscription overflows, it is
+				// resubscribed and the next head fetches the missing ones.
+				for _, header := range headers {
+					if !sendHeader(ctx, ws.logger, ws.headersChan, ws.stop, header) {
+						sub.Unsubscribe()
+						return
 					}
-				}
 
-				// Send the latest header to the stream
-				select {
-				case ws.headersChan <- header:
-				default:
-					ws.logger.Warn("headers channel is full, skipping header")
+					ws.tracker.add(header)
 				}
-
-				// Update the last handled block number
-				ws.lastBlockNumberLock.Lock()
-				ws.lastBlockNumber = big.NewInt(0).Set(header.Number)
-				ws.lastBlockNumberLock.Unlock()
 			}
 		}
 	}()
 }
 
 func (ws *wsHeadStreamer) Stop() {
-	ws.stop <- struct{}{}
+	ws.stopOnce.Do(func() {
+		close(ws.stop)
+	})
 }
 
-func (ws *wsHeadStreamer) Next() *types.Header {
-	return <-ws.headersChan
+func (ws *wsHeadStreamer) Next() (*types.Header, bool) {
+	return nextHeader(ws.headersChan, ws.stop)
 }
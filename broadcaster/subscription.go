@@ -2,7 +2,7 @@ package broadcaster
 
 import (
 	"context"
-	"errors"
+	"math/big"
 	"sync"
 	"sync/atomic"
 
@@ -18,6 +18,12 @@ type subscriptions struct {
 
 	blockSubscribersLock sync.Mutex
 	blockSubscribers     []*blockSubscription
+
+	transactionSubscribersLock sync.Mutex
+	transactionSubscribers     []*transactionSubscription
+
+	pendingTransactionSubscribersLock sync.Mutex
+	pendingTransactionSubscribers     []*transactionSubscription
 }
 
 func newSubscriptions() *subscriptions {
@@ -67,6 +73,46 @@ func (s *subscriptions) removeBlockSubscriptions(id string) {
 	}
 }
 
+func (s *subscriptions) addTransactionSubscription(ts *transactionSubscription) {
+	s.transactionSubscribersLock.Lock()
+	s.transactionSubscribers = append(s.transactionSubscribers, ts)
+	s.transactionSubscribersLock.Unlock()
+}
+
+func (s *subscriptions) removeTransactionSubscriptions(id string) {
+	s.transactionSubscribersLock.Lock()
+	defer s.transactionSubscribersLock.Unlock()
+
+	var subscribers []*transactionSubscription
+	for _, ts := range s.transactionSubscribers {
+		if ts.id != id {
+			subscribers = append(subscribers, ts)
+		}
+	}
+
+	s.transactionSubscribers = subscribers
+}
+
+func (s *subscriptions) addPendingTransactionSubscription(ts *transactionSubscription) {
+	s.pendingTransactionSubscribersLock.Lock()
+	s.pendingTransactionSubscribers = append(s.pendingTransactionSubscribers, ts)
+	s.pendingTransactionSubscribersLock.Unlock()
+}
+
+func (s *subscriptions) removePendingTransactionSubscriptions(id string) {
+	s.pendingTransactionSubscribersLock.Lock()
+	defer s.pendingTransactionSubscribersLock.Unlock()
+
+	var subscribers []*transactionSubscription
+	for _, ts := range s.pendingTransactionSubscribers {
+		if ts.id != id {
+			subscribers = append(subscribers, ts)
+		}
+	}
+
+	s.pendingTransactionSubscribers = subscribers
+}
+
 func (s *subscriptions) addEventSubscription(es *eventSubscription) {
 	s.eventSubscribersLock.Lock()
 	defer s.eventSubscribersLock.Unlock()
@@ -82,7 +128,6 @@ func (s *subscriptions) addEventSubscription(es *eventSubscription) {
 		}
 
 		if es.opts.LogsWithTopics != nil {
-			// TODO: Check values as well
 			for topic := range es.opts.LogsWithTopics {
 				if _, ok := s.eventSubscribers[addr][topic]; !ok {
 					s.eventSubscribers[addr][topic] = make([]*eventSubscription, 0)
@@ -105,20 +150,22 @@ func (s *subscriptions) getEventSubscriptions(event types.Log) []*eventSubscript
 
 	var sbs []*eventSubscription
 
-	// Exact match both by address and topic
-	subs, ok := s.eventSubscribers[event.Address][event.Topics[0]]
-	if ok {
-		sbs = append(sbs, subs...)
-	}
+	if len(event.Topics) > 0 {
+		// Exact match both by address and topic
+		subs, ok := s.eventSubscribers[event.Address][event.Topics[0]]
+		if ok {
+			sbs = append(sbs, subs...)
+		}
 
-	// Match by topic
-	subs, ok = s.eventSubscribers[zeroAddr][event.Topics[0]]
-	if ok {
-		sbs = append(sbs, subs...)
+		// Match by topic
+		subs, ok = s.eventSubscribers[zeroAddr][event.Topics[0]]
+		if ok {
+			sbs = append(sbs, subs...)
+		}
 	}
 
 	// Match by contract address
-	subs, ok = s.eventSubscribers[event.Address][zeroHash]
+	subs, ok := s.eventSubscribers[event.Address][zeroHash]
 	if ok {
 		sbs = append(sbs, subs...)
 	}
@@ -131,16 +178,19 @@ func (s *subscriptions) getEventSubscriptions(event types.Log) []*eventSubscript
 
 	s.eventSubscribersLock.Unlock()
 
+	// The logs of several planned queries are routed here, check the topic values as well. A subscription
+	// is found twice if it wants both the event type and any event.
+	seen := make(map[*eventSubscription]struct{})
 	var filteredSubscriptions []*eventSubscription
 	for _, sb := range sbs {
-		if len(sb.opts.LogsWithTopics) > 0 && len(event.Topics) > 1 {
-			topicValues := event.Topics[1:]
-			if !filtersContainValues(topicValues, sb.opts.LogsWithTopics[event.Topics[0]]) {
-				continue
-			}
+		if _, ok := seen[sb]; ok {
+			continue
 		}
+		seen[sb] = struct{}{}
 
-		filteredSubscriptions = append(filteredSubscriptions, sb)
+		if sb.matches(event) {
+			filteredSubscriptions = append(filteredSubscriptions, sb)
+		}
 	}
 
 	return filteredSubscriptions
@@ -166,27 +216,55 @@ func (s *subscriptions) removeEventSubscriptions(id string) {
 	}
 }
 
-func (s *subscriptions) buildFilters() ethereum.FilterQuery {
+// allEventSubscriptions returns all event subscriptions, each one once
+func (s *subscriptions) allEventSubscriptions() []*eventSubscription {
 	s.eventSubscribersLock.Lock()
-	var cntrcts []common.Address
-	var topics []common.Hash
-	for contract, topicsMap := range s.eventSubscribers {
-		for topic := range topicsMap {
-			if topic != zeroHash {
-				topics = append(topics, topic)
-			}
-		}
+	defer s.eventSubscribersLock.Unlock()
 
-		if contract != zeroAddr {
-			cntrcts = append(cntrcts, contract)
+	seen := make(map[*eventSubscription]struct{})
+	var sbs []*eventSubscription
+	for _, subss := range s.eventSubscribers {
+		for _, subs := range subss {
+			for _, sub := range subs {
+				if _, ok := seen[sub]; !ok {
+					seen[sub] = struct{}{}
+					sbs = append(sbs, sub)
+				}
+			}
 		}
 	}
-	s.eventSubscribersLock.Unlock()
 
-	return ethereum.FilterQuery{
-		Addresses: cntrcts,
-		Topics:    [][]common.Hash{topics},
-	}
+	return sbs
+}
+
+// allBlockSubscriptions returns all block subscriptions
+func (s *subscriptions) allBlockSubscriptions() []*blockSubscription {
+	s.blockSubscribersLock.Lock()
+	sbs := make([]*blockSubscription, len(s.blockSubscribers))
+	copy(sbs, s.blockSubscribers)
+	s.blockSubscribersLock.Unlock()
+
+	return sbs
+}
+
+// allTransactionSubscriptions returns all transaction subscriptions
+func (s *subscriptions) allTransactionSubscriptions() []*transactionSubscription {
+	s.transactionSubscribersLock.Lock()
+	sbs := make([]*transactionSubscription, len(s.transactionSubscribers))
+	copy(sbs, s.transactionSubscribers)
+	s.transactionSubscribersLock.Unlock()
+
+	return sbs
+}
+
+// allPendingTransactionSubscriptions returns all pending transaction subscriptions
+func (s *subscriptions) allPendingTransactionSubscriptions() []*transactionSubscription {
+	s.pendingTransactionSubscribersLock.Lock()
+	sbs := make([]*transactionSubscription, len(s.pendingTransactionSubscribers))
+	copy(sbs, s.pendingTransactionSubscribers)
+	s.pendingTransactionSubscribersLock.Unlock()
+
+	return sbs
 }
 
 func (s *subscriptions) existEventSubscribers() bool {
@@ -206,53 +284,142 @@ func (s *subscriptions) existBlockSubscribers() bool {
 }
 
 type eventSubscription struct {
-	id         string
-	inProgress int32
-	handler    HandleEventFunc
-	opts       EventOptions
+	id      string
+	handler HandleEventErrFunc
+	opts    EventOptions
+	queue   *deliveryQueue
+
+	// checkpoint is the last block queued to the subscription, 0 if unknown
+	checkpoint uint64
+	// progress advances the checkpoint of the subscription as its deliveries are done
+	progress *deliveryProgress
+	// live is set once the subscription receives events of new blocks, i.e. after the backfill
+	live bool
+	// removed is set to 1 once the subscription has been unregistered
+	removed int32
 }
 
-func newEventSubscription(id string, handler HandleEventFunc, opts EventOptions) *eventSubscription {
-	return &eventSubscription{
-		id:      id,
-		handler: handler,
-		opts:    opts,
+func newEventSubscription(id string, handler HandleEventErrFunc, opts EventOptions) *eventSubscription {
+	s := &eventSubscription{
+		id:       id,
+		handler:  handler,
+		opts:     opts,
+		queue:    newDeliveryQueue(opts.Queue),
+		progress: newDeliveryProgress(EventCheckpointKey(id), opts.Confirmations),
+		live:     opts.FromBlock == nil,
+	}
+
+	if opts.FromBlock != nil && opts.FromBlock.Sign() > 0 {
+		s.checkpoint = opts.FromBlock.Uint64() - 1
 	}
+
+	return s
 }
 
-func (s *eventSubscription) execute(ctx context.Context, event types.Log) error {
-	if s.inProgress == 1 {
-		return errors.New("subscriber is in progress")
+func (s *eventSubscription) remove() {
+	atomic.StoreInt32(&s.removed, 1)
+	s.queue.close()
+}
+
+func (s *eventSubscription) isRemoved() bool {
+	return atomic.LoadInt32(&s.removed) == 1
+}
+
+// beforeToBlock returns true if the subscription wants events of the block with the given number
+func (s *eventSubscription) beforeToBlock(number uint64) bool {
+	return s.opts.ToBlock == nil || number <= s.opts.ToBlock.Uint64()
+}
+
+// filterQuery returns the query to fetch the events of the subscription within the given blocks. The
+// query is precise if the subscription wants a single event type, the events are filtered by matches
+// otherwise.
+func (s *eventSubscription) filterQuery(from, to uint64) ethereum.FilterQuery {
+	var query ethereum.FilterQuery
+	if planned := planLogQueries(s.logQueries()); len(planned) == 1 {
+		query = planned[0].filterQuery()
+	} else {
+		var topics []common.Hash
+		for topic := range s.opts.LogsWithTopics {
+			topics = append(topics, topic)
+		}
+
+		// The zero hash stands for any event type
+		if _, ok := s.opts.LogsWithTopics[zeroHash]; ok {
+			topics = nil
+		}
+
+		query = logQuery{planned[0][0], newHashSet(topics)}.filterQuery()
+	}
+
+	query.FromBlock = big.NewInt(0).SetUint64(from)
+	query.ToBlock = big.NewInt(0).SetUint64(to)
+
+	return query
+}
+
+// matches returns true if the given event passes the filters of the subscription
+func (s *eventSubscription) matches(event types.Log) bool {
+	if len(s.opts.Contracts) > 0 {
+		var found bool
+		for _, addr := range s.opts.Contracts {
+			if addr == event.Address {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(s.opts.LogsWithTopics) > 0 {
+		var topicValues []common.Hash
+		if len(event.Topics) > 0 {
+			// Match the event type
+			if filters, ok := s.opts.LogsWithTopics[event.Topics[0]]; ok {
+				if filtersContainValues(event.Topics[1:], filters) {
+					return true
+				}
+			}
+
+			topicValues = event.Topics[1:]
+		}
+
+		// Match any event type
+		filters, ok := s.opts.LogsWithTopics[zeroHash]
+		return ok && filtersContainValues(topicValues, filters)
 	}
 
-	atomic.StoreInt32(&s.inProgress, 1)
-	s.handler(ctx, event)
-	atomic.StoreInt32(&s.inProgress, 0)
-	return nil
+	return true
+}
+
+func (s *eventSubscription) execute(ctx context.Context, event types.Log) error {
+	return s.handler(ctx, event)
 }
 
 type blockSubscription struct {
-	id         string
-	inProgress int32
-	handler    HandleBlockFunc
-	opts       BlockOptions
+	id      string
+	handler HandleBlockErrFunc
+	opts    BlockOptions
+	queue   *deliveryQueue
+
+	// checkpoint is the last block queued to the subscription, 0 if unknown
+	checkpoint uint64
+	// progress advances the checkpoint of the subscription as its deliveries are done
+	progress *deliveryProgress
 }
 
-func newBlockSubscription(id string, handler HandleBlockFunc, opts BlockOptions) *blockSubscription {
+func newBlockSubscription(id string, handler HandleBlockErrFunc, opts BlockOptions) *blockSubscription {
 	return &blockSubscription{
-		id:      id,
-		handler: handler,
-		opts:    opts,
+		id:       id,
+		handler:  handler,
+		opts:     opts,
+		queue:    newDeliveryQueue(opts.Queue),
+		progress: newDeliveryProgress(BlockCheckpointKey(id), opts.Confirmations),
 	}
 }
 
 func (s *blockSubscription) execute(ctx context.Context, header types.Header) error {
-	if s.inProgress == 1 {
-		return errors.New("subscriber is in progress")
-	}
-
-	atomic.StoreInt32(&s.inProgress, 1)
-	s.handler(ctx, header)
-	atomic.StoreInt32(&s.inProgress, 0)
-	return nil
+	return s.handler(ctx, header)
 }
@@ -0,0 +1,618 @@
+package broadcaster
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+)
+
+// Transaction is a mined or pending transaction delivered to transaction handlers
+type Transaction struct {
+	// Tx is the transaction
+	Tx *types.Transaction `json:"tx"`
+
+	// From is the sender of the transaction
+	From common.Address `json:"from"`
+
+	// Receipt is the receipt of the transaction if TransactionOptions.Receipts is set, nil otherwise
+	Receipt *types.Receipt `json:"receipt,omitempty"`
+
+	// Header is the header of the block including the transaction, nil if it is pending
+	Header *types.Header `json:"header,omitempty"`
+}
+
+// HandleTransactionFunc is the signature of a function to handle transactions which may fail.
+// Failed deliveries are retried and dead-lettered once the attempts are exhausted.
+type HandleTransactionFunc func(ctx context.Context, tx Transaction) error
+
+// TransactionOptions contains options to filter transactions. A transaction matches if it passes all
+// the given filters.
+type TransactionOptions struct {
+	// From contains the senders to receive transactions of. Optional.
+	From []common.Address
+
+	// To contains the recipients to receive transactions to. Contract creations never match. Optional.
+	To []common.Address
+
+	// Selectors contains the 4-byte method selectors of the calls to receive. Plain transfers never
+	// match. Optional.
+	Selectors [][4]byte
+
+	// MinValue is the minimum value transferred by the transactions to receive. Optional.
+	MinValue *big.Int
+
+	// Receipts makes the handler receive the receipt of each transaction along with it. The client
+	// must implement TransactionReceipt.
+	Receipts bool
+
+	// Retry configures the retries of failed deliveries
+	Retry RetryOptions
+
+	// Queue configures the queue the transactions are delivered through
+	Queue QueueOptions
+}
+
+// receiptReader is implemented by clients which fetch transaction receipts
+type receiptReader interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// rpcCaller is implemented by clients which call JSON-RPC methods, used to fetch all the receipts of a
+// block with eth_getBlockReceipts
+type rpcCaller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// methodNotFoundCode is the JSON-RPC error code of unknown methods
+const methodNotFoundCode = -32601
+
+// transactionReader is implemented by clients which fetch transactions by hash
+type transactionReader interface {
+	TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error)
+}
+
+type transactionSubscription struct {
+	id      string
+	handler HandleTransactionFunc
+	opts    TransactionOptions
+	queue   *deliveryQueue
+
+	// pending is true for the subscriptions of pending transactions
+	pending bool
+	// checkpoint is the last block queued to the subscription, 0 if unknown
+	checkpoint uint64
+	// progress advances the checkpoint of the subscription as its deliveries are done
+	progress *deliveryProgress
+}
+
+func newTransactionSubscription(id string, handler HandleTransactionFunc, opts TransactionOptions) *transactionSubscription {
+	return &transactionSubscription{
+		id:       id,
+		handler:  handler,
+		opts:     opts,
+		queue:    newDeliveryQueue(opts.Queue),
+		progress: newDeliveryProgress(TransactionCheckpointKey(id), 0),
+	}
+}
+
+// matches returns true if the given transaction sent by the given sender passes the filters of the
+// subscription
+func (s *transactionSubscription) matches(tx *types.Transaction, from common.Address) bool {
+	if len(s.opts.From) > 0 && !containsAddress(s.opts.From, from) {
+		return false
+	}
+
+	if len(s.opts.To) > 0 && (tx.To() == nil || !containsAddress(s.opts.To, *tx.To())) {
+		return false
+	}
+
+	if len(s.opts.Selectors) > 0 {
+		data := tx.Data()
+		if len(data) < 4 {
+			return false
+		}
+
+		var found bool
+		for _, selector := range s.opts.Selectors {
+			if bytes.Equal(data[:4], selector[:]) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return s.opts.MinValue == nil || tx.Value().Cmp(s.opts.MinValue) >= 0
+}
+
+func (s *transactionSubscription) execute(ctx context.Context, tx Transaction) error {
+	return s.handler(ctx, tx)
+}
+
+func containsAddress(addrs []common.Address, addr common.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RegisterTransactionHandler registers the given handler for the transactions passing the given filters
+func (l *singleChainBroadcaster) RegisterTransactionHandler(
+	id string,
+	chainID uint64,
+	handler HandleTransactionFunc,
+	opts TransactionOptions,
+) (func(), error) {
+	if chainID != l.chainID {
+		return nil, fmt.Errorf("the given chain ID %d does not match with the broadcaster's one %d", chainID, l.chainID)
+	}
+
+	if _, ok := l.client.(receiptReader); opts.Receipts && !ok {
+		return nil, errors.New("the client does not support fetching receipts")
+	}
+
+	s := newTransactionSubscription(id, handler, opts)
+	l.sbs.addTransactionSubscription(s)
+
+	return func() {
+		s.queue.close()
+		l.sbs.removeTransactionSubscriptions(id)
+		l.logger.WithField("id", id).Info("subscription has been unregistered")
+	}, nil
+}
+
+// blockTransactions are the transactions of a block fetched for transaction subscriptions
+type blockTransactions struct {
+	// deliveries are the transactions to deliver to each subscription
+	deliveries map[*transactionSubscription][]Transaction
+	// failures are the transactions which could not be fetched, to dead-letter
+	failures []transactionFailure
+}
+
+// transactionFailure is a transaction of a subscription which could not be fetched. Tx is nil if the
+// block body could not be fetched, the failure then stands for all the transactions of the block.
+type transactionFailure struct {
+	s        *transactionSubscription
+	tx       Transaction
+	attempts int
+	err      error
+}
+
+// transactionSubscriptions returns the transaction subscriptions which have not handled the given block
+func (l *singleChainBroadcaster) transactionSubscriptions(header types.Header) []*transactionSubscription {
+	var sbs []*transactionSubscription
+	for _, s := range l.sbs.allTransactionSubscriptions() {
+		// Skip subscriptions which have handled the block before a restart
+		if s.checkpoint < header.Number.Uint64() {
+			sbs = append(sbs, s)
+		}
+	}
+
+	return sbs
+}
+
+// fetchTransactions fetches the transactions of the given block matching the given subscriptions, with
+// their receipts if wanted. The block body is fetched by hash, so that the transactions belong to the
+// given header. Failed requests are retried, then recorded as failures of the subscriptions, so that
+// they do not hold back the block. Transactions whose sender cannot be derived are skipped. Returns an
+// error only if the broadcaster is stopped meanwhile.
+func (l *singleChainBroadcaster) fetchTransactions(
+	ctx context.Context,
+	header types.Header,
+	sbs []*transactionSubscription,
+) (*blockTransactions, error) {
+	txs := &blockTransactions{deliveries: make(map[*transactionSubscription][]Transaction)}
+	if len(sbs) == 0 {
+		return txs, nil
+	}
+
+	var block *types.Block
+	attempts, err := retry(ctx, l.stop, l.fetchRetry, func() (err error) {
+		block, err = l.client.BlockByHash(ctx, header.Hash())
+		if errors.Is(err, types.ErrTxTypeNotSupported) {
+			return permanent(err)
+		}
+		return err
+	})
+	if err != nil {
+		if l.isStopped(ctx) {
+			return nil, errors.Wrap(err, "failed to get the transactions of the current block")
+		}
+
+		for _, s := range sbs {
+			txs.failures = append(txs.failures, transactionFailure{
+				s:        s,
+				tx:       Transaction{Header: &header},
+				attempts: attempts,
+				err:      errors.Wrap(err, "failed to get the transactions of the block"),
+			})
+		}
+
+		return txs, nil
+	}
+
+	// The receipts are fetched at once for all the matching transactions of the block
+	type match struct {
+		tx   *types.Transaction
+		from common.Address
+		sbs  []*transactionSubscription
+	}
+	var (
+		matches       []match
+		receiptHashes []common.Hash
+	)
+	for _, tx := range block.Transactions() {
+		from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil {
+			logger := l.logger.WithError(err).WithField("tx", tx.Hash().Hex())
+			logger.Warn("failed to get the sender of transaction, skipping")
+			continue
+		}
+
+		m := match{tx: tx, from: from}
+		receipts := false
+		for _, s := range sbs {
+			if s.matches(tx, from) {
+				m.sbs = append(m.sbs, s)
+				receipts = receipts || s.opts.Receipts
+			}
+		}
+		if len(m.sbs) == 0 {
+			continue
+		}
+
+		matches = append(matches, m)
+		if receipts {
+			receiptHashes = append(receiptHashes, tx.Hash())
+		}
+	}
+
+	receipts, err := l.fetchReceipts(ctx, header, receiptHashes)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range matches {
+		for _, s := range m.sbs {
+			delivery := Transaction{Tx: m.tx, From: m.from, Header: &header}
+
+			if s.opts.Receipts {
+				result := receipts[m.tx.Hash()]
+				if result.err != nil {
+					txs.failures = append(txs.failures, transactionFailure{
+						s:        s,
+						tx:       delivery,
+						attempts: result.attempts,
+						err:      errors.Wrap(result.err, "failed to get the receipt of the transaction"),
+					})
+					continue
+				}
+
+				delivery.Receipt = result.receipt
+			}
+
+			txs.deliveries[s] = append(txs.deliveries[s], delivery)
+		}
+	}
+
+	return txs, nil
+}
+
+// receiptResult is the outcome of fetching the receipt of a transaction
+type receiptResult struct {
+	receipt  *types.Receipt
+	attempts int
+	err      error
+}
+
+// fetchReceipts fetches the receipts of the given transactions of the given block. All of them are
+// fetched with a single eth_getBlockReceipts call if the client supports it. The others are fetched
+// one by one with retries, by a bounded number of workers. An error is only returned if the broadcaster
+// has been stopped meanwhile, failed fetches are returned in the results.
+func (l *singleChainBroadcaster) fetchReceipts(
+	ctx context.Context,
+	header types.Header,
+	hashes []common.Hash,
+) (map[common.Hash]receiptResult, error) {
+	results := make(map[common.Hash]receiptResult, len(hashes))
+	if len(hashes) == 0 {
+		return results, nil
+	}
+
+	missing := hashes
+	if blockReceipts := l.fetchBlockReceipts(ctx, header); blockReceipts != nil {
+		missing = nil
+		for _, hash := range hashes {
+			if receipt, ok := blockReceipts[hash]; ok {
+				results[hash] = receiptResult{receipt: receipt, attempts: 1}
+			} else {
+				missing = append(missing, hash)
+			}
+		}
+	}
+
+	var (
+		lock    sync.Mutex
+		workers sync.WaitGroup
+		stopped error
+	)
+	queue := make(chan common.Hash)
+	for i := 0; i < l.receiptWorkers && i < len(missing); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			for hash := range queue {
+				var receipt *types.Receipt
+				attempts, err := retry(ctx, l.stop, l.fetchRetry, func() (err error) {
+					receipt, err = l.client.(receiptReader).TransactionReceipt(ctx, hash)
+					return err
+				})
+
+				lock.Lock()
+				if err != nil && l.isStopped(ctx) && stopped == nil {
+					stopped = errors.Wrapf(err, "failed to get the receipt of transaction %s", hash.Hex())
+				}
+				results[hash] = receiptResult{receipt: receipt, attempts: attempts, err: err}
+				lock.Unlock()
+			}
+		}()
+	}
+
+	for _, hash := range missing {
+		queue <- hash
+	}
+	close(queue)
+	workers.Wait()
+
+	if stopped != nil {
+		return nil, stopped
+	}
+	return results, nil
+}
+
+// fetchBlockReceipts returns the receipts of the given block by transaction hash, or nil if the
+// client cannot fetch them at once. Providers which do not support eth_getBlockReceipts are not asked
+// again.
+func (l *singleChainBroadcaster) fetchBlockReceipts(ctx context.Context, header types.Header) map[common.Hash]*types.Receipt {
+	caller, ok := l.client.(rpcCaller)
+	if !ok || atomic.LoadInt32(&l.blockReceiptsUnsupported) == 1 {
+		return nil
+	}
+
+	var receipts []*types.Receipt
+	if err := caller.CallContext(ctx, &receipts, "eth_getBlockReceipts", header.Hash()); err != nil {
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == methodNotFoundCode {
+			atomic.StoreInt32(&l.blockReceiptsUnsupported, 1)
+			l.logger.Info("eth_getBlockReceipts is not supported, fetching the receipts one by one")
+			return nil
+		}
+
+		l.logger.WithError(err).Warn("failed to get the receipts of the block, fetching them one by one")
+		return nil
+	}
+
+	byHash := make(map[common.Hash]*types.Receipt, len(receipts))
+	for _, receipt := range receipts {
+		if receipt != nil && receipt.BlockHash == header.Hash() {
+			byHash[receipt.TxHash] = receipt
+		}
+	}
+	return byHash
+}
+
+// queueTransactions queues the deliveries of the given transactions, and dead-letters the ones which
+// could not be fetched
+func (l *singleChainBroadcaster) queueTransactions(
+	ctx context.Context,
+	txs *blockTransactions,
+	queued queuedBlocks,
+) {
+	for _, failure := range txs.failures {
+		tx := failure.tx
+		l.deadLetter(ctx, &DeadLetter{SubscriptionID: failure.s.id, Transaction: &tx}, failure.attempts, failure.err)
+	}
+
+	for s, deliveries := range txs.deliveries {
+		for _, tx := range deliveries {
+			l.enqueueTransaction(ctx, s, tx, queued.of(s.progress))
+		}
+	}
+}
+
+// enqueueTransaction queues the delivery of the given transaction to the given subscription. handlers,
+// if not nil, is done once the transaction has been delivered, dead-lettered or discarded.
+func (l *singleChainBroadcaster) enqueueTransaction(
+	ctx context.Context,
+	s *transactionSubscription,
+	tx Transaction,
+	handlers deliveryTracker,
+) {
+	done := trackDelivery(handlers)
+
+	err := l.enqueue(s.queue, s.id, delivery{
+		run:  func() { l.deliverTransaction(ctx, s, tx) },
+		done: done,
+	})
+	if err != nil {
+		done()
+
+		if err == errQueueFull {
+			l.deadLetter(ctx, &DeadLetter{SubscriptionID: s.id, Transaction: &tx, Pending: s.pending}, 0, err)
+		}
+	}
+}
+
+// deliverTransaction delivers the given transaction to the given subscription, retrying on failure.
+// The transaction is dead-lettered once the attempts are exhausted.
+func (l *singleChainBroadcaster) deliverTransaction(ctx context.Context, s *transactionSubscription, tx Transaction) {
+	attempts, err := retry(ctx, l.stop, s.opts.Retry, func() error {
+		return s.execute(ctx, tx)
+	})
+	if err != nil {
+		l.deadLetter(ctx, &DeadLetter{SubscriptionID: s.id, Transaction: &tx, Pending: s.pending}, attempts, err)
+	}
+}
+
+// replayTransaction delivers the given dead-lettered transaction to the given subscription again. It is
+// given its receipt first if it could not be fetched. If the body of the block could not be fetched,
+// the transactions of the block are fetched and queued as usual instead.
+func (l *singleChainBroadcaster) replayTransaction(
+	ctx context.Context,
+	s *transactionSubscription,
+	tx Transaction,
+) (int, error) {
+	if tx.Tx == nil {
+		txs, err := l.fetchTransactions(ctx, *tx.Header, []*transactionSubscription{s})
+		if err != nil {
+			return 0, err
+		}
+
+		for _, failure := range txs.failures {
+			if failure.tx.Tx == nil {
+				return failure.attempts, failure.err
+			}
+		}
+
+		l.queueTransactions(ctx, txs, nil)
+		return 1, nil
+	}
+
+	return l.redeliver(ctx, s.queue, s.id, s.opts.Retry, func() error {
+		if s.opts.Receipts && tx.Receipt == nil {
+			receipt, err := l.client.(receiptReader).TransactionReceipt(ctx, tx.Tx.Hash())
+			if err != nil {
+				return errors.Wrap(err, "failed to get the receipt of the transaction")
+			}
+			tx.Receipt = receipt
+		}
+
+		return s.execute(ctx, tx)
+	})
+}
+
+// RegisterPendingTransactionHandler registers the given handler for the pending transactions passing
+// the given filters. Each transaction is delivered once, when it enters the mempool.
+func (l *singleChainBroadcaster) RegisterPendingTransactionHandler(
+	id string,
+	chainID uint64,
+	handler HandleTransactionFunc,
+	opts TransactionOptions,
+) (func(), error) {
+	if chainID != l.chainID {
+		return nil, fmt.Errorf("the given chain ID %d does not match with the broadcaster's one %d", chainID, l.chainID)
+	}
+
+	if l.pendingTxStreamer == nil {
+		return nil, errors.New("no pending transaction streamer configured")
+	}
+
+	if _, ok := l.client.(transactionReader); !ok {
+		return nil, errors.New("the client does not support fetching transactions by hash")
+	}
+
+	if opts.Receipts {
+		return nil, errors.New("pending transactions have no receipts")
+	}
+
+	s := newTransactionSubscription(id, handler, opts)
+	s.pending = true
+	l.sbs.addPendingTransactionSubscription(s)
+
+	return func() {
+		s.queue.close()
+		l.sbs.removePendingTransactionSubscriptions(id)
+		l.logger.WithField("id", id).Info("subscription has been unregistered")
+	}, nil
+}
+
+// handlePendingTransactions delivers the pending transactions streamed by the pending transaction
+// streamer to the matching subscriptions until the broadcaster is stopped
+func (l *singleChainBroadcaster) handlePendingTransactions(ctx context.Context) {
+	hashes := make(chan common.Hash)
+
+	// The transactions are fetched by a bounded number of workers, so that a slow node does not hold
+	// back the stream
+	var workers sync.WaitGroup
+	for i := 0; i < l.pendingTxWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			for hash := range hashes {
+				l.handlePendingTransaction(ctx, hash)
+			}
+		}()
+	}
+
+	defer func() {
+		close(hashes)
+		workers.Wait()
+	}()
+
+	for {
+		hash, ok := l.pendingTxStreamer.Next()
+		if !ok {
+			return
+		}
+
+		select {
+		case hashes <- hash:
+		case <-l.stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handlePendingTransaction delivers the pending transaction with the given hash to the matching
+// subscriptions
+func (l *singleChainBroadcaster) handlePendingTransaction(ctx context.Context, hash common.Hash) {
+	sbs := l.sbs.allPendingTransactionSubscriptions()
+	if len(sbs) == 0 {
+		return
+	}
+
+	logger := l.logger.WithField("tx", hash.Hex())
+
+	// The transaction may have been mined or dropped meanwhile
+	tx, isPending, err := l.client.(transactionReader).TransactionByHash(ctx, hash)
+	if err != nil {
+		logger.WithError(err).Debug("failed to get pending transaction")
+		return
+	}
+
+	if !isPending {
+		logger.Debug("pending transaction has been mined already")
+		return
+	}
+
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		logger.WithError(err).Error("failed to get the sender of pending transaction")
+		return
+	}
+
+	// Pending transactions are not checkpointed, so the deliveries are not waited for
+	for _, s := range sbs {
+		if s.matches(tx, from) {
+			l.enqueueTransaction(ctx, s, Transaction{Tx: tx, From: from}, nil)
+		}
+	}
+}
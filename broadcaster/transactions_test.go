@@ -0,0 +1,419 @@
+package broadcaster
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/onsi/gomega"
+	"github.com/stretchr/testify/require"
+
+	"github.com/begmaroman/eth-services/broadcaster/contracts"
+)
+
+func Test_SingleChainBroadcaster_Transactions(t *testing.T) {
+	env := newTestEnv(t)
+
+	counterABI, err := contracts.CounterMetaData.GetAbi()
+	require.NoError(t, err)
+
+	var triggerSelector [4]byte
+	copy(triggerSelector[:], counterABI.Methods["trigger"].ID)
+
+	calls := make(chan Transaction, 10)
+	transfers := make(chan Transaction, 10)
+	broadcaster := env.startBroadcaster(t, Options{}, func(broadcaster *singleChainBroadcaster) {
+		_, err := broadcaster.RegisterTransactionHandler(testWfID, testChainID, func(ctx context.Context, tx Transaction) error {
+			calls <- tx
+			return nil
+		}, TransactionOptions{
+			From:      []common.Address{env.txOpts.From},
+			To:        []common.Address{env.addr},
+			Selectors: [][4]byte{triggerSelector},
+			Receipts:  true,
+		})
+		require.NoError(t, err)
+
+		_, err = broadcaster.RegisterTransactionHandler("transfers", testChainID, func(ctx context.Context, tx Transaction) error {
+			transfers <- tx
+			return nil
+		}, TransactionOptions{
+			MinValue: big.NewInt(params.GWei),
+		})
+		require.NoError(t, err)
+	})
+
+	call := env.trigger(t)
+
+	// A plain transfer to another account
+	nonce, err := env.backend.PendingNonceAt(env.ctx, env.txOpts.From)
+	require.NoError(t, err)
+	gasPrice, err := env.backend.SuggestGasPrice(env.ctx)
+	require.NoError(t, err)
+
+	transfer := types.NewTransaction(nonce, common.HexToAddress("0x1"), big.NewInt(params.Ether), 21000, gasPrice, nil)
+	transfer, err = env.txOpts.Signer(env.txOpts.From, transfer)
+	require.NoError(t, err)
+	require.NoError(t, env.backend.SendTransaction(env.ctx, transfer))
+
+	env.backend.Commit()
+
+	select {
+	case tx := <-calls:
+		require.Equal(t, call.Hash(), tx.Tx.Hash())
+		require.Equal(t, env.txOpts.From, tx.From)
+		require.NotNil(t, tx.Receipt)
+		require.Equal(t, types.ReceiptStatusSuccessful, tx.Receipt.Status)
+		require.Equal(t, tx.Header.Hash(), tx.Receipt.BlockHash)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no call delivered")
+	}
+
+	select {
+	case tx := <-transfers:
+		require.Equal(t, transfer.Hash(), tx.Tx.Hash())
+		require.Nil(t, tx.Receipt)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no transfer delivered")
+	}
+
+	require.NoError(t, broadcaster.Stop())
+	require.Empty(t, calls)
+	require.Empty(t, transfers)
+}
+
+func Test_SingleChainBroadcaster_PendingTransactions(t *testing.T) {
+	env := newTestEnv(t)
+
+	rpc := &fakePendingTxRPC{}
+	pending := make(chan Transaction, 10)
+	broadcaster := env.startBroadcaster(t, Options{
+		PendingTransactions: NewPendingTxStreamer(env.logger, rpc, 10*time.Millisecond, testChainID),
+	}, func(broadcaster *singleChainBroadcaster) {
+		_, err := broadcaster.RegisterPendingTransactionHandler(testWfID, testChainID,
+			func(ctx context.Context, tx Transaction) error {
+				pending <- tx
+				return nil
+			}, TransactionOptions{
+				From: []common.Address{env.txOpts.From},
+				To:   []common.Address{env.addr},
+			})
+		require.NoError(t, err)
+	})
+
+	tx := env.trigger(t)
+
+	rpc.lock.Lock()
+	rpc.batches = append(rpc.batches, []common.Hash{tx.Hash(), tx.Hash()})
+	rpc.lock.Unlock()
+
+	select {
+	case delivered := <-pending:
+		require.Equal(t, tx.Hash(), delivered.Tx.Hash())
+		require.Equal(t, env.txOpts.From, delivered.From)
+		require.Nil(t, delivered.Header)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no pending transaction delivered")
+	}
+
+	require.NoError(t, broadcaster.Stop())
+	require.Empty(t, pending)
+}
+
+// slowTxClient delays the transactions queried by hash, recording the most queries in flight at once
+type slowTxClient struct {
+	*backends.SimulatedBackend
+
+	inFlight, maxInFlight int32
+}
+
+func (c *slowTxClient) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	inFlight := atomic.AddInt32(&c.inFlight, 1)
+	defer atomic.AddInt32(&c.inFlight, -1)
+
+	for max := atomic.LoadInt32(&c.maxInFlight); inFlight > max; max = atomic.LoadInt32(&c.maxInFlight) {
+		if atomic.CompareAndSwapInt32(&c.maxInFlight, max, inFlight) {
+			break
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	return c.SimulatedBackend.TransactionByHash(ctx, hash)
+}
+
+func Test_SingleChainBroadcaster_PendingTransactionsConcurrency(t *testing.T) {
+	env := newTestEnv(t)
+	client := &slowTxClient{SimulatedBackend: env.backend}
+
+	rpc := &fakePendingTxRPC{}
+	broadcaster := newPollingTestBroadcaster(t, env.logger, client, Options{
+		PendingTransactions:  NewPendingTxStreamer(env.logger, rpc, 10*time.Millisecond, testChainID),
+		PendingTxConcurrency: 3,
+	})
+
+	pending := make(chan Transaction, 10)
+	_, err := broadcaster.RegisterPendingTransactionHandler(testWfID, testChainID, func(ctx context.Context, tx Transaction) error {
+		pending <- tx
+		return nil
+	}, TransactionOptions{})
+	require.NoError(t, err)
+	startTestBroadcaster(env.ctx, t, broadcaster)
+	defer func() {
+		require.NoError(t, broadcaster.Stop())
+	}()
+
+	var hashes []common.Hash
+	for i := 0; i < 3; i++ {
+		hashes = append(hashes, env.trigger(t).Hash())
+	}
+
+	rpc.lock.Lock()
+	rpc.batches = append(rpc.batches, hashes)
+	rpc.lock.Unlock()
+
+	for range hashes {
+		select {
+		case <-pending:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no pending transaction delivered")
+		}
+	}
+
+	require.Greater(t, atomic.LoadInt32(&client.maxInFlight), int32(1))
+}
+
+// flakyTxClient fails the block bodies and the receipts while the corresponding flags are set, and adds
+// an unsigned transaction to the block bodies
+type flakyTxClient struct {
+	*backends.SimulatedBackend
+
+	failBlocks, failReceipts int32
+}
+
+func (c *flakyTxClient) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	if atomic.LoadInt32(&c.failBlocks) == 1 {
+		return nil, errors.New("block body unavailable")
+	}
+
+	block, err := c.SimulatedBackend.BlockByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	unsigned := types.NewTransaction(0, common.HexToAddress("0x1"), big.NewInt(1), 21000, big.NewInt(1), nil)
+	txs := append(types.Transactions{unsigned}, block.Transactions()...)
+	return types.NewBlockWithHeader(block.Header()).WithBody(txs, nil), nil
+}
+
+func (c *flakyTxClient) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	if atomic.LoadInt32(&c.failReceipts) == 1 {
+		return nil, errors.New("receipt unavailable")
+	}
+
+	return c.SimulatedBackend.TransactionReceipt(ctx, hash)
+}
+
+func Test_SingleChainBroadcaster_TransactionFetchFailures(t *testing.T) {
+	env := newTestEnv(t)
+	client := &flakyTxClient{SimulatedBackend: env.backend}
+	deadLetters := NewMemoryDeadLetterStore()
+
+	broadcaster := newPollingTestBroadcaster(t, env.logger, client, Options{DeadLetters: deadLetters})
+	broadcaster.fetchRetry = RetryOptions{MaxAttempts: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	defer func() {
+		require.NoError(t, broadcaster.Stop())
+	}()
+
+	txs := make(chan Transaction, 10)
+	_, err := broadcaster.RegisterTransactionHandler(testWfID, testChainID, func(ctx context.Context, tx Transaction) error {
+		txs <- tx
+		return nil
+	}, TransactionOptions{
+		To:       []common.Address{env.addr},
+		Receipts: true,
+	})
+	require.NoError(t, err)
+	startTestBroadcaster(env.ctx, t, broadcaster)
+
+	waitDeadLetters := func(count int) []*DeadLetter {
+		var letters []*DeadLetter
+		gomega.NewWithT(t).Eventually(func() int {
+			letters, err = deadLetters.GetDeadLetters(env.ctx, testChainID)
+			require.NoError(t, err)
+			return len(letters)
+		}).Should(gomega.Equal(count))
+
+		return letters
+	}
+
+	// The block is handled in spite of the receipt failure, and the transaction is dead-lettered
+	atomic.StoreInt32(&client.failReceipts, 1)
+	receiptTx := env.trigger(t)
+	env.backend.Commit()
+	waitCheckpoint(t, broadcaster, 2)
+
+	letters := waitDeadLetters(1)
+	require.Equal(t, receiptTx.Hash(), letters[0].Transaction.Tx.Hash())
+	require.Nil(t, letters[0].Transaction.Receipt)
+
+	// The block is handled in spite of the block body failure, and the block is dead-lettered
+	atomic.StoreInt32(&client.failBlocks, 1)
+	blockTx := env.trigger(t)
+	env.backend.Commit()
+	waitCheckpoint(t, broadcaster, 3)
+
+	letters = waitDeadLetters(2)
+	require.Nil(t, letters[1].Transaction.Tx)
+	require.Equal(t, uint64(3), letters[1].Transaction.Header.Number.Uint64())
+
+	// Replaying fetches what is missing, the unsigned transaction is skipped
+	atomic.StoreInt32(&client.failReceipts, 0)
+	atomic.StoreInt32(&client.failBlocks, 0)
+
+	replayed, err := broadcaster.ReplayDeadLetters(env.ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, replayed)
+	waitDeadLetters(0)
+
+	for _, expected := range []common.Hash{receiptTx.Hash(), blockTx.Hash()} {
+		select {
+		case tx := <-txs:
+			require.Equal(t, expected, tx.Tx.Hash())
+			require.NotNil(t, tx.Receipt)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no transaction delivered")
+		}
+	}
+	require.Empty(t, txs)
+}
+
+// blockReceiptsClient serves eth_getBlockReceipts from the simulated backend, or rejects it as unknown
+// if unsupported is set. It records the calls and the receipts queried by hash in flight at once.
+type blockReceiptsClient struct {
+	*backends.SimulatedBackend
+
+	unsupported                                     bool
+	blockCalls, receiptCalls, inFlight, maxInFlight int32
+}
+
+type methodNotFoundError struct{}
+
+func (methodNotFoundError) Error() string  { return "the method eth_getBlockReceipts does not exist" }
+func (methodNotFoundError) ErrorCode() int { return methodNotFoundCode }
+
+func (c *blockReceiptsClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if method != "eth_getBlockReceipts" {
+		return errors.New("unexpected method " + method)
+	}
+
+	atomic.AddInt32(&c.blockCalls, 1)
+	if c.unsupported {
+		return methodNotFoundError{}
+	}
+
+	block, err := c.SimulatedBackend.BlockByHash(ctx, args[0].(common.Hash))
+	if err != nil {
+		return err
+	}
+
+	var receipts []*types.Receipt
+	for _, tx := range block.Transactions() {
+		receipt, err := c.SimulatedBackend.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			return err
+		}
+		receipts = append(receipts, receipt)
+	}
+	*result.(*[]*types.Receipt) = receipts
+	return nil
+}
+
+func (c *blockReceiptsClient) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	atomic.AddInt32(&c.receiptCalls, 1)
+	inFlight := atomic.AddInt32(&c.inFlight, 1)
+	defer atomic.AddInt32(&c.inFlight, -1)
+
+	for max := atomic.LoadInt32(&c.maxInFlight); inFlight > max; max = atomic.LoadInt32(&c.maxInFlight) {
+		if atomic.CompareAndSwapInt32(&c.maxInFlight, max, inFlight) {
+			break
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	return c.SimulatedBackend.TransactionReceipt(ctx, hash)
+}
+
+func Test_SingleChainBroadcaster_TransactionReceipts(t *testing.T) {
+	run := func(t *testing.T, client *blockReceiptsClient, env *testEnv) chan Transaction {
+		broadcaster := newPollingTestBroadcaster(t, env.logger, client, Options{ReceiptsConcurrency: 2})
+		t.Cleanup(func() {
+			require.NoError(t, broadcaster.Stop())
+		})
+
+		txs := make(chan Transaction, 10)
+		_, err := broadcaster.RegisterTransactionHandler(testWfID, testChainID, func(ctx context.Context, tx Transaction) error {
+			txs <- tx
+			return nil
+		}, TransactionOptions{
+			To:       []common.Address{env.addr},
+			Receipts: true,
+		})
+		require.NoError(t, err)
+		startTestBroadcaster(env.ctx, t, broadcaster)
+
+		return txs
+	}
+
+	// mine mines count calls in a single block and waits for their deliveries
+	mine := func(t *testing.T, env *testEnv, txs chan Transaction, count int) {
+		for i := 0; i < count; i++ {
+			env.trigger(t)
+		}
+		env.backend.Commit()
+
+		for i := 0; i < count; i++ {
+			select {
+			case tx := <-txs:
+				require.NotNil(t, tx.Receipt)
+				require.Equal(t, tx.Tx.Hash(), tx.Receipt.TxHash)
+			case <-time.After(5 * time.Second):
+				require.FailNow(t, "no transaction delivered")
+			}
+		}
+	}
+
+	t.Run("fetch the receipts of a block at once", func(t *testing.T) {
+		env := newTestEnv(t)
+		client := &blockReceiptsClient{SimulatedBackend: env.backend}
+		txs := run(t, client, env)
+
+		mine(t, env, txs, 3)
+
+		require.Equal(t, int32(1), atomic.LoadInt32(&client.blockCalls))
+		require.Zero(t, atomic.LoadInt32(&client.receiptCalls))
+	})
+
+	t.Run("fetch the receipts by hash with bounded concurrency if unsupported", func(t *testing.T) {
+		env := newTestEnv(t)
+		client := &blockReceiptsClient{SimulatedBackend: env.backend, unsupported: true}
+		txs := run(t, client, env)
+
+		mine(t, env, txs, 3)
+
+		require.Equal(t, int32(3), atomic.LoadInt32(&client.receiptCalls))
+		require.Equal(t, int32(2), atomic.LoadInt32(&client.maxInFlight))
+
+		// The provider is not asked again
+		mine(t, env, txs, 1)
+
+		require.Equal(t, int32(1), atomic.LoadInt32(&client.blockCalls))
+		require.Equal(t, int32(4), atomic.LoadInt32(&client.receiptCalls))
+	})
+}
@@ -3,6 +3,7 @@ module github.com/begmaroman/eth-services
 go 1.15
 
 require (
+	github.com/alicebob/miniredis/v2 v2.35.0
 	github.com/allegro/bigcache v1.2.1 // indirect
 	github.com/aristanetworks/goarista v0.0.0-20191023202215-f096da5361bb // indirect
 	github.com/btcsuite/btcd v0.21.0-beta // indirect
@@ -14,11 +15,14 @@ require (
 	github.com/google/uuid v1.3.0
 	github.com/jackpal/go-nat-pmp v1.0.2 // indirect
 	github.com/jpillora/backoff v1.0.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.17
 	github.com/onsi/gomega v1.18.1
-	github.com/pborman/uuid v1.2.1
 	github.com/pkg/errors v0.9.1
-	github.com/prometheus/client_golang v1.17.0 // indirect
+	github.com/prometheus/client_golang v1.17.0
+	github.com/prometheus/client_model v0.4.1-0.20230718164431-9a2bf3000d16
 	github.com/prometheus/tsdb v0.10.0 // indirect
+	github.com/redis/go-redis/v9 v9.7.3
 	github.com/rjeczalik/notify v0.9.2 // indirect
 	github.com/rs/cors v1.7.0 // indirect
 	github.com/sirupsen/logrus v1.9.0
@@ -31,4 +35,5 @@ require (
 	github.com/vmihailenco/tagparser v0.1.2 // indirect
 	go.uber.org/multierr v1.6.0
 	go.uber.org/zap v1.17.0
+	golang.org/x/sync v0.3.0
 )
@@ -13,7 +13,6 @@ import (
 	esStore "github.com/begmaroman/eth-services/store"
 	"github.com/begmaroman/eth-services/store/models"
 	"github.com/google/uuid"
-	pbormanUUID "github.com/pborman/uuid"
 
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
@@ -263,7 +262,7 @@ func MustGenerateRandomAccount(t testing.TB, opts ...interface{}) (account *mode
 
 	privateKeyECDSA, err := ecdsa.GenerateKey(crypto.S256(), rand.Reader)
 	require.NoError(t, err)
-	id := pbormanUUID.NewRandom()
+	id := uuid.New()
 	k := &keystore.Key{
 		Id:         id,
 		Address:    crypto.PubkeyToAddress(privateKeyECDSA.PublicKey),
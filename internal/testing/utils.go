@@ -20,7 +20,9 @@ import (
 func NewStore(t testing.TB) store.Store {
 	t.Helper()
 
-	return tendermint.NewTMStore(tmDB.NewMemDB())
+	s, err := tendermint.NewTMStore(tmDB.NewMemDB())
+	require.NoError(t, err)
+	return s
 }
 
 // NewConfig creates a new Config for testing
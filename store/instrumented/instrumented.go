@@ -0,0 +1,386 @@
+// Package instrumented provides a store.Store decorator recording the latency, the errors and the
+// number of returned records of every call to Prometheus, and logging slow calls.
+package instrumented
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+	"github.com/begmaroman/eth-services/types"
+)
+
+// Options configures an InstrumentedStore
+type Options struct {
+	// Logger logs calls taking at least SlowThreshold. Slow calls are not logged if Logger is nil or
+	// SlowThreshold is zero.
+	Logger        types.Logger
+	SlowThreshold time.Duration
+}
+
+// InstrumentedStore wraps a Store and records metrics of all calls. Calls made through the Store
+// passed to RunInTx callbacks are recorded as well, RunInTx itself includes the time spent in the
+// callback.
+type InstrumentedStore struct {
+	store esStore.Store
+	opts  Options
+}
+
+var _ esStore.Store = (*InstrumentedStore)(nil)
+
+// NewInstrumentedStore creates a new InstrumentedStore wrapping store
+func NewInstrumentedStore(store esStore.Store, opts Options) *InstrumentedStore {
+	return &InstrumentedStore{
+		store: store,
+		opts:  opts,
+	}
+}
+
+// observe records a call of method which started at start, returned the given number of records
+// and failed with err.
+func (s *InstrumentedStore) observe(method string, start time.Time, records int, err error) {
+	duration := time.Since(start)
+	callDurationHistogram.WithLabelValues(method).Observe(duration.Seconds())
+	if err != nil && !errors.Is(err, esStore.ErrNotFound) {
+		callErrorsCounter.WithLabelValues(method).Inc()
+	}
+	if records > 0 {
+		decodedRecordsCounter.WithLabelValues(method).Add(float64(records))
+	}
+	if s.opts.Logger != nil && s.opts.SlowThreshold > 0 && duration >= s.opts.SlowThreshold {
+		s.opts.Logger.Warnw("Slow store call", "method", method, "duration", duration, "err", err)
+	}
+}
+
+func one(found bool) int {
+	if found {
+		return 1
+	}
+	return 0
+}
+
+func (s *InstrumentedStore) RunInTx(fn func(store esStore.Store) error) error {
+	start := time.Now()
+	err := s.store.RunInTx(func(txStore esStore.Store) error {
+		return fn(NewInstrumentedStore(txStore, s.opts))
+	})
+	s.observe("RunInTx", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) InsertHead(head *models.Head) error {
+	start := time.Now()
+	err := s.store.InsertHead(head)
+	s.observe("InsertHead", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) LastHead() (*models.Head, error) {
+	start := time.Now()
+	head, err := s.store.LastHead()
+	s.observe("LastHead", start, one(head != nil), err)
+	return head, err
+}
+
+func (s *InstrumentedStore) FirstHead() (*models.Head, error) {
+	start := time.Now()
+	head, err := s.store.FirstHead()
+	s.observe("FirstHead", start, one(head != nil), err)
+	return head, err
+}
+
+func (s *InstrumentedStore) HeadByHash(hash common.Hash) (*models.Head, error) {
+	start := time.Now()
+	head, err := s.store.HeadByHash(hash)
+	s.observe("HeadByHash", start, one(head != nil), err)
+	return head, err
+}
+
+func (s *InstrumentedStore) HeadsByNumber(number int64) ([]*models.Head, error) {
+	start := time.Now()
+	heads, err := s.store.HeadsByNumber(number)
+	s.observe("HeadsByNumber", start, len(heads), err)
+	return heads, err
+}
+
+func (s *InstrumentedStore) HeadsInRange(fromNumber, toNumber int64) ([]*models.Head, error) {
+	start := time.Now()
+	heads, err := s.store.HeadsInRange(fromNumber, toNumber)
+	s.observe("HeadsInRange", start, len(heads), err)
+	return heads, err
+}
+
+func (s *InstrumentedStore) TrimOldHeads(depth int64) error {
+	start := time.Now()
+	err := s.store.TrimOldHeads(depth)
+	s.observe("TrimOldHeads", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) Chain(hash common.Hash, lookback int64) (*models.Head, error) {
+	start := time.Now()
+	head, err := s.store.Chain(hash, lookback)
+	records := 0
+	if head != nil {
+		records = int(head.ChainLength())
+	}
+	s.observe("Chain", start, records, err)
+	return head, err
+}
+
+func (s *InstrumentedStore) GetAccount(address common.Address) (*models.Account, error) {
+	start := time.Now()
+	account, err := s.store.GetAccount(address)
+	s.observe("GetAccount", start, one(account != nil), err)
+	return account, err
+}
+
+func (s *InstrumentedStore) GetAccounts() ([]*models.Account, error) {
+	start := time.Now()
+	accounts, err := s.store.GetAccounts()
+	s.observe("GetAccounts", start, len(accounts), err)
+	return accounts, err
+}
+
+func (s *InstrumentedStore) PutAccount(account *models.Account) error {
+	start := time.Now()
+	err := s.store.PutAccount(account)
+	s.observe("PutAccount", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetTx(id uuid.UUID) (*models.Tx, error) {
+	start := time.Now()
+	tx, err := s.store.GetTx(id)
+	s.observe("GetTx", start, one(tx != nil), err)
+	return tx, err
+}
+
+func (s *InstrumentedStore) PutTx(tx *models.Tx) error {
+	start := time.Now()
+	err := s.store.PutTx(tx)
+	s.observe("PutTx", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) QueryTxs(query esStore.TxQuery) (*esStore.TxPage, error) {
+	start := time.Now()
+	page, err := s.store.QueryTxs(query)
+	records := 0
+	if page != nil {
+		records = len(page.Txs)
+	}
+	s.observe("QueryTxs", start, records, err)
+	return page, err
+}
+
+func (s *InstrumentedStore) GetTxAttempt(id uuid.UUID) (*models.TxAttempt, error) {
+	start := time.Now()
+	attempt, err := s.store.GetTxAttempt(id)
+	s.observe("GetTxAttempt", start, one(attempt != nil), err)
+	return attempt, err
+}
+
+func (s *InstrumentedStore) PutTxAttempt(attempt *models.TxAttempt) error {
+	start := time.Now()
+	err := s.store.PutTxAttempt(attempt)
+	s.observe("PutTxAttempt", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) DeleteTxAttempt(id uuid.UUID) error {
+	start := time.Now()
+	err := s.store.DeleteTxAttempt(id)
+	s.observe("DeleteTxAttempt", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetAttemptsForTx(tx *models.Tx) ([]*models.TxAttempt, error) {
+	start := time.Now()
+	attempts, err := s.store.GetAttemptsForTx(tx)
+	s.observe("GetAttemptsForTx", start, len(attempts), err)
+	return attempts, err
+}
+
+func (s *InstrumentedStore) AddOrUpdateAttempt(tx *models.Tx, attempt *models.TxAttempt) error {
+	start := time.Now()
+	err := s.store.AddOrUpdateAttempt(tx, attempt)
+	s.observe("AddOrUpdateAttempt", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) ReplaceAttempt(
+	tx *models.Tx,
+	oldAttempt *models.TxAttempt,
+	newAttempt *models.TxAttempt,
+) error {
+	start := time.Now()
+	err := s.store.ReplaceAttempt(tx, oldAttempt, newAttempt)
+	s.observe("ReplaceAttempt", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetTxReceipt(id uuid.UUID) (*models.TxReceipt, error) {
+	start := time.Now()
+	receipt, err := s.store.GetTxReceipt(id)
+	s.observe("GetTxReceipt", start, one(receipt != nil), err)
+	return receipt, err
+}
+
+func (s *InstrumentedStore) PutTxReceipt(receipt *models.TxReceipt) error {
+	start := time.Now()
+	err := s.store.PutTxReceipt(receipt)
+	s.observe("PutTxReceipt", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) DeleteTxReceipt(id uuid.UUID) error {
+	start := time.Now()
+	err := s.store.DeleteTxReceipt(id)
+	s.observe("DeleteTxReceipt", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) AddTx(
+	txID uuid.UUID,
+	fromAddress common.Address,
+	toAddress common.Address,
+	encodedPayload []byte,
+	value *big.Int,
+	gasLimit uint64,
+	maxGasPrice *big.Int,
+) error {
+	start := time.Now()
+	err := s.store.AddTx(txID, fromAddress, toAddress, encodedPayload, value, gasLimit, maxGasPrice)
+	s.observe("AddTx", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetInProgressTx(fromAddress common.Address) (*models.Tx, error) {
+	start := time.Now()
+	tx, err := s.store.GetInProgressTx(fromAddress)
+	s.observe("GetInProgressTx", start, one(tx != nil), err)
+	return tx, err
+}
+
+func (s *InstrumentedStore) GetNextNonce(address common.Address) (int64, error) {
+	start := time.Now()
+	nonce, err := s.store.GetNextNonce(address)
+	s.observe("GetNextNonce", start, one(err == nil), err)
+	return nonce, err
+}
+
+func (s *InstrumentedStore) SetNextNonce(address common.Address, nextNonce int64) error {
+	start := time.Now()
+	err := s.store.SetNextNonce(address, nextNonce)
+	s.observe("SetNextNonce", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetNextUnstartedTx(fromAddress common.Address) (*models.Tx, error) {
+	start := time.Now()
+	tx, err := s.store.GetNextUnstartedTx(fromAddress)
+	s.observe("GetNextUnstartedTx", start, one(tx != nil), err)
+	return tx, err
+}
+
+func (s *InstrumentedStore) GetTxsRequiringReceiptFetch() ([]*models.Tx, error) {
+	start := time.Now()
+	txs, err := s.store.GetTxsRequiringReceiptFetch()
+	s.observe("GetTxsRequiringReceiptFetch", start, len(txs), err)
+	return txs, err
+}
+
+func (s *InstrumentedStore) SetBroadcastBeforeBlockNum(blockNum int64) error {
+	start := time.Now()
+	err := s.store.SetBroadcastBeforeBlockNum(blockNum)
+	s.observe("SetBroadcastBeforeBlockNum", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) MarkConfirmedMissingReceipt() error {
+	start := time.Now()
+	err := s.store.MarkConfirmedMissingReceipt()
+	s.observe("MarkConfirmedMissingReceipt", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) MarkOldTxsMissingReceiptAsErrored(cutoff int64) error {
+	start := time.Now()
+	err := s.store.MarkOldTxsMissingReceiptAsErrored(cutoff)
+	s.observe("MarkOldTxsMissingReceiptAsErrored", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetTxsRequiringNewAttempt(
+	address common.Address,
+	blockNum int64,
+	gasBumpThreshold int64,
+	depth int,
+) ([]*models.Tx, error) {
+	start := time.Now()
+	txs, err := s.store.GetTxsRequiringNewAttempt(address, blockNum, gasBumpThreshold, depth)
+	s.observe("GetTxsRequiringNewAttempt", start, len(txs), err)
+	return txs, err
+}
+
+func (s *InstrumentedStore) GetTxsConfirmedAtOrAboveBlockHeight(blockNum int64) ([]*models.Tx, error) {
+	start := time.Now()
+	txs, err := s.store.GetTxsConfirmedAtOrAboveBlockHeight(blockNum)
+	s.observe("GetTxsConfirmedAtOrAboveBlockHeight", start, len(txs), err)
+	return txs, err
+}
+
+func (s *InstrumentedStore) GetInProgressAttempts(address common.Address) ([]*models.TxAttempt, error) {
+	start := time.Now()
+	attempts, err := s.store.GetInProgressAttempts(address)
+	s.observe("GetInProgressAttempts", start, len(attempts), err)
+	return attempts, err
+}
+
+func (s *InstrumentedStore) IsTxConfirmedAtOrBeforeBlockNumber(txID uuid.UUID, blockNumber int64) (bool, error) {
+	start := time.Now()
+	confirmed, err := s.store.IsTxConfirmedAtOrBeforeBlockNumber(txID, blockNumber)
+	s.observe("IsTxConfirmedAtOrBeforeBlockNumber", start, 0, err)
+	return confirmed, err
+}
+
+func (s *InstrumentedStore) GetJob(jobID uuid.UUID) (*models.Job, error) {
+	start := time.Now()
+	job, err := s.store.GetJob(jobID)
+	s.observe("GetJob", start, one(job != nil), err)
+	return job, err
+}
+
+func (s *InstrumentedStore) GetJobs() ([]*models.Job, error) {
+	start := time.Now()
+	jobs, err := s.store.GetJobs()
+	s.observe("GetJobs", start, len(jobs), err)
+	return jobs, err
+}
+
+func (s *InstrumentedStore) PutJob(job *models.Job) error {
+	start := time.Now()
+	err := s.store.PutJob(job)
+	s.observe("PutJob", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) DeleteJob(jobID uuid.UUID) error {
+	start := time.Now()
+	err := s.store.DeleteJob(jobID)
+	s.observe("DeleteJob", start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetUnhandledJobIDs() ([]uuid.UUID, error) {
+	start := time.Now()
+	jobIDs, err := s.store.GetUnhandledJobIDs()
+	s.observe("GetUnhandledJobIDs", start, len(jobIDs), err)
+	return jobIDs, err
+}
@@ -0,0 +1,81 @@
+package instrumented
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+	logrusTest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	tmDB "github.com/tendermint/tm-db"
+
+	esLogger "github.com/begmaroman/eth-services/logger"
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+	"github.com/begmaroman/eth-services/store/storetest"
+	"github.com/begmaroman/eth-services/store/tendermint"
+)
+
+func newTestStore(t *testing.T, opts Options) *InstrumentedStore {
+	s, err := tendermint.NewTMStore(tmDB.NewMemDB())
+	require.NoError(t, err)
+	return NewInstrumentedStore(s, opts)
+}
+
+func Test_InstrumentedStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) esStore.Store {
+		return newTestStore(t, Options{})
+	})
+}
+
+func Test_InstrumentedStore_Metrics(t *testing.T) {
+	s := newTestStore(t, Options{})
+	job := &models.Job{ID: uuid.New(), State: models.JobStateUnhandled}
+	require.NoError(t, s.PutJob(job))
+
+	txCalls := sampleCount(t, "RunInTx")
+	getJobsCalls := sampleCount(t, "GetJobs")
+	errs := testutil.ToFloat64(callErrorsCounter.WithLabelValues("GetJob"))
+	records := testutil.ToFloat64(decodedRecordsCounter.WithLabelValues("GetJobs"))
+
+	// Calls within transactions are recorded too
+	require.NoError(t, s.RunInTx(func(txStore esStore.Store) error {
+		_, err := txStore.GetJobs()
+		return err
+	}))
+	// Not found is not an error
+	_, err := s.GetJob(uuid.New())
+	require.Error(t, err)
+
+	require.Equal(t, txCalls+1, sampleCount(t, "RunInTx"))
+	require.Equal(t, getJobsCalls+1, sampleCount(t, "GetJobs"))
+	require.Equal(t, errs, testutil.ToFloat64(callErrorsCounter.WithLabelValues("GetJob")))
+	require.Equal(t, records+1, testutil.ToFloat64(decodedRecordsCounter.WithLabelValues("GetJobs")))
+}
+
+func sampleCount(t *testing.T, method string) uint64 {
+	var metric dto.Metric
+	require.NoError(t, callDurationHistogram.WithLabelValues(method).(prometheus.Metric).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func Test_InstrumentedStore_SlowCalls(t *testing.T) {
+	logger, hook := logrusTest.NewNullLogger()
+	logger.SetLevel(logrus.TraceLevel)
+	s := newTestStore(t, Options{
+		Logger:        esLogger.NewLogrus(logger),
+		SlowThreshold: time.Nanosecond,
+	})
+
+	_, err := s.LastHead()
+	require.NoError(t, err)
+
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	require.Equal(t, logrus.WarnLevel, entry.Level)
+	require.Equal(t, "LastHead", entry.Data["method"])
+}
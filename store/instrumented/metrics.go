@@ -0,0 +1,33 @@
+package instrumented
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	callDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "nerif_app",
+		Subsystem: "store",
+		Name:      "call_duration_seconds",
+		Help:      "The duration of store calls",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method"})
+
+	callErrorsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nerif_app",
+		Subsystem: "store",
+		Name:      "call_errors",
+		Help:      "The total number of failed store calls, not counting not found errors",
+	}, []string{"method"})
+
+	decodedRecordsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nerif_app",
+		Subsystem: "store",
+		Name:      "decoded_records",
+		Help:      "The total number of records returned by store calls",
+	}, []string{"method"})
+)
+
+func init() {
+	prometheus.MustRegister(callDurationHistogram)
+	prometheus.MustRegister(callErrorsCounter)
+	prometheus.MustRegister(decodedRecordsCounter)
+}
@@ -0,0 +1,138 @@
+package sqlstore
+
+import (
+	"database/sql"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+func (store *SQLStore) PutAccount(account *models.Account) error {
+	return store.runInTx(func(txStore *SQLStore) error {
+		address := encodeAddress(account.Address)
+		err := txStore.checkVersion("Account", "accounts", "address", address, account.Version)
+		if err != nil {
+			return err
+		}
+		res, err := txStore.exec(
+			"INSERT INTO accounts (address, next_nonce, version) VALUES (?, ?, ?) "+
+				"ON CONFLICT (address) DO UPDATE SET next_nonce = excluded.next_nonce, version = excluded.version "+
+				"WHERE accounts.version = ?",
+			address, account.NextNonce, account.Version+1, account.Version,
+		)
+		if err != nil {
+			return err
+		}
+		if err = txStore.checkVersionedWrite(res, "Account", "accounts", "address", address, account.Version); err != nil {
+			return err
+		}
+		if err = txStore.storeIDList("account_tx_ids", "address", "tx_id", address, account.TxIDs); err != nil {
+			return err
+		}
+		account.Version++
+		return nil
+	})
+}
+
+func (store *SQLStore) GetAccount(address common.Address) (*models.Account, error) {
+	account := models.Account{Address: address}
+	err := store.queryRow(
+		"SELECT next_nonce, version FROM accounts WHERE address = ?", encodeAddress(address),
+	).Scan(&account.NextNonce, &account.Version)
+	if err == sql.ErrNoRows {
+		return nil, esStore.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get account")
+	}
+	account.TxIDs, err = store.loadIDList("account_tx_ids", "address", "tx_id", encodeAddress(address))
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// lockAccount locks the account row for read-modify-write updates within a transaction.
+func (store *SQLStore) lockAccount(address common.Address) error {
+	if store.dialect.LockClause == "" {
+		return nil
+	}
+	var locked string
+	err := store.queryRow(
+		"SELECT address FROM accounts WHERE address = ?"+store.dialect.LockClause, encodeAddress(address),
+	).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return esStore.ErrNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not lock account")
+	}
+	return nil
+}
+
+func (store *SQLStore) GetAccounts() ([]*models.Account, error) {
+	rows, err := store.query("SELECT address FROM accounts ORDER BY address")
+	if err != nil {
+		return nil, err
+	}
+	var addresses []common.Address
+	for rows.Next() {
+		var address string
+		if err = rows.Scan(&address); err != nil {
+			rows.Close()
+			return nil, errors.Wrap(err, "could not scan row")
+		}
+		addresses = append(addresses, common.HexToAddress(address))
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, esStore.ErrNotFound
+	}
+
+	accounts := make([]*models.Account, 0, len(addresses))
+	for _, address := range addresses {
+		account, getErr := store.GetAccount(address)
+		if getErr != nil {
+			return nil, getErr
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+func (store *SQLStore) GetNextNonce(address common.Address) (int64, error) {
+	var nextNonce int64
+	err := store.queryRow(
+		"SELECT next_nonce FROM accounts WHERE address = ?", encodeAddress(address),
+	).Scan(&nextNonce)
+	if err == sql.ErrNoRows {
+		return 0, esStore.ErrNotFound
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get account")
+	}
+	return nextNonce, nil
+}
+
+func (store *SQLStore) SetNextNonce(address common.Address, nextNonce int64) error {
+	res, err := store.exec(
+		"UPDATE accounts SET next_nonce = ?, version = version + 1 WHERE address = ?", nextNonce, encodeAddress(address),
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "could not get affected rows")
+	}
+	if n == 0 {
+		return esStore.ErrNotFound
+	}
+	return nil
+}
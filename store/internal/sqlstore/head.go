@@ -0,0 +1,138 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+const headColumns = "hash, number, parent_hash, block_timestamp"
+
+// InsertHead inserts a block head
+func (store *SQLStore) InsertHead(head *models.Head) error {
+	return store.runInTx(func(txStore *SQLStore) error {
+		// Re-inserting a head makes it the most recently seen one, which wins LastHead ties
+		_, err := txStore.exec("DELETE FROM heads WHERE hash = ?", encodeHash(head.Hash))
+		if err != nil {
+			return err
+		}
+		_, err = txStore.exec(
+			"INSERT INTO heads ("+headColumns+") VALUES (?, ?, ?, ?)",
+			encodeHash(head.Hash), head.Number, encodeHash(head.ParentHash), head.Timestamp.Unix(),
+		)
+		return err
+	})
+}
+
+// LastHead returns the head with the highest number. In the case of ties (e.g.
+// due to re-org) it returns the most recently seen head entry.
+func (store *SQLStore) LastHead() (*models.Head, error) {
+	return store.optionalHead("SELECT " + headColumns + " FROM heads ORDER BY number DESC, id DESC LIMIT 1")
+}
+
+// FirstHead returns the head with the lowest number. Only for testing.
+func (store *SQLStore) FirstHead() (*models.Head, error) {
+	return store.optionalHead("SELECT " + headColumns + " FROM heads ORDER BY number ASC, id ASC LIMIT 1")
+}
+
+// HeadByHash fetches the head with the given hash from the db, returns nil if none exists.
+func (store *SQLStore) HeadByHash(hash common.Hash) (*models.Head, error) {
+	return store.optionalHead("SELECT "+headColumns+" FROM heads WHERE hash = ?", encodeHash(hash))
+}
+
+// HeadsByNumber returns all heads with the given number, e.g. competing heads due to re-org.
+// Returns nil if none exists.
+func (store *SQLStore) HeadsByNumber(number int64) ([]*models.Head, error) {
+	return store.HeadsInRange(number, number)
+}
+
+// HeadsInRange returns all heads with a number between fromNumber and toNumber (both inclusive),
+// ordered by ascending number. Returns nil if none exists.
+func (store *SQLStore) HeadsInRange(fromNumber, toNumber int64) ([]*models.Head, error) {
+	rows, err := store.query(
+		"SELECT "+headColumns+" FROM heads WHERE number >= ? AND number <= ? ORDER BY number, hash",
+		fromNumber, toNumber,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var heads []*models.Head
+	for rows.Next() {
+		head, scanErr := scanHead(rows)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		heads = append(heads, head)
+	}
+	return heads, rows.Err()
+}
+
+// TrimOldHeads deletes "depth" number of heads such that only the top N block numbers remain.
+func (store *SQLStore) TrimOldHeads(depth int64) error {
+	_, err := store.exec(
+		"DELETE FROM heads WHERE number <= (SELECT MAX(number) FROM heads) - ?",
+		depth,
+	)
+	return err
+}
+
+// Chain returns the chain of heads starting at hash and up to lookback parents.
+func (store *SQLStore) Chain(hash common.Hash, lookback int64) (*models.Head, error) {
+	var firstHead *models.Head
+	var prevHead *models.Head
+	currHash := hash
+	for i := 0; i < int(lookback); i++ {
+		head, headErr := store.HeadByHash(currHash)
+		if headErr != nil {
+			return nil, errors.Wrap(headErr, "could not get head")
+		}
+		if head == nil {
+			// Chain is shorter than specified lookback
+			break
+		}
+		if firstHead == nil {
+			firstHead = head
+		} else {
+			prevHead.Parent = head
+		}
+		prevHead = head
+		currHash = prevHead.ParentHash
+	}
+	if firstHead == nil {
+		return nil, esStore.ErrNotFound
+	}
+	return firstHead, nil
+}
+
+func (store *SQLStore) optionalHead(query string, args ...interface{}) (*models.Head, error) {
+	head, err := scanHead(store.queryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get head")
+	}
+	return head, nil
+}
+
+func scanHead(row scanner) (*models.Head, error) {
+	var (
+		hash       string
+		parentHash string
+		timestamp  int64
+		head       models.Head
+	)
+	if err := row.Scan(&hash, &head.Number, &parentHash, &timestamp); err != nil {
+		return nil, err
+	}
+	head.Hash = common.HexToHash(hash)
+	head.ParentHash = common.HexToHash(parentHash)
+	head.Timestamp = time.Unix(timestamp, 0)
+	return &head, nil
+}
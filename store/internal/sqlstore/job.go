@@ -0,0 +1,108 @@
+package sqlstore
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+const jobColumns = "id, tx_id, metadata, state"
+
+func (store *SQLStore) GetJob(jobID uuid.UUID) (*models.Job, error) {
+	job, err := scanJob(store.queryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?", encodeUUID(jobID)))
+	if err == sql.ErrNoRows {
+		return nil, esStore.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get Job")
+	}
+	return job, nil
+}
+
+// GetJobs returns all jobs ordered by ID. Returns nil if none exists.
+func (store *SQLStore) GetJobs() ([]*models.Job, error) {
+	rows, err := store.query("SELECT " + jobColumns + " FROM jobs ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []*models.Job
+	for rows.Next() {
+		job, scanErr := scanJob(rows)
+		if scanErr != nil {
+			return nil, errors.Wrap(scanErr, "could not scan row")
+		}
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (store *SQLStore) PutJob(job *models.Job) error {
+	_, err := store.exec(
+		"INSERT INTO jobs ("+jobColumns+") VALUES (?, ?, ?, ?) "+
+			"ON CONFLICT (id) DO UPDATE SET tx_id = excluded.tx_id, metadata = excluded.metadata, "+
+			"state = excluded.state",
+		encodeUUID(job.ID), encodeUUID(job.TxID), job.Metadata, string(job.State),
+	)
+	return err
+}
+
+func (store *SQLStore) DeleteJob(jobID uuid.UUID) error {
+	_, err := store.exec("DELETE FROM jobs WHERE id = ?", encodeUUID(jobID))
+	return err
+}
+
+func (store *SQLStore) GetUnhandledJobIDs() ([]uuid.UUID, error) {
+	rows, err := store.query("SELECT id FROM jobs WHERE state = ? ORDER BY id", string(models.JobStateUnhandled))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobIDs []uuid.UUID
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "could not scan row")
+		}
+		jobID, decodeErr := decodeUUID(id)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		jobIDs = append(jobIDs, jobID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(jobIDs) == 0 {
+		return nil, esStore.ErrNotFound
+	}
+	return jobIDs, nil
+}
+
+func scanJob(row scanner) (*models.Job, error) {
+	var (
+		id    string
+		txID  string
+		state string
+		job   models.Job
+	)
+	err := row.Scan(&id, &txID, &job.Metadata, &state)
+	if err != nil {
+		return nil, err
+	}
+	if job.ID, err = decodeUUID(id); err != nil {
+		return nil, err
+	}
+	if job.TxID, err = decodeUUID(txID); err != nil {
+		return nil, err
+	}
+	job.State = models.JobState(state)
+	return &job, nil
+}
@@ -0,0 +1,82 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// Migration upgrades the schema to Version. All statements of a migration run in one transaction with
+// the other pending migrations.
+type Migration struct {
+	Version    int
+	Statements []string
+}
+
+// Migrate applies all migrations of the dialect which have not been applied yet. The applied
+// versions are recorded in the schema_migrations table. It refuses to run against a schema newer than
+// the latest known migration. All migrations run in one transaction holding the MigrationLock of the
+// dialect, so that stores opened concurrently on the same database do not apply them twice.
+func Migrate(db *sql.DB, dialect Dialect) error {
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "could not begin transaction")
+	}
+	if err = migrate(ctx, tx, dialect); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "could not commit migrations")
+}
+
+func migrate(ctx context.Context, tx *sql.Tx, dialect Dialect) error {
+	if dialect.MigrationLock != "" {
+		if _, err := tx.ExecContext(ctx, dialect.MigrationLock); err != nil {
+			return errors.Wrap(err, "could not lock migrations")
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)")
+	if err != nil {
+		return errors.Wrap(err, "could not create schema_migrations table")
+	}
+
+	var current sql.NullInt64
+	err = tx.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return errors.Wrap(err, "could not get schema version")
+	}
+
+	latest := 0
+	if len(dialect.Migrations) > 0 {
+		latest = dialect.Migrations[len(dialect.Migrations)-1].Version
+	}
+	if int(current.Int64) > latest {
+		return errors.Errorf(
+			"%s schema version %d is newer than the latest known version %d", dialect.Name, current.Int64, latest,
+		)
+	}
+
+	for _, migration := range dialect.Migrations {
+		if int64(migration.Version) <= current.Int64 {
+			continue
+		}
+		if err = applyMigration(ctx, tx, dialect, migration); err != nil {
+			return errors.Wrapf(err, "could not apply %s migration %d", dialect.Name, migration.Version)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, tx *sql.Tx, dialect Dialect, migration Migration) error {
+	for _, statement := range migration.Statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	_, err := tx.ExecContext(ctx, rebind(dialect, "INSERT INTO schema_migrations (version) VALUES (?)"), migration.Version)
+	return err
+}
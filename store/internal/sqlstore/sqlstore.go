@@ -0,0 +1,337 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+)
+
+// Dialect describes the differences between the supported SQL databases.
+type Dialect struct {
+	// Name of the database, used in error messages
+	Name string
+
+	// Placeholder returns the bind parameter for the n-th (1-based) argument of a query
+	Placeholder func(n int) string
+
+	// Migrations creates and upgrades the schema, ordered by ascending version
+	Migrations []Migration
+
+	// LockClause is appended to a SELECT to lock the selected rows until the end of the transaction,
+	// e.g. " FOR UPDATE". Empty if the database serializes write transactions anyway.
+	LockClause string
+
+	// MigrationLock is executed first in the migration transaction to take a lock held until its end,
+	// serializing the migrations of concurrently opened stores. Empty if the database serializes write
+	// transactions anyway.
+	MigrationLock string
+}
+
+// QuestionPlaceholder is the Placeholder of databases using "?" bind parameters.
+func QuestionPlaceholder(int) string {
+	return "?"
+}
+
+// DollarPlaceholder is the Placeholder of databases using "$n" bind parameters.
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// SQLStore is a Store implementation on top of database/sql. It is shared by the SQL backends, which
+// only provide the driver and the Dialect.
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+
+	// q is the transaction the store is bound to, or db
+	q    querier
+	inTx bool
+}
+
+var _ esStore.Store = (*SQLStore)(nil)
+
+// New creates a new SQLStore and migrates the schema to the latest version.
+func New(db *sql.DB, dialect Dialect) (*SQLStore, error) {
+	if err := Migrate(db, dialect); err != nil {
+		return nil, err
+	}
+	return &SQLStore{
+		db:      db,
+		dialect: dialect,
+		q:       db,
+	}, nil
+}
+
+// DB returns the underlying database handle.
+func (store *SQLStore) DB() *sql.DB {
+	return store.db
+}
+
+// RunInTx runs fn within a database transaction. The transaction is committed if fn returns nil and
+// rolled back otherwise. Nested calls join the running transaction.
+func (store *SQLStore) RunInTx(fn func(esStore.Store) error) error {
+	return store.runInTx(func(txStore *SQLStore) error {
+		return fn(txStore)
+	})
+}
+
+func (store *SQLStore) runInTx(fn func(txStore *SQLStore) error) error {
+	if store.inTx {
+		return fn(store)
+	}
+
+	tx, err := store.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return errors.Wrap(err, "could not begin transaction")
+	}
+	txStore := &SQLStore{
+		db:      store.db,
+		dialect: store.dialect,
+		q:       tx,
+		inTx:    true,
+	}
+	if err = fn(txStore); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return errors.Wrapf(err, "could not roll back transaction: %v", rollbackErr)
+		}
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "could not commit transaction")
+	}
+	return nil
+}
+
+// rebind replaces the "?" bind parameters of query with the ones of the dialect.
+func (store *SQLStore) rebind(query string) string {
+	return rebind(store.dialect, query)
+}
+
+func rebind(dialect Dialect, query string) string {
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			sb.WriteString(dialect.Placeholder(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func (store *SQLStore) exec(query string, args ...interface{}) (sql.Result, error) {
+	res, err := store.q.ExecContext(context.Background(), store.rebind(query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not execute query")
+	}
+	return res, nil
+}
+
+func (store *SQLStore) query(query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := store.q.QueryContext(context.Background(), store.rebind(query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not execute query")
+	}
+	return rows, nil
+}
+
+func (store *SQLStore) queryRow(query string, args ...interface{}) *sql.Row {
+	return store.q.QueryRowContext(context.Background(), store.rebind(query), args...)
+}
+
+// inClause returns a "(?, ?, ...)" list with n bind parameters.
+func inClause(n int) string {
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", n), ", ") + ")"
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func encodeUUID(id uuid.UUID) string {
+	return id.String()
+}
+
+func decodeUUID(s string) (uuid.UUID, error) {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.UUID{}, errors.Wrap(err, "could not decode UUID")
+	}
+	return id, nil
+}
+
+// decodeTime decodes nanoseconds since the Unix epoch as written by store.UnixNano.
+func decodeTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// encodeAddress encodes an address as lowercase hex, so that the text order matches the byte order.
+func encodeAddress(address common.Address) string {
+	return strings.ToLower(address.Hex())
+}
+
+func encodeHash(hash common.Hash) string {
+	return hash.Hex()
+}
+
+func encodeBig(n *big.Int) sql.NullString {
+	if n == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: n.String(), Valid: true}
+}
+
+func decodeBig(s sql.NullString) (*big.Int, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	n, ok := new(big.Int).SetString(s.String, 10)
+	if !ok {
+		return nil, errors.Errorf("could not decode big integer %q", s.String)
+	}
+	return n, nil
+}
+
+func uuidsToArgs(ids []uuid.UUID) []interface{} {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = encodeUUID(id)
+	}
+	return args
+}
+
+// loadIDList returns the ordered list of IDs stored in the given link table for the owner.
+func (store *SQLStore) loadIDList(table, ownerColumn, idColumn, owner string) ([]uuid.UUID, error) {
+	rows, err := store.query(
+		"SELECT "+idColumn+" FROM "+table+" WHERE "+ownerColumn+" = ? ORDER BY list_index",
+		owner,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []uuid.UUID
+	for rows.Next() {
+		var s string
+		if err = rows.Scan(&s); err != nil {
+			return nil, errors.Wrap(err, "could not scan row")
+		}
+		id, decodeErr := decodeUUID(s)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// storeIDList replaces the ordered list of IDs stored in the given link table for the owner. Lists
+// which only grew are appended to instead of being rewritten.
+func (store *SQLStore) storeIDList(table, ownerColumn, idColumn, owner string, ids []uuid.UUID) error {
+	current, err := store.loadIDList(table, ownerColumn, idColumn, owner)
+	if err != nil {
+		return err
+	}
+	start := len(current)
+	if len(current) > len(ids) {
+		start = 0
+	}
+	for i := 0; i < start; i++ {
+		if current[i] != ids[i] {
+			start = 0
+			break
+		}
+	}
+	if start == 0 && len(current) > 0 {
+		if _, err = store.exec("DELETE FROM "+table+" WHERE "+ownerColumn+" = ?", owner); err != nil {
+			return err
+		}
+	}
+	for i := start; i < len(ids); i++ {
+		_, err = store.exec(
+			"INSERT INTO "+table+" ("+ownerColumn+", list_index, "+idColumn+") VALUES (?, ?, ?)",
+			owner, i, encodeUUID(ids[i]),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasAccounts returns ErrNotFound if no account has been stored yet.
+func (store *SQLStore) hasAccounts() error {
+	var exists int
+	err := store.queryRow("SELECT 1 FROM accounts LIMIT 1").Scan(&exists)
+	if err == sql.ErrNoRows {
+		return esStore.ErrNotFound
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not query accounts")
+	}
+	return nil
+}
+
+// storedVersion returns the version of the record of table with the given key, 0 if there is none.
+// The record is locked until the end of the transaction if the dialect supports it.
+func (store *SQLStore) storedVersion(table, keyColumn, key string) (int64, error) {
+	var version int64
+	err := store.queryRow(
+		"SELECT version FROM "+table+" WHERE "+keyColumn+" = ?"+store.dialect.LockClause, key,
+	).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get version")
+	}
+	return version, nil
+}
+
+// checkVersion returns a ConflictError if version does not match the stored version of the record.
+func (store *SQLStore) checkVersion(entity, table, keyColumn, key string, version int64) error {
+	storedVersion, err := store.storedVersion(table, keyColumn, key)
+	if err != nil {
+		return err
+	}
+	return esStore.CheckVersion(entity, key, version, storedVersion)
+}
+
+// checkVersionedWrite returns a ConflictError if the conditional upsert of a versioned record did not
+// write anything, i.e. the record has been written concurrently since checkVersion.
+func (store *SQLStore) checkVersionedWrite(res sql.Result, entity, table, keyColumn, key string, version int64) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "could not get affected rows")
+	}
+	if n > 0 {
+		return nil
+	}
+	storedVersion, err := store.storedVersion(table, keyColumn, key)
+	if err != nil {
+		return err
+	}
+	return &esStore.ConflictError{Entity: entity, Key: key, Version: version, StoredVersion: storedVersion}
+}
@@ -0,0 +1,427 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+const txColumns = "id, nonce, from_address, to_address, encoded_payload, value, gas_limit, max_gas_price, state, error, " +
+	"created_at, version"
+
+// txColumnsOf returns txColumns qualified with the given table alias.
+func txColumnsOf(alias string) string {
+	return alias + ".id, " + alias + ".nonce, " + alias + ".from_address, " + alias + ".to_address, " +
+		alias + ".encoded_payload, " + alias + ".value, " + alias + ".gas_limit, " + alias + ".max_gas_price, " +
+		alias + ".state, " + alias + ".error, " + alias + ".created_at, " + alias + ".version"
+}
+
+func (store *SQLStore) AddTx(
+	txID uuid.UUID,
+	fromAddress common.Address,
+	toAddress common.Address,
+	encodedPayload []byte,
+	value *big.Int,
+	gasLimit uint64,
+	maxGasPrice *big.Int,
+) error {
+	return store.runInTx(func(txStore *SQLStore) error {
+		if err := txStore.lockAccount(fromAddress); err != nil {
+			return err
+		}
+		account, err := txStore.GetAccount(fromAddress)
+		if err != nil {
+			return err
+		}
+
+		tx := models.Tx{
+			ID:             txID,
+			FromAddress:    fromAddress,
+			ToAddress:      toAddress,
+			EncodedPayload: encodedPayload,
+			Value:          value,
+			GasLimit:       gasLimit,
+			MaxGasPrice:    maxGasPrice,
+			State:          models.TxStateUnstarted,
+			CreatedAt:      time.Now(),
+		}
+
+		if err = txStore.PutTx(&tx); err != nil {
+			return err
+		}
+
+		account.TxIDs = append(account.TxIDs, txID)
+
+		return txStore.PutAccount(account)
+	})
+}
+
+func (store *SQLStore) PutTx(tx *models.Tx) error {
+	return store.runInTx(func(txStore *SQLStore) error {
+		if err := txStore.checkVersion("Tx", "txs", "id", encodeUUID(tx.ID), tx.Version); err != nil {
+			return err
+		}
+		res, err := txStore.exec(
+			"INSERT INTO txs ("+txColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) "+
+				"ON CONFLICT (id) DO UPDATE SET nonce = excluded.nonce, from_address = excluded.from_address, "+
+				"to_address = excluded.to_address, encoded_payload = excluded.encoded_payload, "+
+				"value = excluded.value, gas_limit = excluded.gas_limit, max_gas_price = excluded.max_gas_price, "+
+				"state = excluded.state, error = excluded.error, created_at = excluded.created_at, "+
+				"version = excluded.version "+
+				"WHERE txs.version = ?",
+			encodeUUID(tx.ID),
+			tx.Nonce,
+			encodeAddress(tx.FromAddress),
+			encodeAddress(tx.ToAddress),
+			tx.EncodedPayload,
+			encodeBig(tx.Value),
+			int64(tx.GasLimit),
+			encodeBig(tx.MaxGasPrice),
+			string(tx.State),
+			tx.Error,
+			esStore.UnixNano(tx.CreatedAt),
+			tx.Version+1,
+			tx.Version,
+		)
+		if err != nil {
+			return err
+		}
+		if err = txStore.checkVersionedWrite(res, "Tx", "txs", "id", encodeUUID(tx.ID), tx.Version); err != nil {
+			return err
+		}
+		err = txStore.storeIDList("tx_attempt_ids", "tx_id", "attempt_id", encodeUUID(tx.ID), tx.TxAttemptIDs)
+		if err != nil {
+			return err
+		}
+		tx.Version++
+		return nil
+	})
+}
+
+func (store *SQLStore) GetTx(id uuid.UUID) (*models.Tx, error) {
+	txs, err := store.queryTxs("SELECT "+txColumns+" FROM txs WHERE id = ?", encodeUUID(id))
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, esStore.ErrNotFound
+	}
+	return txs[0], nil
+}
+
+func (store *SQLStore) QueryTxs(query esStore.TxQuery) (*esStore.TxPage, error) {
+	cursor, err := esStore.ParseTxCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if query.FromAddress != nil {
+		conditions = append(conditions, "from_address = ?")
+		args = append(args, encodeAddress(*query.FromAddress))
+	}
+	if query.ToAddress != nil {
+		conditions = append(conditions, "to_address = ?")
+		args = append(args, encodeAddress(*query.ToAddress))
+	}
+	if len(query.States) > 0 {
+		conditions = append(conditions, "state IN (?"+strings.Repeat(", ?", len(query.States)-1)+")")
+		for _, state := range query.States {
+			args = append(args, string(state))
+		}
+	}
+	if query.MinNonce != nil {
+		conditions = append(conditions, "nonce >= ?")
+		args = append(args, *query.MinNonce)
+	}
+	if query.MaxNonce != nil {
+		conditions = append(conditions, "nonce <= ?")
+		args = append(args, *query.MaxNonce)
+	}
+	if !query.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, esStore.UnixNano(query.CreatedFrom))
+	}
+	if !query.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, esStore.UnixNano(query.CreatedTo))
+	}
+	order, cmp := "ASC", ">"
+	if query.Order == esStore.SortDescending {
+		order, cmp = "DESC", "<"
+	}
+	if cursor != nil {
+		conditions = append(conditions, "(created_at "+cmp+" ? OR (created_at = ? AND id "+cmp+" ?))")
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, encodeUUID(cursor.ID))
+	}
+
+	q := "SELECT " + txColumns + " FROM txs"
+	if len(conditions) > 0 {
+		q += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	limit := query.PageLimit()
+	q += " ORDER BY created_at " + order + ", id " + order + " LIMIT ?"
+	args = append(args, limit+1)
+
+	txs, err := store.queryTxs(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	page := &esStore.TxPage{Txs: txs}
+	if len(txs) > limit {
+		page.Txs = txs[:limit]
+		page.NextCursor = esStore.TxCursorOf(page.Txs[limit-1]).String()
+	}
+	return page, nil
+}
+
+func (store *SQLStore) GetInProgressTx(fromAddress common.Address) (*models.Tx, error) {
+	return store.firstAccountTxInState(fromAddress, models.TxStateInProgress)
+}
+
+func (store *SQLStore) GetNextUnstartedTx(fromAddress common.Address) (*models.Tx, error) {
+	return store.firstAccountTxInState(fromAddress, models.TxStateUnstarted)
+}
+
+// firstAccountTxInState returns the first Tx in the list of the account which is in the given state.
+func (store *SQLStore) firstAccountTxInState(address common.Address, state models.TxState) (*models.Tx, error) {
+	if _, err := store.GetAccount(address); err != nil {
+		return nil, err
+	}
+	txs, err := store.queryTxs(
+		"SELECT "+txColumnsOf("t")+" FROM account_tx_ids l JOIN txs t ON t.id = l.tx_id "+
+			"WHERE l.address = ? AND t.state = ? ORDER BY l.list_index LIMIT 1",
+		encodeAddress(address), string(state),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, esStore.ErrNotFound
+	}
+	return txs[0], nil
+}
+
+func (store *SQLStore) GetTxsRequiringReceiptFetch() ([]*models.Tx, error) {
+	var txs []*models.Tx
+	for _, state := range []models.TxState{models.TxStateUnconfirmed, models.TxStateConfirmedMissingReceipt} {
+		stateTxs, err := store.queryTxs(
+			"SELECT "+txColumns+" FROM txs WHERE state = ? ORDER BY from_address, nonce, id", string(state),
+		)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, stateTxs...)
+	}
+	// NOTE: Returns (nil, nil) when not found instead of (nil, ErrNotFound)
+	return txs, nil
+}
+
+func (store *SQLStore) SetBroadcastBeforeBlockNum(blockNum int64) error {
+	_, err := store.exec(
+		"UPDATE tx_attempts SET broadcast_before_block_num = ?, version = version + 1 "+
+			"WHERE state = ? AND broadcast_before_block_num = -1",
+		blockNum, string(models.TxAttemptStateBroadcast),
+	)
+	return err
+}
+
+func (store *SQLStore) MarkConfirmedMissingReceipt() error {
+	if err := store.hasAccounts(); err != nil {
+		return err
+	}
+	_, err := store.exec(
+		"UPDATE txs SET state = ?, version = version + 1 WHERE state = ? AND nonce < ("+
+			"SELECT MAX(c.nonce) FROM txs c WHERE c.from_address = txs.from_address AND c.state = ?)",
+		string(models.TxStateConfirmedMissingReceipt),
+		string(models.TxStateUnconfirmed),
+		string(models.TxStateConfirmed),
+	)
+	return err
+}
+
+func (store *SQLStore) MarkOldTxsMissingReceiptAsErrored(cutoff int64) error {
+	if err := store.hasAccounts(); err != nil {
+		return err
+	}
+	// Txs without any broadcast attempt have a max BroadcastBeforeBlockNum of -1 and are skipped
+	_, err := store.exec(
+		"UPDATE txs SET state = ?, nonce = -1, error = ?, version = version + 1 WHERE state = ? AND ("+
+			"SELECT COALESCE(MAX(a.broadcast_before_block_num), -1) FROM tx_attempt_ids l "+
+			"JOIN tx_attempts a ON a.id = l.attempt_id WHERE l.tx_id = txs.id"+
+			") BETWEEN 0 AND ?",
+		string(models.TxStateFatalError),
+		esStore.ErrCouldNotGetReceipt.Error(),
+		string(models.TxStateConfirmedMissingReceipt),
+		cutoff-1,
+	)
+	return err
+}
+
+func (store *SQLStore) GetTxsRequiringNewAttempt(
+	address common.Address,
+	blockNum int64,
+	gasBumpThreshold int64,
+	depth int,
+) ([]*models.Tx, error) {
+	if _, err := store.GetAccount(address); err != nil {
+		return nil, err
+	}
+	txs, err := store.queryTxs(
+		"SELECT "+txColumns+" FROM txs WHERE from_address = ? AND state = ? ORDER BY nonce, id",
+		encodeAddress(address), string(models.TxStateUnconfirmed),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	numTxs := len(txs)
+	if numTxs == 0 {
+		return txs, nil
+	}
+
+	limit := numTxs
+	if depth > 0 && depth < limit {
+		limit = depth
+	}
+
+	var includedTxs []*models.Tx
+	for _, tx := range txs[:limit] {
+		var excluded int
+		err = store.queryRow(
+			"SELECT COUNT(*) FROM tx_attempt_ids l JOIN tx_attempts a ON a.id = l.attempt_id "+
+				"WHERE l.tx_id = ? AND a.state <> ? AND "+
+				"(a.state <> ? OR a.broadcast_before_block_num = -1 OR a.broadcast_before_block_num > ?)",
+			encodeUUID(tx.ID),
+			string(models.TxAttemptStateInsufficientEth),
+			string(models.TxAttemptStateBroadcast),
+			blockNum-gasBumpThreshold,
+		).Scan(&excluded)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not query attempts")
+		}
+		if excluded == 0 {
+			includedTxs = append(includedTxs, tx)
+		}
+	}
+	return includedTxs, nil
+}
+
+func (store *SQLStore) GetTxsConfirmedAtOrAboveBlockHeight(blockNum int64) ([]*models.Tx, error) {
+	if err := store.hasAccounts(); err != nil {
+		return nil, err
+	}
+	return store.queryTxs(
+		"SELECT "+txColumns+" FROM txs WHERE state IN (?, ?) AND id IN ("+
+			"SELECT l.tx_id FROM tx_attempt_ids l "+
+			"JOIN tx_attempts a ON a.id = l.attempt_id "+
+			"JOIN tx_attempt_receipt_ids r ON r.attempt_id = a.id "+
+			"JOIN tx_receipts rc ON rc.id = r.receipt_id "+
+			"WHERE a.state = ? AND rc.block_number >= ?"+
+			") ORDER BY from_address, nonce, id",
+		string(models.TxStateConfirmed),
+		string(models.TxStateConfirmedMissingReceipt),
+		string(models.TxAttemptStateBroadcast),
+		blockNum,
+	)
+}
+
+func (store *SQLStore) IsTxConfirmedAtOrBeforeBlockNumber(txID uuid.UUID, blockNumber int64) (bool, error) {
+	tx, err := store.GetTx(txID)
+	if err != nil {
+		return false, err
+	}
+	if tx.State != models.TxStateConfirmed && tx.State != models.TxStateConfirmedMissingReceipt {
+		return false, nil
+	}
+	var count int
+	err = store.queryRow(
+		"SELECT COUNT(*) FROM tx_attempt_ids l "+
+			"JOIN tx_attempts a ON a.id = l.attempt_id "+
+			"JOIN tx_attempt_receipt_ids r ON r.attempt_id = a.id "+
+			"JOIN tx_receipts rc ON rc.id = r.receipt_id "+
+			"WHERE l.tx_id = ? AND a.state = ? AND rc.block_number <= ?",
+		encodeUUID(txID), string(models.TxAttemptStateBroadcast), blockNumber,
+	).Scan(&count)
+	if err != nil {
+		return false, errors.Wrap(err, "could not query receipts")
+	}
+	return count > 0, nil
+}
+
+// queryTxs runs a query selecting txColumns and returns the resulting Txs along with their attempt
+// IDs.
+func (store *SQLStore) queryTxs(query string, args ...interface{}) ([]*models.Tx, error) {
+	rows, err := store.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var txs []*models.Tx
+	for rows.Next() {
+		tx, scanErr := scanTx(rows)
+		if scanErr != nil {
+			rows.Close()
+			return nil, scanErr
+		}
+		txs = append(txs, tx)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, tx := range txs {
+		tx.TxAttemptIDs, err = store.loadIDList("tx_attempt_ids", "tx_id", "attempt_id", encodeUUID(tx.ID))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return txs, nil
+}
+
+func scanTx(row scanner) (*models.Tx, error) {
+	var (
+		id          string
+		fromAddress string
+		toAddress   string
+		value       sql.NullString
+		gasLimit    int64
+		maxGasPrice sql.NullString
+		state       string
+		createdAt   int64
+		tx          models.Tx
+		err         error
+	)
+	err = row.Scan(
+		&id, &tx.Nonce, &fromAddress, &toAddress, &tx.EncodedPayload, &value, &gasLimit, &maxGasPrice, &state,
+		&tx.Error, &createdAt, &tx.Version,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not scan Tx")
+	}
+	if tx.ID, err = decodeUUID(id); err != nil {
+		return nil, err
+	}
+	tx.FromAddress = common.HexToAddress(fromAddress)
+	tx.ToAddress = common.HexToAddress(toAddress)
+	if tx.Value, err = decodeBig(value); err != nil {
+		return nil, err
+	}
+	tx.GasLimit = uint64(gasLimit)
+	if tx.MaxGasPrice, err = decodeBig(maxGasPrice); err != nil {
+		return nil, err
+	}
+	tx.State = models.TxState(state)
+	tx.CreatedAt = decodeTime(createdAt)
+	return &tx, nil
+}
@@ -0,0 +1,240 @@
+package sqlstore
+
+import (
+	"bytes"
+	"database/sql"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+const txAttemptColumns = "id, tx_id, gas_price, signed_raw_tx, hash, broadcast_before_block_num, state, version"
+
+func (store *SQLStore) PutTxAttempt(attempt *models.TxAttempt) error {
+	return store.runInTx(func(txStore *SQLStore) error {
+		err := txStore.checkVersion("TxAttempt", "tx_attempts", "id", encodeUUID(attempt.ID), attempt.Version)
+		if err != nil {
+			return err
+		}
+		res, err := txStore.exec(
+			"INSERT INTO tx_attempts ("+txAttemptColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?) "+
+				"ON CONFLICT (id) DO UPDATE SET tx_id = excluded.tx_id, gas_price = excluded.gas_price, "+
+				"signed_raw_tx = excluded.signed_raw_tx, hash = excluded.hash, "+
+				"broadcast_before_block_num = excluded.broadcast_before_block_num, state = excluded.state, "+
+				"version = excluded.version WHERE tx_attempts.version = ?",
+			encodeUUID(attempt.ID),
+			encodeUUID(attempt.TxID),
+			encodeBig(attempt.GasPrice),
+			attempt.SignedRawTx,
+			encodeHash(attempt.Hash),
+			attempt.BroadcastBeforeBlockNum,
+			string(attempt.State),
+			attempt.Version+1,
+			attempt.Version,
+		)
+		if err != nil {
+			return err
+		}
+		err = txStore.checkVersionedWrite(res, "TxAttempt", "tx_attempts", "id", encodeUUID(attempt.ID), attempt.Version)
+		if err != nil {
+			return err
+		}
+		err = txStore.storeIDList(
+			"tx_attempt_receipt_ids", "attempt_id", "receipt_id", encodeUUID(attempt.ID), attempt.TxReceiptIDs,
+		)
+		if err != nil {
+			return err
+		}
+		attempt.Version++
+		return nil
+	})
+}
+
+func (store *SQLStore) GetTxAttempt(id uuid.UUID) (*models.TxAttempt, error) {
+	attempts, err := store.queryTxAttempts("SELECT "+txAttemptColumns+" FROM tx_attempts WHERE id = ?", encodeUUID(id))
+	if err != nil {
+		return nil, err
+	}
+	if len(attempts) == 0 {
+		return nil, esStore.ErrNotFound
+	}
+	return attempts[0], nil
+}
+
+func (store *SQLStore) DeleteTxAttempt(id uuid.UUID) error {
+	return store.runInTx(func(txStore *SQLStore) error {
+		if _, err := txStore.exec("DELETE FROM tx_attempt_receipt_ids WHERE attempt_id = ?", encodeUUID(id)); err != nil {
+			return err
+		}
+		_, err := txStore.exec("DELETE FROM tx_attempts WHERE id = ?", encodeUUID(id))
+		return err
+	})
+}
+
+func (store *SQLStore) GetAttemptsForTx(tx *models.Tx) ([]*models.TxAttempt, error) {
+	var attempts []*models.TxAttempt
+	for _, attemptID := range tx.TxAttemptIDs {
+		attempt, getAttemptErr := store.GetTxAttempt(attemptID)
+		if getAttemptErr != nil {
+			return nil, getAttemptErr
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, nil
+}
+
+// AddOrUpdateAttempt adds a new attempt or updates an existing attempt assuming only the state, NOT
+// the gas price, has changed. In case of an addition, the list of attempts are sorted by gas price.
+// The attempt and the Tx are written atomically.
+func (store *SQLStore) AddOrUpdateAttempt(tx *models.Tx, attempt *models.TxAttempt) error {
+	return store.runInTx(func(txStore *SQLStore) error {
+		if err := txStore.PutTxAttempt(attempt); err != nil {
+			return err
+		}
+		update := false
+		for _, attemptID := range tx.TxAttemptIDs {
+			if bytes.Equal(attemptID[:], attempt.ID[:]) {
+				update = true
+				break
+			}
+		}
+		if !update {
+			tx.TxAttemptIDs = append(tx.TxAttemptIDs, attempt.ID)
+			if err := txStore.sortAttemptsByGasPriceForTx(tx); err != nil {
+				return err
+			}
+		}
+		return txStore.PutTx(tx)
+	})
+}
+
+// ReplaceAttempt removes an existing attempt and adds a new attempt with a different ID. Sorts the new list of attempts
+// by gas price. The new attempt and the Tx are written atomically.
+func (store *SQLStore) ReplaceAttempt(tx *models.Tx, oldAttempt *models.TxAttempt, newAttempt *models.TxAttempt) error {
+	return store.runInTx(func(txStore *SQLStore) error {
+		if err := txStore.PutTxAttempt(newAttempt); err != nil {
+			return err
+		}
+		attemptIDs := tx.TxAttemptIDs
+		removeIndex := -1
+		for i, attemptID := range attemptIDs {
+			if bytes.Equal(attemptID[:], oldAttempt.ID[:]) {
+				removeIndex = i
+				break
+			}
+		}
+		if removeIndex == -1 {
+			return errors.New("old attempt not found")
+		}
+		copy(attemptIDs[removeIndex:], attemptIDs[removeIndex+1:])
+		attemptIDs = attemptIDs[:len(attemptIDs)-1]
+		tx.TxAttemptIDs = append(attemptIDs, newAttempt.ID)
+		if err := txStore.sortAttemptsByGasPriceForTx(tx); err != nil {
+			return err
+		}
+		return txStore.PutTx(tx)
+	})
+}
+
+func (store *SQLStore) sortAttemptsByGasPriceForTx(tx *models.Tx) error {
+	attempts, err := store.GetAttemptsForTx(tx)
+	if err != nil {
+		return err
+	}
+
+	// Sort txs by descending GasPrice
+	sort.Slice(attempts, func(i int, j int) bool {
+		return attempts[i].GasPrice.Cmp(attempts[j].GasPrice) == 1
+	})
+
+	// Reconstruct attemptIDs
+	var attemptIDs []uuid.UUID
+	for _, attempt := range attempts {
+		attemptIDs = append(attemptIDs, attempt.ID)
+	}
+	tx.TxAttemptIDs = attemptIDs
+	return nil
+}
+
+func (store *SQLStore) GetInProgressAttempts(address common.Address) ([]*models.TxAttempt, error) {
+	if _, err := store.GetAccount(address); err != nil {
+		return nil, err
+	}
+	return store.queryTxAttempts(
+		"SELECT a.id, a.tx_id, a.gas_price, a.signed_raw_tx, a.hash, a.broadcast_before_block_num, a.state, "+
+			"a.version "+
+			"FROM txs t JOIN tx_attempt_ids l ON l.tx_id = t.id JOIN tx_attempts a ON a.id = l.attempt_id "+
+			"WHERE t.from_address = ? AND t.state IN (?, ?, ?) AND a.state = ? ORDER BY a.id",
+		encodeAddress(address),
+		string(models.TxStateConfirmed),
+		string(models.TxStateConfirmedMissingReceipt),
+		string(models.TxStateUnconfirmed),
+		string(models.TxAttemptStateInProgress),
+	)
+}
+
+// queryTxAttempts runs a query selecting txAttemptColumns and returns the resulting attempts along
+// with their receipt IDs.
+func (store *SQLStore) queryTxAttempts(query string, args ...interface{}) ([]*models.TxAttempt, error) {
+	rows, err := store.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var attempts []*models.TxAttempt
+	for rows.Next() {
+		attempt, scanErr := scanTxAttempt(rows)
+		if scanErr != nil {
+			rows.Close()
+			return nil, scanErr
+		}
+		attempts = append(attempts, attempt)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, attempt := range attempts {
+		attempt.TxReceiptIDs, err = store.loadIDList(
+			"tx_attempt_receipt_ids", "attempt_id", "receipt_id", encodeUUID(attempt.ID),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return attempts, nil
+}
+
+func scanTxAttempt(row scanner) (*models.TxAttempt, error) {
+	var (
+		id       string
+		txID     string
+		gasPrice sql.NullString
+		hash     string
+		state    string
+		attempt  models.TxAttempt
+		err      error
+	)
+	err = row.Scan(
+		&id, &txID, &gasPrice, &attempt.SignedRawTx, &hash, &attempt.BroadcastBeforeBlockNum, &state, &attempt.Version,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not scan TxAttempt")
+	}
+	if attempt.ID, err = decodeUUID(id); err != nil {
+		return nil, err
+	}
+	if attempt.TxID, err = decodeUUID(txID); err != nil {
+		return nil, err
+	}
+	if attempt.GasPrice, err = decodeBig(gasPrice); err != nil {
+		return nil, err
+	}
+	attempt.Hash = common.HexToHash(hash)
+	attempt.State = models.TxAttemptState(state)
+	return &attempt, nil
+}
@@ -0,0 +1,61 @@
+package sqlstore
+
+import (
+	"database/sql"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+const txReceiptColumns = "id, tx_hash, block_hash, block_number, transaction_index, receipt"
+
+func (store *SQLStore) GetTxReceipt(id uuid.UUID) (*models.TxReceipt, error) {
+	var (
+		receiptID        string
+		txHash           string
+		blockHash        string
+		transactionIndex int64
+		receipt          models.TxReceipt
+	)
+	err := store.queryRow(
+		"SELECT "+txReceiptColumns+" FROM tx_receipts WHERE id = ?", encodeUUID(id),
+	).Scan(&receiptID, &txHash, &blockHash, &receipt.BlockNumber, &transactionIndex, &receipt.Receipt)
+	if err == sql.ErrNoRows {
+		return nil, esStore.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get TxReceipt")
+	}
+	if receipt.ID, err = decodeUUID(receiptID); err != nil {
+		return nil, err
+	}
+	receipt.TxHash = common.HexToHash(txHash)
+	receipt.BlockHash = common.HexToHash(blockHash)
+	receipt.TransactionIndex = uint(transactionIndex)
+	return &receipt, nil
+}
+
+func (store *SQLStore) PutTxReceipt(receipt *models.TxReceipt) error {
+	_, err := store.exec(
+		"INSERT INTO tx_receipts ("+txReceiptColumns+") VALUES (?, ?, ?, ?, ?, ?) "+
+			"ON CONFLICT (id) DO UPDATE SET tx_hash = excluded.tx_hash, block_hash = excluded.block_hash, "+
+			"block_number = excluded.block_number, transaction_index = excluded.transaction_index, "+
+			"receipt = excluded.receipt",
+		encodeUUID(receipt.ID),
+		encodeHash(receipt.TxHash),
+		encodeHash(receipt.BlockHash),
+		receipt.BlockNumber,
+		int64(receipt.TransactionIndex),
+		receipt.Receipt,
+	)
+	return err
+}
+
+func (store *SQLStore) DeleteTxReceipt(id uuid.UUID) error {
+	_, err := store.exec("DELETE FROM tx_receipts WHERE id = ?", encodeUUID(id))
+	return err
+}
@@ -47,6 +47,8 @@ type Account struct {
 	// because we have a better view of our own transactions
 	NextNonce int64
 	TxIDs     []uuid.UUID
+	// Version is incremented on every write, 0 if the account has not been stored yet
+	Version int64
 }
 
 type Job struct {
@@ -68,6 +70,10 @@ type Tx struct {
 	State          TxState
 	Error          string
 	TxAttemptIDs   []uuid.UUID
+	// CreatedAt is set by AddTx, it is zero for Txs added before it was recorded
+	CreatedAt time.Time
+	// Version is incremented on every write, 0 if the Tx has not been stored yet
+	Version int64
 }
 
 func (tx *Tx) GetError() error {
@@ -91,6 +97,8 @@ type TxAttempt struct {
 	BroadcastBeforeBlockNum int64
 	State                   TxAttemptState
 	TxReceiptIDs            []uuid.UUID
+	// Version is incremented on every write, 0 if the attempt has not been stored yet
+	Version int64
 }
 
 type TxReceipt struct {
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"github.com/begmaroman/eth-services/store/internal/sqlstore"
+)
+
+// migrations creates and upgrades the schema. Released migrations must never be changed, add a new
+// one instead.
+var migrations = []sqlstore.Migration{
+	{
+		Version: 1,
+		Statements: []string{
+			`CREATE TABLE heads (
+				id BIGSERIAL PRIMARY KEY,
+				hash TEXT NOT NULL UNIQUE,
+				number BIGINT NOT NULL,
+				parent_hash TEXT NOT NULL,
+				block_timestamp BIGINT NOT NULL
+			)`,
+			`CREATE INDEX idx_heads_number ON heads (number)`,
+
+			`CREATE TABLE accounts (
+				address TEXT PRIMARY KEY,
+				next_nonce BIGINT NOT NULL
+			)`,
+			`CREATE TABLE account_tx_ids (
+				address TEXT NOT NULL,
+				list_index INTEGER NOT NULL,
+				tx_id UUID NOT NULL,
+				PRIMARY KEY (address, list_index)
+			)`,
+
+			`CREATE TABLE txs (
+				id UUID PRIMARY KEY,
+				nonce BIGINT NOT NULL,
+				from_address TEXT NOT NULL,
+				to_address TEXT NOT NULL,
+				encoded_payload BYTEA,
+				value NUMERIC(78, 0),
+				gas_limit BIGINT NOT NULL,
+				max_gas_price NUMERIC(78, 0),
+				state TEXT NOT NULL,
+				error TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX idx_txs_state_from_address_nonce ON txs (state, from_address, nonce)`,
+			`CREATE TABLE tx_attempt_ids (
+				tx_id UUID NOT NULL,
+				list_index INTEGER NOT NULL,
+				attempt_id UUID NOT NULL,
+				PRIMARY KEY (tx_id, list_index)
+			)`,
+			`CREATE INDEX idx_tx_attempt_ids_attempt_id ON tx_attempt_ids (attempt_id)`,
+
+			`CREATE TABLE tx_attempts (
+				id UUID PRIMARY KEY,
+				tx_id UUID NOT NULL,
+				gas_price NUMERIC(78, 0),
+				signed_raw_tx BYTEA,
+				hash TEXT NOT NULL,
+				broadcast_before_block_num BIGINT NOT NULL,
+				state TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_tx_attempts_state ON tx_attempts (state)`,
+			`CREATE INDEX idx_tx_attempts_unset_broadcast_block ON tx_attempts (id)
+				WHERE broadcast_before_block_num = -1`,
+			`CREATE TABLE tx_attempt_receipt_ids (
+				attempt_id UUID NOT NULL,
+				list_index INTEGER NOT NULL,
+				receipt_id UUID NOT NULL,
+				PRIMARY KEY (attempt_id, list_index)
+			)`,
+			`CREATE INDEX idx_tx_attempt_receipt_ids_receipt_id ON tx_attempt_receipt_ids (receipt_id)`,
+
+			`CREATE TABLE tx_receipts (
+				id UUID PRIMARY KEY,
+				tx_hash TEXT NOT NULL,
+				block_hash TEXT NOT NULL,
+				block_number BIGINT NOT NULL,
+				transaction_index BIGINT NOT NULL,
+				receipt BYTEA
+			)`,
+			`CREATE INDEX idx_tx_receipts_block_number ON tx_receipts (block_number)`,
+
+			`CREATE TABLE jobs (
+				id UUID PRIMARY KEY,
+				tx_id UUID NOT NULL,
+				metadata BYTEA,
+				state TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_jobs_state ON jobs (state)`,
+		},
+	},
+	{
+		Version: 2,
+		Statements: []string{
+			`ALTER TABLE accounts ADD COLUMN version BIGINT NOT NULL DEFAULT 1`,
+			`ALTER TABLE txs ADD COLUMN version BIGINT NOT NULL DEFAULT 1`,
+			`ALTER TABLE tx_attempts ADD COLUMN version BIGINT NOT NULL DEFAULT 1`,
+		},
+	},
+	{
+		Version: 3,
+		Statements: []string{
+			`ALTER TABLE txs ADD COLUMN created_at BIGINT NOT NULL DEFAULT 0`,
+			`CREATE INDEX idx_txs_created_at_id ON txs (created_at, id)`,
+		},
+	},
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+const (
+	// DefaultTxQueryLimit is the page size of queries without a limit
+	DefaultTxQueryLimit = 100
+	// MaxTxQueryLimit is the largest page size, larger limits are reduced to it
+	MaxTxQueryLimit = 1000
+)
+
+// ErrInvalidCursor is returned by QueryTxs for cursors not taken from a TxPage
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SortOrder is the order of query results
+type SortOrder int
+
+const (
+	// SortAscending returns the oldest records first
+	SortAscending SortOrder = iota
+	// SortDescending returns the newest records first
+	SortDescending
+)
+
+// TxQuery selects Txs for QueryTxs. Filters left at their zero value match all Txs. Results are ordered
+// by creation time and then by ID.
+type TxQuery struct {
+	FromAddress *common.Address
+	ToAddress   *common.Address
+	// States matches Txs in any of the given states
+	States []models.TxState
+	// MinNonce and MaxNonce are inclusive
+	MinNonce *int64
+	MaxNonce *int64
+	// CreatedFrom is inclusive and CreatedTo is exclusive
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+
+	Order SortOrder
+	// Cursor continues a previous query with the same filters, it is taken from TxPage.NextCursor
+	Cursor string
+	// Limit is the maximum number of Txs returned, DefaultTxQueryLimit if not positive
+	Limit int
+}
+
+// TxPage is a single page of the results of QueryTxs
+type TxPage struct {
+	Txs []*models.Tx
+	// NextCursor continues the query after the last Tx of this page, empty if there are no more Txs
+	NextCursor string
+}
+
+// PageLimit returns the page size of the query.
+func (q *TxQuery) PageLimit() int {
+	if q.Limit <= 0 {
+		return DefaultTxQueryLimit
+	}
+	if q.Limit > MaxTxQueryLimit {
+		return MaxTxQueryLimit
+	}
+	return q.Limit
+}
+
+// Matches reports whether tx passes all filters of the query. The cursor is not taken into account.
+func (q *TxQuery) Matches(tx *models.Tx) bool {
+	if q.FromAddress != nil && tx.FromAddress != *q.FromAddress {
+		return false
+	}
+	if q.ToAddress != nil && tx.ToAddress != *q.ToAddress {
+		return false
+	}
+	if len(q.States) > 0 {
+		found := false
+		for _, state := range q.States {
+			if tx.State == state {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.MinNonce != nil && tx.Nonce < *q.MinNonce {
+		return false
+	}
+	if q.MaxNonce != nil && tx.Nonce > *q.MaxNonce {
+		return false
+	}
+	createdAt := UnixNano(tx.CreatedAt)
+	if !q.CreatedFrom.IsZero() && createdAt < UnixNano(q.CreatedFrom) {
+		return false
+	}
+	if !q.CreatedTo.IsZero() && createdAt >= UnixNano(q.CreatedTo) {
+		return false
+	}
+	return true
+}
+
+// TxCursor is the position of a Tx in the results of QueryTxs
+type TxCursor struct {
+	// CreatedAt is the creation time of the Tx in nanoseconds since the Unix epoch, see UnixNano
+	CreatedAt int64
+	ID        uuid.UUID
+}
+
+// TxCursorOf returns the position of tx.
+func TxCursorOf(tx *models.Tx) TxCursor {
+	return TxCursor{CreatedAt: UnixNano(tx.CreatedAt), ID: tx.ID}
+}
+
+// ParseTxCursor decodes a cursor of a TxPage. It returns nil for an empty cursor.
+func ParseTxCursor(cursor string) (*TxCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) != 8+len(uuid.UUID{}) {
+		return nil, errors.Wrapf(ErrInvalidCursor, "could not decode cursor %q", cursor)
+	}
+	c := &TxCursor{CreatedAt: int64(binary.BigEndian.Uint64(b))}
+	copy(c.ID[:], b[8:])
+	return c, nil
+}
+
+func (c TxCursor) String() string {
+	b := make([]byte, 8, 8+len(c.ID))
+	binary.BigEndian.PutUint64(b, uint64(c.CreatedAt))
+	return base64.RawURLEncoding.EncodeToString(append(b, c.ID[:]...))
+}
+
+// UnixNano returns t in nanoseconds since the Unix epoch, or 0 for the zero time which is used for Txs
+// created before their creation time was recorded.
+func UnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
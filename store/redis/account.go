@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+func (s *RedisStore) PutAccount(account *models.Account) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		var storedVersion int64
+		old, err := txStore.GetAccount(account.Address)
+		if err == nil {
+			storedVersion = old.Version
+		} else if !errors.Is(err, esStore.ErrNotFound) {
+			return err
+		}
+		if err = esStore.CheckVersion("Account", account.Address.Hex(), account.Version, storedVersion); err != nil {
+			return err
+		}
+		next := *account
+		next.Version++
+		if err = txStore.set(txStore.keys.accountKey(account.Address), &next); err != nil {
+			return err
+		}
+		if old == nil {
+			txStore.zadd(txStore.keys.accounts, addressField(account.Address))
+		}
+		txStore.setVersion(&account.Version, next.Version)
+		return nil
+	})
+}
+
+func (s *RedisStore) GetAccount(address common.Address) (*models.Account, error) {
+	var account models.Account
+	if err := s.get(s.keys.accountKey(address), &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (s *RedisStore) GetAccounts() ([]*models.Account, error) {
+	members, err := s.zrange(s.keys.accounts, "", "", false, 0)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []*models.Account
+	for _, member := range members {
+		account, err := s.GetAccount(common.HexToAddress(member))
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	if len(accounts) == 0 {
+		return nil, esStore.ErrNotFound
+	}
+	return accounts, nil
+}
+
+func (s *RedisStore) GetNextNonce(address common.Address) (int64, error) {
+	account, err := s.GetAccount(address)
+	if err != nil {
+		return 0, err
+	}
+	return account.NextNonce, nil
+}
+
+func (s *RedisStore) SetNextNonce(address common.Address, nextNonce int64) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		account, err := txStore.GetAccount(address)
+		if err != nil {
+			return err
+		}
+		account.NextNonce = nextNonce
+		return txStore.PutAccount(account)
+	})
+}
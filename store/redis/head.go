@@ -0,0 +1,153 @@
+package redis
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+// InsertHead inserts a block head
+func (s *RedisStore) InsertHead(head *models.Head) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		lastHead, err := txStore.LastHead()
+		if err != nil {
+			return err
+		}
+		if lastHead == nil || head.Number >= lastHead.Number {
+			txStore.setString(txStore.keys.lastHead, hashField(head.Hash))
+		}
+		oldHead, err := txStore.HeadByHash(head.Hash)
+		if err != nil {
+			return err
+		}
+		if oldHead != nil {
+			txStore.zrem(txStore.keys.headNumberIdx, headNumberMember(oldHead.Number, oldHead.Hash))
+		}
+		txStore.zadd(txStore.keys.headNumberIdx, headNumberMember(head.Number, head.Hash))
+		return txStore.set(txStore.keys.headKey(head.Hash), head)
+	})
+}
+
+// LastHead returns the head with the highest number. In the case of ties (e.g.
+// due to re-org) it returns the most recently seen head entry.
+func (s *RedisStore) LastHead() (*models.Head, error) {
+	hash, ok, err := s.getString(s.keys.lastHead)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get last head")
+	}
+	if !ok {
+		return nil, nil
+	}
+	return s.HeadByHash(common.HexToHash(hash))
+}
+
+// FirstHead returns the head with the lowest number. Only for testing.
+func (s *RedisStore) FirstHead() (*models.Head, error) {
+	members, err := s.zrange(s.keys.headNumberIdx, "", "", false, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+	return s.HeadByHash(headNumberMemberHash(members[0]))
+}
+
+// HeadByHash fetches the head with the given hash from the db, returns nil if none exists.
+func (s *RedisStore) HeadByHash(hash common.Hash) (*models.Head, error) {
+	var head models.Head
+	err := s.get(s.keys.headKey(hash), &head)
+	if err != nil {
+		if errors.Is(err, esStore.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "could not get head")
+	}
+	return &head, nil
+}
+
+// HeadsByNumber returns all heads with the given number, e.g. competing heads due to re-org.
+// Returns nil if none exists.
+func (s *RedisStore) HeadsByNumber(number int64) ([]*models.Head, error) {
+	return s.HeadsInRange(number, number)
+}
+
+// HeadsInRange returns all heads with a number between fromNumber and toNumber (both inclusive),
+// ordered by ascending number. Returns nil if none exists.
+func (s *RedisStore) HeadsInRange(fromNumber, toNumber int64) ([]*models.Head, error) {
+	if toNumber < fromNumber || toNumber < 0 {
+		return nil, nil
+	}
+	members, err := s.zrange(s.keys.headNumberIdx, encodeBlockNumber(fromNumber), encodeBlockNumber(toNumber+1), false, 0)
+	if err != nil {
+		return nil, err
+	}
+	var heads []*models.Head
+	for _, member := range members {
+		head, headErr := s.HeadByHash(headNumberMemberHash(member))
+		if headErr != nil {
+			return nil, headErr
+		}
+		if head != nil {
+			heads = append(heads, head)
+		}
+	}
+	return heads, nil
+}
+
+// TrimOldHeads deletes "depth" number of heads such that only the top N block numbers remain.
+func (s *RedisStore) TrimOldHeads(depth int64) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		lastHead, err := txStore.LastHead()
+		if err != nil {
+			return err
+		}
+		if lastHead == nil {
+			return nil
+		}
+		// Delete all heads with highestNumber - number >= depth
+		cutoff := lastHead.Number - depth + 1
+		if cutoff <= 0 {
+			return nil
+		}
+		members, err := txStore.zrange(txStore.keys.headNumberIdx, "", encodeBlockNumber(cutoff), false, 0)
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			txStore.delString(txStore.keys.headKey(headNumberMemberHash(member)))
+			txStore.zrem(txStore.keys.headNumberIdx, member)
+		}
+		return nil
+	})
+}
+
+// Chain returns the chain of heads starting at hash and up to lookback parents.
+func (s *RedisStore) Chain(hash common.Hash, lookback int64) (*models.Head, error) {
+	var firstHead *models.Head
+	var prevHead *models.Head
+	currHash := hash
+	for i := 0; i < int(lookback); i++ {
+		head, headErr := s.HeadByHash(currHash)
+		if headErr != nil {
+			return nil, errors.Wrap(headErr, "could not get head")
+		}
+		if head == nil {
+			// Chain is shorter than specified lookback
+			break
+		}
+		if firstHead == nil {
+			firstHead = head
+		} else {
+			prevHead.Parent = head
+		}
+		prevHead = head
+		currHash = prevHead.ParentHash
+	}
+	if firstHead == nil {
+		return nil, esStore.ErrNotFound
+	}
+	return firstHead, nil
+}
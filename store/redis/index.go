@@ -0,0 +1,326 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+// keys holds the names of all keys of a store. Each record is kept in its own key, named by the prefix
+// of its type and its ID, so that transactions only watch the records they read. The indexes are
+// sorted sets unless noted otherwise.
+type keys struct {
+	schema string
+
+	head     string
+	lastHead string
+	account  string
+	tx       string
+	attempt  string
+	receipt  string
+	job      string
+
+	// address, lists the accounts
+	accounts string
+	// job ID, lists the jobs
+	jobs string
+
+	// number:hash
+	headNumberIdx string
+	// address:nonce:tx ID, one sorted set per state
+	txStateIdx string
+	// nonce:tx ID, one sorted set per state and from address
+	txAccountStateIdx string
+	// created at:tx ID
+	txCreatedIdx string
+	// attempt ID, one sorted set per state
+	attemptStateIdx string
+	// attempt ID, only for attempts with BroadcastBeforeBlockNum == -1
+	attemptUnsetIdx string
+	// block number:receipt ID
+	receiptBlockIdx string
+	// attempt ID, one string per receipt ID
+	receiptAttemptIdx string
+}
+
+func newKeys(prefix string) keys {
+	// The hash tag keeps all keys in the same cluster slot, which MULTI/EXEC requires
+	p := "{" + prefix + "}:"
+	return keys{
+		schema: p + "schema",
+
+		head:     p + "head:",
+		lastHead: p + "last_head",
+		account:  p + "account:",
+		tx:       p + "tx:",
+		attempt:  p + "attempt:",
+		receipt:  p + "receipt:",
+		job:      p + "job:",
+
+		accounts: p + "accounts",
+		jobs:     p + "jobs",
+
+		headNumberIdx:     p + "ix:head_number",
+		txStateIdx:        p + "ix:tx_state:",
+		txAccountStateIdx: p + "ix:tx_account_state:",
+		txCreatedIdx:      p + "ix:tx_created",
+		attemptStateIdx:   p + "ix:attempt_state:",
+		attemptUnsetIdx:   p + "ix:attempt_unset",
+		receiptBlockIdx:   p + "ix:receipt_block",
+		receiptAttemptIdx: p + "ix:receipt_attempt:",
+	}
+}
+
+func (k keys) headKey(hash common.Hash) string {
+	return k.head + hashField(hash)
+}
+
+func (k keys) accountKey(address common.Address) string {
+	return k.account + addressField(address)
+}
+
+func (k keys) txKey(id uuid.UUID) string {
+	return k.tx + id.String()
+}
+
+func (k keys) attemptKey(id uuid.UUID) string {
+	return k.attempt + id.String()
+}
+
+func (k keys) receiptKey(id uuid.UUID) string {
+	return k.receipt + id.String()
+}
+
+func (k keys) jobKey(id uuid.UUID) string {
+	return k.job + id.String()
+}
+
+func (k keys) txState(state models.TxState) string {
+	return k.txStateIdx + string(state)
+}
+
+func (k keys) txAccountState(state models.TxState, address common.Address) string {
+	return k.txAccountStateIdx + string(state) + ":" + addressField(address)
+}
+
+func (k keys) attemptState(state models.TxAttemptState) string {
+	return k.attemptStateIdx + string(state)
+}
+
+func (k keys) receiptAttempt(receiptID uuid.UUID) string {
+	return k.receiptAttemptIdx + receiptID.String()
+}
+
+const (
+	// uint64Len is the length of a hex encoded uint64
+	uint64Len   = 16
+	uuidLen     = 36
+	errStrIndex = "could not update index"
+)
+
+func addressField(address common.Address) string {
+	return strings.ToLower(address.Hex())
+}
+
+func hashField(hash common.Hash) string {
+	return hash.Hex()
+}
+
+// encodeUint64 encodes n so that the lexicographical order matches the numeric order.
+func encodeUint64(n uint64) string {
+	return fmt.Sprintf("%016x", n)
+}
+
+func decodeUint64(s string) (uint64, error) {
+	n, err := strconv.ParseUint(s, 16, 64)
+	return n, errors.Wrapf(err, "invalid index member %q", s)
+}
+
+// encodeBlockNumber encodes a block number so that the lexicographical order matches the numeric
+// order. Negative numbers are clamped to zero.
+func encodeBlockNumber(number int64) string {
+	if number < 0 {
+		number = 0
+	}
+	return encodeUint64(uint64(number))
+}
+
+func headNumberMember(number int64, hash common.Hash) string {
+	return encodeBlockNumber(number) + ":" + hashField(hash)
+}
+
+// headNumberMemberHash extracts the head hash from a member of the head number index.
+func headNumberMemberHash(member string) common.Hash {
+	return common.HexToHash(member[uint64Len+1:])
+}
+
+// txStateMember orders the Txs of a state by from address, nonce and ID. Unassigned nonces (-1)
+// sort first.
+func txStateMember(tx *models.Tx) string {
+	return addressField(tx.FromAddress) + ":" + txAccountStateMember(tx)
+}
+
+// txAccountStateMember orders the Txs of a state sent from the same address by nonce and ID.
+func txAccountStateMember(tx *models.Tx) string {
+	return encodeUint64(uint64(tx.Nonce+1)) + ":" + tx.ID.String()
+}
+
+// txAccountStateMemberNonce extracts the nonce from a member of a Tx account state index.
+func txAccountStateMemberNonce(member string) (int64, error) {
+	n, err := decodeUint64(member[:uint64Len])
+	return int64(n) - 1, err
+}
+
+// txCreatedMember orders Txs by creation time and ID. Negative times are clamped to zero.
+func txCreatedMember(createdAt int64, id uuid.UUID) string {
+	if createdAt < 0 {
+		createdAt = 0
+	}
+	return encodeUint64(uint64(createdAt)) + ":" + id.String()
+}
+
+func receiptBlockMember(receipt *models.TxReceipt) string {
+	return encodeBlockNumber(receipt.BlockNumber) + ":" + receipt.ID.String()
+}
+
+// memberID extracts the ID from a member ending with an ID.
+func memberID(member string) (uuid.UUID, error) {
+	return parseID(member[len(member)-uuidLen:])
+}
+
+func parseID(s string) (uuid.UUID, error) {
+	id, err := uuid.Parse(s)
+	return id, errors.Wrapf(err, "invalid ID %q", s)
+}
+
+// replaceMember moves an index entry from oldMember, if not empty, to newMember.
+func (s *RedisStore) replaceMember(key, oldMember, newMember string) {
+	if oldMember == newMember {
+		return
+	}
+	if oldMember != "" {
+		s.zrem(key, oldMember)
+	}
+	s.zadd(key, newMember)
+}
+
+// indexTx updates the Tx indexes after tx has been written. old is the previously stored version of
+// the Tx, or nil if there was none.
+func (s *RedisStore) indexTx(old, tx *models.Tx) {
+	var oldStateMember, oldAccountStateMember, oldCreatedMember string
+	if old != nil {
+		oldCreatedMember = txCreatedMember(esStore.UnixNano(old.CreatedAt), old.ID)
+		if old.State == tx.State && old.FromAddress == tx.FromAddress {
+			oldStateMember = txStateMember(old)
+			oldAccountStateMember = txAccountStateMember(old)
+		} else {
+			s.zrem(s.keys.txState(old.State), txStateMember(old))
+			s.zrem(s.keys.txAccountState(old.State, old.FromAddress), txAccountStateMember(old))
+		}
+	}
+	s.replaceMember(s.keys.txState(tx.State), oldStateMember, txStateMember(tx))
+	s.replaceMember(s.keys.txAccountState(tx.State, tx.FromAddress), oldAccountStateMember, txAccountStateMember(tx))
+	s.replaceMember(s.keys.txCreatedIdx, oldCreatedMember, txCreatedMember(esStore.UnixNano(tx.CreatedAt), tx.ID))
+}
+
+// indexTxAttempt updates the TxAttempt indexes after attempt has been written or deleted. old is
+// the previously stored version of the attempt, or nil if there was none. attempt is nil on delete.
+func (s *RedisStore) indexTxAttempt(old, attempt *models.TxAttempt) {
+	if old != nil {
+		s.zrem(s.keys.attemptState(old.State), old.ID.String())
+		s.zrem(s.keys.attemptUnsetIdx, old.ID.String())
+		for _, receiptID := range old.TxReceiptIDs {
+			s.delString(s.keys.receiptAttempt(receiptID))
+		}
+	}
+	if attempt == nil {
+		return
+	}
+	s.zadd(s.keys.attemptState(attempt.State), attempt.ID.String())
+	if attempt.BroadcastBeforeBlockNum == -1 {
+		s.zadd(s.keys.attemptUnsetIdx, attempt.ID.String())
+	}
+	for _, receiptID := range attempt.TxReceiptIDs {
+		s.setString(s.keys.receiptAttempt(receiptID), attempt.ID.String())
+	}
+}
+
+// indexTxReceipt updates the receipt indexes after receipt has been written or deleted. old is the
+// previously stored version of the receipt, or nil if there was none. receipt is nil on delete.
+func (s *RedisStore) indexTxReceipt(old, receipt *models.TxReceipt) {
+	if old != nil {
+		s.zrem(s.keys.receiptBlockIdx, receiptBlockMember(old))
+	}
+	if receipt != nil {
+		s.zadd(s.keys.receiptBlockIdx, receiptBlockMember(receipt))
+	}
+}
+
+// txsInState returns the Txs in the given state, ordered by from address, nonce and ID.
+func (s *RedisStore) txsInState(state models.TxState) ([]*models.Tx, error) {
+	members, err := s.zrange(s.keys.txState(state), "", "", false, 0)
+	if err != nil {
+		return nil, err
+	}
+	return s.txsForMembers(members)
+}
+
+// txsInStateForAddress returns the Txs in the given state sent from address, ordered by nonce and
+// ID. Only the index of the address is read, so that transactions of different accounts do not
+// conflict.
+func (s *RedisStore) txsInStateForAddress(state models.TxState, address common.Address) ([]*models.Tx, error) {
+	members, err := s.zrange(s.keys.txAccountState(state, address), "", "", false, 0)
+	if err != nil {
+		return nil, err
+	}
+	return s.txsForMembers(members)
+}
+
+// txsForMembers returns the Txs of the given index members ending with their IDs.
+func (s *RedisStore) txsForMembers(members []string) ([]*models.Tx, error) {
+	var txs []*models.Tx
+	for _, member := range members {
+		id, err := memberID(member)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := s.GetTx(id)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// maxNonceInState returns the highest nonce of the Txs in the given state sent from address, or -1
+// if there are none.
+func (s *RedisStore) maxNonceInState(state models.TxState, address common.Address) (int64, error) {
+	members, err := s.zrange(s.keys.txAccountState(state, address), "", "", true, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(members) == 0 {
+		return -1, nil
+	}
+	return txAccountStateMemberNonce(members[0])
+}
+
+// hasAccounts returns ErrNotFound if no account has been stored yet.
+func (s *RedisStore) hasAccounts() error {
+	members, err := s.zrange(s.keys.accounts, "", "", false, 1)
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return esStore.ErrNotFound
+	}
+	return nil
+}
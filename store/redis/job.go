@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+func (s *RedisStore) GetJob(jobID uuid.UUID) (*models.Job, error) {
+	var job models.Job
+	if err := s.get(s.keys.jobKey(jobID), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetJobs returns all jobs ordered by ID. Returns nil if none exists.
+func (s *RedisStore) GetJobs() ([]*models.Job, error) {
+	members, err := s.zrange(s.keys.jobs, "", "", false, 0)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*models.Job
+	for _, member := range members {
+		jobID, err := parseID(member)
+		if err != nil {
+			return nil, err
+		}
+		job, err := s.GetJob(jobID)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (s *RedisStore) PutJob(job *models.Job) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		_, err := txStore.GetJob(job.ID)
+		if errors.Is(err, esStore.ErrNotFound) {
+			txStore.zadd(txStore.keys.jobs, job.ID.String())
+		} else if err != nil {
+			return err
+		}
+		return txStore.set(txStore.keys.jobKey(job.ID), job)
+	})
+}
+
+func (s *RedisStore) DeleteJob(jobID uuid.UUID) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		txStore.delString(txStore.keys.jobKey(jobID))
+		txStore.zrem(txStore.keys.jobs, jobID.String())
+		return nil
+	})
+}
+
+func (s *RedisStore) GetUnhandledJobIDs() ([]uuid.UUID, error) {
+	jobs, err := s.GetJobs()
+	if err != nil {
+		return nil, err
+	}
+	var jobIDs []uuid.UUID
+	for _, job := range jobs {
+		if job.State == models.JobStateUnhandled {
+			jobIDs = append(jobIDs, job.ID)
+		}
+	}
+	if len(jobIDs) == 0 {
+		return nil, esStore.ErrNotFound
+	}
+	return jobIDs, nil
+}
@@ -0,0 +1,196 @@
+// Package redis implements store.Store on top of Redis, so that several instances can share their state.
+//
+// Records are msgpack-encoded and kept in one key per record, named by the record type and ID. Secondary
+// indexes are sorted sets with all scores set to 0, ordered by their members, and queried by
+// lexicographical ranges. The indexes read by the operations of a single account are kept per account.
+// All keys share the hash tag of the key prefix, so the store also works with Redis Cluster.
+//
+// Transactions are optimistic: every key is watched with WATCH before a transaction reads it, writes
+// are buffered while the transaction runs and applied atomically with MULTI/EXEC. The transaction is
+// run again if another one wrote a key it read meanwhile, so instances never wait for each other.
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/begmaroman/eth-services/store"
+)
+
+const (
+	// DefaultKeyPrefix is the key prefix of stores created without one
+	DefaultKeyPrefix = "eth-services"
+	// DefaultMaxTxAttempts is the maximum number of attempts of a transaction of stores created without one
+	DefaultMaxTxAttempts = 10
+
+	// schemaVersion is the version of the key layout written by this store
+	schemaVersion = "1"
+
+	txRetryMin = 2 * time.Millisecond
+	txRetryMax = 100 * time.Millisecond
+)
+
+var (
+	// ErrUnknownSchemaVersion is returned when the keys were written by a newer version of the store
+	ErrUnknownSchemaVersion = errors.New("unknown schema version")
+	// ErrTxConflict is returned when the keys read by a transaction have been written concurrently on
+	// every attempt. Nothing has been written then.
+	ErrTxConflict = errors.New("transaction conflicts with concurrent writes")
+)
+
+// Options configures a RedisStore
+type Options struct {
+	// KeyPrefix is prepended to all keys, e.g. to keep the state of several chains in one database.
+	// Defaults to DefaultKeyPrefix.
+	KeyPrefix string
+	// MaxTxAttempts is the maximum number of times a transaction is run when the keys it read are
+	// written concurrently. Defaults to DefaultMaxTxAttempts.
+	MaxTxAttempts int
+}
+
+// RedisStore is a Store implementation using Redis
+type RedisStore struct {
+	client goredis.UniversalClient
+	keys   keys
+	opts   Options
+	// tx is set if the store is bound to a running transaction
+	tx *txn
+}
+
+var _ store.Store = (*RedisStore)(nil)
+
+// NewRedisStore creates a new RedisStore using client. It fails with ErrUnknownSchemaVersion if the
+// keys were written by a newer version of the store.
+func NewRedisStore(client goredis.UniversalClient, opts Options) (*RedisStore, error) {
+	if opts.KeyPrefix == "" {
+		opts.KeyPrefix = DefaultKeyPrefix
+	}
+	if opts.MaxTxAttempts <= 0 {
+		opts.MaxTxAttempts = DefaultMaxTxAttempts
+	}
+	s := &RedisStore{client: client, keys: newKeys(opts.KeyPrefix), opts: opts}
+
+	ctx := context.Background()
+	if err := client.SetNX(ctx, s.keys.schema, schemaVersion, 0).Err(); err != nil {
+		return nil, errors.Wrap(err, "could not set schema version")
+	}
+	version, err := client.Get(ctx, s.keys.schema).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get schema version")
+	}
+	if version != schemaVersion {
+		return nil, errors.Wrapf(ErrUnknownSchemaVersion, "schema version %s is not supported", version)
+	}
+	return s, nil
+}
+
+// RunInTx runs fn within a transaction. The writes made through the Store passed to fn are buffered
+// and written atomically once fn returns nil. Nothing is written if fn returns an error. fn is run
+// again if another transaction wrote the keys it read meanwhile, so it must not have side effects
+// besides the writes through the Store. Nested calls join the running transaction.
+func (s *RedisStore) RunInTx(fn func(store.Store) error) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		return fn(txStore)
+	})
+}
+
+func (s *RedisStore) runInTx(fn func(txStore *RedisStore) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	ctx := context.Background()
+	wait := txRetryMin
+	for attempt := 1; ; attempt++ {
+		tx := newTxn()
+		// The schema key never changes, watching it makes the connection stick to the slot of the keys
+		err := s.client.Watch(ctx, func(conn *goredis.Tx) error {
+			tx.conn = conn
+			tx.watched[s.keys.schema] = true
+			if err := fn(&RedisStore{client: s.client, keys: s.keys, opts: s.opts, tx: tx}); err != nil {
+				// The error may stem from keys written concurrently between two reads, e.g. a version
+				// conflict, the transaction is run again then
+				if s.validate(ctx, tx) == goredis.TxFailedErr {
+					return goredis.TxFailedErr
+				}
+				return err
+			}
+			return s.commit(ctx, tx)
+		}, s.keys.schema)
+		if err != goredis.TxFailedErr {
+			return err
+		}
+
+		tx.rollback()
+		if attempt >= s.opts.MaxTxAttempts {
+			return ErrTxConflict
+		}
+		time.Sleep(wait)
+		if wait *= 2; wait > txRetryMax {
+			wait = txRetryMax
+		}
+	}
+}
+
+// commit writes the buffered writes of tx in a single MULTI/EXEC block, which fails with
+// goredis.TxFailedErr if a key read by the transaction has been written in the meantime.
+func (s *RedisStore) commit(ctx context.Context, tx *txn) error {
+	if tx.empty() {
+		return nil
+	}
+	_, err := tx.conn.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		tx.apply(ctx, pipe)
+		return nil
+	})
+	if err != nil && err != goredis.TxFailedErr {
+		return errors.Wrap(err, "could not commit transaction")
+	}
+	return err
+}
+
+// validate checks whether the keys read by tx are unchanged with an empty MULTI/EXEC block, which fails
+// with goredis.TxFailedErr otherwise.
+func (s *RedisStore) validate(ctx context.Context, tx *txn) error {
+	_, err := tx.conn.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Ping(ctx)
+		return nil
+	})
+	return err
+}
+
+// setVersion sets the version of a record of the caller after it has been written, and sets it back if
+// the transaction is run again.
+func (s *RedisStore) setVersion(version *int64, next int64) {
+	previous := *version
+	*version = next
+	s.tx.onRollback(func() { *version = previous })
+}
+
+// get decodes the record stored in key into entity. It returns store.ErrNotFound if there is none.
+func (s *RedisStore) get(key string, entity interface{}) error {
+	value, ok, err := s.getString(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return store.ErrNotFound
+	}
+	if err = msgpack.Unmarshal([]byte(value), entity); err != nil {
+		return errors.Wrap(err, "could not decode data")
+	}
+	return nil
+}
+
+// set encodes entity using MessagePack and stores it in key.
+func (s *RedisStore) set(key string, entity interface{}) error {
+	value, err := msgpack.Marshal(entity)
+	if err != nil {
+		return errors.Wrap(err, "could not encode entity")
+	}
+	s.setString(key, string(value))
+	return nil
+}
@@ -0,0 +1,104 @@
+package redis_test
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+	"github.com/begmaroman/eth-services/store/redis"
+	"github.com/begmaroman/eth-services/store/storetest"
+)
+
+func newTestStore(t *testing.T) *redis.RedisStore {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		require.NoError(t, client.Close())
+	})
+	s, err := redis.NewRedisStore(client, redis.Options{})
+	require.NoError(t, err)
+	return s
+}
+
+func Test_RedisStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) esStore.Store {
+		return newTestStore(t)
+	})
+}
+
+func Test_RedisStore_ConcurrentTransactions(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	// Every writer uses its own client, as separate instances would
+	newStore := func(opts redis.Options) *redis.RedisStore {
+		client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+		t.Cleanup(func() {
+			require.NoError(t, client.Close())
+		})
+		s, err := redis.NewRedisStore(client, opts)
+		require.NoError(t, err)
+		return s
+	}
+
+	const writers = 10
+	addTxs := func(opts redis.Options, addresses []common.Address) {
+		var wg sync.WaitGroup
+		errs := make(chan error, len(addresses))
+		for _, address := range addresses {
+			s, address := newStore(opts), address
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- s.AddTx(uuid.New(), address, address, nil, big.NewInt(1), 21000, big.NewInt(1))
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+	}
+
+	t.Run("writers of the same account", func(t *testing.T) {
+		address := common.HexToAddress("0x27548a32b9ad5d64c5945eae9da5337bc3169d15")
+		require.NoError(t, newStore(redis.Options{}).PutAccount(&models.Account{Address: address}))
+
+		addresses := make([]common.Address, writers)
+		for i := range addresses {
+			addresses[i] = address
+		}
+		addTxs(redis.Options{}, addresses)
+
+		// No Tx has been lost by concurrent read-modify-write cycles of the account
+		account, err := newStore(redis.Options{}).GetAccount(address)
+		require.NoError(t, err)
+		require.Len(t, account.TxIDs, writers)
+	})
+
+	t.Run("writers of different accounts", func(t *testing.T) {
+		addresses := make([]common.Address, writers)
+		for i := range addresses {
+			addresses[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+			require.NoError(t, newStore(redis.Options{}).PutAccount(&models.Account{Address: addresses[i]}))
+		}
+
+		// The writers never read the keys of each other, so every transaction commits at once
+		addTxs(redis.Options{MaxTxAttempts: 1}, addresses)
+
+		for _, address := range addresses {
+			account, err := newStore(redis.Options{}).GetAccount(address)
+			require.NoError(t, err)
+			require.Len(t, account.TxIDs, 1)
+		}
+	})
+}
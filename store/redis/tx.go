@@ -0,0 +1,429 @@
+package redis
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+// txQueryBatchSize is the number of index members QueryTxs reads at once
+const txQueryBatchSize = 100
+
+func (s *RedisStore) AddTx(
+	txID uuid.UUID,
+	fromAddress common.Address,
+	toAddress common.Address,
+	encodedPayload []byte,
+	value *big.Int,
+	gasLimit uint64,
+	maxGasPrice *big.Int,
+) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		account, err := txStore.GetAccount(fromAddress)
+		if err != nil {
+			return err
+		}
+
+		tx := models.Tx{
+			ID:             txID,
+			FromAddress:    fromAddress,
+			ToAddress:      toAddress,
+			EncodedPayload: encodedPayload,
+			Value:          value,
+			GasLimit:       gasLimit,
+			MaxGasPrice:    maxGasPrice,
+			State:          models.TxStateUnstarted,
+			CreatedAt:      time.Now(),
+		}
+		if err = txStore.PutTx(&tx); err != nil {
+			return err
+		}
+
+		account.TxIDs = append(account.TxIDs, txID)
+		return txStore.PutAccount(account)
+	})
+}
+
+func (s *RedisStore) PutTx(tx *models.Tx) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		var storedVersion int64
+		old, err := txStore.GetTx(tx.ID)
+		if err == nil {
+			storedVersion = old.Version
+		} else if !errors.Is(err, esStore.ErrNotFound) {
+			return err
+		}
+		if err = esStore.CheckVersion("Tx", tx.ID.String(), tx.Version, storedVersion); err != nil {
+			return err
+		}
+		next := *tx
+		next.Version++
+		if err = txStore.set(txStore.keys.txKey(tx.ID), &next); err != nil {
+			return err
+		}
+		txStore.indexTx(old, &next)
+		txStore.setVersion(&tx.Version, next.Version)
+		return nil
+	})
+}
+
+func (s *RedisStore) GetTx(id uuid.UUID) (*models.Tx, error) {
+	var tx models.Tx
+	if err := s.get(s.keys.txKey(id), &tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// QueryTxs walks the creation time index in the requested order and filters the Txs it points to.
+func (s *RedisStore) QueryTxs(query esStore.TxQuery) (*esStore.TxPage, error) {
+	cursor, err := esStore.ParseTxCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	reverse := query.Order == esStore.SortDescending
+
+	var start, end string
+	if !query.CreatedFrom.IsZero() {
+		start = txCreatedMember(esStore.UnixNano(query.CreatedFrom), uuid.UUID{})
+	}
+	if !query.CreatedTo.IsZero() {
+		end = txCreatedMember(esStore.UnixNano(query.CreatedTo), uuid.UUID{})
+	}
+	if cursor != nil {
+		member := txCreatedMember(cursor.CreatedAt, cursor.ID)
+		if reverse && (end == "" || member < end) {
+			end = member
+		} else if !reverse && (start == "" || member >= start) {
+			start = member + "\x00"
+		}
+	}
+
+	limit := query.PageLimit()
+	page := &esStore.TxPage{}
+	for len(page.Txs) <= limit {
+		members, rangeErr := s.zrange(s.keys.txCreatedIdx, start, end, reverse, txQueryBatchSize)
+		if rangeErr != nil {
+			return nil, rangeErr
+		}
+		for _, member := range members {
+			id, idErr := memberID(member)
+			if idErr != nil {
+				return nil, idErr
+			}
+			tx, getErr := s.GetTx(id)
+			if getErr != nil {
+				return nil, getErr
+			}
+			if query.Matches(tx) {
+				page.Txs = append(page.Txs, tx)
+				if len(page.Txs) > limit {
+					break
+				}
+			}
+		}
+		if len(members) < txQueryBatchSize {
+			break
+		}
+		if last := members[len(members)-1]; reverse {
+			end = last
+		} else {
+			start = last + "\x00"
+		}
+	}
+	if len(page.Txs) > limit {
+		page.Txs = page.Txs[:limit]
+		page.NextCursor = esStore.TxCursorOf(page.Txs[limit-1]).String()
+	}
+	return page, nil
+}
+
+func (s *RedisStore) GetInProgressTx(fromAddress common.Address) (*models.Tx, error) {
+	if _, err := s.GetAccount(fromAddress); err != nil {
+		return nil, err
+	}
+	txs, err := s.txsInStateForAddress(models.TxStateInProgress, fromAddress)
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, esStore.ErrNotFound
+	}
+	return txs[0], nil
+}
+
+func (s *RedisStore) GetNextUnstartedTx(fromAddress common.Address) (*models.Tx, error) {
+	account, err := s.GetAccount(fromAddress)
+	if err != nil {
+		return nil, err
+	}
+	txs, err := s.txsInStateForAddress(models.TxStateUnstarted, fromAddress)
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, esStore.ErrNotFound
+	}
+
+	// Unstarted Txs have no nonce yet, so pick the one which was added to the account first
+	positions := make(map[uuid.UUID]int, len(account.TxIDs))
+	for i, txID := range account.TxIDs {
+		positions[txID] = i
+	}
+	unstartedTx := txs[0]
+	for _, tx := range txs[1:] {
+		if positions[tx.ID] < positions[unstartedTx.ID] {
+			unstartedTx = tx
+		}
+	}
+	return unstartedTx, nil
+}
+
+func (s *RedisStore) GetTxsRequiringReceiptFetch() ([]*models.Tx, error) {
+	var txs []*models.Tx
+	for _, state := range []models.TxState{models.TxStateUnconfirmed, models.TxStateConfirmedMissingReceipt} {
+		stateTxs, err := s.txsInState(state)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, stateTxs...)
+	}
+	// NOTE: Returns (nil, nil) when not found instead of (nil, ErrNotFound)
+	return txs, nil
+}
+
+func (s *RedisStore) SetBroadcastBeforeBlockNum(blockNum int64) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		members, err := txStore.zrange(txStore.keys.attemptUnsetIdx, "", "", false, 0)
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			attemptID, parseErr := parseID(member)
+			if parseErr != nil {
+				return parseErr
+			}
+			attempt, getAttemptErr := txStore.GetTxAttempt(attemptID)
+			if getAttemptErr != nil {
+				return getAttemptErr
+			}
+			if attempt.State == models.TxAttemptStateBroadcast && attempt.BroadcastBeforeBlockNum == -1 {
+				attempt.BroadcastBeforeBlockNum = blockNum
+				if err = txStore.PutTxAttempt(attempt); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *RedisStore) MarkConfirmedMissingReceipt() error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		if err := txStore.hasAccounts(); err != nil {
+			return err
+		}
+		unconfirmedTxs, err := txStore.txsInState(models.TxStateUnconfirmed)
+		if err != nil {
+			return err
+		}
+
+		// Get max nonce for confirmed Txs of each account having unconfirmed Txs
+		maxNonces := make(map[common.Address]int64)
+		for _, tx := range unconfirmedTxs {
+			if _, ok := maxNonces[tx.FromAddress]; ok {
+				continue
+			}
+			maxNonce, maxNonceErr := txStore.maxNonceInState(models.TxStateConfirmed, tx.FromAddress)
+			if maxNonceErr != nil {
+				return maxNonceErr
+			}
+			maxNonces[tx.FromAddress] = maxNonce
+		}
+
+		// Set to confirmed_missing_receipt for stale unconfirmed Txs
+		for _, tx := range unconfirmedTxs {
+			if tx.Nonce < maxNonces[tx.FromAddress] {
+				tx.State = models.TxStateConfirmedMissingReceipt
+				if err = txStore.PutTx(tx); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *RedisStore) MarkOldTxsMissingReceiptAsErrored(cutoff int64) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		if err := txStore.hasAccounts(); err != nil {
+			return err
+		}
+		txs, err := txStore.txsInState(models.TxStateConfirmedMissingReceipt)
+		if err != nil {
+			return err
+		}
+		for _, tx := range txs {
+			var maxAttemptBroadcastBeforeBlockNum int64 = -1
+			for _, attemptID := range tx.TxAttemptIDs {
+				attempt, getAttemptErr := txStore.GetTxAttempt(attemptID)
+				if getAttemptErr != nil {
+					return getAttemptErr
+				}
+				if attempt.BroadcastBeforeBlockNum > maxAttemptBroadcastBeforeBlockNum {
+					maxAttemptBroadcastBeforeBlockNum = attempt.BroadcastBeforeBlockNum
+				}
+			}
+			if maxAttemptBroadcastBeforeBlockNum != int64(-1) &&
+				maxAttemptBroadcastBeforeBlockNum < cutoff {
+				tx.State = models.TxStateFatalError
+				tx.Nonce = -1
+				tx.Error = esStore.ErrCouldNotGetReceipt.Error()
+				if err = txStore.PutTx(tx); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *RedisStore) GetTxsRequiringNewAttempt(
+	address common.Address,
+	blockNum int64,
+	gasBumpThreshold int64,
+	depth int,
+) ([]*models.Tx, error) {
+	if _, err := s.GetAccount(address); err != nil {
+		return nil, err
+	}
+	// Txs are sorted by ascending nonce by the index
+	txs, err := s.txsInStateForAddress(models.TxStateUnconfirmed, address)
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return txs, nil
+	}
+
+	limit := len(txs)
+	if depth > 0 && depth < limit {
+		limit = depth
+	}
+
+	var includedTxs []*models.Tx
+	for _, tx := range txs[:limit] {
+		excludeTx := false
+		for _, attemptID := range tx.TxAttemptIDs {
+			attempt, getAttemptErr := s.GetTxAttempt(attemptID)
+			if getAttemptErr != nil {
+				return nil, getAttemptErr
+			}
+			excludeAttempt := attempt.State != models.TxAttemptStateInsufficientEth &&
+				(attempt.State != models.TxAttemptStateBroadcast ||
+					attempt.BroadcastBeforeBlockNum == int64(-1) ||
+					attempt.BroadcastBeforeBlockNum > blockNum-gasBumpThreshold)
+			if excludeAttempt {
+				excludeTx = true
+				break
+			}
+		}
+		if !excludeTx {
+			includedTxs = append(includedTxs, tx)
+		}
+	}
+	return includedTxs, nil
+}
+
+func (s *RedisStore) GetTxsConfirmedAtOrAboveBlockHeight(blockNum int64) ([]*models.Tx, error) {
+	if err := s.hasAccounts(); err != nil {
+		return nil, err
+	}
+	members, err := s.zrange(s.keys.receiptBlockIdx, encodeBlockNumber(blockNum), "", false, 0)
+	if err != nil {
+		return nil, err
+	}
+	var allTxs []*models.Tx
+	seen := make(map[uuid.UUID]bool)
+	for _, member := range members {
+		receiptID, idErr := memberID(member)
+		if idErr != nil {
+			return nil, idErr
+		}
+		attemptIDStr, ok, getErr := s.getString(s.keys.receiptAttempt(receiptID))
+		if getErr != nil {
+			return nil, getErr
+		}
+		if !ok {
+			// Receipt is not attached to any attempt
+			continue
+		}
+		attemptID, idErr := parseID(attemptIDStr)
+		if idErr != nil {
+			return nil, idErr
+		}
+		attempt, getAttemptErr := s.GetTxAttempt(attemptID)
+		if getAttemptErr != nil {
+			return nil, getAttemptErr
+		}
+		if attempt.State != models.TxAttemptStateBroadcast || seen[attempt.TxID] {
+			continue
+		}
+		tx, getTxErr := s.GetTx(attempt.TxID)
+		if getTxErr != nil {
+			return nil, getTxErr
+		}
+		if tx.State != models.TxStateConfirmed && tx.State != models.TxStateConfirmedMissingReceipt {
+			continue
+		}
+		seen[tx.ID] = true
+		allTxs = append(allTxs, tx)
+	}
+
+	// Sort txs by account and ascending nonce
+	sort.Slice(allTxs, func(i int, j int) bool {
+		from, to := addressField(allTxs[i].FromAddress), addressField(allTxs[j].FromAddress)
+		if cmp := strings.Compare(from, to); cmp != 0 {
+			return cmp < 0
+		}
+		return allTxs[i].Nonce < allTxs[j].Nonce
+	})
+	return allTxs, nil
+}
+
+func (s *RedisStore) IsTxConfirmedAtOrBeforeBlockNumber(txID uuid.UUID, blockNumber int64) (bool, error) {
+	tx, err := s.GetTx(txID)
+	if err != nil {
+		return false, err
+	}
+	if tx.State != models.TxStateConfirmed && tx.State != models.TxStateConfirmedMissingReceipt {
+		return false, nil
+	}
+	for _, attemptID := range tx.TxAttemptIDs {
+		attempt, getAttemptErr := s.GetTxAttempt(attemptID)
+		if getAttemptErr != nil {
+			return false, getAttemptErr
+		}
+		if attempt.State != models.TxAttemptStateBroadcast {
+			continue
+		}
+		for j := len(attempt.TxReceiptIDs) - 1; j >= 0; j-- {
+			receipt, getReceiptErr := s.GetTxReceipt(attempt.TxReceiptIDs[j])
+			if getReceiptErr != nil {
+				return false, getReceiptErr
+			}
+			if receipt.BlockNumber <= blockNumber {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
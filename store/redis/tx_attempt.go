@@ -0,0 +1,185 @@
+package redis
+
+import (
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+func (s *RedisStore) PutTxAttempt(attempt *models.TxAttempt) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		var storedVersion int64
+		old, err := txStore.GetTxAttempt(attempt.ID)
+		if err == nil {
+			storedVersion = old.Version
+		} else if !errors.Is(err, esStore.ErrNotFound) {
+			return err
+		}
+		if err = esStore.CheckVersion("TxAttempt", attempt.ID.String(), attempt.Version, storedVersion); err != nil {
+			return err
+		}
+		next := *attempt
+		next.Version++
+		if err = txStore.set(txStore.keys.attemptKey(attempt.ID), &next); err != nil {
+			return err
+		}
+		txStore.indexTxAttempt(old, &next)
+		txStore.setVersion(&attempt.Version, next.Version)
+		return nil
+	})
+}
+
+func (s *RedisStore) GetTxAttempt(id uuid.UUID) (*models.TxAttempt, error) {
+	var attempt models.TxAttempt
+	if err := s.get(s.keys.attemptKey(id), &attempt); err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (s *RedisStore) GetAttemptsForTx(tx *models.Tx) ([]*models.TxAttempt, error) {
+	var attempts []*models.TxAttempt
+	for _, attemptID := range tx.TxAttemptIDs {
+		attempt, err := s.GetTxAttempt(attemptID)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, nil
+}
+
+// AddOrUpdateAttempt adds a new attempt or updates an existing attempt assuming only the state, NOT
+// the gas price, has changed. In case of an addition, the list of attempts are sorted by gas price.
+// The attempt and the Tx are written atomically.
+func (s *RedisStore) AddOrUpdateAttempt(tx *models.Tx, attempt *models.TxAttempt) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		attemptIDs := tx.TxAttemptIDs
+		txStore.tx.onRollback(func() { tx.TxAttemptIDs = attemptIDs })
+		if err := txStore.PutTxAttempt(attempt); err != nil {
+			return err
+		}
+		for _, attemptID := range tx.TxAttemptIDs {
+			if attemptID == attempt.ID {
+				return txStore.PutTx(tx)
+			}
+		}
+		tx.TxAttemptIDs = append(tx.TxAttemptIDs, attempt.ID)
+		if err := txStore.sortAttemptsByGasPriceForTx(tx); err != nil {
+			return err
+		}
+		return txStore.PutTx(tx)
+	})
+}
+
+// ReplaceAttempt removes an existing attempt and adds a new attempt with a different ID. Sorts the new list of attempts
+// by gas price. The new attempt and the Tx are written atomically.
+func (s *RedisStore) ReplaceAttempt(tx *models.Tx, oldAttempt *models.TxAttempt, newAttempt *models.TxAttempt) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		originalIDs := tx.TxAttemptIDs
+		txStore.tx.onRollback(func() { tx.TxAttemptIDs = originalIDs })
+		if err := txStore.PutTxAttempt(newAttempt); err != nil {
+			return err
+		}
+		attemptIDs := append([]uuid.UUID{}, tx.TxAttemptIDs...)
+		removeIndex := -1
+		for i, attemptID := range attemptIDs {
+			if attemptID == oldAttempt.ID {
+				removeIndex = i
+				break
+			}
+		}
+		if removeIndex == -1 {
+			return errors.New("old attempt not found")
+		}
+		copy(attemptIDs[removeIndex:], attemptIDs[removeIndex+1:])
+		attemptIDs = attemptIDs[:len(attemptIDs)-1]
+		tx.TxAttemptIDs = append(attemptIDs, newAttempt.ID)
+		if err := txStore.sortAttemptsByGasPriceForTx(tx); err != nil {
+			return err
+		}
+		return txStore.PutTx(tx)
+	})
+}
+
+func (s *RedisStore) sortAttemptsByGasPriceForTx(tx *models.Tx) error {
+	attempts, err := s.GetAttemptsForTx(tx)
+	if err != nil {
+		return err
+	}
+
+	// Sort txs by descending GasPrice
+	sort.Slice(attempts, func(i int, j int) bool {
+		return attempts[i].GasPrice.Cmp(attempts[j].GasPrice) == 1
+	})
+
+	// Reconstruct attemptIDs
+	var attemptIDs []uuid.UUID
+	for _, attempt := range attempts {
+		attemptIDs = append(attemptIDs, attempt.ID)
+	}
+	tx.TxAttemptIDs = attemptIDs
+	return nil
+}
+
+func (s *RedisStore) DeleteTxAttempt(id uuid.UUID) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		old, err := txStore.GetTxAttempt(id)
+		if err != nil {
+			if errors.Is(err, esStore.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		txStore.delString(txStore.keys.attemptKey(id))
+		txStore.indexTxAttempt(old, nil)
+		return nil
+	})
+}
+
+func (s *RedisStore) GetInProgressAttempts(address common.Address) ([]*models.TxAttempt, error) {
+	if _, err := s.GetAccount(address); err != nil {
+		return nil, err
+	}
+	members, err := s.zrange(s.keys.attemptState(models.TxAttemptStateInProgress), "", "", false, 0)
+	if err != nil {
+		return nil, err
+	}
+	var attempts []*models.TxAttempt
+	for _, member := range members {
+		attemptID, parseErr := parseID(member)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		attempt, getAttemptErr := s.GetTxAttempt(attemptID)
+		if getAttemptErr != nil {
+			return nil, getAttemptErr
+		}
+		tx, getTxErr := s.GetTx(attempt.TxID)
+		if getTxErr != nil {
+			if errors.Is(getTxErr, esStore.ErrNotFound) {
+				continue
+			}
+			return nil, getTxErr
+		}
+		if tx.FromAddress != address {
+			continue
+		}
+		if tx.State != models.TxStateConfirmed && tx.State != models.TxStateConfirmedMissingReceipt &&
+			tx.State != models.TxStateUnconfirmed {
+			continue
+		}
+		for _, txAttemptID := range tx.TxAttemptIDs {
+			if txAttemptID == attemptID {
+				attempts = append(attempts, attempt)
+				break
+			}
+		}
+	}
+	return attempts, nil
+}
@@ -0,0 +1,46 @@
+package redis
+
+import (
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+func (s *RedisStore) GetTxReceipt(id uuid.UUID) (*models.TxReceipt, error) {
+	var receipt models.TxReceipt
+	if err := s.get(s.keys.receiptKey(id), &receipt); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+func (s *RedisStore) PutTxReceipt(receipt *models.TxReceipt) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		old, err := txStore.GetTxReceipt(receipt.ID)
+		if err != nil && !errors.Is(err, esStore.ErrNotFound) {
+			return err
+		}
+		if err = txStore.set(txStore.keys.receiptKey(receipt.ID), receipt); err != nil {
+			return err
+		}
+		txStore.indexTxReceipt(old, receipt)
+		return nil
+	})
+}
+
+func (s *RedisStore) DeleteTxReceipt(id uuid.UUID) error {
+	return s.runInTx(func(txStore *RedisStore) error {
+		old, err := txStore.GetTxReceipt(id)
+		if err != nil {
+			if errors.Is(err, esStore.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		txStore.delString(txStore.keys.receiptKey(id))
+		txStore.indexTxReceipt(old, nil)
+		return nil
+	})
+}
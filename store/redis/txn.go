@@ -0,0 +1,211 @@
+package redis
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// txn buffers the writes of a transaction. Reads made through a store bound to the transaction merge
+// the buffered writes into the stored data, so that the transaction sees its own writes.
+type txn struct {
+	// strings maps keys to values, nil values are deleted keys
+	strings map[string]*string
+	// zsets maps keys to members, true for added and false for removed members
+	zsets map[string]map[string]bool
+
+	// conn is the connection the transaction reads and commits through, watched lists its watched keys
+	conn    *goredis.Tx
+	watched map[string]bool
+	// undo reverts the changes made to the records of the caller, so that the transaction can be run again
+	undo []func()
+}
+
+func newTxn() *txn {
+	return &txn{
+		strings: make(map[string]*string),
+		zsets:   make(map[string]map[string]bool),
+		watched: make(map[string]bool),
+	}
+}
+
+// onRollback registers fn to revert a change made to a record of the caller if the transaction is run
+// again.
+func (tx *txn) onRollback(fn func()) {
+	tx.undo = append(tx.undo, fn)
+}
+
+// rollback reverts the changes made to the records of the caller, latest first.
+func (tx *txn) rollback() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+	tx.undo = nil
+}
+
+func (tx *txn) empty() bool {
+	return len(tx.strings) == 0 && len(tx.zsets) == 0
+}
+
+func (tx *txn) setMember(key, member string, present bool) {
+	members, ok := tx.zsets[key]
+	if !ok {
+		members = make(map[string]bool)
+		tx.zsets[key] = members
+	}
+	members[member] = present
+}
+
+// apply queues the buffered writes on pipe.
+func (tx *txn) apply(ctx context.Context, pipe goredis.Pipeliner) {
+	for key, value := range tx.strings {
+		if value == nil {
+			pipe.Del(ctx, key)
+		} else {
+			pipe.Set(ctx, key, *value, 0)
+		}
+	}
+	for key, members := range tx.zsets {
+		var added []goredis.Z
+		var removed []interface{}
+		for member, present := range members {
+			if present {
+				added = append(added, goredis.Z{Member: member})
+			} else {
+				removed = append(removed, member)
+			}
+		}
+		if len(added) > 0 {
+			pipe.ZAdd(ctx, key, added...)
+		}
+		if len(removed) > 0 {
+			pipe.ZRem(ctx, key, removed...)
+		}
+	}
+}
+
+// reader returns the client to read key with. Within a transaction the key is watched before it is read,
+// so that the transaction fails to commit if the key is written concurrently afterwards.
+func (s *RedisStore) reader(ctx context.Context, key string) (goredis.Cmdable, error) {
+	if s.tx == nil {
+		return s.client, nil
+	}
+	if !s.tx.watched[key] {
+		if err := s.tx.conn.Watch(ctx, key).Err(); err != nil {
+			return nil, errors.Wrap(err, "could not watch key")
+		}
+		s.tx.watched[key] = true
+	}
+	return s.tx.conn, nil
+}
+
+// getString returns the value of the string key and whether it exists.
+func (s *RedisStore) getString(key string) (string, bool, error) {
+	if s.tx != nil {
+		if value, ok := s.tx.strings[key]; ok {
+			if value == nil {
+				return "", false, nil
+			}
+			return *value, true, nil
+		}
+	}
+	ctx := context.Background()
+	client, err := s.reader(ctx, key)
+	if err != nil {
+		return "", false, err
+	}
+	value, err := client.Get(ctx, key).Result()
+	if err == goredis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, errors.Wrap(err, "could not get data")
+	}
+	return value, true, nil
+}
+
+func (s *RedisStore) setString(key, value string) {
+	s.tx.strings[key] = &value
+}
+
+func (s *RedisStore) delString(key string) {
+	s.tx.strings[key] = nil
+}
+
+func (s *RedisStore) zadd(key, member string) {
+	s.tx.setMember(key, member, true)
+}
+
+func (s *RedisStore) zrem(key, member string) {
+	s.tx.setMember(key, member, false)
+}
+
+// zrange returns the members of the sorted set key within [start, end), in descending order if
+// reverse is set. Empty bounds are unbounded. At most limit members are returned if limit is positive.
+func (s *RedisStore) zrange(key, start, end string, reverse bool, limit int) ([]string, error) {
+	if start != "" && end != "" && start >= end {
+		return nil, nil
+	}
+	by := &goredis.ZRangeBy{Min: "-", Max: "+"}
+	if start != "" {
+		by.Min = "[" + start
+	}
+	if end != "" {
+		by.Max = "(" + end
+	}
+	var buffered map[string]bool
+	if s.tx != nil {
+		buffered = s.tx.zsets[key]
+	}
+	if limit > 0 && len(buffered) == 0 {
+		by.Count = int64(limit)
+	}
+
+	ctx := context.Background()
+	client, err := s.reader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var members []string
+	if reverse {
+		members, err = client.ZRevRangeByLex(ctx, key, by).Result()
+	} else {
+		members, err = client.ZRangeByLex(ctx, key, by).Result()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query index")
+	}
+	if len(buffered) == 0 {
+		return members, nil
+	}
+
+	merged := make(map[string]bool, len(members))
+	for _, member := range members {
+		merged[member] = true
+	}
+	for member, present := range buffered {
+		if (start != "" && member < start) || (end != "" && member >= end) {
+			continue
+		}
+		if present {
+			merged[member] = true
+		} else {
+			delete(merged, member)
+		}
+	}
+	members = members[:0]
+	for member := range merged {
+		members = append(members, member)
+	}
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(members)))
+	} else {
+		sort.Strings(members)
+	}
+	if limit > 0 && len(members) > limit {
+		members = members[:limit]
+	}
+	return members, nil
+}
@@ -0,0 +1,237 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/google/uuid"
+
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+// The record types define the snapshot format independently of the models, so that changes of the
+// models don't silently change the format. Any incompatible change requires a new Version.
+
+// Record types
+const (
+	typeHeader    = "header"
+	typeHead      = "head"
+	typeAccount   = "account"
+	typeTx        = "tx"
+	typeTxAttempt = "tx_attempt"
+	typeTxReceipt = "tx_receipt"
+	typeJob       = "job"
+)
+
+// record is a single line of a snapshot
+type record struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// header is the first record of every snapshot
+type header struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type headRecord struct {
+	Hash       common.Hash `json:"hash"`
+	Number     int64       `json:"number"`
+	ParentHash common.Hash `json:"parentHash"`
+	Timestamp  int64       `json:"timestamp"`
+}
+
+func fromHead(head *models.Head) *headRecord {
+	return &headRecord{
+		Hash:       head.Hash,
+		Number:     head.Number,
+		ParentHash: head.ParentHash,
+		Timestamp:  head.Timestamp.Unix(),
+	}
+}
+
+func (r *headRecord) toModel() *models.Head {
+	return &models.Head{
+		Hash:       r.Hash,
+		Number:     r.Number,
+		ParentHash: r.ParentHash,
+		Timestamp:  time.Unix(r.Timestamp, 0),
+	}
+}
+
+type accountRecord struct {
+	Address   common.Address `json:"address"`
+	NextNonce int64          `json:"nextNonce"`
+	TxIDs     []uuid.UUID    `json:"txIds"`
+}
+
+func fromAccount(account *models.Account) *accountRecord {
+	return &accountRecord{
+		Address:   account.Address,
+		NextNonce: account.NextNonce,
+		TxIDs:     account.TxIDs,
+	}
+}
+
+func (r *accountRecord) toModel() *models.Account {
+	return &models.Account{
+		Address:   r.Address,
+		NextNonce: r.NextNonce,
+		TxIDs:     r.TxIDs,
+	}
+}
+
+type txRecord struct {
+	ID             uuid.UUID      `json:"id"`
+	Nonce          int64          `json:"nonce"`
+	FromAddress    common.Address `json:"fromAddress"`
+	ToAddress      common.Address `json:"toAddress"`
+	EncodedPayload hexutil.Bytes  `json:"encodedPayload"`
+	Value          *hexutil.Big   `json:"value"`
+	GasLimit       hexutil.Uint64 `json:"gasLimit"`
+	MaxGasPrice    *hexutil.Big   `json:"maxGasPrice"`
+	State          string         `json:"state"`
+	Error          string         `json:"error,omitempty"`
+	TxAttemptIDs   []uuid.UUID    `json:"txAttemptIds"`
+	// CreatedAt is missing for Txs added before their creation time was recorded
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+func fromTx(tx *models.Tx) *txRecord {
+	var createdAt *time.Time
+	if !tx.CreatedAt.IsZero() {
+		t := tx.CreatedAt.UTC()
+		createdAt = &t
+	}
+	return &txRecord{
+		ID:             tx.ID,
+		Nonce:          tx.Nonce,
+		FromAddress:    tx.FromAddress,
+		ToAddress:      tx.ToAddress,
+		EncodedPayload: tx.EncodedPayload,
+		Value:          (*hexutil.Big)(tx.Value),
+		GasLimit:       hexutil.Uint64(tx.GasLimit),
+		MaxGasPrice:    (*hexutil.Big)(tx.MaxGasPrice),
+		State:          string(tx.State),
+		Error:          tx.Error,
+		TxAttemptIDs:   tx.TxAttemptIDs,
+		CreatedAt:      createdAt,
+	}
+}
+
+func (r *txRecord) toModel() *models.Tx {
+	var createdAt time.Time
+	if r.CreatedAt != nil {
+		createdAt = *r.CreatedAt
+	}
+	return &models.Tx{
+		ID:             r.ID,
+		Nonce:          r.Nonce,
+		FromAddress:    r.FromAddress,
+		ToAddress:      r.ToAddress,
+		EncodedPayload: r.EncodedPayload,
+		Value:          r.Value.ToInt(),
+		GasLimit:       uint64(r.GasLimit),
+		MaxGasPrice:    r.MaxGasPrice.ToInt(),
+		State:          models.TxState(r.State),
+		Error:          r.Error,
+		TxAttemptIDs:   r.TxAttemptIDs,
+		CreatedAt:      createdAt,
+	}
+}
+
+type txAttemptRecord struct {
+	ID                      uuid.UUID     `json:"id"`
+	TxID                    uuid.UUID     `json:"txId"`
+	GasPrice                *hexutil.Big  `json:"gasPrice"`
+	SignedRawTx             hexutil.Bytes `json:"signedRawTx"`
+	Hash                    common.Hash   `json:"hash"`
+	BroadcastBeforeBlockNum int64         `json:"broadcastBeforeBlockNum"`
+	State                   string        `json:"state"`
+	TxReceiptIDs            []uuid.UUID   `json:"txReceiptIds"`
+}
+
+func fromTxAttempt(attempt *models.TxAttempt) *txAttemptRecord {
+	return &txAttemptRecord{
+		ID:                      attempt.ID,
+		TxID:                    attempt.TxID,
+		GasPrice:                (*hexutil.Big)(attempt.GasPrice),
+		SignedRawTx:             attempt.SignedRawTx,
+		Hash:                    attempt.Hash,
+		BroadcastBeforeBlockNum: attempt.BroadcastBeforeBlockNum,
+		State:                   string(attempt.State),
+		TxReceiptIDs:            attempt.TxReceiptIDs,
+	}
+}
+
+func (r *txAttemptRecord) toModel() *models.TxAttempt {
+	return &models.TxAttempt{
+		ID:                      r.ID,
+		TxID:                    r.TxID,
+		GasPrice:                r.GasPrice.ToInt(),
+		SignedRawTx:             r.SignedRawTx,
+		Hash:                    r.Hash,
+		BroadcastBeforeBlockNum: r.BroadcastBeforeBlockNum,
+		State:                   models.TxAttemptState(r.State),
+		TxReceiptIDs:            r.TxReceiptIDs,
+	}
+}
+
+type txReceiptRecord struct {
+	ID               uuid.UUID     `json:"id"`
+	TxHash           common.Hash   `json:"txHash"`
+	BlockHash        common.Hash   `json:"blockHash"`
+	BlockNumber      int64         `json:"blockNumber"`
+	TransactionIndex uint          `json:"transactionIndex"`
+	Receipt          hexutil.Bytes `json:"receipt"`
+}
+
+func fromTxReceipt(receipt *models.TxReceipt) *txReceiptRecord {
+	return &txReceiptRecord{
+		ID:               receipt.ID,
+		TxHash:           receipt.TxHash,
+		BlockHash:        receipt.BlockHash,
+		BlockNumber:      receipt.BlockNumber,
+		TransactionIndex: receipt.TransactionIndex,
+		Receipt:          receipt.Receipt,
+	}
+}
+
+func (r *txReceiptRecord) toModel() *models.TxReceipt {
+	return &models.TxReceipt{
+		ID:               r.ID,
+		TxHash:           r.TxHash,
+		BlockHash:        r.BlockHash,
+		BlockNumber:      r.BlockNumber,
+		TransactionIndex: r.TransactionIndex,
+		Receipt:          r.Receipt,
+	}
+}
+
+type jobRecord struct {
+	ID       uuid.UUID     `json:"id"`
+	TxID     uuid.UUID     `json:"txId"`
+	Metadata hexutil.Bytes `json:"metadata"`
+	State    string        `json:"state"`
+}
+
+func fromJob(job *models.Job) *jobRecord {
+	return &jobRecord{
+		ID:       job.ID,
+		TxID:     job.TxID,
+		Metadata: job.Metadata,
+		State:    string(job.State),
+	}
+}
+
+func (r *jobRecord) toModel() *models.Job {
+	return &models.Job{
+		ID:       r.ID,
+		TxID:     r.TxID,
+		Metadata: r.Metadata,
+		State:    models.JobState(r.State),
+	}
+}
@@ -0,0 +1,262 @@
+// Package snapshot exports the content of a store.Store to a portable JSON Lines snapshot and
+// imports it again, e.g. for backups, for moving to another backend or as fixtures for bug reports.
+//
+// A snapshot starts with a header record carrying the format version followed by one record per
+// line, each of them an object with the record type and its data:
+//
+//	{"type":"header","data":{"version":1,"createdAt":"2021-01-01T00:00:00Z"}}
+//	{"type":"head","data":{"hash":"0x...","number":42,"parentHash":"0x...","timestamp":1609459200}}
+//	{"type":"account","data":{"address":"0x...","nextNonce":3,"txIds":["..."]}}
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+// Version is the version of the snapshot format written by Export
+const Version = 1
+
+// ErrUnknownVersion is returned by Import for snapshots newer than Version
+var ErrUnknownVersion = errors.New("unknown snapshot version")
+
+// Export writes all heads, accounts, Txs, attempts, receipts and jobs of store to w. Txs are found
+// through the accounts, attempts through the Txs and receipts through the attempts, records not
+// referenced this way are not exported. The snapshot is read within one transaction of store.
+func Export(store esStore.Store, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	err := store.RunInTx(func(txStore esStore.Store) error {
+		e := &exporter{store: txStore, enc: json.NewEncoder(bw)}
+		return e.export()
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(bw.Flush(), "could not write snapshot")
+}
+
+type exporter struct {
+	store esStore.Store
+	enc   *json.Encoder
+}
+
+func (e *exporter) write(recordType string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrapf(err, "could not encode %s", recordType)
+	}
+	if err = e.enc.Encode(&record{Type: recordType, Data: raw}); err != nil {
+		return errors.Wrap(err, "could not write snapshot")
+	}
+	return nil
+}
+
+func (e *exporter) export() error {
+	if err := e.write(typeHeader, &header{Version: Version, CreatedAt: time.Now().UTC()}); err != nil {
+		return err
+	}
+	if err := e.exportHeads(); err != nil {
+		return err
+	}
+	accounts, err := e.store.GetAccounts()
+	if err != nil && !errors.Is(err, esStore.ErrNotFound) {
+		return err
+	}
+	for _, account := range accounts {
+		if err = e.exportAccount(account); err != nil {
+			return err
+		}
+	}
+	jobs, err := e.store.GetJobs()
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if err = e.write(typeJob, fromJob(job)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportHeads writes the heads ordered by number and hash. The last head is written last, so that
+// it is the last head again after the import.
+func (e *exporter) exportHeads() error {
+	lastHead, err := e.store.LastHead()
+	if err != nil {
+		return err
+	}
+	if lastHead == nil {
+		return nil
+	}
+	heads, err := e.store.HeadsInRange(0, lastHead.Number)
+	if err != nil {
+		return err
+	}
+	sort.Slice(heads, func(i, j int) bool {
+		if heads[i].Number != heads[j].Number {
+			return heads[i].Number < heads[j].Number
+		}
+		return bytes.Compare(heads[i].Hash.Bytes(), heads[j].Hash.Bytes()) < 0
+	})
+	for _, head := range heads {
+		if head.Hash == lastHead.Hash {
+			continue
+		}
+		if err = e.write(typeHead, fromHead(head)); err != nil {
+			return err
+		}
+	}
+	return e.write(typeHead, fromHead(lastHead))
+}
+
+func (e *exporter) exportAccount(account *models.Account) error {
+	if err := e.write(typeAccount, fromAccount(account)); err != nil {
+		return err
+	}
+	for _, txID := range account.TxIDs {
+		tx, err := e.store.GetTx(txID)
+		if err != nil {
+			return errors.Wrapf(err, "could not get Tx %s", txID)
+		}
+		if err = e.write(typeTx, fromTx(tx)); err != nil {
+			return err
+		}
+		attempts, err := e.store.GetAttemptsForTx(tx)
+		if err != nil {
+			return errors.Wrapf(err, "could not get attempts of Tx %s", txID)
+		}
+		for _, attempt := range attempts {
+			if err = e.write(typeTxAttempt, fromTxAttempt(attempt)); err != nil {
+				return err
+			}
+			for _, receiptID := range attempt.TxReceiptIDs {
+				receipt, getErr := e.store.GetTxReceipt(receiptID)
+				if getErr != nil {
+					return errors.Wrapf(getErr, "could not get receipt %s", receiptID)
+				}
+				if err = e.write(typeTxReceipt, fromTxReceipt(receipt)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Import reads a snapshot written by Export from r and writes all of its records to store. Existing
+// records with the same keys are overwritten regardless of their versions. The import is atomic,
+// nothing is written if it fails. It runs in a single transaction of store, so stores buffering the
+// writes of a transaction hold the whole snapshot until it commits. TMStore buffers them in memory,
+// so the memory used by the import grows with the size of the snapshot.
+func Import(store esStore.Store, r io.Reader) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	var first record
+	if err := dec.Decode(&first); err != nil {
+		return errors.Wrap(err, "could not read snapshot header")
+	}
+	if first.Type != typeHeader {
+		return errors.Errorf("snapshot must start with a header, got %q", first.Type)
+	}
+	var h header
+	if err := json.Unmarshal(first.Data, &h); err != nil {
+		return errors.Wrap(err, "could not decode snapshot header")
+	}
+	if h.Version > Version {
+		return errors.Wrapf(ErrUnknownVersion, "snapshot version %d is newer than the latest known version %d",
+			h.Version, Version)
+	}
+
+	return store.RunInTx(func(txStore esStore.Store) error {
+		for n := 2; ; n++ {
+			var rec record
+			err := dec.Decode(&rec)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return errors.Wrapf(err, "could not read record %d", n)
+			}
+			if err = importRecord(txStore, &rec); err != nil {
+				return errors.Wrapf(err, "could not import record %d", n)
+			}
+		}
+	})
+}
+
+func importRecord(store esStore.Store, rec *record) error {
+	switch rec.Type {
+	case typeHead:
+		var r headRecord
+		if err := json.Unmarshal(rec.Data, &r); err != nil {
+			return errors.Wrap(err, "could not decode head")
+		}
+		return store.InsertHead(r.toModel())
+	case typeAccount:
+		var r accountRecord
+		if err := json.Unmarshal(rec.Data, &r); err != nil {
+			return errors.Wrap(err, "could not decode account")
+		}
+		account := r.toModel()
+		existing, err := store.GetAccount(account.Address)
+		if err != nil && !errors.Is(err, esStore.ErrNotFound) {
+			return err
+		}
+		if existing != nil {
+			account.Version = existing.Version
+		}
+		return store.PutAccount(account)
+	case typeTx:
+		var r txRecord
+		if err := json.Unmarshal(rec.Data, &r); err != nil {
+			return errors.Wrap(err, "could not decode Tx")
+		}
+		tx := r.toModel()
+		existing, err := store.GetTx(tx.ID)
+		if err != nil && !errors.Is(err, esStore.ErrNotFound) {
+			return err
+		}
+		if existing != nil {
+			tx.Version = existing.Version
+		}
+		return store.PutTx(tx)
+	case typeTxAttempt:
+		var r txAttemptRecord
+		if err := json.Unmarshal(rec.Data, &r); err != nil {
+			return errors.Wrap(err, "could not decode TxAttempt")
+		}
+		attempt := r.toModel()
+		existing, err := store.GetTxAttempt(attempt.ID)
+		if err != nil && !errors.Is(err, esStore.ErrNotFound) {
+			return err
+		}
+		if existing != nil {
+			attempt.Version = existing.Version
+		}
+		return store.PutTxAttempt(attempt)
+	case typeTxReceipt:
+		var r txReceiptRecord
+		if err := json.Unmarshal(rec.Data, &r); err != nil {
+			return errors.Wrap(err, "could not decode TxReceipt")
+		}
+		return store.PutTxReceipt(r.toModel())
+	case typeJob:
+		var r jobRecord
+		if err := json.Unmarshal(rec.Data, &r); err != nil {
+			return errors.Wrap(err, "could not decode Job")
+		}
+		return store.PutJob(r.toModel())
+	default:
+		return errors.Errorf("unknown record type %q", rec.Type)
+	}
+}
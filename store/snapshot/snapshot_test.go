@@ -0,0 +1,136 @@
+package snapshot_test
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	tmDB "github.com/tendermint/tm-db"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+	"github.com/begmaroman/eth-services/store/snapshot"
+	"github.com/begmaroman/eth-services/store/sqlite"
+	"github.com/begmaroman/eth-services/store/tendermint"
+)
+
+func newTMStore(t *testing.T) esStore.Store {
+	s, err := tendermint.NewTMStore(tmDB.NewMemDB())
+	require.NoError(t, err)
+	return s
+}
+
+func newSQLiteStore(t *testing.T) esStore.Store {
+	s, err := sqlite.Open(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, s.DB().Close())
+	})
+	return s
+}
+
+func fillStore(t *testing.T, s esStore.Store) (address common.Address, txID uuid.UUID) {
+	newHead := func(hash string, number int64, parentHash common.Hash) *models.Head {
+		return &models.Head{
+			Hash:       common.HexToHash(hash),
+			Number:     number,
+			ParentHash: parentHash,
+			Timestamp:  time.Unix(1600000000+number, 0),
+		}
+	}
+	parent := newHead("0x01", 1, common.Hash{})
+	head := newHead("0x02", 2, parent.Hash)
+	// Competing head inserted before the last head, with a higher hash
+	uncle := newHead("0x03", 2, parent.Hash)
+	for _, h := range []*models.Head{parent, uncle, head} {
+		require.NoError(t, s.InsertHead(h))
+	}
+
+	address = common.HexToAddress("0x27548a32b9ad5d64c5945eae9da5337bc3169d15")
+	require.NoError(t, s.PutAccount(&models.Account{Address: address, NextNonce: 1}))
+	txID = uuid.New()
+	require.NoError(t, s.AddTx(txID, address, address, []byte{1, 2, 3}, big.NewInt(142), 21000, big.NewInt(1e9)))
+	tx, err := s.GetTx(txID)
+	require.NoError(t, err)
+	tx.State = models.TxStateConfirmed
+	require.NoError(t, s.PutTx(tx))
+
+	receipt := &models.TxReceipt{ID: uuid.New(), TxHash: common.HexToHash("0x04"), BlockNumber: 2, Receipt: []byte(`{}`)}
+	require.NoError(t, s.PutTxReceipt(receipt))
+	attempt := &models.TxAttempt{
+		ID:                      uuid.New(),
+		TxID:                    txID,
+		GasPrice:                big.NewInt(1e9),
+		SignedRawTx:             []byte{4, 5, 6},
+		Hash:                    receipt.TxHash,
+		BroadcastBeforeBlockNum: 2,
+		State:                   models.TxAttemptStateBroadcast,
+		TxReceiptIDs:            []uuid.UUID{receipt.ID},
+	}
+	require.NoError(t, s.AddOrUpdateAttempt(tx, attempt))
+
+	require.NoError(t, s.PutJob(&models.Job{ID: uuid.New(), TxID: txID, State: models.JobStateHandled}))
+	return address, txID
+}
+
+// records returns the records of the snapshot without the header, which contains the creation time.
+func records(t *testing.T, snap string) string {
+	lines := strings.SplitN(snap, "\n", 2)
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], `"type":"header"`)
+	return lines[1]
+}
+
+func Test_ExportImport(t *testing.T) {
+	source := newTMStore(t)
+	address, txID := fillStore(t, source)
+
+	var snap bytes.Buffer
+	require.NoError(t, snapshot.Export(source, &snap))
+
+	// Move the data to another backend
+	target := newSQLiteStore(t)
+	require.NoError(t, snapshot.Import(target, bytes.NewReader(snap.Bytes())))
+
+	var exported bytes.Buffer
+	require.NoError(t, snapshot.Export(target, &exported))
+	require.Equal(t, records(t, snap.String()), records(t, exported.String()))
+
+	lastHead, err := target.LastHead()
+	require.NoError(t, err)
+	require.Equal(t, common.HexToHash("0x02"), lastHead.Hash)
+	txs, err := target.GetTxsConfirmedAtOrAboveBlockHeight(2)
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	require.Equal(t, txID, txs[0].ID)
+	require.Equal(t, address, txs[0].FromAddress)
+}
+
+func Test_Import(t *testing.T) {
+	t.Run("refuses newer versions", func(t *testing.T) {
+		err := snapshot.Import(newTMStore(t), strings.NewReader(`{"type":"header","data":{"version":2}}`))
+		require.True(t, errors.Is(err, snapshot.ErrUnknownVersion))
+	})
+
+	t.Run("requires a header", func(t *testing.T) {
+		err := snapshot.Import(newTMStore(t), strings.NewReader(`{"type":"job","data":{}}`))
+		require.Error(t, err)
+	})
+
+	t.Run("is atomic", func(t *testing.T) {
+		s := newTMStore(t)
+		snap := `{"type":"header","data":{"version":1}}
+{"type":"account","data":{"address":"0x27548a32b9ad5d64c5945eae9da5337bc3169d15","nextNonce":0,"txIds":[]}}
+{"type":"unknown","data":{}}
+`
+		require.Error(t, snapshot.Import(s, strings.NewReader(snap)))
+		_, err := s.GetAccounts()
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+	})
+}
@@ -0,0 +1,108 @@
+package sqlite
+
+import (
+	"github.com/begmaroman/eth-services/store/internal/sqlstore"
+)
+
+// migrations creates and upgrades the schema. Released migrations must never be changed, add a new
+// one instead.
+var migrations = []sqlstore.Migration{
+	{
+		Version: 1,
+		Statements: []string{
+			`CREATE TABLE heads (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				hash TEXT NOT NULL UNIQUE,
+				number INTEGER NOT NULL,
+				parent_hash TEXT NOT NULL,
+				block_timestamp INTEGER NOT NULL
+			)`,
+			`CREATE INDEX idx_heads_number ON heads (number)`,
+
+			`CREATE TABLE accounts (
+				address TEXT PRIMARY KEY,
+				next_nonce INTEGER NOT NULL
+			)`,
+			`CREATE TABLE account_tx_ids (
+				address TEXT NOT NULL,
+				list_index INTEGER NOT NULL,
+				tx_id TEXT NOT NULL,
+				PRIMARY KEY (address, list_index)
+			)`,
+
+			`CREATE TABLE txs (
+				id TEXT PRIMARY KEY,
+				nonce INTEGER NOT NULL,
+				from_address TEXT NOT NULL,
+				to_address TEXT NOT NULL,
+				encoded_payload BLOB,
+				value TEXT,
+				gas_limit INTEGER NOT NULL,
+				max_gas_price TEXT,
+				state TEXT NOT NULL,
+				error TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX idx_txs_state_from_address_nonce ON txs (state, from_address, nonce)`,
+			`CREATE TABLE tx_attempt_ids (
+				tx_id TEXT NOT NULL,
+				list_index INTEGER NOT NULL,
+				attempt_id TEXT NOT NULL,
+				PRIMARY KEY (tx_id, list_index)
+			)`,
+			`CREATE INDEX idx_tx_attempt_ids_attempt_id ON tx_attempt_ids (attempt_id)`,
+
+			`CREATE TABLE tx_attempts (
+				id TEXT PRIMARY KEY,
+				tx_id TEXT NOT NULL,
+				gas_price TEXT,
+				signed_raw_tx BLOB,
+				hash TEXT NOT NULL,
+				broadcast_before_block_num INTEGER NOT NULL,
+				state TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_tx_attempts_state ON tx_attempts (state)`,
+			`CREATE INDEX idx_tx_attempts_unset_broadcast_block ON tx_attempts (id)
+				WHERE broadcast_before_block_num = -1`,
+			`CREATE TABLE tx_attempt_receipt_ids (
+				attempt_id TEXT NOT NULL,
+				list_index INTEGER NOT NULL,
+				receipt_id TEXT NOT NULL,
+				PRIMARY KEY (attempt_id, list_index)
+			)`,
+			`CREATE INDEX idx_tx_attempt_receipt_ids_receipt_id ON tx_attempt_receipt_ids (receipt_id)`,
+
+			`CREATE TABLE tx_receipts (
+				id TEXT PRIMARY KEY,
+				tx_hash TEXT NOT NULL,
+				block_hash TEXT NOT NULL,
+				block_number INTEGER NOT NULL,
+				transaction_index INTEGER NOT NULL,
+				receipt BLOB
+			)`,
+			`CREATE INDEX idx_tx_receipts_block_number ON tx_receipts (block_number)`,
+
+			`CREATE TABLE jobs (
+				id TEXT PRIMARY KEY,
+				tx_id TEXT NOT NULL,
+				metadata BLOB,
+				state TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_jobs_state ON jobs (state)`,
+		},
+	},
+	{
+		Version: 2,
+		Statements: []string{
+			`ALTER TABLE accounts ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+			`ALTER TABLE txs ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+			`ALTER TABLE tx_attempts ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		},
+	},
+	{
+		Version: 3,
+		Statements: []string{
+			`ALTER TABLE txs ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0`,
+			`CREATE INDEX idx_txs_created_at_id ON txs (created_at, id)`,
+		},
+	},
+}
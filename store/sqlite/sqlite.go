@@ -0,0 +1,58 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	// Registers the "sqlite3" database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+
+	"github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/internal/sqlstore"
+)
+
+// SQLiteStore is a Store implementation using an embedded SQLite database
+type SQLiteStore struct {
+	*sqlstore.SQLStore
+}
+
+var _ store.Store = (*SQLiteStore)(nil)
+
+// Dialect is the SQLite dialect of the SQL store
+var Dialect = sqlstore.Dialect{
+	Name:        "sqlite",
+	Placeholder: sqlstore.QuestionPlaceholder,
+	Migrations:  migrations,
+}
+
+// NewSQLiteStore creates a new SQLiteStore on top of the given database handle and migrates the
+// schema to the latest version. SQLite only supports a single writer, so the handle should be limited
+// to one open connection.
+func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
+	sqlStore, err := sqlstore.New(db, Dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteStore{SQLStore: sqlStore}, nil
+}
+
+// Open opens or creates the SQLite database file at the given path and creates a new SQLiteStore.
+// Use ":memory:" for a transient in-memory database.
+func Open(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=1&_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open database")
+	}
+	// A single connection serializes all transactions and keeps in-memory databases alive
+	db.SetMaxOpenConns(1)
+	if err = db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "could not connect to database")
+	}
+	s, err := NewSQLiteStore(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
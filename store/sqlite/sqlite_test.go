@@ -0,0 +1,28 @@
+package sqlite_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/sqlite"
+	"github.com/begmaroman/eth-services/store/storetest"
+)
+
+func newTestStore(t *testing.T) *sqlite.SQLiteStore {
+	t.Helper()
+
+	s, err := sqlite.Open(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, s.DB().Close())
+	})
+	return s
+}
+
+func Test_SQLiteStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) esStore.Store {
+		return newTestStore(t)
+	})
+}
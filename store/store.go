@@ -1,6 +1,7 @@
 package store
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -13,10 +14,54 @@ import (
 var (
 	ErrNotFound           = errors.New("value not found")
 	ErrCouldNotGetReceipt = errors.New("could not get receipt")
+	// ErrConflict matches all ConflictErrors using errors.Is
+	ErrConflict = errors.New("version conflict")
 )
 
-// Store defines the interface for the storage layer
+// ConflictError is returned when writing a versioned record (Account, Tx or TxAttempt) which has been
+// written by someone else since it was read. The record needs to be read again before retrying.
+type ConflictError struct {
+	// Entity is the type of the record, e.g. "Tx"
+	Entity string
+	// Key identifies the record
+	Key string
+	// Version is the version of the record which was attempted to be written
+	Version int64
+	// StoredVersion is the version of the stored record, 0 if there is none
+	StoredVersion int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf(
+		"%s: %s %s has version %d, expected %d", ErrConflict, e.Entity, e.Key, e.StoredVersion, e.Version,
+	)
+}
+
+// Is makes errors.Is(err, ErrConflict) report true for ConflictErrors
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// CheckVersion returns a ConflictError if version does not match the stored version of a record.
+func CheckVersion(entity, key string, version, storedVersion int64) error {
+	if version == storedVersion {
+		return nil
+	}
+	return &ConflictError{Entity: entity, Key: key, Version: version, StoredVersion: storedVersion}
+}
+
+// Store defines the interface for the storage layer.
+//
+// Accounts, Txs and TxAttempts are versioned. Writing one of them fails with a ConflictError unless
+// its Version matches the stored version, or is 0 for a new record, and increments its Version on
+// success. Read-modify-write cycles of concurrent writers can't overwrite each other that way.
+// Versions are not reset when a transaction is rolled back, records need to be read again then.
 type Store interface {
+	// RunInTx runs fn within a transaction. Writes made through the Store passed to fn are committed
+	// atomically if fn returns nil and discarded otherwise. Calling RunInTx on the Store passed to fn
+	// joins the running transaction.
+	RunInTx(fn func(store Store) error) error
+
 	// InsertHead inserts a block head
 	InsertHead(head *models.Head) error
 
@@ -30,6 +75,14 @@ type Store interface {
 	// HeadByHash fetches the head with the given hash from the db, returns nil if none exists.
 	HeadByHash(hash common.Hash) (*models.Head, error)
 
+	// HeadsByNumber returns all heads with the given number, e.g. competing heads due to re-org.
+	// Returns nil if none exists.
+	HeadsByNumber(number int64) ([]*models.Head, error)
+
+	// HeadsInRange returns all heads with a number between fromNumber and toNumber (both inclusive),
+	// ordered by ascending number. Returns nil if none exists.
+	HeadsInRange(fromNumber, toNumber int64) ([]*models.Head, error)
+
 	// TrimOldHeads deletes "depth" number of heads such that only the top N block numbers remain.
 	TrimOldHeads(depth int64) error
 
@@ -43,6 +96,9 @@ type Store interface {
 
 	GetTx(id uuid.UUID) (*models.Tx, error)
 	PutTx(tx *models.Tx) error
+	// QueryTxs returns a page of the Txs matching query. Pass TxPage.NextCursor in the query to get the
+	// next page, Txs written in the meantime may or may not be included.
+	QueryTxs(query TxQuery) (*TxPage, error)
 
 	GetTxAttempt(id uuid.UUID) (*models.TxAttempt, error)
 	PutTxAttempt(attempt *models.TxAttempt) error
@@ -116,6 +172,8 @@ type Store interface {
 	IsTxConfirmedAtOrBeforeBlockNumber(txID uuid.UUID, blockNumber int64) (bool, error)
 
 	GetJob(jobID uuid.UUID) (*models.Job, error)
+	// GetJobs returns all jobs ordered by ID. Returns nil if none exists.
+	GetJobs() ([]*models.Job, error)
 	PutJob(job *models.Job) error
 	DeleteJob(jobID uuid.UUID) error
 	GetUnhandledJobIDs() ([]uuid.UUID, error)
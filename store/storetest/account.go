@@ -0,0 +1,81 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+func testAccounts(t *testing.T, newStore Factory) {
+	t.Run("not found", func(t *testing.T) {
+		s := newStore(t)
+		address := newAddress()
+
+		_, err := s.GetAccount(address)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+		_, err = s.GetAccounts()
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+		_, err = s.GetNextNonce(address)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+		err = s.SetNextNonce(address, 1)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		s := newStore(t)
+		account := &models.Account{
+			Address:   newAddress(),
+			NextNonce: 7,
+			TxIDs:     []uuid.UUID{uuid.New(), uuid.New(), uuid.New()},
+		}
+
+		require.NoError(t, s.PutAccount(account))
+		stored, err := s.GetAccount(account.Address)
+		require.NoError(t, err)
+		require.Equal(t, account, stored)
+
+		// Lists can shrink as well as grow
+		account.TxIDs = account.TxIDs[1:]
+		require.NoError(t, s.PutAccount(account))
+		stored, err = s.GetAccount(account.Address)
+		require.NoError(t, err)
+		require.Equal(t, account.TxIDs, stored.TxIDs)
+	})
+
+	t.Run("get accounts", func(t *testing.T) {
+		s := newStore(t)
+		first := mustInsertAccount(t, s)
+		second := mustInsertAccount(t, s)
+
+		accounts, err := s.GetAccounts()
+		require.NoError(t, err)
+		require.Len(t, accounts, 2)
+		require.ElementsMatch(t,
+			[]interface{}{first.Address, second.Address},
+			[]interface{}{accounts[0].Address, accounts[1].Address},
+		)
+	})
+
+	t.Run("next nonce", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		txID := uuid.New()
+		account.TxIDs = []uuid.UUID{txID}
+		require.NoError(t, s.PutAccount(account))
+
+		require.NoError(t, s.SetNextNonce(account.Address, 12))
+		nonce, err := s.GetNextNonce(account.Address)
+		require.NoError(t, err)
+		require.Equal(t, int64(12), nonce)
+
+		// Setting the nonce keeps the Txs of the account
+		stored, err := s.GetAccount(account.Address)
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{txID}, stored.TxIDs)
+	})
+}
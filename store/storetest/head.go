@@ -0,0 +1,201 @@
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+func testHeads(t *testing.T, newStore Factory) {
+	t.Run("empty store", func(t *testing.T) {
+		s := newStore(t)
+
+		lastHead, err := s.LastHead()
+		require.NoError(t, err)
+		require.Nil(t, lastHead)
+		firstHead, err := s.FirstHead()
+		require.NoError(t, err)
+		require.Nil(t, firstHead)
+		head, err := s.HeadByHash(newHash())
+		require.NoError(t, err)
+		require.Nil(t, head)
+		heads, err := s.HeadsByNumber(1)
+		require.NoError(t, err)
+		require.Empty(t, heads)
+		heads, err = s.HeadsInRange(0, 100)
+		require.NoError(t, err)
+		require.Empty(t, heads)
+		require.NoError(t, s.TrimOldHeads(10))
+		_, err = s.Chain(newHash(), 10)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		s := newStore(t)
+		head := newHead(42, newHash())
+
+		require.NoError(t, s.InsertHead(head))
+		// Inserting the same head again is a no-op
+		require.NoError(t, s.InsertHead(head))
+
+		stored, err := s.HeadByHash(head.Hash)
+		require.NoError(t, err)
+		requireHeadsEqual(t, head, stored)
+		heads, err := s.HeadsByNumber(head.Number)
+		require.NoError(t, err)
+		require.Len(t, heads, 1)
+		requireHeadsEqual(t, head, heads[0])
+	})
+
+	t.Run("first and last head", func(t *testing.T) {
+		s := newStore(t)
+		heads := mustInsertChain(t, s, 5, 3)
+
+		firstHead, err := s.FirstHead()
+		require.NoError(t, err)
+		requireHeadsEqual(t, heads[0], firstHead)
+		lastHead, err := s.LastHead()
+		require.NoError(t, err)
+		requireHeadsEqual(t, heads[2], lastHead)
+
+		// A lower head does not become the last head
+		require.NoError(t, s.InsertHead(newHead(1, newHash())))
+		lastHead, err = s.LastHead()
+		require.NoError(t, err)
+		requireHeadsEqual(t, heads[2], lastHead)
+	})
+
+	t.Run("last head ties are won by the most recently inserted head", func(t *testing.T) {
+		s := newStore(t)
+		heads := mustInsertChain(t, s, 1, 3)
+
+		reorgHead := newHead(3, heads[1].Hash)
+		require.NoError(t, s.InsertHead(reorgHead))
+		lastHead, err := s.LastHead()
+		require.NoError(t, err)
+		requireHeadsEqual(t, reorgHead, lastHead)
+
+		require.NoError(t, s.InsertHead(heads[2]))
+		lastHead, err = s.LastHead()
+		require.NoError(t, err)
+		requireHeadsEqual(t, heads[2], lastHead)
+
+		competing, err := s.HeadsByNumber(3)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []common.Hash{heads[2].Hash, reorgHead.Hash}, headHashes(competing))
+	})
+
+	t.Run("heads in range", func(t *testing.T) {
+		s := newStore(t)
+		heads := mustInsertChain(t, s, 10, 5)
+		reorgHead := newHead(12, heads[1].Hash)
+		require.NoError(t, s.InsertHead(reorgHead))
+
+		inRange, err := s.HeadsInRange(11, 13)
+		require.NoError(t, err)
+		require.Len(t, inRange, 4)
+		require.ElementsMatch(t,
+			[]common.Hash{heads[1].Hash, heads[2].Hash, reorgHead.Hash, heads[3].Hash},
+			headHashes(inRange),
+		)
+		for i := 1; i < len(inRange); i++ {
+			require.LessOrEqual(t, inRange[i-1].Number, inRange[i].Number)
+		}
+
+		inRange, err = s.HeadsInRange(13, 11)
+		require.NoError(t, err)
+		require.Empty(t, inRange)
+		inRange, err = s.HeadsInRange(0, 9)
+		require.NoError(t, err)
+		require.Empty(t, inRange)
+	})
+
+	t.Run("trim old heads", func(t *testing.T) {
+		s := newStore(t)
+		heads := mustInsertChain(t, s, 1, 10)
+
+		require.NoError(t, s.TrimOldHeads(3))
+
+		firstHead, err := s.FirstHead()
+		require.NoError(t, err)
+		requireHeadsEqual(t, heads[7], firstHead)
+		remaining, err := s.HeadsInRange(0, 100)
+		require.NoError(t, err)
+		require.Equal(t, headHashes(heads[7:]), headHashes(remaining))
+		trimmed, err := s.HeadByHash(heads[6].Hash)
+		require.NoError(t, err)
+		require.Nil(t, trimmed)
+
+		// A depth beyond the chain length keeps everything
+		require.NoError(t, s.TrimOldHeads(100))
+		remaining, err = s.HeadsInRange(0, 100)
+		require.NoError(t, err)
+		require.Len(t, remaining, 3)
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		s := newStore(t)
+		heads := mustInsertChain(t, s, 1, 5)
+
+		chain, err := s.Chain(heads[4].Hash, 3)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), chain.ChainLength())
+		requireHeadsEqual(t, heads[4], chain)
+		requireHeadsEqual(t, heads[3], chain.Parent)
+		requireHeadsEqual(t, heads[2], chain.EarliestInChain())
+
+		// The chain ends at the first missing parent
+		chain, err = s.Chain(heads[4].Hash, 100)
+		require.NoError(t, err)
+		require.Equal(t, int64(5), chain.ChainLength())
+		requireHeadsEqual(t, heads[0], chain.EarliestInChain())
+	})
+}
+
+func newHead(number int64, parentHash common.Hash) *models.Head {
+	return &models.Head{
+		Hash:       newHash(),
+		Number:     number,
+		ParentHash: parentHash,
+		Timestamp:  time.Unix(1600000000+number, 0),
+	}
+}
+
+// mustInsertChain inserts n linked heads starting at number from, ordered by ascending number.
+func mustInsertChain(t *testing.T, s esStore.Store, from int64, n int) []*models.Head {
+	t.Helper()
+
+	heads := make([]*models.Head, 0, n)
+	parentHash := newHash()
+	for i := 0; i < n; i++ {
+		head := newHead(from+int64(i), parentHash)
+		require.NoError(t, s.InsertHead(head))
+		heads = append(heads, head)
+		parentHash = head.Hash
+	}
+	return heads
+}
+
+func requireHeadsEqual(t *testing.T, expected, actual *models.Head) {
+	t.Helper()
+
+	require.NotNil(t, actual)
+	require.Equal(t, expected.Hash, actual.Hash)
+	require.Equal(t, expected.Number, actual.Number)
+	require.Equal(t, expected.ParentHash, actual.ParentHash)
+	require.Equal(t, expected.Timestamp.Unix(), actual.Timestamp.Unix())
+}
+
+func headHashes(heads []*models.Head) []common.Hash {
+	hashes := make([]common.Hash, 0, len(heads))
+	for _, head := range heads {
+		hashes = append(hashes, head.Hash)
+	}
+	return hashes
+}
@@ -0,0 +1,84 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+func testJobs(t *testing.T, newStore Factory) {
+	t.Run("not found", func(t *testing.T) {
+		s := newStore(t)
+
+		_, err := s.GetJob(uuid.New())
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+		// Returns ErrNotFound instead of an empty list
+		_, err = s.GetUnhandledJobIDs()
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+		jobs, err := s.GetJobs()
+		require.NoError(t, err)
+		require.Empty(t, jobs)
+		// Deleting a missing job is not an error
+		require.NoError(t, s.DeleteJob(uuid.New()))
+	})
+
+	t.Run("round trip and delete", func(t *testing.T) {
+		s := newStore(t)
+		job := &models.Job{
+			ID:       uuid.New(),
+			TxID:     uuid.New(),
+			Metadata: []byte(`{"key":"value"}`),
+			State:    models.JobStateUnhandled,
+		}
+
+		require.NoError(t, s.PutJob(job))
+		stored, err := s.GetJob(job.ID)
+		require.NoError(t, err)
+		require.Equal(t, job, stored)
+
+		job.State = models.JobStateHandled
+		require.NoError(t, s.PutJob(job))
+		stored, err = s.GetJob(job.ID)
+		require.NoError(t, err)
+		require.Equal(t, models.JobStateHandled, stored.State)
+
+		require.NoError(t, s.DeleteJob(job.ID))
+		_, err = s.GetJob(job.ID)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+	})
+
+	t.Run("unhandled job IDs", func(t *testing.T) {
+		s := newStore(t)
+		first := &models.Job{ID: uuid.New(), TxID: uuid.New(), State: models.JobStateUnhandled}
+		second := &models.Job{ID: uuid.New(), TxID: uuid.New(), State: models.JobStateUnhandled}
+		handled := &models.Job{ID: uuid.New(), TxID: uuid.New(), State: models.JobStateHandled}
+		for _, job := range []*models.Job{first, second, handled} {
+			require.NoError(t, s.PutJob(job))
+		}
+
+		unhandledIDs, err := s.GetUnhandledJobIDs()
+		require.NoError(t, err)
+		require.ElementsMatch(t, []uuid.UUID{first.ID, second.ID}, unhandledIDs)
+
+		jobs, err := s.GetJobs()
+		require.NoError(t, err)
+		require.Len(t, jobs, 3)
+		for i := 1; i < len(jobs); i++ {
+			require.Less(t, jobs[i-1].ID.String(), jobs[i].ID.String())
+		}
+		require.ElementsMatch(t, []uuid.UUID{first.ID, second.ID, handled.ID}, jobIDs(jobs))
+	})
+}
+
+func jobIDs(jobs []*models.Job) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	return ids
+}
@@ -0,0 +1,274 @@
+// Package storetest provides a behavioural test suite which every store.Store implementation must
+// pass. Backends run it from their own tests:
+//
+//	func Test_MyStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) store.Store {
+//			return newEmptyStore(t)
+//		})
+//	}
+package storetest
+
+import (
+	"crypto/rand"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+// Factory creates a new, empty Store for a single test. Resources should be released with t.Cleanup.
+type Factory func(t *testing.T) esStore.Store
+
+// Run runs the whole suite, every test gets its own Store from newStore.
+func Run(t *testing.T, newStore Factory) {
+	t.Run("Heads", func(t *testing.T) { testHeads(t, newStore) })
+	t.Run("Accounts", func(t *testing.T) { testAccounts(t, newStore) })
+	t.Run("Txs", func(t *testing.T) { testTxs(t, newStore) })
+	t.Run("TxAttempts", func(t *testing.T) { testTxAttempts(t, newStore) })
+	t.Run("TxReceipts", func(t *testing.T) { testTxReceipts(t, newStore) })
+	t.Run("Queries", func(t *testing.T) { testQueries(t, newStore) })
+	t.Run("QueryTxs", func(t *testing.T) { testQueryTxs(t, newStore) })
+	t.Run("Jobs", func(t *testing.T) { testJobs(t, newStore) })
+	t.Run("Versions", func(t *testing.T) { testVersions(t, newStore) })
+	t.Run("RunInTx", func(t *testing.T) { testRunInTx(t, newStore) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, newStore) })
+}
+
+func testRunInTx(t *testing.T, newStore Factory) {
+	t.Run("commits writes", func(t *testing.T) {
+		s := newStore(t)
+		address := newAddress()
+		job := &models.Job{ID: uuid.New(), TxID: uuid.New(), State: models.JobStateUnhandled}
+
+		require.NoError(t, s.RunInTx(func(txStore esStore.Store) error {
+			if err := txStore.PutAccount(&models.Account{Address: address}); err != nil {
+				return err
+			}
+			return txStore.PutJob(job)
+		}))
+
+		_, err := s.GetAccount(address)
+		require.NoError(t, err)
+		_, err = s.GetJob(job.ID)
+		require.NoError(t, err)
+	})
+
+	t.Run("reads its own writes", func(t *testing.T) {
+		s := newStore(t)
+		address := newAddress()
+
+		require.NoError(t, s.RunInTx(func(txStore esStore.Store) error {
+			if err := txStore.PutAccount(&models.Account{Address: address, NextNonce: 3}); err != nil {
+				return err
+			}
+			if err := txStore.SetNextNonce(address, 4); err != nil {
+				return err
+			}
+			nonce, err := txStore.GetNextNonce(address)
+			if err != nil {
+				return err
+			}
+			require.Equal(t, int64(4), nonce)
+			return nil
+		}))
+	})
+
+	t.Run("discards writes on error", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		errTest := errors.New("test error")
+
+		err := s.RunInTx(func(txStore esStore.Store) error {
+			if err := txStore.SetNextNonce(account.Address, 42); err != nil {
+				return err
+			}
+			if err := txStore.PutAccount(&models.Account{Address: newAddress()}); err != nil {
+				return err
+			}
+			return errTest
+		})
+		require.True(t, errors.Is(err, errTest))
+
+		nonce, err := s.GetNextNonce(account.Address)
+		require.NoError(t, err)
+		require.Equal(t, account.NextNonce, nonce)
+		accounts, err := s.GetAccounts()
+		require.NoError(t, err)
+		require.Len(t, accounts, 1)
+	})
+
+	t.Run("nested calls join the running transaction", func(t *testing.T) {
+		s := newStore(t)
+		address := newAddress()
+		errTest := errors.New("test error")
+
+		err := s.RunInTx(func(txStore esStore.Store) error {
+			if err := txStore.RunInTx(func(nestedStore esStore.Store) error {
+				return nestedStore.PutAccount(&models.Account{Address: address})
+			}); err != nil {
+				return err
+			}
+			return errTest
+		})
+		require.True(t, errors.Is(err, errTest))
+
+		_, err = s.GetAccount(address)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+	})
+}
+
+func testConcurrency(t *testing.T, newStore Factory) {
+	const workers = 10
+
+	t.Run("AddTx does not lose Txs of the same account", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+
+		txIDs := make([]uuid.UUID, workers)
+		errs := make([]error, workers)
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			txIDs[i] = uuid.New()
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = s.AddTx(txIDs[i], account.Address, newAddress(), []byte{1}, big.NewInt(1), 21000, big.NewInt(1))
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+
+		account, err := s.GetAccount(account.Address)
+		require.NoError(t, err)
+		require.ElementsMatch(t, txIDs, account.TxIDs)
+		for _, txID := range txIDs {
+			_, err = s.GetTx(txID)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("InsertHead keeps the highest head", func(t *testing.T) {
+		s := newStore(t)
+
+		heads := make([]*models.Head, workers)
+		errs := make([]error, workers)
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			heads[i] = newHead(int64(i+1), common.Hash{})
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = s.InsertHead(heads[i])
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+
+		lastHead, err := s.LastHead()
+		require.NoError(t, err)
+		require.Equal(t, heads[workers-1].Hash, lastHead.Hash)
+		inRange, err := s.HeadsInRange(1, workers)
+		require.NoError(t, err)
+		require.Len(t, inRange, workers)
+	})
+}
+
+func newAddress() common.Address {
+	return common.BytesToAddress(randomBytes(common.AddressLength))
+}
+
+func newHash() common.Hash {
+	return common.BytesToHash(randomBytes(common.HashLength))
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func mustInsertAccount(t *testing.T, s esStore.Store) *models.Account {
+	t.Helper()
+
+	account := &models.Account{Address: newAddress(), NextNonce: 0}
+	require.NoError(t, s.PutAccount(account))
+	return account
+}
+
+// mustInsertTx adds a new Tx to the account and moves it to the given state and nonce.
+func mustInsertTx(t *testing.T, s esStore.Store, fromAddress common.Address, state models.TxState, nonce int64) *models.Tx {
+	t.Helper()
+
+	txID := uuid.New()
+	require.NoError(t, s.AddTx(txID, fromAddress, newAddress(), []byte{1, 2, 3}, big.NewInt(1), 21000, big.NewInt(100)))
+	tx, err := s.GetTx(txID)
+	require.NoError(t, err)
+	if state != models.TxStateUnstarted {
+		tx.State = state
+		tx.Nonce = nonce
+		require.NoError(t, s.PutTx(tx))
+	}
+	return tx
+}
+
+func mustAddAttempt(
+	t *testing.T,
+	s esStore.Store,
+	tx *models.Tx,
+	state models.TxAttemptState,
+	broadcastBeforeBlockNum int64,
+	gasPrice int64,
+) *models.TxAttempt {
+	t.Helper()
+
+	attempt := &models.TxAttempt{
+		ID:                      uuid.New(),
+		TxID:                    tx.ID,
+		GasPrice:                big.NewInt(gasPrice),
+		SignedRawTx:             []byte{4, 5, 6},
+		Hash:                    newHash(),
+		BroadcastBeforeBlockNum: broadcastBeforeBlockNum,
+		State:                   state,
+	}
+	require.NoError(t, s.AddOrUpdateAttempt(tx, attempt))
+	return attempt
+}
+
+// mustAddReceipt creates a receipt mined at the given block and attaches it to the attempt.
+func mustAddReceipt(t *testing.T, s esStore.Store, attempt *models.TxAttempt, blockNumber int64) *models.TxReceipt {
+	t.Helper()
+
+	receipt := &models.TxReceipt{
+		ID:               uuid.New(),
+		TxHash:           attempt.Hash,
+		BlockHash:        newHash(),
+		BlockNumber:      blockNumber,
+		TransactionIndex: 1,
+		Receipt:          []byte(`{"status":"0x1"}`),
+	}
+	require.NoError(t, s.PutTxReceipt(receipt))
+	attempt.TxReceiptIDs = append(attempt.TxReceiptIDs, receipt.ID)
+	require.NoError(t, s.PutTxAttempt(attempt))
+	return receipt
+}
+
+func txIDs(txs []*models.Tx) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(txs))
+	for _, tx := range txs {
+		ids = append(ids, tx.ID)
+	}
+	return ids
+}
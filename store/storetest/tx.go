@@ -0,0 +1,462 @@
+package storetest
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+func testTxs(t *testing.T, newStore Factory) {
+	t.Run("not found", func(t *testing.T) {
+		s := newStore(t)
+		address := newAddress()
+
+		_, err := s.GetTx(uuid.New())
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+		err = s.AddTx(uuid.New(), address, newAddress(), nil, big.NewInt(0), 21000, big.NewInt(1))
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+		_, err = s.GetNextUnstartedTx(address)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+		_, err = s.GetInProgressTx(address)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+
+		account := mustInsertAccount(t, s)
+		_, err = s.GetNextUnstartedTx(account.Address)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+		_, err = s.GetInProgressTx(account.Address)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+	})
+
+	t.Run("add and round trip", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		txID := uuid.New()
+		toAddress := newAddress()
+		// Values beyond 64 bits must survive
+		value, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+		require.NoError(t, s.AddTx(txID, account.Address, toAddress, []byte{1, 2, 3}, value, 21000, big.NewInt(5e9)))
+
+		tx, err := s.GetTx(txID)
+		require.NoError(t, err)
+		require.Equal(t, txID, tx.ID)
+		require.Equal(t, account.Address, tx.FromAddress)
+		require.Equal(t, toAddress, tx.ToAddress)
+		require.Equal(t, []byte{1, 2, 3}, tx.EncodedPayload)
+		require.Equal(t, 0, value.Cmp(tx.Value))
+		require.Equal(t, uint64(21000), tx.GasLimit)
+		require.Equal(t, 0, big.NewInt(5e9).Cmp(tx.MaxGasPrice))
+		require.Equal(t, models.TxStateUnstarted, tx.State)
+		require.Empty(t, tx.TxAttemptIDs)
+
+		stored, err := s.GetAccount(account.Address)
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{txID}, stored.TxIDs)
+
+		tx.State = models.TxStateFatalError
+		tx.Nonce = -1
+		tx.Error = "boom"
+		require.NoError(t, s.PutTx(tx))
+		stored2, err := s.GetTx(txID)
+		require.NoError(t, err)
+		require.Equal(t, models.TxStateFatalError, stored2.State)
+		require.Equal(t, int64(-1), stored2.Nonce)
+		require.Equal(t, "boom", stored2.Error)
+		require.Error(t, stored2.GetError())
+	})
+
+	t.Run("next unstarted Tx is the first one added", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		other := mustInsertAccount(t, s)
+		mustInsertTx(t, s, other.Address, models.TxStateUnstarted, 0)
+
+		// IDs in descending order, so ordering by ID would pick the wrong one
+		firstID := uuid.MustParse("ffffffff-0000-4000-8000-000000000000")
+		secondID := uuid.MustParse("00000000-0000-4000-8000-000000000000")
+		require.NoError(t, s.AddTx(firstID, account.Address, newAddress(), nil, big.NewInt(0), 21000, big.NewInt(1)))
+		require.NoError(t, s.AddTx(secondID, account.Address, newAddress(), nil, big.NewInt(0), 21000, big.NewInt(1)))
+
+		tx, err := s.GetNextUnstartedTx(account.Address)
+		require.NoError(t, err)
+		require.Equal(t, firstID, tx.ID)
+
+		tx.State = models.TxStateInProgress
+		require.NoError(t, s.PutTx(tx))
+		tx, err = s.GetNextUnstartedTx(account.Address)
+		require.NoError(t, err)
+		require.Equal(t, secondID, tx.ID)
+	})
+
+	t.Run("in progress Tx", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		other := mustInsertAccount(t, s)
+		mustInsertTx(t, s, other.Address, models.TxStateInProgress, 0)
+		mustInsertTx(t, s, account.Address, models.TxStateUnstarted, 0)
+		_, err := s.GetInProgressTx(account.Address)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+
+		inProgress := mustInsertTx(t, s, account.Address, models.TxStateInProgress, 3)
+		tx, err := s.GetInProgressTx(account.Address)
+		require.NoError(t, err)
+		require.Equal(t, inProgress.ID, tx.ID)
+		require.Equal(t, int64(3), tx.Nonce)
+	})
+}
+
+func testTxAttempts(t *testing.T, newStore Factory) {
+	t.Run("not found", func(t *testing.T) {
+		s := newStore(t)
+
+		_, err := s.GetTxAttempt(uuid.New())
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+		// Deleting a missing attempt is not an error
+		require.NoError(t, s.DeleteTxAttempt(uuid.New()))
+		_, err = s.GetInProgressAttempts(newAddress())
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+	})
+
+	t.Run("round trip and delete", func(t *testing.T) {
+		s := newStore(t)
+		attempt := &models.TxAttempt{
+			ID:                      uuid.New(),
+			TxID:                    uuid.New(),
+			GasPrice:                big.NewInt(20e9),
+			SignedRawTx:             []byte{1, 2},
+			Hash:                    newHash(),
+			BroadcastBeforeBlockNum: -1,
+			State:                   models.TxAttemptStateInProgress,
+			TxReceiptIDs:            []uuid.UUID{uuid.New()},
+		}
+
+		require.NoError(t, s.PutTxAttempt(attempt))
+		stored, err := s.GetTxAttempt(attempt.ID)
+		require.NoError(t, err)
+		require.Equal(t, attempt.ID, stored.ID)
+		require.Equal(t, attempt.TxID, stored.TxID)
+		require.Equal(t, 0, attempt.GasPrice.Cmp(stored.GasPrice))
+		require.Equal(t, attempt.SignedRawTx, stored.SignedRawTx)
+		require.Equal(t, attempt.Hash, stored.Hash)
+		require.Equal(t, attempt.BroadcastBeforeBlockNum, stored.BroadcastBeforeBlockNum)
+		require.Equal(t, attempt.State, stored.State)
+		require.Equal(t, attempt.TxReceiptIDs, stored.TxReceiptIDs)
+
+		require.NoError(t, s.DeleteTxAttempt(attempt.ID))
+		_, err = s.GetTxAttempt(attempt.ID)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+	})
+
+	t.Run("attempts are sorted by descending gas price", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		tx := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 0)
+
+		low := mustAddAttempt(t, s, tx, models.TxAttemptStateBroadcast, 1, 10)
+		high := mustAddAttempt(t, s, tx, models.TxAttemptStateBroadcast, 1, 30)
+		mid := mustAddAttempt(t, s, tx, models.TxAttemptStateInProgress, -1, 20)
+
+		stored, err := s.GetTx(tx.ID)
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{high.ID, mid.ID, low.ID}, stored.TxAttemptIDs)
+		attempts, err := s.GetAttemptsForTx(stored)
+		require.NoError(t, err)
+		require.Len(t, attempts, 3)
+		require.Equal(t, high.ID, attempts[0].ID)
+		require.Equal(t, low.ID, attempts[2].ID)
+
+		// Updating an existing attempt does not add it twice
+		mid.State = models.TxAttemptStateBroadcast
+		require.NoError(t, s.AddOrUpdateAttempt(stored, mid))
+		stored, err = s.GetTx(tx.ID)
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{high.ID, mid.ID, low.ID}, stored.TxAttemptIDs)
+		updated, err := s.GetTxAttempt(mid.ID)
+		require.NoError(t, err)
+		require.Equal(t, models.TxAttemptStateBroadcast, updated.State)
+	})
+
+	t.Run("replace attempt", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		tx := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 0)
+		first := mustAddAttempt(t, s, tx, models.TxAttemptStateBroadcast, 1, 10)
+		second := mustAddAttempt(t, s, tx, models.TxAttemptStateBroadcast, 1, 20)
+
+		replacement := &models.TxAttempt{
+			ID:                      uuid.New(),
+			TxID:                    tx.ID,
+			GasPrice:                big.NewInt(30),
+			Hash:                    newHash(),
+			BroadcastBeforeBlockNum: -1,
+			State:                   models.TxAttemptStateInProgress,
+		}
+		require.NoError(t, s.ReplaceAttempt(tx, first, replacement))
+
+		stored, err := s.GetTx(tx.ID)
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{replacement.ID, second.ID}, stored.TxAttemptIDs)
+		_, err = s.GetTxAttempt(replacement.ID)
+		require.NoError(t, err)
+
+		unknown := &models.TxAttempt{ID: uuid.New()}
+		require.Error(t, s.ReplaceAttempt(stored, unknown, replacement))
+	})
+
+	t.Run("set broadcast before block number", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		tx := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 0)
+		unset := mustAddAttempt(t, s, tx, models.TxAttemptStateBroadcast, -1, 10)
+		alreadySet := mustAddAttempt(t, s, tx, models.TxAttemptStateBroadcast, 5, 20)
+		inProgress := mustAddAttempt(t, s, tx, models.TxAttemptStateInProgress, -1, 30)
+
+		require.NoError(t, s.SetBroadcastBeforeBlockNum(9))
+
+		for attempt, expected := range map[*models.TxAttempt]int64{unset: 9, alreadySet: 5, inProgress: -1} {
+			stored, err := s.GetTxAttempt(attempt.ID)
+			require.NoError(t, err)
+			require.Equal(t, expected, stored.BroadcastBeforeBlockNum)
+		}
+
+		// Attempts are only set once
+		require.NoError(t, s.SetBroadcastBeforeBlockNum(12))
+		stored, err := s.GetTxAttempt(unset.ID)
+		require.NoError(t, err)
+		require.Equal(t, int64(9), stored.BroadcastBeforeBlockNum)
+	})
+
+	t.Run("in progress attempts", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		other := mustInsertAccount(t, s)
+
+		attempts, err := s.GetInProgressAttempts(account.Address)
+		require.NoError(t, err)
+		require.Empty(t, attempts)
+
+		unconfirmed := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 0)
+		expected := mustAddAttempt(t, s, unconfirmed, models.TxAttemptStateInProgress, -1, 10)
+		mustAddAttempt(t, s, unconfirmed, models.TxAttemptStateBroadcast, -1, 20)
+		// Attempts of Txs in other states or of other accounts are ignored
+		inProgress := mustInsertTx(t, s, account.Address, models.TxStateInProgress, 1)
+		mustAddAttempt(t, s, inProgress, models.TxAttemptStateInProgress, -1, 10)
+		otherTx := mustInsertTx(t, s, other.Address, models.TxStateUnconfirmed, 0)
+		mustAddAttempt(t, s, otherTx, models.TxAttemptStateInProgress, -1, 10)
+
+		attempts, err = s.GetInProgressAttempts(account.Address)
+		require.NoError(t, err)
+		require.Len(t, attempts, 1)
+		require.Equal(t, expected.ID, attempts[0].ID)
+	})
+}
+
+func testTxReceipts(t *testing.T, newStore Factory) {
+	t.Run("not found", func(t *testing.T) {
+		s := newStore(t)
+
+		_, err := s.GetTxReceipt(uuid.New())
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+		// Deleting a missing receipt is not an error
+		require.NoError(t, s.DeleteTxReceipt(uuid.New()))
+	})
+
+	t.Run("round trip and delete", func(t *testing.T) {
+		s := newStore(t)
+		receipt := &models.TxReceipt{
+			ID:               uuid.New(),
+			TxHash:           newHash(),
+			BlockHash:        newHash(),
+			BlockNumber:      42,
+			TransactionIndex: 3,
+			Receipt:          []byte(`{"status":"0x1"}`),
+		}
+
+		require.NoError(t, s.PutTxReceipt(receipt))
+		stored, err := s.GetTxReceipt(receipt.ID)
+		require.NoError(t, err)
+		require.Equal(t, receipt, stored)
+
+		require.NoError(t, s.DeleteTxReceipt(receipt.ID))
+		_, err = s.GetTxReceipt(receipt.ID)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+	})
+}
+
+func testQueries(t *testing.T, newStore Factory) {
+	t.Run("without accounts", func(t *testing.T) {
+		s := newStore(t)
+
+		require.True(t, errors.Is(s.MarkConfirmedMissingReceipt(), esStore.ErrNotFound))
+		require.True(t, errors.Is(s.MarkOldTxsMissingReceiptAsErrored(10), esStore.ErrNotFound))
+		_, err := s.GetTxsConfirmedAtOrAboveBlockHeight(0)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+		_, err = s.GetTxsRequiringNewAttempt(newAddress(), 10, 3, 0)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+		_, err = s.IsTxConfirmedAtOrBeforeBlockNumber(uuid.New(), 10)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+
+		// Returns (nil, nil) instead of ErrNotFound
+		txs, err := s.GetTxsRequiringReceiptFetch()
+		require.NoError(t, err)
+		require.Empty(t, txs)
+	})
+
+	t.Run("Txs requiring receipt fetch", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		unconfirmed := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 0)
+		missingReceipt := mustInsertTx(t, s, account.Address, models.TxStateConfirmedMissingReceipt, 1)
+		mustInsertTx(t, s, account.Address, models.TxStateConfirmed, 2)
+		mustInsertTx(t, s, account.Address, models.TxStateInProgress, 3)
+
+		txs, err := s.GetTxsRequiringReceiptFetch()
+		require.NoError(t, err)
+		require.ElementsMatch(t, []uuid.UUID{unconfirmed.ID, missingReceipt.ID}, txIDs(txs))
+	})
+
+	t.Run("mark confirmed missing receipt", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		other := mustInsertAccount(t, s)
+		stale := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 1)
+		mustInsertTx(t, s, account.Address, models.TxStateConfirmed, 3)
+		pending := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 4)
+		// Confirmed Txs of one account don't affect other accounts
+		otherPending := mustInsertTx(t, s, other.Address, models.TxStateUnconfirmed, 0)
+
+		require.NoError(t, s.MarkConfirmedMissingReceipt())
+
+		for tx, expected := range map[*models.Tx]models.TxState{
+			stale:        models.TxStateConfirmedMissingReceipt,
+			pending:      models.TxStateUnconfirmed,
+			otherPending: models.TxStateUnconfirmed,
+		} {
+			stored, err := s.GetTx(tx.ID)
+			require.NoError(t, err)
+			require.Equal(t, expected, stored.State)
+		}
+	})
+
+	t.Run("mark old Txs missing receipt as errored", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		old := mustInsertTx(t, s, account.Address, models.TxStateConfirmedMissingReceipt, 1)
+		mustAddAttempt(t, s, old, models.TxAttemptStateBroadcast, 5, 10)
+		mustAddAttempt(t, s, old, models.TxAttemptStateBroadcast, 8, 20)
+		recent := mustInsertTx(t, s, account.Address, models.TxStateConfirmedMissingReceipt, 2)
+		mustAddAttempt(t, s, recent, models.TxAttemptStateBroadcast, 5, 10)
+		mustAddAttempt(t, s, recent, models.TxAttemptStateBroadcast, 12, 20)
+		neverBroadcast := mustInsertTx(t, s, account.Address, models.TxStateConfirmedMissingReceipt, 3)
+		mustAddAttempt(t, s, neverBroadcast, models.TxAttemptStateInProgress, -1, 10)
+
+		require.NoError(t, s.MarkOldTxsMissingReceiptAsErrored(10))
+
+		stored, err := s.GetTx(old.ID)
+		require.NoError(t, err)
+		require.Equal(t, models.TxStateFatalError, stored.State)
+		require.Equal(t, int64(-1), stored.Nonce)
+		require.Equal(t, esStore.ErrCouldNotGetReceipt.Error(), stored.Error)
+		for _, tx := range []*models.Tx{recent, neverBroadcast} {
+			stored, err = s.GetTx(tx.ID)
+			require.NoError(t, err)
+			require.Equal(t, models.TxStateConfirmedMissingReceipt, stored.State)
+		}
+	})
+
+	t.Run("Txs requiring new attempt", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+
+		txs, err := s.GetTxsRequiringNewAttempt(account.Address, 10, 3, 0)
+		require.NoError(t, err)
+		require.Empty(t, txs)
+
+		// Inserted out of nonce order, results are sorted by nonce
+		third := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 2)
+		mustAddAttempt(t, s, third, models.TxAttemptStateBroadcast, 2, 10)
+		first := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 0)
+		mustAddAttempt(t, s, first, models.TxAttemptStateBroadcast, 1, 10)
+		second := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 1)
+		mustAddAttempt(t, s, second, models.TxAttemptStateInsufficientEth, -1, 10)
+		recentlyBumped := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 3)
+		mustAddAttempt(t, s, recentlyBumped, models.TxAttemptStateBroadcast, 1, 10)
+		mustAddAttempt(t, s, recentlyBumped, models.TxAttemptStateBroadcast, 9, 20)
+		notBroadcast := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 4)
+		mustAddAttempt(t, s, notBroadcast, models.TxAttemptStateBroadcast, -1, 10)
+		mustInsertTx(t, s, account.Address, models.TxStateConfirmed, 5)
+
+		txs, err = s.GetTxsRequiringNewAttempt(account.Address, 10, 3, 0)
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{first.ID, second.ID, third.ID}, txIDs(txs))
+
+		// The depth limits the number of pending Txs considered, not the number of results
+		txs, err = s.GetTxsRequiringNewAttempt(account.Address, 10, 3, 2)
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{first.ID, second.ID}, txIDs(txs))
+		txs, err = s.GetTxsRequiringNewAttempt(account.Address, 4, 3, 0)
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{first.ID, second.ID}, txIDs(txs))
+	})
+
+	t.Run("Txs confirmed at or above block height", func(t *testing.T) {
+		s := newStore(t)
+		first := mustInsertAccount(t, s)
+		second := mustInsertAccount(t, s)
+		if bytes.Compare(first.Address.Bytes(), second.Address.Bytes()) > 0 {
+			first, second = second, first
+		}
+
+		secondLow := mustInsertTx(t, s, second.Address, models.TxStateConfirmed, 0)
+		mustAddReceipt(t, s, mustAddAttempt(t, s, secondLow, models.TxAttemptStateBroadcast, 9, 10), 10)
+		firstHigh := mustInsertTx(t, s, first.Address, models.TxStateConfirmedMissingReceipt, 1)
+		mustAddReceipt(t, s, mustAddAttempt(t, s, firstHigh, models.TxAttemptStateBroadcast, 9, 10), 12)
+		// Multiple receipts of the same Tx are returned once
+		firstLow := mustInsertTx(t, s, first.Address, models.TxStateConfirmed, 0)
+		attempt := mustAddAttempt(t, s, firstLow, models.TxAttemptStateBroadcast, 9, 10)
+		mustAddReceipt(t, s, attempt, 10)
+		mustAddReceipt(t, s, attempt, 11)
+		// Below the height, not broadcast or not confirmed
+		below := mustInsertTx(t, s, first.Address, models.TxStateConfirmed, 2)
+		mustAddReceipt(t, s, mustAddAttempt(t, s, below, models.TxAttemptStateBroadcast, 2, 10), 3)
+		notBroadcast := mustInsertTx(t, s, first.Address, models.TxStateConfirmed, 3)
+		mustAddReceipt(t, s, mustAddAttempt(t, s, notBroadcast, models.TxAttemptStateInProgress, -1, 10), 10)
+		unconfirmed := mustInsertTx(t, s, first.Address, models.TxStateUnconfirmed, 4)
+		mustAddReceipt(t, s, mustAddAttempt(t, s, unconfirmed, models.TxAttemptStateBroadcast, 9, 10), 10)
+
+		txs, err := s.GetTxsConfirmedAtOrAboveBlockHeight(10)
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{firstLow.ID, firstHigh.ID, secondLow.ID}, txIDs(txs))
+	})
+
+	t.Run("is Tx confirmed at or before block number", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		confirmed := mustInsertTx(t, s, account.Address, models.TxStateConfirmed, 0)
+		mustAddReceipt(t, s, mustAddAttempt(t, s, confirmed, models.TxAttemptStateBroadcast, 9, 10), 10)
+		unconfirmed := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 1)
+		mustAddReceipt(t, s, mustAddAttempt(t, s, unconfirmed, models.TxAttemptStateBroadcast, 9, 10), 10)
+
+		for _, tc := range []struct {
+			tx          *models.Tx
+			blockNumber int64
+			expected    bool
+		}{
+			{confirmed, 10, true},
+			{confirmed, 11, true},
+			{confirmed, 9, false},
+			{unconfirmed, 10, false},
+		} {
+			isConfirmed, err := s.IsTxConfirmedAtOrBeforeBlockNumber(tc.tx.ID, tc.blockNumber)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, isConfirmed, "block %d", tc.blockNumber)
+		}
+	})
+}
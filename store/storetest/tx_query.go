@@ -0,0 +1,176 @@
+package storetest
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+func testQueryTxs(t *testing.T, newStore Factory) {
+	base := time.Unix(1600000000, 0)
+
+	t.Run("empty", func(t *testing.T) {
+		s := newStore(t)
+		page, err := s.QueryTxs(esStore.TxQuery{})
+		require.NoError(t, err)
+		require.Empty(t, page.Txs)
+		require.Empty(t, page.NextCursor)
+	})
+
+	t.Run("records creation time", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		before := time.Now()
+		tx := mustInsertTx(t, s, account.Address, models.TxStateUnstarted, 0)
+		require.False(t, tx.CreatedAt.Before(before.Add(-time.Second)))
+		require.False(t, tx.CreatedAt.After(time.Now()))
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		s := newStore(t)
+		from, other, to := newAddress(), newAddress(), newAddress()
+		first := mustPutTx(t, s, from, to, models.TxStateConfirmed, 1, base)
+		second := mustPutTx(t, s, from, newAddress(), models.TxStateUnconfirmed, 2, base.Add(time.Second))
+		third := mustPutTx(t, s, other, to, models.TxStateUnconfirmed, 3, base.Add(2*time.Second))
+		legacy := mustPutTx(t, s, other, newAddress(), models.TxStateFatalError, -1, time.Time{})
+
+		minNonce, maxNonce := int64(2), int64(3)
+		for name, tc := range map[string]struct {
+			query    esStore.TxQuery
+			expected []*models.Tx
+		}{
+			"all":          {esStore.TxQuery{}, []*models.Tx{legacy, first, second, third}},
+			"from address": {esStore.TxQuery{FromAddress: &from}, []*models.Tx{first, second}},
+			"to address":   {esStore.TxQuery{ToAddress: &to}, []*models.Tx{first, third}},
+			"states": {
+				esStore.TxQuery{States: []models.TxState{models.TxStateUnconfirmed, models.TxStateFatalError}},
+				[]*models.Tx{legacy, second, third},
+			},
+			"min nonce":   {esStore.TxQuery{MinNonce: &minNonce}, []*models.Tx{second, third}},
+			"nonce range": {esStore.TxQuery{MinNonce: &minNonce, MaxNonce: &minNonce}, []*models.Tx{second}},
+			"max nonce":   {esStore.TxQuery{MaxNonce: &maxNonce, FromAddress: &other}, []*models.Tx{legacy, third}},
+			"created range": {
+				esStore.TxQuery{CreatedFrom: base, CreatedTo: base.Add(2 * time.Second)},
+				[]*models.Tx{first, second},
+			},
+			"combined": {
+				esStore.TxQuery{ToAddress: &to, States: []models.TxState{models.TxStateUnconfirmed}},
+				[]*models.Tx{third},
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				page, err := s.QueryTxs(tc.query)
+				require.NoError(t, err)
+				require.Equal(t, txIDs(tc.expected), txIDs(page.Txs))
+				require.Empty(t, page.NextCursor)
+			})
+		}
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		s := newStore(t)
+		address := newAddress()
+		var txs []*models.Tx
+		for i := 0; i < 5; i++ {
+			// Two Txs share every creation time, they are ordered by ID
+			txs = append(txs, mustPutTx(t, s, address, newAddress(), models.TxStateUnconfirmed, int64(i),
+				base.Add(time.Duration(i/2)*time.Second)))
+		}
+		ascending := []*models.Tx{txs[0], txs[1], txs[2], txs[3], txs[4]}
+		if txs[1].ID.String() < txs[0].ID.String() {
+			ascending[0], ascending[1] = txs[1], txs[0]
+		}
+		if txs[3].ID.String() < txs[2].ID.String() {
+			ascending[2], ascending[3] = txs[3], txs[2]
+		}
+		descending := make([]*models.Tx, len(ascending))
+		for i, tx := range ascending {
+			descending[len(ascending)-1-i] = tx
+		}
+
+		for name, tc := range map[string]struct {
+			order    esStore.SortOrder
+			expected []*models.Tx
+		}{
+			"ascending":  {esStore.SortAscending, ascending},
+			"descending": {esStore.SortDescending, descending},
+		} {
+			t.Run(name, func(t *testing.T) {
+				query := esStore.TxQuery{FromAddress: &address, Order: tc.order, Limit: 2}
+				var pages [][]uuid.UUID
+				for {
+					page, err := s.QueryTxs(query)
+					require.NoError(t, err)
+					pages = append(pages, txIDs(page.Txs))
+					if page.NextCursor == "" {
+						break
+					}
+					query.Cursor = page.NextCursor
+				}
+				require.Equal(t, [][]uuid.UUID{
+					txIDs(tc.expected[:2]),
+					txIDs(tc.expected[2:4]),
+					txIDs(tc.expected[4:]),
+				}, pages)
+			})
+		}
+	})
+
+	t.Run("skips many non-matching Txs", func(t *testing.T) {
+		s := newStore(t)
+		address := newAddress()
+		for i := 0; i < 250; i++ {
+			mustPutTx(t, s, newAddress(), newAddress(), models.TxStateConfirmed, int64(i), base)
+		}
+		first := mustPutTx(t, s, address, newAddress(), models.TxStateConfirmed, 0, base.Add(time.Second))
+		second := mustPutTx(t, s, address, newAddress(), models.TxStateConfirmed, 1, base.Add(2*time.Second))
+
+		page, err := s.QueryTxs(esStore.TxQuery{FromAddress: &address, Limit: 1})
+		require.NoError(t, err)
+		require.Equal(t, txIDs([]*models.Tx{first}), txIDs(page.Txs))
+		page, err = s.QueryTxs(esStore.TxQuery{FromAddress: &address, Limit: 1, Cursor: page.NextCursor})
+		require.NoError(t, err)
+		require.Equal(t, txIDs([]*models.Tx{second}), txIDs(page.Txs))
+		require.Empty(t, page.NextCursor)
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		s := newStore(t)
+		_, err := s.QueryTxs(esStore.TxQuery{Cursor: "not a cursor"})
+		require.True(t, errors.Is(err, esStore.ErrInvalidCursor))
+	})
+}
+
+// mustPutTx stores a new Tx with the given creation time.
+func mustPutTx(
+	t *testing.T,
+	s esStore.Store,
+	fromAddress, toAddress common.Address,
+	state models.TxState,
+	nonce int64,
+	createdAt time.Time,
+) *models.Tx {
+	t.Helper()
+
+	tx := &models.Tx{
+		ID:          uuid.New(),
+		Nonce:       nonce,
+		FromAddress: fromAddress,
+		ToAddress:   toAddress,
+		Value:       big.NewInt(1),
+		GasLimit:    21000,
+		MaxGasPrice: big.NewInt(100),
+		State:       state,
+		CreatedAt:   createdAt,
+	}
+	require.NoError(t, s.PutTx(tx))
+	return tx
+}
@@ -0,0 +1,119 @@
+package storetest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+func testVersions(t *testing.T, newStore Factory) {
+	t.Run("increments on write", func(t *testing.T) {
+		s := newStore(t)
+		account := &models.Account{Address: newAddress()}
+		require.NoError(t, s.PutAccount(account))
+		require.Equal(t, int64(1), account.Version)
+		require.NoError(t, s.PutAccount(account))
+		require.Equal(t, int64(2), account.Version)
+
+		stored, err := s.GetAccount(account.Address)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), stored.Version)
+
+		require.NoError(t, s.SetNextNonce(account.Address, 5))
+		stored, err = s.GetAccount(account.Address)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), stored.Version)
+
+		tx := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 0)
+		storedTx, err := s.GetTx(tx.ID)
+		require.NoError(t, err)
+		require.Equal(t, tx.Version, storedTx.Version)
+		storedTx.State = models.TxStateConfirmed
+		require.NoError(t, s.PutTx(storedTx))
+		require.Equal(t, tx.Version+1, storedTx.Version)
+
+		attempt := mustAddAttempt(t, s, storedTx, models.TxAttemptStateBroadcast, 1, 1)
+		storedAttempt, err := s.GetTxAttempt(attempt.ID)
+		require.NoError(t, err)
+		require.Equal(t, attempt.Version, storedAttempt.Version)
+	})
+
+	t.Run("stale write conflicts", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		tx := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 0)
+
+		first, err := s.GetTx(tx.ID)
+		require.NoError(t, err)
+		second, err := s.GetTx(tx.ID)
+		require.NoError(t, err)
+
+		first.State = models.TxStateConfirmed
+		require.NoError(t, s.PutTx(first))
+
+		second.State = models.TxStateFatalError
+		err = s.PutTx(second)
+		require.True(t, errors.Is(err, esStore.ErrConflict))
+		var conflict *esStore.ConflictError
+		require.True(t, errors.As(err, &conflict))
+		require.Equal(t, "Tx", conflict.Entity)
+		require.Equal(t, tx.ID.String(), conflict.Key)
+		require.Equal(t, second.Version, conflict.Version)
+		require.Equal(t, first.Version, conflict.StoredVersion)
+
+		stored, err := s.GetTx(tx.ID)
+		require.NoError(t, err)
+		require.Equal(t, models.TxStateConfirmed, stored.State)
+	})
+
+	t.Run("new record with existing key conflicts", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+
+		err := s.PutAccount(&models.Account{Address: account.Address, NextNonce: 9})
+		require.True(t, errors.Is(err, esStore.ErrConflict))
+
+		tx := mustInsertTx(t, s, account.Address, models.TxStateUnconfirmed, 0)
+		attempt := mustAddAttempt(t, s, tx, models.TxAttemptStateBroadcast, 1, 1)
+		err = s.PutTxAttempt(&models.TxAttempt{ID: attempt.ID, TxID: tx.ID, GasPrice: big.NewInt(2)})
+		require.True(t, errors.Is(err, esStore.ErrConflict))
+
+		nonce, err := s.GetNextNonce(account.Address)
+		require.NoError(t, err)
+		require.Equal(t, account.NextNonce, nonce)
+	})
+
+	t.Run("missing record conflicts", func(t *testing.T) {
+		s := newStore(t)
+		err := s.PutTxAttempt(&models.TxAttempt{ID: uuid.New(), TxID: uuid.New(), GasPrice: big.NewInt(1), Version: 3})
+		require.True(t, errors.Is(err, esStore.ErrConflict))
+		var conflict *esStore.ConflictError
+		require.True(t, errors.As(err, &conflict))
+		require.Equal(t, int64(0), conflict.StoredVersion)
+	})
+
+	t.Run("conflict rolls back transaction", func(t *testing.T) {
+		s := newStore(t)
+		account := mustInsertAccount(t, s)
+		stale, err := s.GetAccount(account.Address)
+		require.NoError(t, err)
+		require.NoError(t, s.SetNextNonce(account.Address, account.NextNonce+1))
+
+		job := &models.Job{ID: uuid.New(), TxID: uuid.New(), State: models.JobStateUnhandled}
+		err = s.RunInTx(func(txStore esStore.Store) error {
+			if putErr := txStore.PutJob(job); putErr != nil {
+				return putErr
+			}
+			return txStore.PutAccount(stale)
+		})
+		require.True(t, errors.Is(err, esStore.ErrConflict))
+		_, err = s.GetJob(job.ID)
+		require.True(t, errors.Is(err, esStore.ErrNotFound))
+	})
+}
@@ -17,7 +17,25 @@ var (
 )
 
 func (store *TMStore) PutAccount(account *models.Account) error {
-	return set(store.nsAccount, account.Address.Bytes(), account)
+	return store.runInTx(func(txStore *TMStore) error {
+		var storedVersion int64
+		old, err := txStore.GetAccount(account.Address)
+		if err == nil {
+			storedVersion = old.Version
+		} else if !errors.Is(err, esStore.ErrNotFound) {
+			return err
+		}
+		if err = esStore.CheckVersion("Account", account.Address.Hex(), account.Version, storedVersion); err != nil {
+			return err
+		}
+		next := *account
+		next.Version++
+		if err = set(txStore.nsAccount, account.Address.Bytes(), &next); err != nil {
+			return err
+		}
+		account.Version = next.Version
+		return nil
+	})
 }
 
 func (store *TMStore) GetAccount(fromAddress common.Address) (*models.Account, error) {
@@ -60,12 +78,14 @@ func (store *TMStore) GetNextNonce(address common.Address) (int64, error) {
 }
 
 func (store *TMStore) SetNextNonce(address common.Address, nextNonce int64) error {
-	account, err := store.GetAccount(address)
-	if err != nil {
-		return err
-	}
-	account.NextNonce = nextNonce
-	return store.PutAccount(account)
+	return store.runInTx(func(txStore *TMStore) error {
+		account, err := txStore.GetAccount(address)
+		if err != nil {
+			return err
+		}
+		account.NextNonce = nextNonce
+		return txStore.PutAccount(account)
+	})
 }
 
 func toDecodeAccountError(err error) error {
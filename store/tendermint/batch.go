@@ -0,0 +1,330 @@
+package tendermint
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/pkg/errors"
+	tmDB "github.com/tendermint/tm-db"
+)
+
+// batchDB is a tmDB.DB which buffers all writes in memory on top of a parent DB. Reads and
+// iterators see the buffered writes. Buffered writes are applied to the parent DB atomically using a
+// tmDB.Batch on commit, or simply dropped if the batchDB is discarded.
+type batchDB struct {
+	parent  tmDB.DB
+	pending map[string]*pendingWrite
+
+	// limit is the number of buffered writes committed at once, writes are buffered until commit if 0
+	limit int
+}
+
+// pendingWrite is a buffered write, deleted is set if the key has been removed.
+type pendingWrite struct {
+	value   []byte
+	deleted bool
+}
+
+var _ tmDB.DB = (*batchDB)(nil)
+
+func newBatchDB(parent tmDB.DB) *batchDB {
+	return &batchDB{
+		parent:  parent,
+		pending: make(map[string]*pendingWrite),
+	}
+}
+
+// Get implements tmDB.DB.
+func (db *batchDB) Get(key []byte) ([]byte, error) {
+	if write, ok := db.pending[string(key)]; ok {
+		if write.deleted {
+			return nil, nil
+		}
+		return write.value, nil
+	}
+	return db.parent.Get(key)
+}
+
+// Has implements tmDB.DB.
+func (db *batchDB) Has(key []byte) (bool, error) {
+	if write, ok := db.pending[string(key)]; ok {
+		return !write.deleted, nil
+	}
+	return db.parent.Has(key)
+}
+
+// newLimitedBatchDB creates a batchDB which commits its buffered writes whenever limit of them are
+// buffered. The writes are not atomic as a whole then, only each commit is.
+func newLimitedBatchDB(parent tmDB.DB, limit int) *batchDB {
+	db := newBatchDB(parent)
+	db.limit = limit
+	return db
+}
+
+// Set implements tmDB.DB.
+func (db *batchDB) Set(key []byte, value []byte) error {
+	db.pending[string(key)] = &pendingWrite{value: copyBytes(value)}
+	return db.commitFull()
+}
+
+// SetSync implements tmDB.DB.
+func (db *batchDB) SetSync(key []byte, value []byte) error {
+	return db.Set(key, value)
+}
+
+// Delete implements tmDB.DB.
+func (db *batchDB) Delete(key []byte) error {
+	db.pending[string(key)] = &pendingWrite{deleted: true}
+	return db.commitFull()
+}
+
+// DeleteSync implements tmDB.DB.
+func (db *batchDB) DeleteSync(key []byte) error {
+	return db.Delete(key)
+}
+
+// Iterator implements tmDB.DB.
+func (db *batchDB) Iterator(start, end []byte) (tmDB.Iterator, error) {
+	source, err := db.parent.Iterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return newBatchIterator(source, db.pendingKeys(start, end, false), db.pending, false), nil
+}
+
+// ReverseIterator implements tmDB.DB.
+func (db *batchDB) ReverseIterator(start, end []byte) (tmDB.Iterator, error) {
+	source, err := db.parent.ReverseIterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return newBatchIterator(source, db.pendingKeys(start, end, true), db.pending, true), nil
+}
+
+// Close implements tmDB.DB. The parent DB is left open.
+func (db *batchDB) Close() error {
+	return nil
+}
+
+// NewBatch implements tmDB.DB.
+func (db *batchDB) NewBatch() tmDB.Batch {
+	return &batchDBBatch{db: db, ops: make([]func(), 0)}
+}
+
+// Print implements tmDB.DB.
+func (db *batchDB) Print() error {
+	return db.parent.Print()
+}
+
+// Stats implements tmDB.DB.
+func (db *batchDB) Stats() map[string]string {
+	return db.parent.Stats()
+}
+
+// commit applies all buffered writes to the parent DB atomically.
+func (db *batchDB) commit() error {
+	if len(db.pending) == 0 {
+		return nil
+	}
+	batch := db.parent.NewBatch()
+	defer batch.Close()
+	for _, key := range db.pendingKeys(nil, nil, false) {
+		write := db.pending[key]
+		if write.deleted {
+			batch.Delete([]byte(key))
+		} else {
+			batch.Set([]byte(key), write.value)
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return errors.Wrap(err, "could not write batch")
+	}
+	db.pending = make(map[string]*pendingWrite)
+	return nil
+}
+
+// commitFull commits the buffered writes once the limit is reached.
+func (db *batchDB) commitFull() error {
+	if db.limit > 0 && len(db.pending) >= db.limit {
+		return db.commit()
+	}
+	return nil
+}
+
+// pendingKeys returns the sorted buffered keys within [start, end).
+func (db *batchDB) pendingKeys(start, end []byte, reverse bool) []string {
+	keys := make([]string, 0, len(db.pending))
+	for key := range db.pending {
+		if tmDB.IsKeyInDomain([]byte(key), start, end) {
+			keys = append(keys, key)
+		}
+	}
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	} else {
+		sort.Strings(keys)
+	}
+	return keys
+}
+
+// batchIterator merges an iterator over the parent DB with the buffered writes of a batchDB.
+type batchIterator struct {
+	source  tmDB.Iterator
+	keys    []string
+	pending map[string]*pendingWrite
+	reverse bool
+
+	// key and value of the current position, key is nil once the iterator is exhausted
+	key   []byte
+	value []byte
+}
+
+var _ tmDB.Iterator = (*batchIterator)(nil)
+
+func newBatchIterator(
+	source tmDB.Iterator,
+	keys []string,
+	pending map[string]*pendingWrite,
+	reverse bool,
+) *batchIterator {
+	iter := &batchIterator{
+		source:  source,
+		keys:    keys,
+		pending: pending,
+		reverse: reverse,
+	}
+	iter.advance()
+	return iter
+}
+
+// before returns true if key a comes before key b in the iteration order.
+func (iter *batchIterator) before(a, b []byte) bool {
+	if iter.reverse {
+		return bytes.Compare(a, b) > 0
+	}
+	return bytes.Compare(a, b) < 0
+}
+
+// advance moves to the next live key, preferring buffered writes over the parent DB.
+func (iter *batchIterator) advance() {
+	for {
+		sourceValid := iter.source.Valid()
+		if !sourceValid && len(iter.keys) == 0 {
+			iter.key, iter.value = nil, nil
+			return
+		}
+
+		var sourceKey []byte
+		if sourceValid {
+			sourceKey = iter.source.Key()
+			if _, ok := iter.pending[string(sourceKey)]; ok {
+				// Shadowed by a buffered write which is handled below
+				iter.source.Next()
+				continue
+			}
+		}
+
+		if len(iter.keys) > 0 && (!sourceValid || iter.before([]byte(iter.keys[0]), sourceKey)) {
+			key := iter.keys[0]
+			iter.keys = iter.keys[1:]
+			write := iter.pending[key]
+			if write.deleted {
+				continue
+			}
+			iter.key, iter.value = []byte(key), write.value
+			return
+		}
+
+		iter.key, iter.value = copyBytes(sourceKey), copyBytes(iter.source.Value())
+		iter.source.Next()
+		return
+	}
+}
+
+// Domain implements tmDB.Iterator.
+func (iter *batchIterator) Domain() (start []byte, end []byte) {
+	return iter.source.Domain()
+}
+
+// Valid implements tmDB.Iterator.
+func (iter *batchIterator) Valid() bool {
+	return iter.key != nil
+}
+
+// Next implements tmDB.Iterator.
+func (iter *batchIterator) Next() {
+	if !iter.Valid() {
+		panic("iterator is invalid")
+	}
+	iter.advance()
+}
+
+// Key implements tmDB.Iterator.
+func (iter *batchIterator) Key() []byte {
+	if !iter.Valid() {
+		panic("iterator is invalid")
+	}
+	return iter.key
+}
+
+// Value implements tmDB.Iterator.
+func (iter *batchIterator) Value() []byte {
+	if !iter.Valid() {
+		panic("iterator is invalid")
+	}
+	return iter.value
+}
+
+// Error implements tmDB.Iterator.
+func (iter *batchIterator) Error() error {
+	return iter.source.Error()
+}
+
+// Close implements tmDB.Iterator.
+func (iter *batchIterator) Close() {
+	iter.source.Close()
+}
+
+// batchDBBatch is a tmDB.Batch which applies its writes to a batchDB.
+type batchDBBatch struct {
+	db  *batchDB
+	ops []func()
+}
+
+// Set implements tmDB.Batch.
+func (b *batchDBBatch) Set(key, value []byte) {
+	key, value = copyBytes(key), copyBytes(value)
+	b.ops = append(b.ops, func() { _ = b.db.Set(key, value) })
+}
+
+// Delete implements tmDB.Batch.
+func (b *batchDBBatch) Delete(key []byte) {
+	key = copyBytes(key)
+	b.ops = append(b.ops, func() { _ = b.db.Delete(key) })
+}
+
+// Write implements tmDB.Batch.
+func (b *batchDBBatch) Write() error {
+	for _, op := range b.ops {
+		op()
+	}
+	b.ops = nil
+	return nil
+}
+
+// WriteSync implements tmDB.Batch.
+func (b *batchDBBatch) WriteSync() error {
+	return b.Write()
+}
+
+// Close implements tmDB.Batch.
+func (b *batchDBBatch) Close() {
+	b.ops = nil
+}
+
+// copyBytes returns a copy of b which is never nil.
+func copyBytes(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
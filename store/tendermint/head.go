@@ -4,35 +4,45 @@ import (
 	esStore "github.com/begmaroman/eth-services/store"
 	"github.com/begmaroman/eth-services/store/models"
 	"github.com/ethereum/go-ethereum/common"
-
 	"github.com/pkg/errors"
-	"github.com/vmihailenco/msgpack/v5"
-)
-
-const (
-	errStrDecodeHead = "could not decode head"
 )
 
 var (
 	prefixHead         = []byte("hd")
 	prefixLastHeadHash = []byte("plh")
 	keyLastHeadHash    = []byte("klh")
+	// number | hash => nil
+	prefixHeadNumberIndex = []byte("ixhn")
 )
 
 // InsertHead inserts a block head
 func (store *TMStore) InsertHead(head *models.Head) error {
-	lastHead, err := store.LastHead()
-	if err != nil {
-		return err
-	}
-	// Stores the hash of the last head.
-	if lastHead == nil || head.Number >= lastHead.Number {
-		err = set(store.nsLastHeadHash, keyLastHeadHash, &(head.Hash))
+	return store.runInTx(func(txStore *TMStore) error {
+		lastHead, err := txStore.LastHead()
 		if err != nil {
-			return errors.Wrap(err, "error updating last head hash")
+			return err
 		}
-	}
-	return set(store.nsHead, head.Hash.Bytes(), &head)
+		// Stores the hash of the last head.
+		if lastHead == nil || head.Number >= lastHead.Number {
+			err = set(txStore.nsLastHeadHash, keyLastHeadHash, &(head.Hash))
+			if err != nil {
+				return errors.Wrap(err, "error updating last head hash")
+			}
+		}
+		oldHead, err := txStore.HeadByHash(head.Hash)
+		if err != nil {
+			return err
+		}
+		if oldHead != nil && oldHead.Number != head.Number {
+			if err = txStore.nsHeadNumber.Delete(headNumberKey(oldHead.Number, oldHead.Hash)); err != nil {
+				return errors.Wrap(err, errStrIndex)
+			}
+		}
+		if err = txStore.nsHeadNumber.Set(headNumberKey(head.Number, head.Hash), []byte{}); err != nil {
+			return errors.Wrap(err, errStrIndex)
+		}
+		return set(txStore.nsHead, head.Hash.Bytes(), &head)
+	})
 }
 
 // LastHead returns the head with the highest number. In the case of ties (e.g.
@@ -55,24 +65,15 @@ func (store *TMStore) LastHead() (*models.Head, error) {
 
 // FirstHead returns the head with the lowest number. Only for testing.
 func (store *TMStore) FirstHead() (*models.Head, error) {
-	iter, err := store.nsHead.Iterator(nil, nil)
+	iter, err := store.nsHeadNumber.Iterator(nil, nil)
 	if err != nil {
 		return nil, toCreateIterError(err)
 	}
 	defer iter.Close()
-	var firstHead *models.Head = nil
-	for ; iter.Valid(); iter.Next() {
-		value := iter.Value()
-		var head models.Head
-		err = msgpack.Unmarshal(value, &head)
-		if err != nil {
-			return nil, toDecodeHeadError(err)
-		}
-		if firstHead == nil || head.Number < firstHead.Number {
-			firstHead = &head
-		}
+	if !iter.Valid() {
+		return nil, iter.Error()
 	}
-	return firstHead, nil
+	return store.HeadByHash(headNumberKeyHash(iter.Key()))
 }
 
 // HeadByHash fetches the head with the given hash from the db, returns nil if none exists.
@@ -88,41 +89,69 @@ func (store *TMStore) HeadByHash(hash common.Hash) (*models.Head, error) {
 	return &head, nil
 }
 
-// TrimOldHeads deletes "depth" number of heads such that only the top N block numbers remain.
-func (store *TMStore) TrimOldHeads(depth int64) error {
-	lastHead, err := store.LastHead()
-	if err != nil {
-		if errors.Is(err, esStore.ErrNotFound) {
-			return nil
-		}
-		return err
+// HeadsByNumber returns all heads with the given number, e.g. competing heads due to re-org.
+// Returns nil if none exists.
+func (store *TMStore) HeadsByNumber(number int64) ([]*models.Head, error) {
+	return store.HeadsInRange(number, number)
+}
+
+// HeadsInRange returns all heads with a number between fromNumber and toNumber (both inclusive),
+// ordered by ascending number. Returns nil if none exists.
+func (store *TMStore) HeadsInRange(fromNumber, toNumber int64) ([]*models.Head, error) {
+	if toNumber < fromNumber || toNumber < 0 {
+		return nil, nil
 	}
-	// lastHead should not be nil by now
-	highestNumber := lastHead.Number
-	iter, err := store.nsHead.Iterator(nil, nil)
+	entries, err := scanIndex(store.nsHeadNumber, encodeBlockNumber(fromNumber), encodeBlockNumber(toNumber+1))
 	if err != nil {
-		return toCreateIterError(err)
+		return nil, err
 	}
-	defer iter.Close()
-	toTrim := make([][]byte, 0)
-	for ; iter.Valid(); iter.Next() {
-		value := iter.Value()
-		var head models.Head
-		err = msgpack.Unmarshal(value, &head)
-		if err != nil {
-			return toDecodeHeadError(err)
+	var heads []*models.Head
+	for _, entry := range entries {
+		head, headErr := store.HeadByHash(headNumberKeyHash(entry.key))
+		if headErr != nil {
+			return nil, headErr
 		}
-		if highestNumber-head.Number >= depth {
-			toTrim = append(toTrim, head.Hash.Bytes())
+		if head != nil {
+			heads = append(heads, head)
 		}
 	}
-	for _, key := range toTrim {
-		err = store.nsHead.Delete(key)
+	return heads, nil
+}
+
+// TrimOldHeads deletes "depth" number of heads such that only the top N block numbers remain.
+func (store *TMStore) TrimOldHeads(depth int64) error {
+	return store.runInTx(func(txStore *TMStore) error {
+		lastHead, err := txStore.LastHead()
 		if err != nil {
-			return errors.Wrap(err, "could not delete head")
+			if errors.Is(err, esStore.ErrNotFound) {
+				return nil
+			}
+			return err
 		}
-	}
-	return nil
+		if lastHead == nil {
+			return nil
+		}
+		// Delete all heads with highestNumber - number >= depth
+		cutoff := lastHead.Number - depth + 1
+		if cutoff <= 0 {
+			return nil
+		}
+		entries, err := scanIndex(txStore.nsHeadNumber, nil, encodeBlockNumber(cutoff))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			err = txStore.nsHead.Delete(headNumberKeyHash(entry.key).Bytes())
+			if err != nil {
+				return errors.Wrap(err, "could not delete head")
+			}
+			err = txStore.nsHeadNumber.Delete(entry.key)
+			if err != nil {
+				return errors.Wrap(err, errStrIndex)
+			}
+		}
+		return nil
+	})
 }
 
 // Chain returns the chain of heads starting at hash and up to lookback parents.
@@ -153,6 +182,11 @@ func (store *TMStore) Chain(hash common.Hash, lookback int64) (*models.Head, err
 	return firstHead, nil
 }
 
-func toDecodeHeadError(err error) error {
-	return errors.Wrap(err, errStrDecodeHead)
+func headNumberKey(number int64, hash common.Hash) []byte {
+	return append(encodeBlockNumber(number), hash.Bytes()...)
+}
+
+// headNumberKeyHash extracts the head hash from a key of the head number index.
+func headNumberKeyHash(key []byte) common.Hash {
+	return common.BytesToHash(key[uint64Len:])
 }
@@ -0,0 +1,327 @@
+package tendermint
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	tmDB "github.com/tendermint/tm-db"
+)
+
+// Secondary indexes are kept in their own keyspaces next to the entities they point to. They hold
+// no data of their own, so each of them can always be rebuilt from the primary records.
+var (
+	// state | 0x00 | from address | nonce | tx ID => nil
+	prefixTxStateIndex = []byte("ixts")
+	// state | 0x00 | attempt ID => tx ID
+	prefixTxAttemptStateIndex = []byte("ixas")
+	// attempt ID => tx ID, only for attempts with BroadcastBeforeBlockNum == -1
+	prefixTxAttemptUnsetBlockIndex = []byte("ixab")
+	// block number | receipt ID => nil
+	prefixReceiptBlockIndex = []byte("ixrb")
+	// receipt ID => attempt ID
+	prefixReceiptAttemptIndex = []byte("ixra")
+	// created at | tx ID => nil
+	prefixTxCreatedIndex = []byte("ixtc")
+)
+
+const (
+	uuidLen     = len(uuid.UUID{})
+	uint64Len   = 8
+	txStateSep  = byte(0)
+	errStrIndex = "could not update index"
+)
+
+// indexEntry is a key/value pair copied out of an index iterator.
+type indexEntry struct {
+	key   []byte
+	value []byte
+}
+
+// scanIndex returns copies of all entries of the given index within [start, end). Entries are
+// collected before returning so that callers are free to write to the index afterwards.
+func scanIndex(db tmDB.DB, start, end []byte) ([]indexEntry, error) {
+	return scanIndexLimit(db, start, end, false, 0)
+}
+
+// scanIndexLimit is like scanIndex but returns at most limit entries if limit is positive, in
+// descending key order if reverse is set.
+func scanIndexLimit(db tmDB.DB, start, end []byte, reverse bool, limit int) ([]indexEntry, error) {
+	if start != nil && end != nil && bytes.Compare(start, end) >= 0 {
+		return nil, nil
+	}
+	var iter tmDB.Iterator
+	var err error
+	if reverse {
+		iter, err = db.ReverseIterator(start, end)
+	} else {
+		iter, err = db.Iterator(start, end)
+	}
+	if err != nil {
+		return nil, toCreateIterError(err)
+	}
+	defer iter.Close()
+	var entries []indexEntry
+	for ; iter.Valid() && (limit <= 0 || len(entries) < limit); iter.Next() {
+		entries = append(entries, indexEntry{
+			key:   common.CopyBytes(iter.Key()),
+			value: common.CopyBytes(iter.Value()),
+		})
+	}
+	return entries, iter.Error()
+}
+
+// scanIndexPrefix returns all entries of the given index which keys start with prefix.
+func scanIndexPrefix(db tmDB.DB, prefix []byte) ([]indexEntry, error) {
+	return scanIndex(db, prefix, prefixEnd(prefix))
+}
+
+// prefixEnd returns the smallest key greater than all keys starting with prefix, or nil if there
+// is no such key.
+func prefixEnd(prefix []byte) []byte {
+	end := common.CopyBytes(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+func encodeUint64(n uint64) []byte {
+	b := make([]byte, uint64Len)
+	binary.BigEndian.PutUint64(b, n)
+	return b
+}
+
+// encodeNonce encodes a nonce so that the byte order matches the numeric order. Unassigned
+// nonces (-1) sort first.
+func encodeNonce(nonce int64) []byte {
+	return encodeUint64(uint64(nonce + 1))
+}
+
+func decodeNonce(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b)) - 1
+}
+
+// encodeBlockNumber encodes a block number so that the byte order matches the numeric order.
+// Negative numbers are clamped to zero.
+func encodeBlockNumber(number int64) []byte {
+	if number < 0 {
+		number = 0
+	}
+	return encodeUint64(uint64(number))
+}
+
+func txStatePrefix(state models.TxState) []byte {
+	return append([]byte(state), txStateSep)
+}
+
+func txStateAddressPrefix(state models.TxState, address common.Address) []byte {
+	return append(txStatePrefix(state), address.Bytes()...)
+}
+
+func txStateKey(tx *models.Tx) []byte {
+	key := txStateAddressPrefix(tx.State, tx.FromAddress)
+	key = append(key, encodeNonce(tx.Nonce)...)
+	return append(key, tx.ID[:]...)
+}
+
+// txStateKeyID extracts the Tx ID from a key of the Tx state index.
+func txStateKeyID(key []byte) uuid.UUID {
+	return bytesToUUID(key[len(key)-uuidLen:])
+}
+
+// txStateKeyNonce extracts the nonce from a key of the Tx state index.
+func txStateKeyNonce(key []byte) int64 {
+	end := len(key) - uuidLen
+	return decodeNonce(key[end-uint64Len : end])
+}
+
+// txCreatedKey encodes the position of a Tx in the creation time index. Negative times are clamped
+// to zero.
+func txCreatedKey(createdAt int64, id uuid.UUID) []byte {
+	if createdAt < 0 {
+		createdAt = 0
+	}
+	return append(encodeUint64(uint64(createdAt)), id[:]...)
+}
+
+// txCreatedKeyID extracts the Tx ID from a key of the Tx creation time index.
+func txCreatedKeyID(key []byte) uuid.UUID {
+	return bytesToUUID(key[uint64Len:])
+}
+
+func txAttemptStatePrefix(state models.TxAttemptState) []byte {
+	return append([]byte(state), txStateSep)
+}
+
+func txAttemptStateKey(attempt *models.TxAttempt) []byte {
+	return append(txAttemptStatePrefix(attempt.State), attempt.ID[:]...)
+}
+
+// txAttemptStateKeyID extracts the TxAttempt ID from a key of the TxAttempt state index.
+func txAttemptStateKeyID(key []byte) uuid.UUID {
+	return bytesToUUID(key[len(key)-uuidLen:])
+}
+
+func receiptBlockKey(receipt *models.TxReceipt) []byte {
+	return append(encodeBlockNumber(receipt.BlockNumber), receipt.ID[:]...)
+}
+
+// receiptBlockKeyID extracts the receipt ID from a key of the receipt block index.
+func receiptBlockKeyID(key []byte) uuid.UUID {
+	return bytesToUUID(key[uint64Len:])
+}
+
+func bytesToUUID(b []byte) uuid.UUID {
+	var id uuid.UUID
+	copy(id[:], b)
+	return id
+}
+
+// indexTx updates the Tx indexes after tx has been written. old is the previously stored version of
+// the Tx, or nil if there was none.
+func (store *TMStore) indexTx(old, tx *models.Tx) error {
+	var oldStateKey, oldCreatedKey []byte
+	if old != nil {
+		oldStateKey = txStateKey(old)
+		oldCreatedKey = txCreatedKey(esStore.UnixNano(old.CreatedAt), old.ID)
+	}
+	if err := replaceIndexKey(store.nsTxStateIdx, oldStateKey, txStateKey(tx)); err != nil {
+		return err
+	}
+	return replaceIndexKey(store.nsTxCreatedIdx, oldCreatedKey, txCreatedKey(esStore.UnixNano(tx.CreatedAt), tx.ID))
+}
+
+// replaceIndexKey moves an index entry without value from oldKey, if not nil, to newKey.
+func replaceIndexKey(ns tmDB.DB, oldKey, newKey []byte) error {
+	if oldKey != nil {
+		if bytes.Equal(oldKey, newKey) {
+			return nil
+		}
+		if err := ns.Delete(oldKey); err != nil {
+			return errors.Wrap(err, errStrIndex)
+		}
+	}
+	if err := ns.Set(newKey, []byte{}); err != nil {
+		return errors.Wrap(err, errStrIndex)
+	}
+	return nil
+}
+
+// indexTxAttempt updates the TxAttempt indexes after attempt has been written or deleted. old is
+// the previously stored version of the attempt, or nil if there was none. attempt is nil on delete.
+func (store *TMStore) indexTxAttempt(old, attempt *models.TxAttempt) error {
+	if old != nil {
+		if err := store.nsTxAttemptStateIdx.Delete(txAttemptStateKey(old)); err != nil {
+			return errors.Wrap(err, errStrIndex)
+		}
+		if err := store.nsTxAttemptUnsetIdx.Delete(old.ID[:]); err != nil {
+			return errors.Wrap(err, errStrIndex)
+		}
+		for _, receiptID := range old.TxReceiptIDs {
+			if err := store.nsReceiptAttemptIdx.Delete(receiptID[:]); err != nil {
+				return errors.Wrap(err, errStrIndex)
+			}
+		}
+	}
+	if attempt == nil {
+		return nil
+	}
+	if err := store.nsTxAttemptStateIdx.Set(txAttemptStateKey(attempt), attempt.TxID[:]); err != nil {
+		return errors.Wrap(err, errStrIndex)
+	}
+	if attempt.BroadcastBeforeBlockNum == -1 {
+		if err := store.nsTxAttemptUnsetIdx.Set(attempt.ID[:], attempt.TxID[:]); err != nil {
+			return errors.Wrap(err, errStrIndex)
+		}
+	}
+	for _, receiptID := range attempt.TxReceiptIDs {
+		if err := store.nsReceiptAttemptIdx.Set(receiptID[:], attempt.ID[:]); err != nil {
+			return errors.Wrap(err, errStrIndex)
+		}
+	}
+	return nil
+}
+
+// indexTxReceipt updates the receipt indexes after receipt has been written or deleted. old is the
+// previously stored version of the receipt, or nil if there was none. receipt is nil on delete.
+func (store *TMStore) indexTxReceipt(old, receipt *models.TxReceipt) error {
+	if old != nil {
+		if err := store.nsReceiptBlockIdx.Delete(receiptBlockKey(old)); err != nil {
+			return errors.Wrap(err, errStrIndex)
+		}
+	}
+	if receipt == nil {
+		return nil
+	}
+	if err := store.nsReceiptBlockIdx.Set(receiptBlockKey(receipt), []byte{}); err != nil {
+		return errors.Wrap(err, errStrIndex)
+	}
+	return nil
+}
+
+// txsInState returns the Txs in the given state, ordered by from address, nonce and ID.
+func (store *TMStore) txsInState(state models.TxState) ([]*models.Tx, error) {
+	entries, err := scanIndexPrefix(store.nsTxStateIdx, txStatePrefix(state))
+	if err != nil {
+		return nil, err
+	}
+	return store.txsForStateEntries(entries)
+}
+
+// txsInStateForAddress returns the Txs in the given state sent from address, ordered by nonce and
+// ID.
+func (store *TMStore) txsInStateForAddress(state models.TxState, address common.Address) ([]*models.Tx, error) {
+	entries, err := scanIndexPrefix(store.nsTxStateIdx, txStateAddressPrefix(state, address))
+	if err != nil {
+		return nil, err
+	}
+	return store.txsForStateEntries(entries)
+}
+
+func (store *TMStore) txsForStateEntries(entries []indexEntry) ([]*models.Tx, error) {
+	var txs []*models.Tx
+	for _, entry := range entries {
+		tx, err := store.GetTx(txStateKeyID(entry.key))
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// maxNonceInState returns the highest nonce of the Txs in the given state sent from address, or -1
+// if there are none.
+func (store *TMStore) maxNonceInState(state models.TxState, address common.Address) (int64, error) {
+	prefix := txStateAddressPrefix(state, address)
+	iter, err := store.nsTxStateIdx.ReverseIterator(prefix, prefixEnd(prefix))
+	if err != nil {
+		return 0, toCreateIterError(err)
+	}
+	defer iter.Close()
+	if !iter.Valid() {
+		return -1, iter.Error()
+	}
+	return txStateKeyNonce(iter.Key()), nil
+}
+
+// hasAccounts returns ErrNotFound if no account has been stored yet.
+func (store *TMStore) hasAccounts() error {
+	iter, err := store.nsAccount.Iterator(nil, nil)
+	if err != nil {
+		return toCreateIterError(err)
+	}
+	defer iter.Close()
+	if !iter.Valid() {
+		return esStore.ErrNotFound
+	}
+	return nil
+}
@@ -20,6 +20,19 @@ func (store *TMStore) GetJob(jobID uuid.UUID) (*models.Job, error) {
 	return &job, nil
 }
 
+// GetJobs returns all jobs ordered by ID. Returns nil if none exists.
+func (store *TMStore) GetJobs() ([]*models.Job, error) {
+	var jobs []*models.Job
+	collect := func(_ []byte, entity interface{}) error {
+		jobs = append(jobs, entity.(*models.Job))
+		return nil
+	}
+	if err := forEachRecord(store.nsJob, func() interface{} { return &models.Job{} }, collect); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
 func (store *TMStore) PutJob(job *models.Job) error {
 	return set(store.nsJob, job.ID[:], job)
 }
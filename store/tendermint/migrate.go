@@ -0,0 +1,337 @@
+package tendermint
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/begmaroman/eth-services/store/models"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	tmDB "github.com/tendermint/tm-db"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var (
+	prefixSchema     = []byte("sch")
+	keySchemaVersion = []byte("ver")
+)
+
+// ErrUnknownSchemaVersion is returned when the database was written by a newer version of the
+// store which this one does not know how to read.
+var ErrUnknownSchemaVersion = errors.New("unknown schema version")
+
+// migrationBatchSize is the number of writes of a migration committed at once.
+const migrationBatchSize = 10000
+
+// migration upgrades the records of a TMStore to version. Records are msgpack-encoded models, so
+// every incompatible change of a persisted model needs a migration re-encoding the existing records,
+// e.g. using rewriteRecords. Released migrations must never be changed, add a new one instead.
+// Migrations are committed in batches of migrationBatchSize writes and run again after a partial
+// run, so they must only rewrite records.
+type migration struct {
+	version     uint64
+	description string
+	migrate     func(store *TMStore) error
+}
+
+var migrations = []migration{
+	{
+		// Databases written before the secondary indexes existed have no index entries, so
+		// index-backed queries would find nothing without it
+		version:     1,
+		description: "build secondary indexes",
+		migrate:     buildIndexesV1,
+	},
+	{
+		version:     2,
+		description: "initialize versions of accounts, Txs and attempts",
+		migrate:     initializeVersions,
+	},
+	{
+		version:     3,
+		description: "index Txs by creation time",
+		migrate:     indexTxsByCreationV3,
+	},
+}
+
+// LatestSchemaVersion returns the schema version of databases written by this version of the store.
+func LatestSchemaVersion() uint64 {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].version
+}
+
+// SchemaVersion returns the schema version of the database. Databases created before schema
+// versioning was introduced have version 0.
+func (store *TMStore) SchemaVersion() (uint64, error) {
+	value, err := store.nsSchema.Get(keySchemaVersion)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get schema version")
+	}
+	if value == nil {
+		return 0, nil
+	}
+	if len(value) != uint64Len {
+		return 0, errors.Errorf("invalid schema version %x", value)
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// migrate applies all migrations newer than the schema version of the database. The writes of a
+// migration are committed in bounded batches, the schema version is updated with the last one.
+func (store *TMStore) migrate() error {
+	current, err := store.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return errors.Wrapf(ErrUnknownSchemaVersion,
+			"database schema version %d is newer than the latest known version %d", current, latest)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err = store.applyMigration(m); err != nil {
+			return errors.Wrapf(err, "could not apply migration %d (%s)", m.version, m.description)
+		}
+	}
+	return nil
+}
+
+// applyMigration applies the given migration and sets the schema version to its version.
+func (store *TMStore) applyMigration(m migration) error {
+	store.txLock.Lock()
+	defer store.txLock.Unlock()
+
+	batch := newLimitedBatchDB(store.db, migrationBatchSize)
+	txStore := newTMStore(batch, store.txLock, batch)
+	if err := m.migrate(txStore); err != nil {
+		return err
+	}
+	if err := txStore.nsSchema.Set(keySchemaVersion, encodeUint64(m.version)); err != nil {
+		return errors.Wrap(err, "could not set schema version")
+	}
+	return batch.commit()
+}
+
+// forEachRecord decodes every record of ns into a new entity created by newEntity and calls fn
+// with it. Records are collected first so that fn is free to write to the store.
+func forEachRecord(
+	ns tmDB.DB,
+	newEntity func() interface{},
+	fn func(key []byte, entity interface{}) error,
+) error {
+	entries, err := scanIndex(ns, nil, nil)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entity := newEntity()
+		if err = msgpack.Unmarshal(entry.value, entity); err != nil {
+			return errors.Wrap(err, "could not decode data")
+		}
+		if err = fn(entry.key, entity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteRecords re-encodes every record of ns. Records are decoded into an entity created by
+// newEntity, and convert returns the record to store instead. newEntity may create the current model
+// if the migration does not change its shape. Otherwise it must create a frozen copy of the model as
+// it was persisted before the migration, declared along with the migration, as the current model
+// keeps changing with later versions.
+func rewriteRecords(
+	ns tmDB.DB,
+	newEntity func() interface{},
+	convert func(entity interface{}) (interface{}, error),
+) error {
+	return forEachRecord(ns, newEntity, func(key []byte, entity interface{}) error {
+		converted, err := convert(entity)
+		if err != nil {
+			return err
+		}
+		return set(ns, key, converted)
+	})
+}
+
+// clearNamespace deletes all keys of ns.
+func clearNamespace(ns tmDB.DB) error {
+	entries, err := scanIndex(ns, nil, nil)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err = ns.Delete(entry.key); err != nil {
+			return errors.Wrap(err, "could not delete data")
+		}
+	}
+	return nil
+}
+
+// The index-building migrations below work on frozen copies of the records and index keys as they
+// were when the migration was released, so that later changes of the live indexing code do not alter
+// what they write.
+
+// v1Head, v1Tx, v1TxAttempt and v1TxReceipt hold the indexed fields of the records as of version 1.
+type v1Head struct {
+	Hash   common.Hash
+	Number int64
+}
+
+type v1Tx struct {
+	ID          uuid.UUID
+	Nonce       int64
+	FromAddress common.Address
+	State       string
+}
+
+type v1TxAttempt struct {
+	ID                      uuid.UUID
+	TxID                    uuid.UUID
+	BroadcastBeforeBlockNum int64
+	State                   string
+	TxReceiptIDs            []uuid.UUID
+}
+
+type v1TxReceipt struct {
+	ID          uuid.UUID
+	BlockNumber int64
+}
+
+// v1BlockNumber encodes a block number of an index key as of version 1.
+func v1BlockNumber(number int64) []byte {
+	if number < 0 {
+		number = 0
+	}
+	return encodeUint64(uint64(number))
+}
+
+// buildIndexesV1 drops the secondary indexes of version 1 and builds them from the primary records.
+func buildIndexesV1(store *TMStore) error {
+	for _, ns := range []tmDB.DB{
+		store.nsHeadNumber,
+		store.nsTxStateIdx,
+		store.nsTxAttemptStateIdx,
+		store.nsTxAttemptUnsetIdx,
+		store.nsReceiptBlockIdx,
+		store.nsReceiptAttemptIdx,
+	} {
+		if err := clearNamespace(ns); err != nil {
+			return err
+		}
+	}
+
+	setIndex := func(ns tmDB.DB, key, value []byte) error {
+		if err := ns.Set(key, value); err != nil {
+			return errors.Wrap(err, errStrIndex)
+		}
+		return nil
+	}
+	indexHead := func(_ []byte, entity interface{}) error {
+		head := entity.(*v1Head)
+		return setIndex(store.nsHeadNumber, append(v1BlockNumber(head.Number), head.Hash.Bytes()...), []byte{})
+	}
+	if err := forEachRecord(store.nsHead, func() interface{} { return &v1Head{} }, indexHead); err != nil {
+		return err
+	}
+	indexTx := func(_ []byte, entity interface{}) error {
+		tx := entity.(*v1Tx)
+		key := append(append([]byte(tx.State), 0), tx.FromAddress.Bytes()...)
+		key = append(append(key, encodeUint64(uint64(tx.Nonce+1))...), tx.ID[:]...)
+		return setIndex(store.nsTxStateIdx, key, []byte{})
+	}
+	if err := forEachRecord(store.nsTx, func() interface{} { return &v1Tx{} }, indexTx); err != nil {
+		return err
+	}
+	indexTxAttempt := func(_ []byte, entity interface{}) error {
+		attempt := entity.(*v1TxAttempt)
+		key := append(append([]byte(attempt.State), 0), attempt.ID[:]...)
+		if err := setIndex(store.nsTxAttemptStateIdx, key, attempt.TxID[:]); err != nil {
+			return err
+		}
+		if attempt.BroadcastBeforeBlockNum == -1 {
+			if err := setIndex(store.nsTxAttemptUnsetIdx, attempt.ID[:], attempt.TxID[:]); err != nil {
+				return err
+			}
+		}
+		for _, receiptID := range attempt.TxReceiptIDs {
+			if err := setIndex(store.nsReceiptAttemptIdx, receiptID[:], attempt.ID[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := forEachRecord(store.nsTxAttempt, func() interface{} { return &v1TxAttempt{} }, indexTxAttempt)
+	if err != nil {
+		return err
+	}
+	indexTxReceipt := func(_ []byte, entity interface{}) error {
+		receipt := entity.(*v1TxReceipt)
+		return setIndex(store.nsReceiptBlockIdx, append(v1BlockNumber(receipt.BlockNumber), receipt.ID[:]...), []byte{})
+	}
+	return forEachRecord(store.nsTxReceipt, func() interface{} { return &v1TxReceipt{} }, indexTxReceipt)
+}
+
+// v3Tx holds the indexed fields of a Tx as of version 3.
+type v3Tx struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+}
+
+// indexTxsByCreationV3 builds the creation time index of the Txs, other indexes are left untouched.
+func indexTxsByCreationV3(store *TMStore) error {
+	if err := clearNamespace(store.nsTxCreatedIdx); err != nil {
+		return err
+	}
+
+	indexTx := func(_ []byte, entity interface{}) error {
+		tx := entity.(*v3Tx)
+		var createdAt int64
+		if !tx.CreatedAt.IsZero() && tx.CreatedAt.UnixNano() > 0 {
+			createdAt = tx.CreatedAt.UnixNano()
+		}
+		if err := store.nsTxCreatedIdx.Set(append(encodeUint64(uint64(createdAt)), tx.ID[:]...), []byte{}); err != nil {
+			return errors.Wrap(err, errStrIndex)
+		}
+		return nil
+	}
+	return forEachRecord(store.nsTx, func() interface{} { return &v3Tx{} }, indexTx)
+}
+
+// initializeVersions sets the version of all accounts, Txs and attempts written before versioning to
+// 1, so that they are not mistaken for new records.
+func initializeVersions(store *TMStore) error {
+	initAccount := func(entity interface{}) (interface{}, error) {
+		account := entity.(*models.Account)
+		if account.Version == 0 {
+			account.Version = 1
+		}
+		return account, nil
+	}
+	if err := rewriteRecords(store.nsAccount, func() interface{} { return &models.Account{} }, initAccount); err != nil {
+		return err
+	}
+	initTx := func(entity interface{}) (interface{}, error) {
+		tx := entity.(*models.Tx)
+		if tx.Version == 0 {
+			tx.Version = 1
+		}
+		return tx, nil
+	}
+	if err := rewriteRecords(store.nsTx, func() interface{} { return &models.Tx{} }, initTx); err != nil {
+		return err
+	}
+	initTxAttempt := func(entity interface{}) (interface{}, error) {
+		attempt := entity.(*models.TxAttempt)
+		if attempt.Version == 0 {
+			attempt.Version = 1
+		}
+		return attempt, nil
+	}
+	return rewriteRecords(store.nsTxAttempt, func() interface{} { return &models.TxAttempt{} }, initTxAttempt)
+}
@@ -0,0 +1,267 @@
+package tendermint
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	tmDB "github.com/tendermint/tm-db"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/models"
+)
+
+func Test_TMStore_Migrate(t *testing.T) {
+	t.Run("builds indexes of databases created before versioning", func(t *testing.T) {
+		db := tmDB.NewMemDB()
+		// Write the records directly, as done before indexes existed
+		legacy := newTMStore(db, &sync.Mutex{}, nil)
+		address := common.HexToAddress("0x27548a32b9ad5d64c5945eae9da5337bc3169d15")
+		tx := &models.Tx{
+			ID:          uuid.New(),
+			FromAddress: address,
+			Value:       big.NewInt(1),
+			MaxGasPrice: big.NewInt(1),
+			State:       models.TxStateUnstarted,
+		}
+		head := &models.Head{Hash: common.HexToHash("0x01"), Number: 7}
+		account := &models.Account{Address: address, TxIDs: []uuid.UUID{tx.ID}}
+		require.NoError(t, set(legacy.nsAccount, address.Bytes(), account))
+		require.NoError(t, set(legacy.nsTx, tx.ID[:], tx))
+		require.NoError(t, set(legacy.nsHead, head.Hash.Bytes(), head))
+
+		store, err := NewTMStore(db)
+		require.NoError(t, err)
+
+		version, err := store.SchemaVersion()
+		require.NoError(t, err)
+		require.Equal(t, LatestSchemaVersion(), version)
+		unstarted, err := store.GetNextUnstartedTx(address)
+		require.NoError(t, err)
+		require.Equal(t, tx.ID, unstarted.ID)
+		require.Equal(t, int64(1), unstarted.Version)
+		storedAccount, err := store.GetAccount(address)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), storedAccount.Version)
+		heads, err := store.HeadsByNumber(7)
+		require.NoError(t, err)
+		require.Len(t, heads, 1)
+
+		// Opening the database again does not migrate twice
+		_, err = NewTMStore(db)
+		require.NoError(t, err)
+	})
+
+	t.Run("index-backed queries find records written before indexes", func(t *testing.T) {
+		db := tmDB.NewMemDB()
+		legacy := newTMStore(db, &sync.Mutex{}, nil)
+		address := common.HexToAddress("0x27548a32b9ad5d64c5945eae9da5337bc3169d15")
+		inProgressTx := &models.Tx{
+			ID:          uuid.New(),
+			FromAddress: address,
+			Value:       big.NewInt(1),
+			MaxGasPrice: big.NewInt(1),
+			State:       models.TxStateInProgress,
+			CreatedAt:   time.Unix(2, 0),
+		}
+		attempt := &models.TxAttempt{
+			ID:                      uuid.New(),
+			GasPrice:                big.NewInt(1),
+			BroadcastBeforeBlockNum: -1,
+			State:                   models.TxAttemptStateInProgress,
+		}
+		unconfirmedTx := &models.Tx{
+			ID:           uuid.New(),
+			FromAddress:  address,
+			Value:        big.NewInt(1),
+			MaxGasPrice:  big.NewInt(1),
+			State:        models.TxStateUnconfirmed,
+			TxAttemptIDs: []uuid.UUID{attempt.ID},
+			CreatedAt:    time.Unix(1, 0),
+		}
+		attempt.TxID = unconfirmedTx.ID
+		account := &models.Account{Address: address, TxIDs: []uuid.UUID{inProgressTx.ID, unconfirmedTx.ID}}
+		require.NoError(t, set(legacy.nsAccount, address.Bytes(), account))
+		require.NoError(t, set(legacy.nsTx, inProgressTx.ID[:], inProgressTx))
+		require.NoError(t, set(legacy.nsTx, unconfirmedTx.ID[:], unconfirmedTx))
+		require.NoError(t, set(legacy.nsTxAttempt, attempt.ID[:], attempt))
+
+		store, err := NewTMStore(db)
+		require.NoError(t, err)
+
+		tx, err := store.GetInProgressTx(address)
+		require.NoError(t, err)
+		require.Equal(t, inProgressTx.ID, tx.ID)
+		txs, err := store.GetTxsRequiringReceiptFetch()
+		require.NoError(t, err)
+		require.Len(t, txs, 1)
+		require.Equal(t, unconfirmedTx.ID, txs[0].ID)
+		attempts, err := store.GetInProgressAttempts(address)
+		require.NoError(t, err)
+		require.Len(t, attempts, 1)
+		require.Equal(t, attempt.ID, attempts[0].ID)
+		page, err := store.QueryTxs(esStore.TxQuery{})
+		require.NoError(t, err)
+		require.Len(t, page.Txs, 2)
+		require.Equal(t, unconfirmedTx.ID, page.Txs[0].ID)
+		require.Equal(t, inProgressTx.ID, page.Txs[1].ID)
+	})
+
+	t.Run("indexes Txs of version 2 databases by creation time", func(t *testing.T) {
+		db := tmDB.NewMemDB()
+		store, err := NewTMStore(db)
+		require.NoError(t, err)
+		tx := &models.Tx{
+			ID:          uuid.New(),
+			FromAddress: common.HexToAddress("0x27548a32b9ad5d64c5945eae9da5337bc3169d15"),
+			Value:       big.NewInt(1),
+			MaxGasPrice: big.NewInt(1),
+			State:       models.TxStateUnstarted,
+			CreatedAt:   time.Unix(1, 0),
+		}
+		require.NoError(t, store.PutTx(tx))
+
+		// Drop what version 3 added
+		require.NoError(t, clearNamespace(store.nsTxCreatedIdx))
+		require.NoError(t, store.nsSchema.Set(keySchemaVersion, encodeUint64(2)))
+
+		store, err = NewTMStore(db)
+		require.NoError(t, err)
+		page, err := store.QueryTxs(esStore.TxQuery{})
+		require.NoError(t, err)
+		require.Len(t, page.Txs, 1)
+		require.Equal(t, tx.ID, page.Txs[0].ID)
+	})
+
+	t.Run("migrations build the indexes written by the store", func(t *testing.T) {
+		db := tmDB.NewMemDB()
+		store, err := NewTMStore(db)
+		require.NoError(t, err)
+
+		address := common.HexToAddress("0x27548a32b9ad5d64c5945eae9da5337bc3169d15")
+		receipt := &models.TxReceipt{ID: uuid.New(), BlockNumber: 9}
+		attempt := &models.TxAttempt{
+			ID:                      uuid.New(),
+			TxID:                    uuid.New(),
+			GasPrice:                big.NewInt(1),
+			BroadcastBeforeBlockNum: -1,
+			State:                   models.TxAttemptStateBroadcast,
+			TxReceiptIDs:            []uuid.UUID{receipt.ID},
+		}
+		tx := &models.Tx{
+			ID:           attempt.TxID,
+			Nonce:        3,
+			FromAddress:  address,
+			Value:        big.NewInt(1),
+			MaxGasPrice:  big.NewInt(1),
+			State:        models.TxStateUnconfirmed,
+			TxAttemptIDs: []uuid.UUID{attempt.ID},
+			CreatedAt:    time.Unix(1, 0),
+		}
+		require.NoError(t, store.PutTx(tx))
+		require.NoError(t, store.PutTxAttempt(attempt))
+		require.NoError(t, store.PutTxReceipt(receipt))
+		require.NoError(t, store.InsertHead(&models.Head{Hash: common.HexToHash("0x01"), Number: 7}))
+
+		indexes := []tmDB.DB{
+			store.nsHeadNumber,
+			store.nsTxStateIdx,
+			store.nsTxAttemptStateIdx,
+			store.nsTxAttemptUnsetIdx,
+			store.nsReceiptBlockIdx,
+			store.nsReceiptAttemptIdx,
+			store.nsTxCreatedIdx,
+		}
+		var written [][]indexEntry
+		for _, ns := range indexes {
+			entries, scanErr := scanIndex(ns, nil, nil)
+			require.NoError(t, scanErr)
+			require.NotEmpty(t, entries)
+			written = append(written, entries)
+			require.NoError(t, clearNamespace(ns))
+		}
+		require.NoError(t, store.nsSchema.Delete(keySchemaVersion))
+
+		_, err = NewTMStore(db)
+		require.NoError(t, err)
+		for i, ns := range indexes {
+			entries, scanErr := scanIndex(ns, nil, nil)
+			require.NoError(t, scanErr)
+			require.Equal(t, written[i], entries)
+		}
+	})
+
+	t.Run("refuses newer schema versions", func(t *testing.T) {
+		db := tmDB.NewMemDB()
+		require.NoError(t, db.Set(append(prefixSchema, keySchemaVersion...), encodeUint64(LatestSchemaVersion()+1)))
+
+		_, err := NewTMStore(db)
+		require.True(t, errors.Is(err, ErrUnknownSchemaVersion))
+	})
+
+	t.Run("rewrites records", func(t *testing.T) {
+		type legacyJob struct {
+			ID      uuid.UUID
+			TxID    uuid.UUID
+			Handled bool
+		}
+		defer func(original []migration) { migrations = original }(migrations)
+		migrations = append(migrations[:len(migrations):len(migrations)], migration{
+			version:     LatestSchemaVersion() + 1,
+			description: "replace Job.Handled with Job.State",
+			migrate: func(store *TMStore) error {
+				convert := func(entity interface{}) (interface{}, error) {
+					job := entity.(*legacyJob)
+					state := models.JobStateUnhandled
+					if job.Handled {
+						state = models.JobStateHandled
+					}
+					return &models.Job{ID: job.ID, TxID: job.TxID, State: state}, nil
+				}
+				return rewriteRecords(store.nsJob, func() interface{} { return &legacyJob{} }, convert)
+			},
+		})
+
+		db := tmDB.NewMemDB()
+		jobID := uuid.New()
+		require.NoError(t, set(tmDB.NewPrefixDB(db, prefixJob), jobID[:], &legacyJob{ID: jobID, Handled: true}))
+
+		store, err := NewTMStore(db)
+		require.NoError(t, err)
+		job, err := store.GetJob(jobID)
+		require.NoError(t, err)
+		require.Equal(t, models.JobStateHandled, job.State)
+	})
+	t.Run("commits migrations in bounded batches", func(t *testing.T) {
+		defer func(original []migration) { migrations = original }(migrations)
+		migrations = append(migrations[:len(migrations):len(migrations)], migration{
+			version:     LatestSchemaVersion() + 1,
+			description: "write more records than a batch and fail",
+			migrate: func(store *TMStore) error {
+				for i := 0; i <= migrationBatchSize; i++ {
+					if err := store.nsJob.Set(encodeUint64(uint64(i)), []byte{}); err != nil {
+						return err
+					}
+				}
+				return errors.New("failed")
+			},
+		})
+
+		db := tmDB.NewMemDB()
+		_, err := NewTMStore(db)
+		require.Error(t, err)
+
+		// The first batch has been committed, the schema version of the failed migration has not
+		committed, err := scanIndex(tmDB.NewPrefixDB(db, prefixJob), nil, nil)
+		require.NoError(t, err)
+		require.Len(t, committed, migrationBatchSize)
+		version, err := newTMStore(db, &sync.Mutex{}, nil).SchemaVersion()
+		require.NoError(t, err)
+		require.Equal(t, LatestSchemaVersion()-1, version)
+	})
+}
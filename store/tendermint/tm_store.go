@@ -1,6 +1,8 @@
 package tendermint
 
 import (
+	"sync"
+
 	"github.com/begmaroman/eth-services/store"
 	"github.com/pkg/errors"
 	tmDB "github.com/tendermint/tm-db"
@@ -13,7 +15,15 @@ const (
 
 // TMStore is a Store implementation using Tendermint tm-db
 type TMStore struct {
+	db tmDB.DB
+
+	// txLock serializes transactions, it is shared with the stores handed to RunInTx callbacks
+	txLock *sync.Mutex
+	// batch is set if the store is bound to a running transaction
+	batch *batchDB
+
 	nsHead         *tmDB.PrefixDB
+	nsHeadNumber   *tmDB.PrefixDB
 	nsLastHeadHash *tmDB.PrefixDB
 
 	nsAccount *tmDB.PrefixDB
@@ -23,21 +33,76 @@ type TMStore struct {
 	nsTxReceipt *tmDB.PrefixDB
 
 	nsJob *tmDB.PrefixDB
+
+	nsSchema *tmDB.PrefixDB
+
+	nsTxStateIdx        *tmDB.PrefixDB
+	nsTxAttemptStateIdx *tmDB.PrefixDB
+	nsTxAttemptUnsetIdx *tmDB.PrefixDB
+	nsReceiptBlockIdx   *tmDB.PrefixDB
+	nsReceiptAttemptIdx *tmDB.PrefixDB
+	nsTxCreatedIdx      *tmDB.PrefixDB
 }
 
 var _ store.Store = (*TMStore)(nil)
 
-// NewTMStore creates a new TMStore
-func NewTMStore(db tmDB.DB) *TMStore {
+// NewTMStore creates a new TMStore and migrates the database to the latest schema version. It fails
+// with ErrUnknownSchemaVersion if the database was written by a newer version of the store.
+func NewTMStore(db tmDB.DB) (*TMStore, error) {
+	store := newTMStore(db, &sync.Mutex{}, nil)
+	if err := store.migrate(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func newTMStore(db tmDB.DB, txLock *sync.Mutex, batch *batchDB) *TMStore {
 	return &TMStore{
+		db:     db,
+		txLock: txLock,
+		batch:  batch,
+
 		nsHead:         tmDB.NewPrefixDB(db, prefixHead),
+		nsHeadNumber:   tmDB.NewPrefixDB(db, prefixHeadNumberIndex),
 		nsLastHeadHash: tmDB.NewPrefixDB(db, prefixLastHeadHash),
 		nsAccount:      tmDB.NewPrefixDB(db, prefixAccount),
 		nsTx:           tmDB.NewPrefixDB(db, prefixTx),
 		nsTxAttempt:    tmDB.NewPrefixDB(db, prefixTxAttempt),
 		nsTxReceipt:    tmDB.NewPrefixDB(db, prefixReceipt),
 		nsJob:          tmDB.NewPrefixDB(db, prefixJob),
+		nsSchema:       tmDB.NewPrefixDB(db, prefixSchema),
+
+		nsTxStateIdx:        tmDB.NewPrefixDB(db, prefixTxStateIndex),
+		nsTxAttemptStateIdx: tmDB.NewPrefixDB(db, prefixTxAttemptStateIndex),
+		nsTxAttemptUnsetIdx: tmDB.NewPrefixDB(db, prefixTxAttemptUnsetBlockIndex),
+		nsReceiptBlockIdx:   tmDB.NewPrefixDB(db, prefixReceiptBlockIndex),
+		nsReceiptAttemptIdx: tmDB.NewPrefixDB(db, prefixReceiptAttemptIndex),
+		nsTxCreatedIdx:      tmDB.NewPrefixDB(db, prefixTxCreatedIndex),
+	}
+}
+
+// RunInTx runs fn within a transaction. All writes made through the Store passed to fn are buffered
+// and written atomically using a tmDB.Batch once fn returns nil. Nothing is written if fn returns an
+// error. Transactions are serialized, nested calls join the running transaction.
+func (store *TMStore) RunInTx(fn func(store.Store) error) error {
+	return store.runInTx(func(txStore *TMStore) error {
+		return fn(txStore)
+	})
+}
+
+func (store *TMStore) runInTx(fn func(txStore *TMStore) error) error {
+	if store.batch != nil {
+		return fn(store)
+	}
+
+	store.txLock.Lock()
+	defer store.txLock.Unlock()
+
+	batch := newBatchDB(store.db)
+	if err := fn(newTMStore(batch, store.txLock, batch)); err != nil {
+		return err
 	}
+	return batch.commit()
 }
 
 // get will retrieve the binary data under the given key from the DB and decode it into the given
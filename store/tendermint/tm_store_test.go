@@ -0,0 +1,33 @@
+package tendermint_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	tmDB "github.com/tendermint/tm-db"
+
+	esStore "github.com/begmaroman/eth-services/store"
+	"github.com/begmaroman/eth-services/store/storetest"
+	"github.com/begmaroman/eth-services/store/tendermint"
+)
+
+func Test_TMStore_MemDB(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) esStore.Store {
+		s, err := tendermint.NewTMStore(tmDB.NewMemDB())
+		require.NoError(t, err)
+		return s
+	})
+}
+
+func Test_TMStore_GoLevelDB(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) esStore.Store {
+		db, err := tmDB.NewGoLevelDB("store", t.TempDir())
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, db.Close())
+		})
+		s, err := tendermint.NewTMStore(db)
+		require.NoError(t, err)
+		return s
+	})
+}
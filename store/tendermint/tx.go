@@ -1,15 +1,16 @@
 package tendermint
 
 import (
+	"bytes"
 	"math/big"
 	"sort"
+	"time"
 
 	esStore "github.com/begmaroman/eth-services/store"
 	"github.com/begmaroman/eth-services/store/models"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
-	"github.com/vmihailenco/msgpack/v5"
 )
 
 const (
@@ -29,33 +30,57 @@ func (store *TMStore) AddTx(
 	gasLimit uint64,
 	maxGasPrice *big.Int,
 ) error {
-	account, err := store.GetAccount(fromAddress)
-	if err != nil {
-		return err
-	}
+	return store.runInTx(func(txStore *TMStore) error {
+		account, err := txStore.GetAccount(fromAddress)
+		if err != nil {
+			return err
+		}
 
-	tx := models.Tx{
-		ID:             txID,
-		FromAddress:    fromAddress,
-		ToAddress:      toAddress,
-		EncodedPayload: encodedPayload,
-		Value:          value,
-		GasLimit:       gasLimit,
-		MaxGasPrice:    maxGasPrice,
-		State:          models.TxStateUnstarted,
-	}
+		tx := models.Tx{
+			ID:             txID,
+			FromAddress:    fromAddress,
+			ToAddress:      toAddress,
+			EncodedPayload: encodedPayload,
+			Value:          value,
+			GasLimit:       gasLimit,
+			MaxGasPrice:    maxGasPrice,
+			State:          models.TxStateUnstarted,
+			CreatedAt:      time.Now(),
+		}
 
-	if err = store.PutTx(&tx); err != nil {
-		return err
-	}
+		if err = txStore.PutTx(&tx); err != nil {
+			return err
+		}
 
-	account.TxIDs = append(account.TxIDs, txID)
+		account.TxIDs = append(account.TxIDs, txID)
 
-	return store.PutAccount(account)
+		return txStore.PutAccount(account)
+	})
 }
 
 func (store *TMStore) PutTx(tx *models.Tx) error {
-	return set(store.nsTx, tx.ID[:], tx)
+	return store.runInTx(func(txStore *TMStore) error {
+		var storedVersion int64
+		old, err := txStore.GetTx(tx.ID)
+		if err == nil {
+			storedVersion = old.Version
+		} else if !errors.Is(err, esStore.ErrNotFound) {
+			return err
+		}
+		if err = esStore.CheckVersion("Tx", tx.ID.String(), tx.Version, storedVersion); err != nil {
+			return err
+		}
+		next := *tx
+		next.Version++
+		if err = set(txStore.nsTx, tx.ID[:], &next); err != nil {
+			return err
+		}
+		if err = txStore.indexTx(old, &next); err != nil {
+			return err
+		}
+		tx.Version = next.Version
+		return nil
+	})
 }
 
 func (store *TMStore) GetTx(id uuid.UUID) (*models.Tx, error) {
@@ -67,27 +92,81 @@ func (store *TMStore) GetTx(id uuid.UUID) (*models.Tx, error) {
 	return &tx, nil
 }
 
-func (store *TMStore) GetInProgressTx(fromAddress common.Address) (*models.Tx, error) {
-	account, err := store.GetAccount(fromAddress)
+// txQueryBatchSize is the number of index entries QueryTxs reads at once
+const txQueryBatchSize = 100
+
+// QueryTxs walks the creation time index in the requested order and filters the Txs it points to.
+func (store *TMStore) QueryTxs(query esStore.TxQuery) (*esStore.TxPage, error) {
+	cursor, err := esStore.ParseTxCursor(query.Cursor)
 	if err != nil {
 		return nil, err
 	}
-	var inProgressTx *models.Tx
-	for _, txID := range account.TxIDs {
-		tx, getTxErr := store.GetTx(txID)
-		if getTxErr != nil {
-			return nil, getTxErr
+	reverse := query.Order == esStore.SortDescending
+
+	var start, end []byte
+	if !query.CreatedFrom.IsZero() {
+		start = txCreatedKey(esStore.UnixNano(query.CreatedFrom), uuid.UUID{})
+	}
+	if !query.CreatedTo.IsZero() {
+		end = txCreatedKey(esStore.UnixNano(query.CreatedTo), uuid.UUID{})
+	}
+	if cursor != nil {
+		key := txCreatedKey(cursor.CreatedAt, cursor.ID)
+		if reverse && (end == nil || bytes.Compare(key, end) < 0) {
+			end = key
+		} else if !reverse && (start == nil || bytes.Compare(key, start) >= 0) {
+			start = append(key, 0)
+		}
+	}
+
+	limit := query.PageLimit()
+	page := &esStore.TxPage{}
+	for len(page.Txs) <= limit {
+		entries, scanErr := scanIndexLimit(store.nsTxCreatedIdx, start, end, reverse, txQueryBatchSize)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		for _, entry := range entries {
+			tx, getErr := store.GetTx(txCreatedKeyID(entry.key))
+			if getErr != nil {
+				return nil, getErr
+			}
+			if query.Matches(tx) {
+				page.Txs = append(page.Txs, tx)
+				if len(page.Txs) > limit {
+					break
+				}
+			}
 		}
-		if tx.State == models.TxStateInProgress {
-			inProgressTx = tx
+		if len(entries) < txQueryBatchSize {
 			break
 		}
+		lastKey := entries[len(entries)-1].key
+		if reverse {
+			end = lastKey
+		} else {
+			start = append(lastKey, 0)
+		}
+	}
+	if len(page.Txs) > limit {
+		page.Txs = page.Txs[:limit]
+		page.NextCursor = esStore.TxCursorOf(page.Txs[limit-1]).String()
+	}
+	return page, nil
+}
 
+func (store *TMStore) GetInProgressTx(fromAddress common.Address) (*models.Tx, error) {
+	if _, err := store.GetAccount(fromAddress); err != nil {
+		return nil, err
 	}
-	if inProgressTx == nil {
+	txs, err := store.txsInStateForAddress(models.TxStateInProgress, fromAddress)
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
 		return nil, esStore.ErrNotFound
 	}
-	return inProgressTx, nil
+	return txs[0], nil
 }
 
 func (store *TMStore) GetNextUnstartedTx(fromAddress common.Address) (*models.Tx, error) {
@@ -95,147 +174,140 @@ func (store *TMStore) GetNextUnstartedTx(fromAddress common.Address) (*models.Tx
 	if err != nil {
 		return nil, err
 	}
-	var unstartedTx *models.Tx
-	for _, txID := range account.TxIDs {
-		tx, getTxErr := store.GetTx(txID)
-		if getTxErr != nil {
-			return nil, getTxErr
-		}
-		if tx.State == models.TxStateUnstarted {
-			unstartedTx = tx
-			break
-		}
+	txs, err := store.txsInStateForAddress(models.TxStateUnstarted, fromAddress)
+	if err != nil {
+		return nil, err
 	}
-	if unstartedTx == nil {
+	if len(txs) == 0 {
 		return nil, esStore.ErrNotFound
 	}
+	if len(txs) == 1 {
+		return txs[0], nil
+	}
+
+	// Unstarted Txs have no nonce yet, so pick the one which was added to the account first
+	positions := make(map[uuid.UUID]int, len(account.TxIDs))
+	for i, txID := range account.TxIDs {
+		positions[txID] = i
+	}
+	unstartedTx := txs[0]
+	for _, tx := range txs[1:] {
+		if positions[tx.ID] < positions[unstartedTx.ID] {
+			unstartedTx = tx
+		}
+	}
 	return unstartedTx, nil
 }
 
 func (store *TMStore) GetTxsRequiringReceiptFetch() ([]*models.Tx, error) {
 	var txs []*models.Tx
-	iter, err := store.nsTx.Iterator(nil, nil)
-	if err != nil {
-		return nil, toCreateIterError(err)
-	}
-	defer iter.Close()
-	for ; iter.Valid(); iter.Next() {
-		var tx models.Tx
-		value := iter.Value()
-		err = msgpack.Unmarshal(value, &tx)
+	for _, state := range []models.TxState{models.TxStateUnconfirmed, models.TxStateConfirmedMissingReceipt} {
+		stateTxs, err := store.txsInState(state)
 		if err != nil {
-			return nil, toDecodeTxError(err)
-		}
-		if tx.State == models.TxStateUnconfirmed || tx.State == models.TxStateConfirmedMissingReceipt {
-			txs = append(txs, &tx)
+			return nil, err
 		}
+		txs = append(txs, stateTxs...)
 	}
 	// NOTE: Returns (nil, nil) when not found instead of (nil, ErrNotFound)
 	return txs, nil
 }
 
 func (store *TMStore) SetBroadcastBeforeBlockNum(blockNum int64) error {
-	iter, err := store.nsTxAttempt.Iterator(nil, nil)
-	if err != nil {
-		return toCreateIterError(err)
-	}
-	defer iter.Close()
-	for ; iter.Valid(); iter.Next() {
-		var attempt models.TxAttempt
-		value := iter.Value()
-		err := msgpack.Unmarshal(value, &attempt)
+	return store.runInTx(func(txStore *TMStore) error {
+		entries, err := scanIndex(txStore.nsTxAttemptUnsetIdx, nil, nil)
 		if err != nil {
-			return toDecodeTxAttemptError(err)
+			return err
 		}
-		if attempt.State == models.TxAttemptStateBroadcast && attempt.BroadcastBeforeBlockNum == -1 {
-			attempt.BroadcastBeforeBlockNum = blockNum
-			putErr := store.PutTxAttempt(&attempt)
-			if putErr != nil {
-				return putErr
+		for _, entry := range entries {
+			attempt, getAttemptErr := txStore.GetTxAttempt(bytesToUUID(entry.key))
+			if getAttemptErr != nil {
+				return getAttemptErr
+			}
+			if attempt.State == models.TxAttemptStateBroadcast && attempt.BroadcastBeforeBlockNum == -1 {
+				attempt.BroadcastBeforeBlockNum = blockNum
+				putErr := txStore.PutTxAttempt(attempt)
+				if putErr != nil {
+					return putErr
+				}
 			}
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 func (store *TMStore) MarkConfirmedMissingReceipt() error {
-	accounts, err := store.GetAccounts()
-	if err != nil {
-		return err
-	}
-	for _, account := range accounts {
-		// Get max nonce for confirmed Txs
-		var txs []*models.Tx
-		var maxNonce int64 = -1
-		for _, txID := range account.TxIDs {
-			tx, getTxErr := store.GetTx(txID)
-			if getTxErr != nil {
-				return getTxErr
+	return store.runInTx(func(txStore *TMStore) error {
+		if err := txStore.hasAccounts(); err != nil {
+			return err
+		}
+		unconfirmedTxs, err := txStore.txsInState(models.TxStateUnconfirmed)
+		if err != nil {
+			return err
+		}
+
+		// Get max nonce for confirmed Txs of each account having unconfirmed Txs
+		maxNonces := make(map[common.Address]int64)
+		for _, tx := range unconfirmedTxs {
+			if _, ok := maxNonces[tx.FromAddress]; ok {
+				continue
 			}
-			if tx.State == models.TxStateConfirmed && tx.Nonce > maxNonce {
-				maxNonce = tx.Nonce
+			maxNonce, maxNonceErr := txStore.maxNonceInState(models.TxStateConfirmed, tx.FromAddress)
+			if maxNonceErr != nil {
+				return maxNonceErr
 			}
-			txs = append(txs, tx)
+			maxNonces[tx.FromAddress] = maxNonce
 		}
 
 		// Set to confirmed_missing_receipt for stale unconfirmed Txs
-		var txsToUpdate []*models.Tx
-		for _, tx := range txs {
-			if tx.State == models.TxStateUnconfirmed && tx.Nonce < maxNonce {
+		for _, tx := range unconfirmedTxs {
+			if tx.Nonce < maxNonces[tx.FromAddress] {
 				tx.State = models.TxStateConfirmedMissingReceipt
-				txsToUpdate = append(txsToUpdate, tx)
-			}
-		}
-		for _, tx := range txsToUpdate {
-			err = store.PutTx(tx)
-			if err != nil {
-				return err
+				if err = txStore.PutTx(tx); err != nil {
+					return err
+				}
 			}
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 func (store *TMStore) MarkOldTxsMissingReceiptAsErrored(cutoff int64) error {
-	accounts, err := store.GetAccounts()
-	if err != nil {
-		return err
-	}
-	for _, account := range accounts {
+	return store.runInTx(func(txStore *TMStore) error {
+		if err := txStore.hasAccounts(); err != nil {
+			return err
+		}
+		txs, err := txStore.txsInState(models.TxStateConfirmedMissingReceipt)
+		if err != nil {
+			return err
+		}
 		var txsToUpdate []*models.Tx
-		for _, txID := range account.TxIDs {
-			tx, getTxErr := store.GetTx(txID)
-			if getTxErr != nil {
-				return getTxErr
-			}
-			if tx.State == models.TxStateConfirmedMissingReceipt {
-				var maxAttemptBroadcastBeforeBlockNum int64 = -1
-				for _, attemptID := range tx.TxAttemptIDs {
-					attempt, getAttemptErr := store.GetTxAttempt(attemptID)
-					if getAttemptErr != nil {
-						return getAttemptErr
-					}
-					if attempt.BroadcastBeforeBlockNum > maxAttemptBroadcastBeforeBlockNum {
-						maxAttemptBroadcastBeforeBlockNum = attempt.BroadcastBeforeBlockNum
-					}
+		for _, tx := range txs {
+			var maxAttemptBroadcastBeforeBlockNum int64 = -1
+			for _, attemptID := range tx.TxAttemptIDs {
+				attempt, getAttemptErr := txStore.GetTxAttempt(attemptID)
+				if getAttemptErr != nil {
+					return getAttemptErr
 				}
-				if maxAttemptBroadcastBeforeBlockNum != int64(-1) &&
-					maxAttemptBroadcastBeforeBlockNum < cutoff {
-					tx.State = models.TxStateFatalError
-					tx.Nonce = -1
-					tx.Error = esStore.ErrCouldNotGetReceipt.Error()
-					txsToUpdate = append(txsToUpdate, tx)
+				if attempt.BroadcastBeforeBlockNum > maxAttemptBroadcastBeforeBlockNum {
+					maxAttemptBroadcastBeforeBlockNum = attempt.BroadcastBeforeBlockNum
 				}
 			}
+			if maxAttemptBroadcastBeforeBlockNum != int64(-1) &&
+				maxAttemptBroadcastBeforeBlockNum < cutoff {
+				tx.State = models.TxStateFatalError
+				tx.Nonce = -1
+				tx.Error = esStore.ErrCouldNotGetReceipt.Error()
+				txsToUpdate = append(txsToUpdate, tx)
+			}
 		}
 		for _, tx := range txsToUpdate {
-			err = store.PutTx(tx)
+			err = txStore.PutTx(tx)
 			if err != nil {
 				return err
 			}
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 func (store *TMStore) GetTxsRequiringNewAttempt(
@@ -244,19 +316,13 @@ func (store *TMStore) GetTxsRequiringNewAttempt(
 	gasBumpThreshold int64,
 	depth int,
 ) ([]*models.Tx, error) {
-	account, err := store.GetAccount(address)
-	if err != nil {
+	if _, err := store.GetAccount(address); err != nil {
 		return nil, err
 	}
-	var txs []*models.Tx
-	for _, txID := range account.TxIDs {
-		tx, getTxErr := store.GetTx(txID)
-		if getTxErr != nil {
-			return nil, getTxErr
-		}
-		if tx.State == models.TxStateUnconfirmed {
-			txs = append(txs, tx)
-		}
+	// Txs are sorted by ascending nonce by the index
+	txs, err := store.txsInStateForAddress(models.TxStateUnconfirmed, address)
+	if err != nil {
+		return nil, err
 	}
 
 	numTxs := len(txs)
@@ -264,11 +330,6 @@ func (store *TMStore) GetTxsRequiringNewAttempt(
 		return txs, nil
 	}
 
-	// Sort txs by ascending nonce
-	sort.Slice(txs, func(i int, j int) bool {
-		return txs[i].Nonce < txs[j].Nonce
-	})
-
 	limit := numTxs
 	if depth > 0 && depth < limit {
 		limit = depth
@@ -277,13 +338,6 @@ func (store *TMStore) GetTxsRequiringNewAttempt(
 	var includedTxs []*models.Tx
 
 	for _, tx := range txs[:limit] {
-		tx, getTxErr := store.GetTx(tx.ID)
-		if getTxErr != nil {
-			return nil, getTxErr
-		}
-		if tx.State != models.TxStateUnconfirmed {
-			continue
-		}
 		excludeTx := false
 		for _, attemptID := range tx.TxAttemptIDs {
 			attempt, getAttemptErr := store.GetTxAttempt(attemptID)
@@ -307,56 +361,50 @@ func (store *TMStore) GetTxsRequiringNewAttempt(
 }
 
 func (store *TMStore) GetTxsConfirmedAtOrAboveBlockHeight(blockNum int64) ([]*models.Tx, error) {
-	var allTxs []*models.Tx
-	accounts, err := store.GetAccounts()
+	if err := store.hasAccounts(); err != nil {
+		return nil, err
+	}
+	entries, err := scanIndex(store.nsReceiptBlockIdx, encodeBlockNumber(blockNum), nil)
 	if err != nil {
 		return nil, err
 	}
-	for _, account := range accounts {
-		var txs []*models.Tx
-		for _, txID := range account.TxIDs {
-			tx, getTxErr := store.GetTx(txID)
-			if getTxErr != nil {
-				return nil, getTxErr
-			}
-			if tx.State != models.TxStateConfirmed && tx.State != models.TxStateConfirmedMissingReceipt {
-				continue
-			}
-			includeTx := false
-			for _, attemptID := range tx.TxAttemptIDs {
-				attempt, getAttemptErr := store.GetTxAttempt(attemptID)
-				if getAttemptErr != nil {
-					return nil, getAttemptErr
-				}
-				if attempt.State != models.TxAttemptStateBroadcast {
-					continue
-				}
-				for j := len(attempt.TxReceiptIDs) - 1; j >= 0; j-- {
-					receiptID := attempt.TxReceiptIDs[j]
-					receipt, getReceiptErr := store.GetTxReceipt(receiptID)
-					if getReceiptErr != nil {
-						return nil, getReceiptErr
-					}
-					if receipt.BlockNumber >= blockNum {
-						includeTx = true
-						break
-					}
-				}
-				if includeTx {
-					break
-				}
-			}
-			if includeTx {
-				txs = append(txs, tx)
-			}
+	var allTxs []*models.Tx
+	seen := make(map[uuid.UUID]bool)
+	for _, entry := range entries {
+		receiptID := receiptBlockKeyID(entry.key)
+		attemptID, getErr := store.nsReceiptAttemptIdx.Get(receiptID[:])
+		if getErr != nil {
+			return nil, errors.Wrap(getErr, "could not get data")
 		}
-
-		// Sort txs by ascending nonce
-		sort.Slice(txs, func(i int, j int) bool {
-			return txs[i].Nonce < txs[j].Nonce
-		})
-		allTxs = append(allTxs, txs...)
+		if attemptID == nil {
+			// Receipt is not attached to any attempt
+			continue
+		}
+		attempt, getAttemptErr := store.GetTxAttempt(bytesToUUID(attemptID))
+		if getAttemptErr != nil {
+			return nil, getAttemptErr
+		}
+		if attempt.State != models.TxAttemptStateBroadcast || seen[attempt.TxID] {
+			continue
+		}
+		tx, getTxErr := store.GetTx(attempt.TxID)
+		if getTxErr != nil {
+			return nil, getTxErr
+		}
+		if tx.State != models.TxStateConfirmed && tx.State != models.TxStateConfirmedMissingReceipt {
+			continue
+		}
+		seen[tx.ID] = true
+		allTxs = append(allTxs, tx)
 	}
+
+	// Sort txs by account and ascending nonce
+	sort.Slice(allTxs, func(i int, j int) bool {
+		if cmp := bytes.Compare(allTxs[i].FromAddress.Bytes(), allTxs[j].FromAddress.Bytes()); cmp != 0 {
+			return cmp < 0
+		}
+		return allTxs[i].Nonce < allTxs[j].Nonce
+	})
 	return allTxs, nil
 }
 
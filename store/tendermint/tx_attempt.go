@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"sort"
 
+	esStore "github.com/begmaroman/eth-services/store"
 	"github.com/begmaroman/eth-services/store/models"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/google/uuid"
@@ -19,7 +20,28 @@ var (
 )
 
 func (store *TMStore) PutTxAttempt(attempt *models.TxAttempt) error {
-	return set(store.nsTxAttempt, attempt.ID[:], attempt)
+	return store.runInTx(func(txStore *TMStore) error {
+		var storedVersion int64
+		old, err := txStore.GetTxAttempt(attempt.ID)
+		if err == nil {
+			storedVersion = old.Version
+		} else if !errors.Is(err, esStore.ErrNotFound) {
+			return err
+		}
+		if err = esStore.CheckVersion("TxAttempt", attempt.ID.String(), attempt.Version, storedVersion); err != nil {
+			return err
+		}
+		next := *attempt
+		next.Version++
+		if err = set(txStore.nsTxAttempt, attempt.ID[:], &next); err != nil {
+			return err
+		}
+		if err = txStore.indexTxAttempt(old, &next); err != nil {
+			return err
+		}
+		attempt.Version = next.Version
+		return nil
+	})
 }
 
 func (store *TMStore) GetTxAttempt(id uuid.UUID) (*models.TxAttempt, error) {
@@ -45,50 +67,61 @@ func (store *TMStore) GetAttemptsForTx(tx *models.Tx) ([]*models.TxAttempt, erro
 
 // AddOrUpdateAttempt adds a new attempt or updates an existing attempt assuming only the state, NOT
 // the gas price, has changed. In case of an addition, the list of attempts are sorted by gas price.
+// The attempt and the Tx are written atomically.
 func (store *TMStore) AddOrUpdateAttempt(tx *models.Tx, attempt *models.TxAttempt) error {
-	attemptIDs := tx.TxAttemptIDs
-	update := false
-	for _, attemptID := range attemptIDs {
-		if bytes.Equal(attemptID[:], attempt.ID[:]) {
-			update = true
-			break
-		}
-	}
-	if !update {
-		attemptIDs = append(attemptIDs, attempt.ID)
-		tx.TxAttemptIDs = attemptIDs
-		var err error
-		tx, err = store.sortAttemptsByGasPriceForTx(tx)
-		if err != nil {
+	return store.runInTx(func(txStore *TMStore) error {
+		if err := txStore.PutTxAttempt(attempt); err != nil {
 			return err
 		}
-	}
-	return store.PutTx(tx)
+		attemptIDs := tx.TxAttemptIDs
+		update := false
+		for _, attemptID := range attemptIDs {
+			if bytes.Equal(attemptID[:], attempt.ID[:]) {
+				update = true
+				break
+			}
+		}
+		if !update {
+			attemptIDs = append(attemptIDs, attempt.ID)
+			tx.TxAttemptIDs = attemptIDs
+			var err error
+			tx, err = txStore.sortAttemptsByGasPriceForTx(tx)
+			if err != nil {
+				return err
+			}
+		}
+		return txStore.PutTx(tx)
+	})
 }
 
 // ReplaceAttempt removes an existing attempt and adds a new attempt with a different ID. Sorts the new list of attempts
-// by gas price.
+// by gas price. The new attempt and the Tx are written atomically.
 func (store *TMStore) ReplaceAttempt(tx *models.Tx, oldAttempt *models.TxAttempt, newAttempt *models.TxAttempt) error {
-	attemptIDs := tx.TxAttemptIDs
-	removeIndex := -1
-	for i, attemptID := range attemptIDs {
-		if bytes.Equal(attemptID[:], oldAttempt.ID[:]) {
-			removeIndex = i
-			break
+	return store.runInTx(func(txStore *TMStore) error {
+		if err := txStore.PutTxAttempt(newAttempt); err != nil {
+			return err
 		}
-	}
-	if removeIndex == -1 {
-		return errors.New("old attempt not found")
-	}
-	copy(attemptIDs[removeIndex:], attemptIDs[removeIndex+1:])
-	attemptIDs = attemptIDs[:len(attemptIDs)-1]
-	attemptIDs = append(attemptIDs, newAttempt.ID)
-	tx.TxAttemptIDs = attemptIDs
-	tx, err := store.sortAttemptsByGasPriceForTx(tx)
-	if err != nil {
-		return err
-	}
-	return store.PutTx(tx)
+		attemptIDs := tx.TxAttemptIDs
+		removeIndex := -1
+		for i, attemptID := range attemptIDs {
+			if bytes.Equal(attemptID[:], oldAttempt.ID[:]) {
+				removeIndex = i
+				break
+			}
+		}
+		if removeIndex == -1 {
+			return errors.New("old attempt not found")
+		}
+		copy(attemptIDs[removeIndex:], attemptIDs[removeIndex+1:])
+		attemptIDs = attemptIDs[:len(attemptIDs)-1]
+		attemptIDs = append(attemptIDs, newAttempt.ID)
+		tx.TxAttemptIDs = attemptIDs
+		tx, err := txStore.sortAttemptsByGasPriceForTx(tx)
+		if err != nil {
+			return err
+		}
+		return txStore.PutTx(tx)
+	})
 }
 
 func (store *TMStore) sortAttemptsByGasPriceForTx(tx *models.Tx) (*models.Tx, error) {
@@ -112,32 +145,56 @@ func (store *TMStore) sortAttemptsByGasPriceForTx(tx *models.Tx) (*models.Tx, er
 }
 
 func (store *TMStore) DeleteTxAttempt(id uuid.UUID) error {
-	return store.nsTxAttempt.Delete(id[:])
+	return store.runInTx(func(txStore *TMStore) error {
+		old, err := txStore.GetTxAttempt(id)
+		if err != nil {
+			if errors.Is(err, esStore.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		if err = txStore.nsTxAttempt.Delete(id[:]); err != nil {
+			return err
+		}
+		return txStore.indexTxAttempt(old, nil)
+	})
 }
 
 func (store *TMStore) GetInProgressAttempts(address common.Address) ([]*models.TxAttempt, error) {
-	account, err := store.GetAccount(address)
+	if _, err := store.GetAccount(address); err != nil {
+		return nil, err
+	}
+	entries, err := scanIndexPrefix(store.nsTxAttemptStateIdx, txAttemptStatePrefix(models.TxAttemptStateInProgress))
 	if err != nil {
 		return nil, err
 	}
 	var attempts []*models.TxAttempt
-	for _, txID := range account.TxIDs {
-		tx, getTxErr := store.GetTx(txID)
+	for _, entry := range entries {
+		tx, getTxErr := store.GetTx(bytesToUUID(entry.value))
 		if getTxErr != nil {
+			if errors.Is(getTxErr, esStore.ErrNotFound) {
+				continue
+			}
 			return nil, getTxErr
 		}
-		if tx.State == models.TxStateConfirmed || tx.State == models.TxStateConfirmedMissingReceipt ||
-			tx.State == models.TxStateUnconfirmed {
-			for _, attemptID := range tx.TxAttemptIDs {
-				attempt, getAttemptErr := store.GetTxAttempt(attemptID)
-				if getAttemptErr != nil {
-					return nil, getAttemptErr
-				}
-				if attempt.State == models.TxAttemptStateInProgress {
-					attempts = append(attempts, attempt)
-				}
-
+		if tx.FromAddress != address {
+			continue
+		}
+		if tx.State != models.TxStateConfirmed && tx.State != models.TxStateConfirmedMissingReceipt &&
+			tx.State != models.TxStateUnconfirmed {
+			continue
+		}
+		inProgressAttemptID := txAttemptStateKeyID(entry.key)
+		for _, attemptID := range tx.TxAttemptIDs {
+			if attemptID != inProgressAttemptID {
+				continue
+			}
+			attempt, getAttemptErr := store.GetTxAttempt(attemptID)
+			if getAttemptErr != nil {
+				return nil, getAttemptErr
 			}
+			attempts = append(attempts, attempt)
+			break
 		}
 	}
 	return attempts, nil
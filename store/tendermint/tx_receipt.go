@@ -1,8 +1,10 @@
 package tendermint
 
 import (
+	esStore "github.com/begmaroman/eth-services/store"
 	"github.com/begmaroman/eth-services/store/models"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 )
 
 var (
@@ -19,9 +21,30 @@ func (store *TMStore) GetTxReceipt(id uuid.UUID) (*models.TxReceipt, error) {
 }
 
 func (store *TMStore) PutTxReceipt(receipt *models.TxReceipt) error {
-	return set(store.nsTxReceipt, receipt.ID[:], receipt)
+	return store.runInTx(func(txStore *TMStore) error {
+		old, err := txStore.GetTxReceipt(receipt.ID)
+		if err != nil && !errors.Is(err, esStore.ErrNotFound) {
+			return err
+		}
+		if err = set(txStore.nsTxReceipt, receipt.ID[:], receipt); err != nil {
+			return err
+		}
+		return txStore.indexTxReceipt(old, receipt)
+	})
 }
 
 func (store *TMStore) DeleteTxReceipt(id uuid.UUID) error {
-	return store.nsTxReceipt.Delete(id[:])
+	return store.runInTx(func(txStore *TMStore) error {
+		old, err := txStore.GetTxReceipt(id)
+		if err != nil {
+			if errors.Is(err, esStore.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		if err = txStore.nsTxReceipt.Delete(id[:]); err != nil {
+			return err
+		}
+		return txStore.indexTxReceipt(old, nil)
+	})
 }